@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/interfaces"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/console"
+	"github.com/ezenkico/deploy-commander/runner/services/heal"
+	"github.com/ezenkico/deploy-commander/runner/services/inspect"
+	"github.com/ezenkico/deploy-commander/runner/services/messages"
+	"github.com/ezenkico/deploy-commander/runner/services/plan"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/schema"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+	"github.com/ezenkico/deploy-commander/runner/services/validate"
+	"github.com/google/uuid"
+)
+
+const usage = `Usage: runner [command] [flags]
+
+Without a command the runner executes ` + configPath + ` (the mode used by the agent).
+
+Commands:
+  apply     -f config.json [--output auto]   run a configuration
+  teardown  --job <uuid> [--platform docker] remove everything a job deployed
+  status    --job <uuid> [--platform docker] show the job's deployed services
+  port-forward --job <uuid> --service <name> --port <port> [--listen addr]
+                                             reach a service's port from this host
+  clone     --bundle dir [--job <uuid>]      deploy a snapshot bundle as a new job
+  expire    [--workspace dir]                tear down jobs whose ttl ran out (run it on a schedule)
+  account   [--workspace dir]                sample and report the usage of deployed jobs (run it on a schedule)
+  heal      [--workspace dir] [--threshold n] recreate services that keep failing, then report them degraded (run it on a schedule)
+  serve     [--socket path] [--workspace dir] read-only inspection API on a unix socket
+  validate  -f config.json [--json]          check a configuration without Docker or the agent
+  completion bash|zsh|fish                   print a shell completion script
+  messages                                   print the message catalog as JSON
+`
+
+// runCLI dispatches the operator subcommands and returns the process exit code.
+func runCLI(args []string) int {
+	if len(args) == 0 {
+		cfg, err := loadConfiguration(configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mode, err := console.ParseMode(os.Getenv("RUNNER_OUTPUT"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return execute(cfg, mode)
+	}
+
+	var err error
+	code := exitSucceeded
+	switch args[0] {
+	case "apply":
+		code, err = applyCommand(args[1:])
+	case "teardown":
+		code, err = teardownCommand(args[1:])
+	case "status":
+		err = statusCommand(args[1:])
+	case "port-forward":
+		code, err = portForwardCommand(args[1:])
+	case "clone":
+		code, err = cloneCommand(args[1:])
+	case "expire":
+		code, err = expireCommand(args[1:])
+	case "account":
+		code, err = accountCommand(args[1:])
+	case "heal":
+		code, err = healCommand(args[1:])
+	case "serve":
+		err = serveCommand(args[1:])
+	case "validate":
+		code, err = validateCommand(args[1:])
+	case "completion":
+		err = completionCommand(args[1:])
+	case "messages":
+		err = messagesCommand()
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return exitSucceeded
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		return exitSucceeded
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, errUsage) {
+			return exitUsage
+		}
+		return exitFailedPartial
+	}
+	return code
+}
+
+// errUsage marks command-line mistakes (exit code exitUsage rather than a run failure).
+var errUsage = errors.New("usage")
+
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	return nil
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of runner %s:\n", name)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func parseJob(s string) (uuid.UUID, error) {
+	if s == "" {
+		return uuid.Nil, fmt.Errorf("%w: --job is required", errUsage)
+	}
+	job, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: --job: %v", errUsage, err)
+	}
+	return job, nil
+}
+
+func applyCommand(args []string) (int, error) {
+	fs := newFlagSet("apply")
+	file := fs.String("f", "", "configuration file")
+	output := outputFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return 0, err
+	}
+	if *file == "" {
+		return 0, fmt.Errorf("%w: -f is required", errUsage)
+	}
+	mode, err := console.ParseMode(*output)
+	if err != nil {
+		return 0, fmt.Errorf("%w: --output: %v", errUsage, err)
+	}
+
+	cfg, err := loadConfiguration(*file)
+	if err != nil {
+		return 0, err
+	}
+	return execute(cfg, mode), nil
+}
+
+func teardownCommand(args []string) (int, error) {
+	fs := newFlagSet("teardown")
+	jobFlag := fs.String("job", "", "job id")
+	platform := fs.String("platform", "docker", "platform the job runs on")
+	workspace := fs.String("workspace", "", "workspace directory (default "+models.DefaultWorkspace+")")
+	dataFile := fs.String("platform-data", "", "JSON file with the platform_data the job ran with")
+	output := outputFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return 0, err
+	}
+	job, err := parseJob(*jobFlag)
+	if err != nil {
+		return 0, err
+	}
+	mode, err := console.ParseMode(*output)
+	if err != nil {
+		return 0, fmt.Errorf("%w: --output: %v", errUsage, err)
+	}
+	data, err := readPlatformData(*dataFile)
+	if err != nil {
+		return 0, err
+	}
+
+	return execute(models.Configuration{
+		SchemaVersion: schema.Current,
+		Job:           job,
+		Run:           uuid.New(),
+		Platform:      *platform,
+		PlatformData:  data,
+		Action:        models.ActionTeardown,
+		Workspace:     *workspace,
+	}, mode), nil
+}
+
+func portForwardCommand(args []string) (int, error) {
+	fs := newFlagSet("port-forward")
+	jobFlag := fs.String("job", "", "job id")
+	platform := fs.String("platform", "docker", "platform the job runs on")
+	dataFile := fs.String("platform-data", "", "JSON file with the platform_data the job ran with")
+	service := fs.String("service", "", "service to forward to")
+	port := fs.Int("port", 0, "container port of the service")
+	listen := fs.String("listen", "", "local address to listen on (default 127.0.0.1:<port>)")
+	image := fs.String("image", "", "helper image with socat (default alpine/socat)")
+	output := outputFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return 0, err
+	}
+	job, err := parseJob(*jobFlag)
+	if err != nil {
+		return 0, err
+	}
+	if *service == "" || *port == 0 {
+		return 0, fmt.Errorf("%w: --service and --port are required", errUsage)
+	}
+	mode, err := console.ParseMode(*output)
+	if err != nil {
+		return 0, fmt.Errorf("%w: --output: %v", errUsage, err)
+	}
+	data, err := readPlatformData(*dataFile)
+	if err != nil {
+		return 0, err
+	}
+
+	return execute(models.Configuration{
+		SchemaVersion: schema.Current,
+		Job:           job,
+		Run:           uuid.New(),
+		Platform:      *platform,
+		PlatformData:  data,
+		Action:        models.ActionPortForward,
+		PortForward: &models.PortForward{
+			Service: *service,
+			Port:    *port,
+			Listen:  *listen,
+			Image:   *image,
+		},
+	}, mode), nil
+}
+
+func cloneCommand(args []string) (int, error) {
+	fs := newFlagSet("clone")
+	bundle := fs.String("bundle", "", "snapshot bundle directory")
+	jobFlag := fs.String("job", "", "job id of the clone (default a new one)")
+	platform := fs.String("platform", "docker", "platform to deploy to")
+	workspace := fs.String("workspace", "", "workspace directory (default "+models.DefaultWorkspace+")")
+	dataFile := fs.String("platform-data", "", "JSON file with the platform_data to deploy with")
+	output := outputFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return 0, err
+	}
+	if *bundle == "" {
+		return 0, fmt.Errorf("%w: --bundle is required", errUsage)
+	}
+	job := uuid.New()
+	if *jobFlag != "" {
+		var err error
+		if job, err = parseJob(*jobFlag); err != nil {
+			return 0, err
+		}
+	}
+	mode, err := console.ParseMode(*output)
+	if err != nil {
+		return 0, fmt.Errorf("%w: --output: %v", errUsage, err)
+	}
+	data, err := readPlatformData(*dataFile)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("clone job: %s", job)
+	return execute(models.Configuration{
+		SchemaVersion: schema.Current,
+		Job:           job,
+		Run:           uuid.New(),
+		Platform:      *platform,
+		PlatformData:  data,
+		Action:        models.ActionClone,
+		Bundle:        *bundle,
+		Workspace:     *workspace,
+	}, mode), nil
+}
+
+func expireCommand(args []string) (int, error) {
+	fs := newFlagSet("expire")
+	workspace := fs.String("workspace", "", "workspace directory (default "+models.DefaultWorkspace+")")
+	output := outputFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return 0, err
+	}
+	mode, err := console.ParseMode(*output)
+	if err != nil {
+		return 0, fmt.Errorf("%w: --output: %v", errUsage, err)
+	}
+
+	cfg := models.Configuration{Workspace: *workspace}
+	expiries, err := state.New(cfg.WorkspaceDir()).Expiries()
+	if err != nil {
+		return 0, err
+	}
+	// One job failing to tear down doesn't stop the rest; the exit code is the
+	// last failure's.
+	code := exitSucceeded
+	now := time.Now()
+	for _, e := range expiries {
+		if e.Expires.After(now) {
+			break
+		}
+		if c := expireJob(e, *workspace, mode); c != exitSucceeded {
+			code = c
+		}
+	}
+	return code, nil
+}
+
+// accountCommand samples every job the workspace has usage for, adds it to what
+// was recorded and reports the totals to the agent. Jobs on platforms that
+// cannot measure usage are skipped.
+func accountCommand(args []string) (int, error) {
+	fs := newFlagSet("account")
+	workspace := fs.String("workspace", "", "workspace directory (default "+models.DefaultWorkspace+")")
+	if err := parseFlags(fs, args); err != nil {
+		return 0, err
+	}
+
+	runs := state.New((models.Configuration{Workspace: *workspace}).WorkspaceDir())
+	usages, err := runs.Usages()
+	if err != nil {
+		return 0, err
+	}
+	comm, _ := agent.NewAgentCommunicationFromEnv()
+	ctx := context.Background()
+
+	// One job failing to sample doesn't stop the rest.
+	code := exitSucceeded
+	for i := range usages {
+		u := &usages[i]
+		p, err := platforms.New(u.Platform, comm, u.PlatformData)
+		if err != nil {
+			log.Printf("job %s: %v", u.Job, err)
+			code = exitFailedPartial
+			continue
+		}
+		acct, ok := p.(interfaces.Accountant)
+		if !ok {
+			continue
+		}
+		if err := sampleUsage(ctx, acct, comm, runs, u); err != nil {
+			log.Printf("job %s: %v", u.Job, err)
+			code = exitFailedPartial
+			continue
+		}
+		log.Printf("job %s: %.0f container second(s), %s of images, %s of volumes",
+			u.Job, u.RuntimeSeconds, models.ByteSize(u.ImageBytes), models.ByteSize(u.VolumeBytes))
+	}
+	return code, nil
+}
+
+// healCommand checks the services of every job the workspace tracks for
+// containers their restart policy cannot keep up: each is recreated from a
+// freshly pulled image once, and reported to the agent as degraded if it keeps
+// failing. Jobs on platforms that cannot heal are skipped.
+func healCommand(args []string) (int, error) {
+	fs := newFlagSet("heal")
+	workspace := fs.String("workspace", "", "workspace directory (default "+models.DefaultWorkspace+")")
+	threshold := fs.Int("threshold", heal.DefaultThreshold, "restarts between two checks that count as failing")
+	if err := parseFlags(fs, args); err != nil {
+		return 0, err
+	}
+	if *threshold < 1 {
+		return 0, fmt.Errorf("%w: --threshold must be at least 1", errUsage)
+	}
+
+	runs := state.New((models.Configuration{Workspace: *workspace}).WorkspaceDir())
+	heals, err := runs.Heals()
+	if err != nil {
+		return 0, err
+	}
+	comm, _ := agent.NewAgentCommunicationFromEnv()
+	ctx := context.Background()
+
+	// One job failing to heal doesn't stop the rest.
+	code := exitSucceeded
+	for i := range heals {
+		h := &heals[i]
+		p, err := platforms.New(h.Platform, comm, h.PlatformData)
+		if err != nil {
+			log.Printf("job %s: %v", h.Job, err)
+			code = exitFailedPartial
+			continue
+		}
+		healer, ok := p.(interfaces.Healer)
+		if !ok {
+			continue
+		}
+		if err := healJob(ctx, healer, comm, runs, h, *threshold); err != nil {
+			log.Printf("job %s: %v", h.Job, err)
+			code = exitFailedPartial
+		}
+	}
+	return code, nil
+}
+
+// outputFlag adds --output, defaulting to $RUNNER_OUTPUT (or auto).
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("output", os.Getenv("RUNNER_OUTPUT"), "output mode: auto, plain, pretty or json")
+}
+
+func statusCommand(args []string) error {
+	fs := newFlagSet("status")
+	jobFlag := fs.String("job", "", "job id")
+	platform := fs.String("platform", "docker", "platform the job runs on")
+	dataFile := fs.String("platform-data", "", "JSON file with the platform_data the job ran with")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	job, err := parseJob(*jobFlag)
+	if err != nil {
+		return err
+	}
+	data, err := readPlatformData(*dataFile)
+	if err != nil {
+		return err
+	}
+
+	comm, _ := agent.NewAgentCommunicationFromEnv()
+	p, err := platforms.New(*platform, comm, data)
+	if err != nil {
+		return err
+	}
+	inspector, ok := p.(interfaces.Inspector)
+	if !ok {
+		return fmt.Errorf("platform %q does not support status", *platform)
+	}
+
+	services, err := inspector.Status(context.Background(), job)
+	if err != nil {
+		return err
+	}
+	if len(services) == 0 {
+		fmt.Printf("job %s has no deployed services\n", job)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if services[0].Host != "" {
+		fmt.Fprintln(tw, "SERVICE\tHOST\tSTATE\tSTATUS\tIMAGE\tRUN")
+		for _, s := range services {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Service, s.Host, s.State, s.Status, s.Image, s.Run)
+		}
+		return tw.Flush()
+	}
+	fmt.Fprintln(tw, "SERVICE\tSTATE\tSTATUS\tIMAGE\tRUN")
+	for _, s := range services {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", s.Service, s.State, s.Status, s.Image, s.Run)
+	}
+	return tw.Flush()
+}
+
+// serveCommand runs the inspection API until SIGINT or SIGTERM.
+func serveCommand(args []string) error {
+	fs := newFlagSet("serve")
+	workspace := fs.String("workspace", models.DefaultWorkspace, "workspace directory the runs write to")
+	socket := fs.String("socket", "", "unix socket to listen on (default <workspace>/runner.sock)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *socket == "" {
+		*socket = filepath.Join(*workspace, "runner.sock")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return inspect.NewServer(*workspace).Serve(ctx, *socket)
+}
+
+// readPlatformData reads a --platform-data file. No file means no platform data.
+func readPlatformData(path string) (*json.RawMessage, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read platform data: %w", err)
+	}
+	if !json.Valid(b) {
+		return nil, fmt.Errorf("platform data %q is not valid JSON", path)
+	}
+	data := json.RawMessage(b)
+	return &data, nil
+}
+
+func validateCommand(args []string) (int, error) {
+	fs := newFlagSet("validate")
+	file := fs.String("f", "", "configuration file")
+	asJSON := fs.Bool("json", false, "print findings as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return 0, err
+	}
+	if *file == "" {
+		return 0, fmt.Errorf("%w: -f is required", errUsage)
+	}
+
+	cfg, err := loadConfiguration(*file)
+	if err != nil {
+		return 0, err
+	}
+
+	// Referenced metadata has to be downloaded, and overrides applied, to be checked.
+	var comm *agent.AgentCommunication
+	if cfg.MetadataRef != nil {
+		comm, _ = agent.NewAgentCommunicationFromEnv()
+	}
+	if err := resolveMetadata(context.Background(), comm, &cfg); err != nil {
+		return 0, err
+	}
+
+	findings := validate.Configuration(cfg)
+	lint, err := validate.Lint(cfg)
+	if err != nil {
+		return 0, err
+	}
+	findings = append(findings, lint...)
+
+	var pl *models.Plan
+	if !validate.HasErrors(findings) {
+		if pl, err = plan.Build(cfg); err != nil {
+			return 0, err
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			File     string             `json:"file"`
+			Valid    bool               `json:"valid"`
+			Findings []validate.Finding `json:"findings"`
+		}{*file, pl != nil, findings}); err != nil {
+			return 0, err
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Printf("%s#%s\n", *file, f)
+		}
+		if pl != nil {
+			fmt.Printf("%s: ok (%d planned operation(s), %d warning(s))\n", *file, len(pl.Operations), len(findings))
+		}
+	}
+
+	if pl == nil {
+		return exitFailedBeforeChanges, nil
+	}
+	return exitSucceeded, nil
+}
+
+// messagesCommand prints every user-facing message code with its English text,
+// for translating them in the agent UI.
+func messagesCommand() error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(messages.Catalog())
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+)
+
+const bashCompletion = `_runner() {
+    local cur prev
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=($(compgen -W "apply teardown status port-forward clone expire account heal serve validate completion messages help" -- "$cur"))
+        return
+    fi
+
+    case "$prev" in
+        -f) COMPREPLY=($(compgen -f -X '!*.json' -- "$cur")); compopt -o plusdirs 2>/dev/null; return ;;
+        --platform|-platform) COMPREPLY=($(compgen -W "docker swarm containerd ecs noop" -- "$cur")); return ;;
+        --socket|-socket) COMPREPLY=($(compgen -f -- "$cur")); return ;;
+        --workspace|-workspace|--bundle|-bundle) COMPREPLY=($(compgen -d -- "$cur")); return ;;
+        completion) COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")); return ;;
+    esac
+
+    case "${COMP_WORDS[1]}" in
+        apply) COMPREPLY=($(compgen -W "-f --output" -- "$cur")) ;;
+        validate) COMPREPLY=($(compgen -W "-f --json" -- "$cur")) ;;
+        serve) COMPREPLY=($(compgen -W "--socket --workspace" -- "$cur")) ;;
+        teardown) COMPREPLY=($(compgen -W "--job --platform --platform-data --workspace --output" -- "$cur")) ;;
+        status) COMPREPLY=($(compgen -W "--job --platform --platform-data" -- "$cur")) ;;
+        port-forward) COMPREPLY=($(compgen -W "--job --platform --platform-data --service --port --listen --image --output" -- "$cur")) ;;
+        clone) COMPREPLY=($(compgen -W "--bundle --job --platform --platform-data --workspace --output" -- "$cur")) ;;
+        expire) COMPREPLY=($(compgen -W "--workspace --output" -- "$cur")) ;;
+        account) COMPREPLY=($(compgen -W "--workspace" -- "$cur")) ;;
+        heal) COMPREPLY=($(compgen -W "--workspace --threshold" -- "$cur")) ;;
+    esac
+}
+complete -F _runner runner
+`
+
+const zshCompletion = `#compdef runner
+
+_runner() {
+    local -a commands
+    commands=(
+        'apply:run a configuration'
+        'teardown:remove everything a job deployed'
+        'status:show the job'"'"'s deployed services'
+        'port-forward:reach a service'"'"'s port from this host'
+        'clone:deploy a snapshot bundle as a new job'
+        'expire:tear down jobs whose ttl ran out'
+        'account:sample and report the usage of deployed jobs'
+        'heal:recreate services that keep failing, then report them degraded'
+        'serve:serve the read-only inspection API on a unix socket'
+        'validate:check a configuration without Docker or the agent'
+        'completion:print a shell completion script'
+        'messages:print the message catalog as JSON'
+    )
+
+    if (( CURRENT == 2 )); then
+        _describe 'command' commands
+        return
+    fi
+
+    case "$words[2]" in
+        apply) _arguments '-f[configuration file]:file:_files -g "*.json"' '--output[output mode]:mode:(auto plain pretty json)' ;;
+        validate) _arguments '-f[configuration file]:file:_files -g "*.json"' '--json[print findings as JSON]' ;;
+        teardown) _arguments '--job[job id]:job:' '--platform[platform]:platform:(docker swarm containerd ecs noop)' '--platform-data[platform data file]:file:_files' '--workspace[workspace directory]:dir:_files -/' '--output[output mode]:mode:(auto plain pretty json)' ;;
+        status) _arguments '--job[job id]:job:' '--platform[platform]:platform:(docker swarm containerd ecs noop)' '--platform-data[platform data file]:file:_files' ;;
+        port-forward) _arguments '--job[job id]:job:' '--platform[platform]:platform:(docker swarm containerd ecs noop)' '--platform-data[platform data file]:file:_files' '--service[service]:service:' '--port[container port]:port:' '--listen[local address]:address:' '--image[helper image]:image:' '--output[output mode]:mode:(auto plain pretty json)' ;;
+        clone) _arguments '--bundle[snapshot bundle]:dir:_files -/' '--job[job id]:job:' '--platform[platform]:platform:(docker swarm containerd ecs noop)' '--platform-data[platform data file]:file:_files' '--workspace[workspace directory]:dir:_files -/' '--output[output mode]:mode:(auto plain pretty json)' ;;
+        expire) _arguments '--workspace[workspace directory]:dir:_files -/' '--output[output mode]:mode:(auto plain pretty json)' ;;
+        account) _arguments '--workspace[workspace directory]:dir:_files -/' ;;
+        heal) _arguments '--workspace[workspace directory]:dir:_files -/' '--threshold[restarts that count as failing]:n:' ;;
+        serve) _arguments '--socket[unix socket]:socket:_files' '--workspace[workspace directory]:dir:_files -/' ;;
+        completion) _arguments '1:shell:(bash zsh fish)' ;;
+    esac
+}
+
+compdef _runner runner
+`
+
+const fishCompletion = `complete -c runner -f
+complete -c runner -n '__fish_use_subcommand' -a apply -d 'run a configuration'
+complete -c runner -n '__fish_use_subcommand' -a teardown -d 'remove everything a job deployed'
+complete -c runner -n '__fish_use_subcommand' -a status -d 'show the job''s deployed services'
+complete -c runner -n '__fish_use_subcommand' -a port-forward -d 'reach a service''s port from this host'
+complete -c runner -n '__fish_use_subcommand' -a clone -d 'deploy a snapshot bundle as a new job'
+complete -c runner -n '__fish_use_subcommand' -a expire -d 'tear down jobs whose ttl ran out'
+complete -c runner -n '__fish_use_subcommand' -a account -d 'sample and report the usage of deployed jobs'
+complete -c runner -n '__fish_use_subcommand' -a heal -d 'recreate services that keep failing, then report them degraded'
+complete -c runner -n '__fish_use_subcommand' -a serve -d 'serve the read-only inspection API on a unix socket'
+complete -c runner -n '__fish_use_subcommand' -a validate -d 'check a configuration without Docker or the agent'
+complete -c runner -n '__fish_use_subcommand' -a completion -d 'print a shell completion script'
+complete -c runner -n '__fish_use_subcommand' -a messages -d 'print the message catalog as JSON'
+complete -c runner -n '__fish_seen_subcommand_from apply validate' -s f -r -F -d 'configuration file'
+complete -c runner -n '__fish_seen_subcommand_from validate' -l json -d 'print findings as JSON'
+complete -c runner -n '__fish_seen_subcommand_from teardown status port-forward clone' -l job -r -d 'job id'
+complete -c runner -n '__fish_seen_subcommand_from teardown status port-forward clone' -l platform -r -a 'docker swarm containerd ecs noop' -d 'platform'
+complete -c runner -n '__fish_seen_subcommand_from teardown status port-forward clone' -l platform-data -r -F -d 'platform data file'
+complete -c runner -n '__fish_seen_subcommand_from serve' -l socket -r -F -d 'unix socket'
+complete -c runner -n '__fish_seen_subcommand_from teardown serve clone expire account heal' -l workspace -r -a '(__fish_complete_directories)' -d 'workspace directory'
+complete -c runner -n '__fish_seen_subcommand_from port-forward' -l service -r -d 'service to forward to'
+complete -c runner -n '__fish_seen_subcommand_from port-forward' -l port -r -d 'container port'
+complete -c runner -n '__fish_seen_subcommand_from port-forward' -l listen -r -d 'local address'
+complete -c runner -n '__fish_seen_subcommand_from port-forward' -l image -r -d 'helper image'
+complete -c runner -n '__fish_seen_subcommand_from apply teardown port-forward clone expire' -l output -r -a 'auto plain pretty json' -d 'output mode'
+complete -c runner -n '__fish_seen_subcommand_from heal' -l threshold -r -d 'restarts that count as failing'
+complete -c runner -n '__fish_seen_subcommand_from clone' -l bundle -r -a '(__fish_complete_directories)' -d 'snapshot bundle'
+complete -c runner -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+`
+
+var completionScripts = map[string]string{
+	"bash": bashCompletion,
+	"zsh":  zshCompletion,
+	"fish": fishCompletion,
+}
+
+func completionCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: completion takes one shell (bash, zsh or fish)", errUsage)
+	}
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		return fmt.Errorf("%w: unsupported shell %q (bash, zsh or fish)", errUsage, args[0])
+	}
+	fmt.Print(script)
+	return nil
+}
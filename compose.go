@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/compose"
+)
+
+// resolveCompose converts cfg.Compose into cfg.Metadata. A relative compose file
+// is resolved against the directory of the configuration file at configFile.
+func resolveCompose(configFile string, cfg *models.Configuration) error {
+	src := cfg.Compose
+	if src == nil {
+		return nil
+	}
+	if cfg.Metadata != nil || cfg.MetadataRef != nil {
+		return errors.New("compose: metadata or metadata_ref is also set (use one of them)")
+	}
+	if (src.File == "") == (src.Content == "") {
+		return errors.New("compose: exactly one of file and content is required")
+	}
+
+	b := []byte(src.Content)
+	if src.File != "" {
+		path := src.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(configFile), path)
+		}
+		var err error
+		b, err = os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("compose: read %q: %w", path, err)
+		}
+	}
+
+	md, warnings, err := compose.Convert(b)
+	if err != nil {
+		return fmt.Errorf("compose: %w", err)
+	}
+	for _, w := range warnings {
+		log.Printf("compose: %s", w)
+	}
+	cfg.Metadata = md
+	return nil
+}
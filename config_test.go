@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/schema"
+)
+
+const largeServices = 10000
+
+func writeLargeConfiguration(t testing.TB, version int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, largeConfiguration(largeServices, version), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadLargeConfiguration(t *testing.T) {
+	for _, version := range []int{1, schema.Current} {
+		cfg, err := readConfiguration(writeLargeConfiguration(t, version))
+		if err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+		if cfg.SchemaVersion != schema.Current {
+			t.Errorf("v%d: schema_version %d, want %d", version, cfg.SchemaVersion, schema.Current)
+		}
+		if n := len(cfg.Metadata.Services); n != largeServices {
+			t.Fatalf("v%d: %d services, want %d", version, n, largeServices)
+		}
+		if n := len(*cfg.Metadata.Volumes); n != largeServices {
+			t.Errorf("v%d: %d volumes, want %d", version, n, largeServices)
+		}
+		svc := cfg.Metadata.Services["svc-01234"]
+		if vols := *svc.Volumes; len(vols) != 1 || vols[0].Name == nil || *vols[0].Name != "data-01234" || vols[0].MountPath != "/data" {
+			t.Errorf("v%d: svc-01234 volumes %+v", version, vols)
+		}
+		if svc.DependsOn == nil || (*svc.DependsOn)[0] != "svc-01233" {
+			t.Errorf("v%d: svc-01234 depends_on %v", version, svc.DependsOn)
+		}
+	}
+}
+
+// peakHeap runs read with the collector at its most eager and returns the
+// largest heap it saw, which then stays close to what read holds live. It
+// samples, so it is only fit for reporting.
+func peakHeap(b *testing.B, read func() error) uint64 {
+	b.Helper()
+	defer debug.SetGCPercent(debug.SetGCPercent(5))
+	runtime.GC()
+
+	done := make(chan struct{})
+	peak := make(chan uint64)
+	go func() {
+		var max uint64
+		var m runtime.MemStats
+		for {
+			runtime.ReadMemStats(&m)
+			if m.HeapAlloc > max {
+				max = m.HeapAlloc
+			}
+			select {
+			case <-done:
+				peak <- max
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}()
+	err := read()
+	close(done)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return <-peak
+}
+
+// BenchmarkMigrateConfiguration compares reading an old document as it streams
+// with buffering the whole document and migrating it, which holds it as bytes,
+// a generic map and structs at once. Streaming should report the lower peak-B.
+func BenchmarkMigrateConfiguration(b *testing.B) {
+	path := writeLargeConfiguration(b, 1)
+	for _, mode := range []struct {
+		name string
+		read func() error
+	}{
+		{"buffered", func() error {
+			doc, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if doc, err = schema.Migrate(doc); err != nil {
+				return err
+			}
+			var cfg models.Configuration
+			return json.Unmarshal(doc, &cfg)
+		}},
+		{"streamed", func() error {
+			_, err := readConfiguration(path)
+			return err
+		}},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var peak uint64
+			for b.Loop() {
+				peak = max(peak, peakHeap(b, mode.read))
+			}
+			b.ReportMetric(float64(peak), "peak-B")
+		})
+	}
+}
+
+func BenchmarkReadConfiguration(b *testing.B) {
+	for _, version := range []int{1, schema.Current} {
+		path := writeLargeConfiguration(b, version)
+		b.Run(fmt.Sprintf("v%d", version), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := readConfiguration(path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
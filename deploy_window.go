@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/window"
+)
+
+// checkDeployWindows defers a run that would change the job outside its
+// deploy_windows, or outside those whoever runs the runner set in
+// RUNNER_DEPLOY_WINDOWS (the same JSON list). When both are set the run needs a
+// time inside both.
+func checkDeployWindows(ctx context.Context, cfg models.Configuration, now time.Time) error {
+	var local []models.DeployWindow
+	if s := strings.TrimSpace(os.Getenv("RUNNER_DEPLOY_WINDOWS")); s != "" {
+		if err := json.Unmarshal([]byte(s), &local); err != nil {
+			return fmt.Errorf("parse RUNNER_DEPLOY_WINDOWS: %w", err)
+		}
+	}
+	err := window.Check(now, cfg.DeployWindows, local)
+	var deferred *window.Deferred
+	if errors.As(err, &deferred) {
+		return runerr.Wrap(runerr.WithRun(ctx, cfg.Job, cfg.Run), "defer run", "", err)
+	}
+	return err
+}
+
+// notBefore is when a run deferred by runErr may start, or nil.
+func notBefore(runErr error) *time.Time {
+	var deferred *window.Deferred
+	if errors.As(runErr, &deferred) {
+		return &deferred.Next
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/device"
+)
+
+// checkDevices refuses host devices the runner has not allowed. Like privileged,
+// a device (a disk, say) can hand the container its host, so the setting is the
+// runner's: RUNNER_ALLOW_DEVICES lists allowed host paths, which may be globs
+// such as /dev/ttyUSB*.
+func checkDevices(cfg models.Configuration) error {
+	if cfg.Metadata == nil {
+		return nil
+	}
+	var allowed []string
+	for _, p := range strings.Split(os.Getenv("RUNNER_ALLOW_DEVICES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			allowed = append(allowed, p)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Metadata.Services)) {
+		mappings, err := device.ParseAll(cfg.Metadata.Services[name].Devices)
+		if err != nil {
+			return fmt.Errorf("service %q: %w", name, err)
+		}
+		for _, m := range mappings {
+			if !slices.ContainsFunc(allowed, func(pattern string) bool {
+				ok, _ := path.Match(pattern, m.Host)
+				return ok
+			}) {
+				return fmt.Errorf("service %q maps device %s; add it to RUNNER_ALLOW_DEVICES on the runner to allow it", name, m.Host)
+			}
+		}
+	}
+	return nil
+}
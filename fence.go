@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/phase"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+)
+
+// claimRun makes the run the owner of its job before it changes anything, so a
+// run that started earlier (a delayed retry, a stuck runner) stops instead of
+// undoing it. The generation comes from the configuration or the agent; without
+// one the run is numbered after the job's current owner.
+func claimRun(ctx context.Context, comm *agent.AgentCommunication, runs *state.Store, cfg *models.Configuration) error {
+	if cfg.Generation == 0 && comm != nil {
+		run, err := comm.GetRun(ctx, cfg.Run)
+		if err != nil {
+			log.Printf("get run generation: %v", err)
+		} else {
+			cfg.Generation = run.Generation
+		}
+	}
+	generation, err := runs.Claim(cfg.Job, cfg.Run, cfg.Generation)
+	if err != nil {
+		return runerr.Wrap(runerr.WithRun(ctx, cfg.Job, cfg.Run), "claim run", cfg.Job.String(), fmt.Errorf("%w: %w", phase.ErrSuperseded, err))
+	}
+	cfg.Generation = generation
+	return nil
+}
+
+// watchOwner cancels the run with phase.ErrSuperseded once a newer run claims
+// the job. It returns when ctx is done.
+func watchOwner(ctx context.Context, runs *state.Store, cfg models.Configuration, interval time.Duration, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := runs.CheckOwner(cfg.Job, cfg.Run, cfg.Generation); err != nil {
+			var superseded *state.SupersededError
+			if !errors.As(err, &superseded) {
+				log.Printf("check owner of job %s: %v", cfg.Job, err)
+				continue
+			}
+			cancel(fmt.Errorf("%w: %v", phase.ErrSuperseded, err))
+			return
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/interfaces"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/heal"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+)
+
+// trackHeal starts the heal record of a job a run deployed afresh, as the run
+// replaced its containers, and forgets it once the job is torn down. Like the
+// expiry it is logged rather than failing the run.
+func trackHeal(p interfaces.Platform, runs *state.Store, cfg models.Configuration) {
+	if _, ok := p.(interfaces.Healer); !ok {
+		return
+	}
+	var err error
+	switch cfg.Action {
+	case models.ActionTeardown:
+		err = runs.RemoveHeal(cfg.Job)
+	case models.ActionSetup, models.ActionUpdate, models.ActionClone:
+		err = runs.SaveHeal(&state.Heal{Job: cfg.Job, Platform: cfg.Platform, PlatformData: cfg.PlatformData})
+	case models.ActionPortForward, models.ActionSnapshot:
+	}
+	if err != nil {
+		log.Printf("update heal record: %v", err)
+	}
+}
+
+// healJob checks the job's long-running containers and escalates the ones that
+// keep failing despite their restart policy: first a fresh container from a
+// newly pulled image, then, if that fails too, a degraded report to the agent.
+// A container seen for the first time is only recorded, as its restarts may
+// predate the record.
+func healJob(ctx context.Context, healer interfaces.Healer, comm *agent.AgentCommunication, runs *state.Store, h *state.Heal, threshold int) error {
+	restarts, err := healer.Restarts(ctx, h.Job)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	seen := make(map[string]state.ContainerHeal, len(restarts))
+	var errs []error
+	for _, r := range restarts {
+		prev, ok := h.Containers[r.Container]
+		if !ok {
+			seen[r.Container] = state.ContainerHeal{Restarts: r.Restarts}
+			continue
+		}
+
+		n, _ := heal.Failed(prev, r, threshold)
+		next, step := heal.Next(prev, r, threshold, now)
+		if step == heal.Recreate {
+			log.Printf("job %s: %s restarted %d time(s) since the last check (health %q); recreating it", h.Job, r.Container, n, r.Health)
+			if err := healer.Recreate(ctx, h.Job, r); err != nil {
+				errs = append(errs, err)
+				// Without a fresh container it is degraded already.
+				next.Restarts = r.Restarts
+				next.Degraded = true
+				step = heal.Degrade
+			}
+		}
+
+		if step == heal.Degrade || step == heal.Recover {
+			report := models.ServiceHealthReport{Job: h.Job, Service: r.Service, Container: r.Container, State: models.ServiceDegraded, Restarts: n, Health: r.Health, Since: now}
+			if prev.Since != nil {
+				report.Since = *prev.Since
+			}
+			if step == heal.Recover {
+				report.State = models.ServiceRecovered
+			}
+			log.Printf("job %s: service %s is %s", h.Job, r.Service, report.State)
+			if err := reportServiceHealth(ctx, comm, report); err != nil {
+				errs = append(errs, err)
+				// Report it again at the next check.
+				next.Degraded = step == heal.Recover
+				if step == heal.Recover {
+					next.Since = prev.Since
+				}
+			}
+		}
+		seen[r.Container] = next
+	}
+
+	h.Containers = seen
+	if err := runs.SaveHeal(h); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func reportServiceHealth(ctx context.Context, comm *agent.AgentCommunication, report models.ServiceHealthReport) error {
+	if comm == nil {
+		return nil
+	}
+	rctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	return comm.ReportServiceHealth(rctx, report)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/heal"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+	"github.com/google/uuid"
+)
+
+// fakeHealer reports one container whose restart count the test sets, and
+// counts the times it was recreated, which resets it like a fresh container.
+type fakeHealer struct {
+	restarts  int
+	recreated int
+}
+
+func (f *fakeHealer) Restarts(context.Context, uuid.UUID) ([]models.ServiceRestarts, error) {
+	return []models.ServiceRestarts{{Service: "web", Container: "web-1", Restarts: f.restarts}}, nil
+}
+
+func (f *fakeHealer) Recreate(context.Context, uuid.UUID, models.ServiceRestarts) error {
+	f.recreated++
+	f.restarts = 0
+	return nil
+}
+
+func TestHealJobEscalates(t *testing.T) {
+	runs := state.New(t.TempDir())
+	job := uuid.New()
+	if err := runs.SaveHeal(&state.Heal{Job: job, Platform: "docker"}); err != nil {
+		t.Fatal(err)
+	}
+	healer := &fakeHealer{}
+
+	// check runs `runner heal` once against the stored record, as a schedule
+	// would, and returns the container's record it left behind.
+	check := func(restarts int) state.ContainerHeal {
+		t.Helper()
+		healer.restarts = restarts
+		heals, err := runs.Heals()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(heals) != 1 {
+			t.Fatalf("%d heal records, want 1", len(heals))
+		}
+		if err := healJob(context.Background(), healer, nil, runs, &heals[0], heal.DefaultThreshold); err != nil {
+			t.Fatal(err)
+		}
+		if heals, err = runs.Heals(); err != nil {
+			t.Fatal(err)
+		}
+		return heals[0].Containers["web-1"]
+	}
+
+	// First seen: only recorded, whatever it restarted before.
+	if c := check(10); c.Restarts != 10 || c.Recreated || c.Degraded || healer.recreated != 0 {
+		t.Fatalf("first check: record %+v, recreated %d time(s)", c, healer.recreated)
+	}
+
+	// Failing: recreated once.
+	c := check(13)
+	if !c.Recreated || c.Degraded || c.Since == nil || healer.recreated != 1 {
+		t.Fatalf("failing: record %+v, recreated %d time(s); want recreated once", c, healer.recreated)
+	}
+	since := *c.Since
+
+	// The fresh container fails too: degraded, not recreated again.
+	c = check(3)
+	if !c.Recreated || !c.Degraded || healer.recreated != 1 {
+		t.Fatalf("failing again: record %+v, recreated %d time(s); want degraded", c, healer.recreated)
+	}
+	if !c.Since.Equal(since) {
+		t.Errorf("failing since %s, want %s", c.Since, since)
+	}
+
+	// Still failing: stays degraded without another step.
+	if c = check(6); !c.Degraded || healer.recreated != 1 {
+		t.Fatalf("still failing: record %+v, recreated %d time(s); want still degraded", c, healer.recreated)
+	}
+
+	// No restarts since: recovered, and escalation starts over.
+	if c = check(6); c != (state.ContainerHeal{Restarts: 6}) {
+		t.Fatalf("recovered: record %+v, want a fresh one", c)
+	}
+}
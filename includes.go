@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/include"
+)
+
+// resolveIncludes merges md's includes into it in place. base is the file, URL or
+// agent path md was read from; pinned says its checksum was verified, so its
+// includes must be checksummed too. Included documents are migrated with the
+// configuration's schema version.
+func resolveIncludes(ctx context.Context, comm *agent.AgentCommunication, base string, pinned bool, version int, md *models.Metadata) error {
+	return include.Resolve(ctx, md, base, pinned, func(ctx context.Context, ref string, digest string) (*models.Metadata, error) {
+		var b []byte
+		var err error
+		switch path, isAgent := strings.CutPrefix(ref, include.AgentPrefix); {
+		case isAgent:
+			if comm == nil {
+				return nil, fmt.Errorf("agent path %q needs the agent (AGENT_ENDPOINT and TOKEN)", path)
+			}
+			b, err = comm.FetchMetadata(ctx, path)
+		case strings.HasPrefix(ref, "https://") || strings.HasPrefix(ref, "http://"):
+			b, err = fetchURL(ctx, ref)
+		default:
+			b, err = os.ReadFile(ref)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if digest != "" {
+			if err := checkSHA256(b, digest); err != nil {
+				return nil, err
+			}
+		}
+		return migrateMetadata(b, version)
+	})
+}
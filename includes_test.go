@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+func sha256Hex(s string) string {
+	b := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(b[:])
+}
+
+func TestResolveMetadataRefChecksIncludes(t *testing.T) {
+	const base = `{"services":{"db":{"image":"postgres:16"}}}`
+	docs := map[string]string{"/base.json": base}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, doc)
+	}))
+	defer srv.Close()
+
+	resolve := func(include string) (*models.Metadata, error) {
+		app := `{"includes":[` + include + `],"services":{"web":{"image":"nginx:1.27"}}}`
+		docs["/app.json"] = app
+		cfg := models.Configuration{SchemaVersion: 2, MetadataRef: &models.MetadataRef{URL: srv.URL + "/app.json", SHA256: sha256Hex(app)}}
+		err := resolveMetadataRef(context.Background(), nil, &cfg)
+		return cfg.Metadata, err
+	}
+
+	md, err := resolve(fmt.Sprintf(`{"ref":"base.json","sha256":%q}`, sha256Hex(base)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(md.Services) != 2 {
+		t.Errorf("services %v, want db and web", md.Services)
+	}
+
+	if _, err := resolve(`"base.json"`); err == nil || !strings.Contains(err.Error(), "sha256 is required") {
+		t.Errorf("include without sha256: got %v", err)
+	}
+	if _, err := resolve(fmt.Sprintf(`{"ref":"base.json","sha256":%q}`, sha256Hex(base+" "))); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("changed include: got %v", err)
+	}
+}
@@ -4,8 +4,49 @@ import (
 	"context"
 
 	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/google/uuid"
 )
 
 type Platform interface {
-	Run(ctx context.Context, config models.Configuration) error
+	Run(ctx context.Context, config models.Configuration) (models.RunResult, error)
+
+	// Capabilities reports which metadata features the platform honors.
+	Capabilities() models.PlatformCapabilities
+}
+
+// Inspector is implemented by platforms that can report what a job has deployed.
+type Inspector interface {
+	Status(ctx context.Context, job uuid.UUID) ([]models.ServiceStatus, error)
+}
+
+// PortForwarder is implemented by platforms that can tunnel a local port to a
+// service's container port for action "port-forward". It runs until ctx ends.
+type PortForwarder interface {
+	PortForward(ctx context.Context, job uuid.UUID, fwd models.PortForward) error
+}
+
+// Snapshotter is implemented by platforms that can capture a job for action
+// "snapshot" and restore its volumes for action "clone". Volume archives are tar
+// files of the volume's contents.
+type Snapshotter interface {
+	// ImageDigests returns the image each running service was started from,
+	// pinned by digest. Services without a container or digest are left out.
+	ImageDigests(ctx context.Context, job uuid.UUID, metadata *models.Metadata) (map[string]string, error)
+
+	ExportVolume(ctx context.Context, job uuid.UUID, metadata *models.Metadata, volume, archive string) error
+	ImportVolume(ctx context.Context, job, run uuid.UUID, metadata *models.Metadata, volume, archive string) error
+}
+
+// Accountant is implemented by platforms that can measure what a job uses, for
+// the usage the runner accumulates and reports for chargeback.
+type Accountant interface {
+	Usage(ctx context.Context, job uuid.UUID) (models.UsageSample, error)
+}
+
+// Healer is implemented by platforms whose daemons restart failing containers
+// themselves, so `runner heal` can tell a service that keeps failing and
+// escalate: replace its container with a fresh one from a newly pulled image.
+type Healer interface {
+	Restarts(ctx context.Context, job uuid.UUID) ([]models.ServiceRestarts, error)
+	Recreate(ctx context.Context, job uuid.UUID, target models.ServiceRestarts) error
 }
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/services/inspect"
+)
+
+// writeInventory refreshes the inventory textfile in RUNNER_TEXTFILE_DIR (e.g.
+// node-exporter's --collector.textfile.directory). It is off unless the variable
+// is set, and a failed write is only logged.
+func writeInventory(workspace string) {
+	dir := strings.TrimSpace(os.Getenv("RUNNER_TEXTFILE_DIR"))
+	if dir == "" {
+		return
+	}
+	if err := inspect.WriteTextfile(workspace, dir); err != nil {
+		log.Printf("write inventory textfile: %v", err)
+	}
+}
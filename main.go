@@ -2,63 +2,574 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/ezenkico/deploy-commander/runner/interfaces"
 	"github.com/ezenkico/deploy-commander/runner/models"
 	"github.com/ezenkico/deploy-commander/runner/services/agent"
-	"github.com/ezenkico/deploy-commander/runner/services/docker"
+	"github.com/ezenkico/deploy-commander/runner/services/console"
+	"github.com/ezenkico/deploy-commander/runner/services/events"
+	"github.com/ezenkico/deploy-commander/runner/services/messages"
+	"github.com/ezenkico/deploy-commander/runner/services/metrics"
+	"github.com/ezenkico/deploy-commander/runner/services/phase"
+	"github.com/ezenkico/deploy-commander/runner/services/plan"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/progress"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/schema"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+	"github.com/ezenkico/deploy-commander/runner/services/validate"
+	"github.com/google/uuid"
 )
 
 const configPath = "/run/config.json"
 
+// How often the runner polls the agent for a cancellation request.
+const cancelPollInterval = 5 * time.Second
+
+// How often queued agent writes are retried during a run, and how long the
+// final attempt after the run may take.
+const (
+	outboxRetryInterval     = 30 * time.Second
+	outboxFinalDrainTimeout = 10 * time.Second
+)
+
+// Exit codes, one per run outcome, so callers without the agent can tell them apart.
+const (
+	exitSucceeded             = 0
+	exitFailedPartial         = 1
+	exitFailedBeforeChanges   = 2
+	exitSucceededWithWarnings = 3
+	exitNotReady              = 4  // the run succeeded but the job is not ready (see checkReadiness)
+	exitDeferred              = 5  // the run was refused outside its deploy windows (see checkDeployWindows)
+	exitUsage                 = 64 // bad command line (sysexits EX_USAGE)
+)
+
+var outcomeExitCodes = map[models.RunOutcome]int{
+	models.RunOutcomeSucceeded:             exitSucceeded,
+	models.RunOutcomeFailedPartial:         exitFailedPartial,
+	models.RunOutcomeFailedBeforeChanges:   exitFailedBeforeChanges,
+	models.RunOutcomeSucceededWithWarnings: exitSucceededWithWarnings,
+}
+
+// loadConfiguration reads the configuration at path and expands its compose source
+// and metadata includes, so callers always get the final metadata.
 func loadConfiguration(path string) (models.Configuration, error) {
-	b, err := os.ReadFile(path)
+	cfg, err := readConfiguration(path)
+	if err != nil {
+		return models.Configuration{}, err
+	}
+	if err := resolveCompose(path, &cfg); err != nil {
+		return models.Configuration{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), metadataFetchTimeout)
+	defer cancel()
+	if err := resolveIncludes(ctx, nil, path, false, cfg.SchemaVersion, cfg.Metadata); err != nil {
+		return models.Configuration{}, err
+	}
+	return cfg, nil
+}
+
+// readConfiguration decodes the configuration at path, migrating older schema
+// versions as it streams, so a huge metadata document is never held as raw bytes
+// and as structs at the same time.
+func readConfiguration(path string) (models.Configuration, error) {
+	f, err := os.Open(path)
 	if err != nil {
 		return models.Configuration{}, fmt.Errorf("read config file %q: %w", path, err)
 	}
+	defer f.Close()
 
-	var cfg models.Configuration
-	if err := json.Unmarshal(b, &cfg); err != nil {
+	cfg, err := schema.Decode(f)
+	if err != nil {
 		return models.Configuration{}, fmt.Errorf("parse config json %q: %w", path, err)
 	}
-
 	return cfg, nil
 }
 
-func selectPlatform(platform string, comm *agent.AgentCommunication) (interfaces.Platform, error) {
-	switch platform {
-	case "docker":
-		return docker.NewDockerPlatform(comm)
-	// case "k8s":
-	//     return k8s.New(...), nil
+func main() {
+	startProfiling()
+	os.Exit(runCLI(os.Args[1:]))
+}
+
+// execute runs one configuration end to end, showing it in the given output mode,
+// and returns the process exit code.
+func execute(cfg models.Configuration, mode console.Mode) int {
+	started := time.Now()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	out := console.New(mode)
+	defer out.Close()
+	ctx = progress.WithReporter(ctx, out)
+
+	// Record which signal stopped the run so it shows up in the final error.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		// expire runs one configuration after another, so stop listening
+		// once this one returns.
+		select {
+		case sig := <-sigs:
+			cancel(fmt.Errorf("%w: %s", phase.ErrSignal, sig))
+		case <-ctx.Done():
+		}
+	}()
+
+	comm, err := agent.NewAgentCommunicationFromEnv()
+
+	p, err := newPlatform(&cfg, comm)
+	if err != nil {
+		// expire runs one job after another, so this fails only the run; its
+		// summary logs the error.
+		return failRun(ctx, out, comm, cfg, started, err)
+	}
+
+	runs := state.New(cfg.WorkspaceDir())
+	// Every mutating call made for the run, to the platform or the agent, is
+	// appended to its event log.
+	if eventLog, err := events.Open(runs.EventsPath(cfg.Run)); err != nil {
+		log.Printf("open event log: %v", err)
+	} else {
+		defer eventLog.Close()
+		ctx = events.WithLog(ctx, eventLog)
+	}
+	record := &state.RunRecord{
+		Run:      cfg.Run,
+		Job:      cfg.Job,
+		Platform: cfg.Platform,
+		Action:   string(cfg.Action),
+		Status:   models.RunStatusRunning,
+		PID:      os.Getpid(),
+		Started:  started.UTC(),
+	}
+	saveRun(runs, record)
+	writeInventory(cfg.WorkspaceDir())
+
+	if comm != nil {
+		comm.RunID = cfg.Run
+		comm.Outbox = agent.NewOutbox(filepath.Join(cfg.WorkspaceDir(), "outbox"))
+		// Deliver what earlier invocations could not before writing anything new.
+		drainOutbox(ctx, comm)
+		go comm.WatchOutbox(ctx, outboxRetryInterval)
+		go comm.WatchRunCancellation(ctx, cfg.Run, cancelPollInterval, cancel)
+	}
+
+	caps := p.Capabilities()
+	if comm != nil {
+		if err := comm.ReportCapabilities(ctx, cfg.Run, caps); err != nil {
+			log.Printf("report capabilities: %v", err)
+		}
+	}
+
+	// Nothing runs unless the metadata resolved, fits the platform, and the plan
+	// was recorded first.
+	var result models.RunResult
+	var capWarnings []string
+	var runErr error
+	switch cfg.Action {
+	case models.ActionPortForward:
+		// Nothing is deployed, so there is no metadata or plan to check.
+		runErr = portForward(ctx, p, cfg)
+	case models.ActionSnapshot:
+		runErr = resolveMetadata(ctx, comm, &cfg)
+		if runErr == nil {
+			result, runErr = snapshotJob(ctx, p, cfg)
+		}
+	case models.ActionSetup, models.ActionUpdate, models.ActionTeardown, models.ActionClone:
+		// Every other action changes the job, so it waits for a deploy window.
+		runErr = checkDeployWindows(ctx, cfg, started)
+
+		// A clone is a setup of the bundle's metadata onto volumes restored from it.
+		var bundle models.SnapshotManifest
+		if runErr == nil && cfg.Action == models.ActionClone {
+			bundle, runErr = loadSnapshot(&cfg)
+		}
+		if runErr == nil {
+			runErr = resolveMetadata(ctx, comm, &cfg)
+		}
+		if runErr == nil {
+			runErr = checkConfiguration(cfg)
+		}
+		if runErr == nil {
+			capWarnings, runErr = checkCapabilities(cfg, caps)
+		}
+		if runErr == nil {
+			runErr = checkPrivileged(cfg)
+		}
+		if runErr == nil {
+			runErr = checkDevices(cfg)
+		}
+		if runErr == nil {
+			runErr = checkStepRuntimes(cfg)
+		}
+		if runErr == nil {
+			runErr = recordPlan(ctx, comm, cfg)
+		}
+		if runErr == nil {
+			runErr = claimRun(ctx, comm, runs, &cfg)
+		}
+		if runErr == nil {
+			go watchOwner(ctx, runs, cfg, cancelPollInterval, cancel)
+		}
+		if runErr == nil && cfg.Action == models.ActionClone {
+			runErr = restoreVolumes(ctx, p, cfg, bundle)
+		}
+		if runErr == nil {
+			recordUsage(ctx, p, comm, runs, cfg)
+			result, runErr = p.Run(ctx, cfg)
+		}
 	default:
-		return nil, fmt.Errorf("%q is not a valid platform", platform)
+		runErr = runerr.Errorf(runerr.WithRun(ctx, cfg.Job, cfg.Run), "parse action", string(cfg.Action), "unknown action %q (valid: %v)", cfg.Action, models.Actions())
+	}
+	result.Warnings = append(capWarnings, result.Warnings...)
+	outcome := result.Outcome(runErr)
+	if runErr == nil {
+		result.Readiness = checkReadiness(ctx, p, comm, cfg)
+	}
+
+	if comm != nil {
+		if n := comm.Outbox.Queued(); n > 0 {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%d agent write(s) queued for retry", n))
+			outcome = result.Outcome(runErr)
+		}
+		reportRunStatus(ctx, comm, cfg, result, runErr)
+
+		// One last attempt so a short agent outage does not wait for the next run.
+		dctx, dcancel := context.WithTimeout(context.WithoutCancel(ctx), outboxFinalDrainTimeout)
+		drainOutbox(dctx, comm)
+		dcancel()
 	}
+
+	if cfg.Metrics != nil {
+		pushMetrics(cfg, result, outcome, started)
+	}
+
+	if runErr == nil {
+		updateExpiry(runs, cfg)
+		trackHeal(p, runs, cfg)
+		if cfg.Action == models.ActionTeardown {
+			// Its last usage was reported before the teardown.
+			if err := runs.RemoveUsage(cfg.Job); err != nil {
+				log.Printf("forget job usage: %v", err)
+			}
+		}
+	}
+
+	msg := messages.ForRun(outcome, len(result.Warnings), runErr)
+	finished := time.Now().UTC()
+	record.Status = runStatus(runErr)
+	record.Finished = &finished
+	record.NotBefore = notBefore(runErr)
+	record.Outcome = outcome
+	record.Message = &msg
+	record.Warnings = result.Warnings
+	record.Services = result.Services
+	record.Readiness = result.Readiness
+	if runErr != nil {
+		record.Error = runErr.Error()
+	}
+	saveRun(runs, record)
+	writeInventory(cfg.WorkspaceDir())
+
+	out.Summary(console.Summary{
+		Message:   msg,
+		Job:       cfg.Job.String(),
+		Run:       cfg.Run.String(),
+		Action:    string(cfg.Action),
+		Outcome:   outcome,
+		Err:       runErr,
+		Warnings:  result.Warnings,
+		Services:  result.Services,
+		Elapsed:   time.Since(started),
+		Readiness: result.Readiness,
+	})
+	if record.Status == models.RunStatusDeferred {
+		return exitDeferred
+	}
+	if result.Readiness != nil && !result.Readiness.Ready {
+		return exitNotReady
+	}
+	return outcomeExitCodes[outcome]
 }
 
-func main() {
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+// newPlatform builds the configuration's platform, detecting it first if the
+// configuration doesn't name one.
+func newPlatform(cfg *models.Configuration, comm *agent.AgentCommunication) (interfaces.Platform, error) {
+	if cfg.Platform == "" {
+		if err := detectPlatform(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return platforms.New(cfg.Platform, comm, cfg.PlatformData)
+}
 
-	cfg, err := loadConfiguration(configPath)
+// failRun ends a run that failed before it could reach its platform: it is
+// recorded, reported to the agent and shown like any other failed run.
+func failRun(ctx context.Context, out console.Renderer, comm *agent.AgentCommunication, cfg models.Configuration, started time.Time, runErr error) int {
+	var result models.RunResult
+	outcome := result.Outcome(runErr)
+	msg := messages.ForRun(outcome, 0, runErr)
+	finished := time.Now().UTC()
+	runs := state.New(cfg.WorkspaceDir())
+	saveRun(runs, &state.RunRecord{
+		Run:      cfg.Run,
+		Job:      cfg.Job,
+		Platform: cfg.Platform,
+		Action:   string(cfg.Action),
+		Status:   runStatus(runErr),
+		PID:      os.Getpid(),
+		Started:  started.UTC(),
+		Finished: &finished,
+		Outcome:  outcome,
+		Message:  &msg,
+		Error:    runErr.Error(),
+	})
+	writeInventory(cfg.WorkspaceDir())
+	if comm != nil {
+		reportRunStatus(ctx, comm, cfg, result, runErr)
+	}
+
+	out.Summary(console.Summary{
+		Message: msg,
+		Job:     cfg.Job.String(),
+		Run:     cfg.Run.String(),
+		Action:  string(cfg.Action),
+		Outcome: outcome,
+		Err:     runErr,
+		Elapsed: time.Since(started),
+	})
+	return outcomeExitCodes[outcome]
+}
+
+// detectPlatform fills in the platform of a configuration that doesn't name one
+// (see platforms.Detect).
+func detectPlatform(cfg *models.Configuration) error {
+	det, err := platforms.Detect()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	cfg.Platform = det.Platform
+	if cfg.PlatformData == nil {
+		cfg.PlatformData = det.Data
+	}
+	log.Printf("platform not set; using %s (found %s)", det.Platform, det.Found)
+	return nil
+}
 
-	comm, err := agent.NewAgentCommunicationFromEnv()
+// drainOutbox replays queued agent writes, logging what is left.
+func drainOutbox(ctx context.Context, comm *agent.AgentCommunication) {
+	left, err := comm.DrainOutbox(ctx)
+	if err != nil {
+		log.Printf("drain outbox: %v", err)
+	} else if left > 0 {
+		log.Printf("%d queued agent write(s) still pending", left)
+	}
+}
+
+// pushMetrics pushes the finished run's metrics. The run is over by now, so a
+// failed push is only logged.
+func pushMetrics(cfg models.Configuration, result models.RunResult, outcome models.RunOutcome, started time.Time) {
+	err := metrics.Push(context.Background(), *cfg.Metrics, metrics.Run{
+		Job:      cfg.Job.String(),
+		Run:      cfg.Run.String(),
+		Runner:   cfg.Runner,
+		Platform: cfg.Platform,
+		Action:   string(cfg.Action),
+		Outcome:  outcome,
+		Started:  started,
+		Finished: time.Now(),
+		Changed:  result.Changed,
+		Warnings: len(result.Warnings),
+		Services: result.Services,
+	})
+	if err != nil {
+		log.Printf("push metrics: %v", err)
+	}
+}
+
+// portForward runs action "port-forward" until the run is stopped, on platforms
+// that can tunnel to a service.
+func portForward(ctx context.Context, p interfaces.Platform, cfg models.Configuration) error {
+	fwd, ok := p.(interfaces.PortForwarder)
+	if !ok {
+		return fmt.Errorf("platform %q does not support port-forward", cfg.Platform)
+	}
+	if cfg.PortForward == nil {
+		return errors.New("port_forward is required for action port-forward")
+	}
+	return fwd.PortForward(runerr.WithRun(ctx, cfg.Job, cfg.Run), cfg.Job, *cfg.PortForward)
+}
+
+// checkConfiguration fails on everything the validator rejects, so a bad field
+// stops the run before anything is created rather than partway through it.
+func checkConfiguration(cfg models.Configuration) error {
+	var errs []error
+	for _, f := range validate.Configuration(cfg) {
+		if f.Severity == validate.SeverityError {
+			errs = append(errs, fmt.Errorf("config: %s", f))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkCapabilities fails on metadata the platform cannot run and returns what it
+// would only ignore as warnings.
+func checkCapabilities(cfg models.Configuration, caps models.PlatformCapabilities) ([]string, error) {
+	var warnings []string
+	for _, f := range validate.Capabilities(cfg, caps) {
+		if f.Severity == validate.SeverityError {
+			return nil, fmt.Errorf("capabilities: %s", f)
+		}
+		log.Printf("warning: %s", f)
+		warnings = append(warnings, f.String())
+	}
+	return warnings, nil
+}
+
+// recordPlan computes the run plan, signs it with PLAN_SIGNING_KEY (if set), saves it
+// to the workspace and, when configured, uploads it to the agent before anything runs.
+func recordPlan(ctx context.Context, comm *agent.AgentCommunication, cfg models.Configuration) error {
+	pl, err := plan.Build(cfg)
+	if err != nil {
+		return fmt.Errorf("build run plan: %w", err)
+	}
+	plan.Sign(pl, []byte(os.Getenv("PLAN_SIGNING_KEY")))
 
-	p, err := selectPlatform(cfg.Platform, comm)
+	lint, err := validate.Lint(cfg)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	for _, f := range lint {
+		if f.Severity == validate.SeverityError {
+			return fmt.Errorf("lint: %s", f)
+		}
+		log.Printf("lint: %s", f)
+	}
+
+	path, err := plan.Save(cfg.WorkspaceDir(), pl)
+	if err != nil {
+		return err
+	}
+	log.Printf("run plan: %d operation(s), digest %s, saved to %s", len(pl.Operations), pl.Digest, path)
+
+	if cfg.UploadPlan && comm != nil {
+		if err := comm.UploadPlan(ctx, cfg.Run, *pl); err != nil {
+			return fmt.Errorf("upload run plan: %w", err)
+		}
+	}
+	return nil
+}
+
+// runStatus is the final status of a run that ended with runErr.
+func runStatus(runErr error) models.RunStatus {
+	switch {
+	case runErr == nil:
+		return models.RunStatusSucceeded
+	case phase.Cause(runErr) != nil:
+		return models.RunStatusCancelled
+	case notBefore(runErr) != nil:
+		return models.RunStatusDeferred
+	default:
+		return models.RunStatusFailed
+	}
+}
+
+// saveRun writes the run record for local tooling (see the serve command). It is
+// only bookkeeping, so a failure is logged.
+func saveRun(runs *state.Store, record *state.RunRecord) {
+	if err := runs.SaveRun(record); err != nil {
+		log.Printf("save run record: %v", err)
+	}
+}
 
-	if err := p.Run(ctx, cfg); err != nil {
-		log.Fatal(err)
+// updateExpiry starts the ttl of a job a run deployed, and forgets it once the
+// job is torn down. Like the run record it is logged rather than failing the run.
+func updateExpiry(runs *state.Store, cfg models.Configuration) {
+	var err error
+	switch {
+	case cfg.Action == models.ActionTeardown:
+		err = runs.RemoveExpiry(cfg.Job)
+	case cfg.TTL != nil && (cfg.Action == models.ActionSetup || cfg.Action == models.ActionUpdate || cfg.Action == models.ActionClone):
+		expires := time.Now().Add(time.Duration(*cfg.TTL)).UTC()
+		err = runs.SaveExpiry(state.Expiry{
+			Job:          cfg.Job,
+			Run:          cfg.Run,
+			Platform:     cfg.Platform,
+			PlatformData: cfg.PlatformData,
+			TTL:          *cfg.TTL,
+			Expires:      expires,
+		})
+		if err == nil {
+			log.Printf("job expires at %s", expires.Format(time.RFC3339))
+		}
+	}
+	if err != nil {
+		log.Printf("update job expiry: %v", err)
+	}
+}
+
+// expireJob tears down a job whose ttl ran out, telling the agent why first.
+func expireJob(e state.Expiry, workspace string, mode console.Mode) int {
+	run := uuid.New()
+	log.Printf("job %s expired at %s; tearing it down", e.Job, e.Expires.Format(time.RFC3339))
+	if comm, _ := agent.NewAgentCommunicationFromEnv(); comm != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := comm.NotifyExpired(ctx, models.JobExpiry{Job: e.Job, Run: run, TTL: e.TTL, Expires: e.Expires})
+		cancel()
+		if err != nil {
+			log.Printf("notify expiry: %v", err)
+		}
+	}
+	return execute(models.Configuration{
+		SchemaVersion: schema.Current,
+		Job:           e.Job,
+		Run:           run,
+		Platform:      e.Platform,
+		PlatformData:  e.PlatformData,
+		Action:        models.ActionTeardown,
+		Workspace:     workspace,
+	}, mode)
+}
+
+// reportRunStatus sends the final run status to the agent. Errors are logged
+// rather than returned so they never mask the run's own result.
+func reportRunStatus(ctx context.Context, comm *agent.AgentCommunication, cfg models.Configuration, result models.RunResult, runErr error) {
+	msg := messages.ForRun(result.Outcome(runErr), len(result.Warnings), runErr)
+	update := models.RunStatusUpdate{
+		Status:   runStatus(runErr),
+		Message:  &msg,
+		Outcome:  result.Outcome(runErr),
+		Warnings: result.Warnings,
+		Services: result.Services,
+
+		Readiness: result.Readiness,
+	}
+	if runErr != nil {
+		msg := runErr.Error()
+		update.Error = &msg
+		update.ErrorContext = runerr.Fields(runErr)
+		update.NotBefore = notBefore(runErr)
+		if cause := phase.Cause(runErr); cause != nil {
+			c := cause.Error()
+			update.Cause = &c
+		}
+	}
+
+	// The run may have been cancelled, but its status still goes out (and into
+	// its event log).
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	if err := comm.UpdateRunStatus(ctx, cfg.Run, update); err != nil {
+		log.Printf("report run status: %v", err)
 	}
 }
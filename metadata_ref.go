@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/include"
+	"github.com/ezenkico/deploy-commander/runner/services/override"
+	"github.com/ezenkico/deploy-commander/runner/services/schema"
+	"github.com/ezenkico/deploy-commander/runner/services/source"
+)
+
+// Upper bound for downloading referenced metadata.
+const metadataFetchTimeout = 2 * time.Minute
+
+// resolveMetadata produces the final metadata of cfg: it downloads metadata_ref (if
+// set), applies the configuration's overrides and expands source steps.
+func resolveMetadata(ctx context.Context, comm *agent.AgentCommunication, cfg *models.Configuration) error {
+	if err := resolveMetadataRef(ctx, comm, cfg); err != nil {
+		return err
+	}
+	if err := override.Apply(cfg.Metadata, cfg.Overrides); err != nil {
+		return err
+	}
+	if len(cfg.Overrides) > 0 {
+		log.Printf("applied %d metadata override(s)", len(cfg.Overrides))
+	}
+	return source.Expand(cfg.Metadata)
+}
+
+// resolveMetadataRef downloads cfg.MetadataRef, checks its SHA-256, and fills in cfg.Metadata.
+// The document is migrated with the configuration's schema version.
+func resolveMetadataRef(ctx context.Context, comm *agent.AgentCommunication, cfg *models.Configuration) error {
+	ref := cfg.MetadataRef
+	if ref == nil {
+		return nil
+	}
+	if cfg.Metadata != nil {
+		return errors.New("metadata_ref: metadata is also set (use one or the other)")
+	}
+	if (ref.URL == "") == (ref.Path == "") {
+		return errors.New("metadata_ref: exactly one of url and path is required")
+	}
+	if _, err := parseSHA256(ref.SHA256); err != nil {
+		return fmt.Errorf("metadata_ref: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, metadataFetchTimeout)
+	defer cancel()
+
+	var b []byte
+	var err error
+	if ref.Path != "" {
+		if comm == nil {
+			return fmt.Errorf("metadata_ref: path %q needs the agent (AGENT_ENDPOINT and TOKEN)", ref.Path)
+		}
+		b, err = comm.FetchMetadata(ctx, ref.Path)
+	} else {
+		b, err = fetchURL(ctx, ref.URL)
+	}
+	if err != nil {
+		return fmt.Errorf("metadata_ref: download: %w", err)
+	}
+
+	if err := checkSHA256(b, ref.SHA256); err != nil {
+		return fmt.Errorf("metadata_ref: %w", err)
+	}
+
+	md, err := migrateMetadata(b, cfg.SchemaVersion)
+	if err != nil {
+		return fmt.Errorf("metadata_ref: %w", err)
+	}
+	// Relative includes resolve against the URL or agent path, and must be
+	// checksummed like the document itself.
+	base := ref.URL
+	if ref.Path != "" {
+		base = include.AgentPrefix + ref.Path
+	}
+	if err := resolveIncludes(ctx, comm, base, true, cfg.SchemaVersion, md); err != nil {
+		return fmt.Errorf("metadata_ref: %w", err)
+	}
+	cfg.Metadata = md
+	return nil
+}
+
+// parseSHA256 decodes a hex SHA-256 digest.
+func parseSHA256(s string) ([]byte, error) {
+	want, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(want) != sha256.Size {
+		return nil, fmt.Errorf("sha256 must be a hex SHA-256 digest, got %q", s)
+	}
+	return want, nil
+}
+
+// checkSHA256 checks b against the hex digest want.
+func checkSHA256(b []byte, want string) error {
+	w, err := parseSHA256(want)
+	if err != nil {
+		return err
+	}
+	if got := sha256.Sum256(b); !bytes.Equal(got[:], w) {
+		return fmt.Errorf("checksum mismatch (want %s, got %x)", want, got)
+	}
+	return nil
+}
+
+// migrateMetadata parses a standalone metadata document, running it through the
+// same migrations as inline metadata of a configuration at the given schema version.
+func migrateMetadata(b []byte, version int) (*models.Metadata, error) {
+	doc, err := json.Marshal(map[string]any{
+		"schema_version": max(version, 1),
+		"metadata":       json.RawMessage(b),
+	})
+	if err != nil {
+		return nil, err
+	}
+	doc, err = schema.Migrate(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var wrapped struct {
+		Metadata *models.Metadata `json:"metadata"`
+	}
+	if err := json.Unmarshal(doc, &wrapped); err != nil {
+		return nil, fmt.Errorf("parse metadata: %w", err)
+	}
+	return wrapped.Metadata, nil
+}
+
+func fetchURL(ctx context.Context, url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return nil, fmt.Errorf("unsupported url %q (use http:// or https://)", url)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
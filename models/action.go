@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Action is what a run does to its job.
+type Action string
+
+const (
+	ActionSetup       Action = "setup"        // deploy the metadata
+	ActionUpdate      Action = "update"       // redeploy only the services whose spec changed
+	ActionTeardown    Action = "teardown"     // remove everything the job created
+	ActionPortForward Action = "port-forward" // tunnel to a service until stopped
+	ActionSnapshot    Action = "snapshot"     // archive the job's volumes and metadata
+	ActionClone       Action = "clone"        // setup from a snapshot bundle
+)
+
+// Actions lists every action, in the order they are documented.
+func Actions() []Action {
+	return []Action{ActionSetup, ActionUpdate, ActionTeardown, ActionPortForward, ActionSnapshot, ActionClone}
+}
+
+// Valid reports whether a is one of Actions.
+func (a Action) Valid() bool {
+	return slices.Contains(Actions(), a)
+}
+
+// UnmarshalJSON rejects unknown actions. An absent action is left empty for
+// validation to report.
+func (a *Action) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("action must be a string: %w", err)
+	}
+	if !Action(s).Valid() {
+		return fmt.Errorf("unknown action %q (valid: %v)", s, Actions())
+	}
+	*a = Action(s)
+	return nil
+}
@@ -0,0 +1,13 @@
+package models
+
+// CacheMount mounts a cache that outlives the run into a runner step, e.g.
+// {"key": "go-mod-${steps.checkout.outputs.commit}", "mount_path": "/go/pkg/mod"}.
+// Caches belong to the job; a new key starts empty, and the least recently used
+// are evicted once the job's caches outgrow the runner's RUNNER_CACHE_LIMIT.
+type CacheMount struct {
+	// Names the cache; may use ${steps.<name>.outputs.<key>}
+	Key string `json:"key"`
+
+	// Path inside the container where the cache is mounted
+	MountPath string `json:"mount_path"`
+}
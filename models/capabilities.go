@@ -0,0 +1,48 @@
+package models
+
+// PlatformCapabilities says which parts of the metadata a platform can honor, so
+// the agent can reject specs up front instead of the run failing late.
+type PlatformCapabilities struct {
+	Platform       string           `json:"platform"`
+	ScaleModes     []ScaleMode      `json:"scale_modes"`     // honored scale modes; others run a single instance
+	Strategies     []DeployStrategy `json:"strategies"`      // honored deploy strategies, the default first
+	Replicas       bool             `json:"replicas"`        // runs more than one instance of a service
+	HostPorts      bool             `json:"host_ports"`      // publishes on a host port other than the container port
+	HostIP         bool             `json:"host_ip"`         // binds published ports to one host address
+	NetworkGroups  bool             `json:"network_groups"`  // isolates services into network groups
+	Aliases        bool             `json:"aliases"`         // gives services extra DNS names
+	PrimaryNetwork bool             `json:"primary_network"` // routes through primary_network by default
+	Addressing     bool             `json:"addressing"`      // applies metadata.networks subnets and fixed endpoints
+	DNS            bool             `json:"dns"`             // applies dns, dns_search and dns_options
+	Hostnames      bool             `json:"hostnames"`       // applies hostname and domainname
+	PinHosts       bool             `json:"pin_hosts"`       // writes pin_hosts addresses into /etc/hosts
+	VolumeSources  bool             `json:"volume_sources"`  // fills new volumes from volume_sources
+	Healthchecks   bool             `json:"healthchecks"`    // gates on container healthchecks
+	GPU            bool             `json:"gpu"`             // attaches GPUs
+	Devices        bool             `json:"devices"`         // maps host devices
+	MemoryLimits   bool             `json:"memory_limits"`   // enforces memory
+	CPULimits      bool             `json:"cpu_limits"`      // enforces limits.cpus
+	PidsLimits     bool             `json:"pids_limits"`     // enforces limits.pids_limit
+	CPUPinning     bool             `json:"cpu_pinning"`     // pins to cpuset_cpus and cpuset_mems
+	MemoryTuning   bool             `json:"memory_tuning"`   // applies swap, swappiness and OOM settings
+	SharedMemory   bool             `json:"shared_memory"`   // applies shm_size and ipc
+	PIDNamespaces  bool             `json:"pid_namespaces"`  // applies pid
+	UsernsMode     bool             `json:"userns_mode"`     // applies userns_mode
+	Runtimes       bool             `json:"runtimes"`        // runs services under another OCI runtime
+	KernelCaps     bool             `json:"kernel_caps"`     // applies cap_add and cap_drop
+	GroupAdd       bool             `json:"group_add"`       // adds supplementary groups
+	CgroupParent   bool             `json:"cgroup_parent"`   // places containers under the job's cgroup_parent
+	Init           bool             `json:"init"`            // runs an init process as PID 1
+	StopSignals    bool             `json:"stop_signals"`    // stops services with their stop_signal
+	Restarts       bool             `json:"restarts"`        // applies restart
+	SecurityOpts   bool             `json:"security_opts"`   // applies security_opt
+	Privileged     bool             `json:"privileged"`      // runs privileged services
+	Checkpoints    bool             `json:"checkpoints"`     // restores checkpoint_on_update services across updates
+	RollingUpdates bool             `json:"rolling_updates"` // replaces instances without downtime
+	RunnerSteps    bool             `json:"runner_steps"`    // runs runner-role steps to completion
+	SSHKeys        bool             `json:"ssh_keys"`        // provisions a runner step's ssh block
+	Caches         bool             `json:"caches"`          // keeps runner step caches between runs
+	Files          bool             `json:"files"`           // writes files into containers
+	Placement      bool             `json:"placement"`       // spreads services across hosts
+	PullPolicies   bool             `json:"pull_policies"`   // applies if-not-present and never; every platform can pull always
+}
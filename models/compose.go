@@ -0,0 +1,8 @@
+package models
+
+// ComposeSource makes the runner build Metadata from a docker-compose file.
+// Exactly one of File and Content is set.
+type ComposeSource struct {
+	File    string `json:"file,omitempty"`    // path, relative to the configuration file
+	Content string `json:"content,omitempty"` // the compose YAML inline
+}
@@ -7,11 +7,68 @@ import (
 )
 
 type Configuration struct {
+	SchemaVersion int `json:"schema_version,omitempty"` // see services/schema; older shapes are migrated on load
+
 	Job          uuid.UUID        `json:"job"`                     // UUID
 	Run          uuid.UUID        `json:"run"`                     // UUID
+	Generation   int64            `json:"generation,omitempty"`    // order of the run among the job's; later runs are higher
 	Runner       string           `json:"runner"`                  // runner name/id
 	Platform     string           `json:"platform"`                // optional
 	PlatformData *json.RawMessage `json:"platform_data,omitempty"` // optional arbitrary JSON
-	Action       string           `json:"action"`                  // e.g. "setup"
+	Action       Action           `json:"action"`                  // setup | update | teardown | port-forward | snapshot | clone
 	Metadata     *Metadata        `json:"metadata,omitempty"`      // The metadata
+	MetadataRef  *MetadataRef     `json:"metadata_ref,omitempty"`  // instead of metadata: where to download it
+	Compose      *ComposeSource   `json:"compose,omitempty"`       // instead of metadata: a docker-compose file
+
+	// Values set over the metadata per environment, keyed by path, e.g.
+	// {"services.web.image": "app:1.4.2"} (see services/override)
+	Overrides map[string]json.RawMessage `json:"overrides,omitempty"`
+
+	// Optional per-phase deadlines, e.g. {"services": "10m", "connections": "30s"}
+	PhaseTimeouts map[string]string `json:"phase_timeouts,omitempty"`
+
+	// Tear the job down this long after the run succeeds (see `runner expire`);
+	// each later run with a ttl restarts the clock
+	TTL *Duration `json:"ttl,omitempty"`
+
+	// Only change the job inside one of these windows; outside them the run is
+	// deferred (status "deferred") and reports when the next one opens
+	DeployWindows []DeployWindow `json:"deploy_windows,omitempty"`
+
+	// Pre-created cgroup every container of the job is placed under, e.g.
+	// "/jobs/ci" or the systemd slice "ci.slice", so the operator's limits on it
+	// cap the job as a whole
+	CgroupParent string `json:"cgroup_parent,omitempty"`
+
+	// Remove everything this run created if it is cancelled (signal, timeout, agent abort)
+	RollbackOnCancel bool `json:"rollback_on_cancel,omitempty"`
+
+	// Lint rule severities, e.g. {"latest-tag": "error", "resource-limits": "off"}
+	LintRules map[string]string `json:"lint_rules,omitempty"`
+
+	// Upload the computed run plan to the agent before executing it
+	UploadPlan bool `json:"upload_plan,omitempty"`
+
+	// Push run metrics to a pushgateway or OTLP endpoint when the run finishes
+	Metrics *MetricsPush `json:"metrics,omitempty"`
+
+	// What action "port-forward" tunnels to
+	PortForward *PortForward `json:"port_forward,omitempty"`
+
+	// Snapshot bundle directory: action "snapshot" writes it (default
+	// <workspace>/snapshots/<run>), action "clone" deploys from it
+	Bundle string `json:"bundle,omitempty"`
+
+	// Directory for runner state and artifacts (defaults to DefaultWorkspace)
+	Workspace string `json:"workspace,omitempty"`
+}
+
+const DefaultWorkspace = "/run/workspace"
+
+// WorkspaceDir returns the configured workspace or DefaultWorkspace.
+func (c Configuration) WorkspaceDir() string {
+	if c.Workspace == "" {
+		return DefaultWorkspace
+	}
+	return c.Workspace
 }
@@ -19,8 +19,9 @@ type NetworkConnection struct {
 }
 
 type ResourceConnection struct {
-	Type ResourceConnectionType `json:"type"` // the connection type which can be Network or Platform
-	Data json.RawMessage        `json:"data"` // the data to marshal to NetworkConnection or platform sepcific setup
+	Type     ResourceConnectionType `json:"type"`               // the connection type which can be Network or Platform
+	Data     json.RawMessage        `json:"data"`               // the data to marshal to NetworkConnection or platform sepcific setup
+	Resource *uuid.UUID             `json:"resource,omitempty"` // the agent resource behind the connection, checked for readiness
 }
 
 type ResourceRef struct {
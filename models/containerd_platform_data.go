@@ -0,0 +1,8 @@
+package models
+
+// ContainerdPlatformData is Configuration.PlatformData for the containerd platform.
+type ContainerdPlatformData struct {
+	// Host directory holding per-job volumes and service logs
+	// (defaults to /var/lib/deploy-commander). The runner and containerd must both see it.
+	Root string `json:"root,omitempty"`
+}
@@ -7,4 +7,8 @@ type CreateResourceSpec struct {
 	Name             string            `json:"name"`
 	PublicConnection *PublicConnection `json:"public_connection,omitempty"`
 	Metadata         json.RawMessage   `json:"metadata"`
+
+	// Ports the resource serves on, advertised in its platform connection so
+	// firewalls can limit consumers to them
+	Ports []int `json:"ports,omitempty"`
 }
@@ -0,0 +1,11 @@
+package models
+
+// DeployStrategy says how an update replaces a service's running instance.
+type DeployStrategy string
+
+const (
+	StrategyRecreate  DeployStrategy = "recreate"   // stop the old instance, then start the new one
+	StrategyBlueGreen DeployStrategy = "blue-green" // start the new instance beside the old and swap once it is up
+	StrategyRolling   DeployStrategy = "rolling"    // replace replicas a few at a time, new before old
+	StrategyCanary    DeployStrategy = "canary"     // send part of the traffic to the new version first
+)
@@ -0,0 +1,11 @@
+package models
+
+// DeployWindow is a recurring span of time in which runs may change a job, e.g.
+// weekdays 09:00-17:00 in Europe/Berlin. A window that ends before it starts runs
+// past midnight into the next day.
+type DeployWindow struct {
+	Days     []string `json:"days,omitempty"`     // mon, tue, ... sun, or a range like "mon-fri"; every day when empty
+	Start    string   `json:"start"`              // "HH:MM"
+	End      string   `json:"end"`                // "HH:MM"; equal to start for the whole day
+	Timezone string   `json:"timezone,omitempty"` // IANA name, e.g. "Europe/Berlin"; UTC by default
+}
@@ -0,0 +1,12 @@
+package models
+
+// DeviceRequest asks the platform for devices such as GPUs, e.g.
+// {"driver": "nvidia", "count": 1, "capabilities": ["gpu"]}. Set either count
+// (-1 for every device) or device_ids.
+type DeviceRequest struct {
+	Driver       string            `json:"driver,omitempty"`
+	Count        int               `json:"count,omitempty"`
+	DeviceIDs    []string          `json:"device_ids,omitempty"`
+	Capabilities []string          `json:"capabilities,omitempty"` // all of these, e.g. ["gpu", "compute"]
+	Options      map[string]string `json:"options,omitempty"`      // passed to the driver
+}
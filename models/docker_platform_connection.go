@@ -4,4 +4,15 @@ type DockerPlatformConnection struct {
 	// Docker network name the resource container is attached to
 	// This is the *only* thing the runner truly needs to connect them
 	Network string `json:"network"`
+
+	// Ports consumers may reach on the network; empty when the resource declared none
+	Ports []int `json:"ports,omitempty"`
+}
+
+// ConnectionACL is one entry of the acl label the docker platform puts on a
+// service's containers: a connection network it joined and the ports it needs
+// there, for an external firewall controller to enforce.
+type ConnectionACL struct {
+	Network string `json:"network"`
+	Ports   []int  `json:"ports,omitempty"` // empty: not declared by the resource
 }
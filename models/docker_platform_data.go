@@ -0,0 +1,48 @@
+package models
+
+// DockerPlatformData is Configuration.PlatformData for the docker and swarm platforms.
+// The embedded DockerHost is the default daemon; unset fields fall back to the
+// DOCKER_* environment variables.
+type DockerPlatformData struct {
+	DockerHost
+
+	// More daemons, by name, that services can be placed on (docker only).
+	// The default daemon is named "default".
+	Hosts map[string]DockerHost `json:"hosts,omitempty"`
+
+	// Driver for the job's networks (default "bridge", or "overlay" on swarm)
+	NetworkDriver string `json:"network_driver,omitempty"`
+
+	// Prefix of the labels the runner puts on everything it creates (default
+	// "deploy-commander."). Changing it on a live job hides its existing objects from
+	// update and teardown.
+	LabelPrefix string `json:"label_prefix,omitempty"`
+
+	// Restart policy of long-running containers: always (default), unless-stopped,
+	// on-failure or no. A service's restart overrides it; runner steps never restart.
+	RestartPolicy string `json:"restart_policy,omitempty"`
+
+	// Directory on the docker hosts for checkpoint_on_update checkpoints, which
+	// must outlive the containers they were taken from
+	CheckpointDir string `json:"checkpoint_dir,omitempty"`
+
+	// Let services set pid "host", which shows them every process on the host
+	AllowHostPID bool `json:"allow_host_pid,omitempty"`
+}
+
+// DockerHost is how to reach one Docker daemon.
+type DockerHost struct {
+	// Daemon address: unix:///var/run/docker.sock, tcp://host:2376 or ssh://user@host[:port]
+	Host string `json:"host,omitempty"`
+
+	// Client TLS files for tcp:// hosts
+	TLSCACert string `json:"tls_ca_cert,omitempty"`
+	TLSCert   string `json:"tls_cert,omitempty"`
+	TLSKey    string `json:"tls_key,omitempty"`
+
+	// Pin the Engine API version (e.g. "1.47") instead of negotiating it
+	APIVersion string `json:"api_version,omitempty"`
+
+	// Labels that placement constraints match, e.g. {"region": "eu", "gpu": "true"}
+	Labels map[string]string `json:"labels,omitempty"`
+}
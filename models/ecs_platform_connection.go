@@ -0,0 +1,10 @@
+package models
+
+// ECSPlatformConnection is the platform connection of a resource on the ecs
+// platform. Services connecting to the resource join its security group.
+type ECSPlatformConnection struct {
+	SecurityGroup string `json:"security_group"`
+
+	// Cloud Map DNS name of the resource, when the platform has a namespace
+	Hostname string `json:"hostname,omitempty"`
+}
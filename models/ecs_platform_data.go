@@ -0,0 +1,36 @@
+package models
+
+// ECSPlatformData is Configuration.PlatformData for the ecs platform. Credentials
+// come from the usual AWS sources (environment, shared config, the EC2 instance role).
+type ECSPlatformData struct {
+	// AWS region (defaults to AWS_REGION / the shared config)
+	Region string `json:"region,omitempty"`
+
+	// ECS cluster the job's services and steps run in
+	Cluster string `json:"cluster"`
+
+	// FARGATE (default) or EC2
+	LaunchType string `json:"launch_type,omitempty"`
+
+	// VPC and subnets tasks are placed in; security groups are created in the VPC
+	VpcID          string   `json:"vpc_id"`
+	Subnets        []string `json:"subnets"`
+	AssignPublicIP bool     `json:"assign_public_ip,omitempty"`
+
+	// Extra security groups every task joins, e.g. one allowing egress to a database
+	SecurityGroups []string `json:"security_groups,omitempty"`
+
+	// IAM roles of the tasks: the execution role pulls images and writes logs
+	ExecutionRoleARN string `json:"execution_role_arn,omitempty"`
+	TaskRoleARN      string `json:"task_role_arn,omitempty"`
+
+	// Cloud Map namespace id resources are registered in (e.g. ns-abc123). Without
+	// it resources are reachable through their security group only, with no DNS name.
+	Namespace string `json:"namespace,omitempty"`
+
+	// CloudWatch log group for the awslogs driver; without it tasks do not log
+	LogGroup string `json:"log_group,omitempty"`
+
+	// Task CPU units (default "256"); task memory comes from each service's memory
+	CPU string `json:"cpu,omitempty"`
+}
@@ -0,0 +1,20 @@
+package models
+
+// FailurePolicy says what happens to a run when one service fails to set up,
+// including when it stalls past its progress_deadline.
+type FailurePolicy string
+
+const (
+	FailurePolicyAbort    FailurePolicy = "abort"    // fail the run, keeping what was deployed
+	FailurePolicyRollback FailurePolicy = "rollback" // fail the run and remove what it created
+	FailurePolicyContinue FailurePolicy = "continue" // warn, skip its dependents and deploy the rest
+	FailurePolicyIgnore   FailurePolicy = "ignore"   // warn and deploy the rest, dependents included; the job is ready without it
+)
+
+// FailurePolicy returns the service's on_failure, defaulting to abort.
+func (s MetadataService) FailurePolicy() FailurePolicy {
+	if s.OnFailure == nil {
+		return FailurePolicyAbort
+	}
+	return *s.OnFailure
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// Files are for small configs; swarm refuses configs past this size.
+const MaxFileSize = 500 << 10
+
+// FileMount writes a small file into the service's container, e.g.
+// {"path": "/etc/nginx/nginx.conf", "content": "events {}\n..."}, so configs
+// don't need a custom image. The file is owned by root and not meant to be
+// written to; on swarm and containerd it is read-only.
+type FileMount struct {
+	// Absolute path inside the container
+	Path string `json:"path"`
+
+	// Text of the file
+	Content string `json:"content,omitempty"`
+
+	// Or its bytes, base64-encoded, for binary files
+	ContentBase64 string `json:"content_base64,omitempty"`
+
+	// Octal permissions, e.g. "0755"; default "0644"
+	Mode string `json:"mode,omitempty"`
+}
+
+// Data returns the file's bytes.
+func (f FileMount) Data() ([]byte, error) {
+	if f.ContentBase64 == "" {
+		return []byte(f.Content), nil
+	}
+	if f.Content != "" {
+		return nil, fmt.Errorf("file %q sets both content and content_base64", f.Path)
+	}
+	b, err := base64.StdEncoding.DecodeString(f.ContentBase64)
+	if err != nil {
+		return nil, fmt.Errorf("file %q: invalid content_base64: %w", f.Path, err)
+	}
+	return b, nil
+}
+
+// FileMode returns the file's permissions.
+func (f FileMount) FileMode() (fs.FileMode, error) {
+	if strings.TrimSpace(f.Mode) == "" {
+		return 0o644, nil
+	}
+	m, err := strconv.ParseUint(strings.TrimSpace(f.Mode), 8, 32)
+	if err != nil || m > 0o777 {
+		return 0, fmt.Errorf("file %q: invalid mode %q (want octal permissions, e.g. \"0644\")", f.Path, f.Mode)
+	}
+	return fs.FileMode(m), nil
+}
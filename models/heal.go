@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServiceRestarts is how one of a job's long-running containers fares under its
+// restart policy, as sampled by `runner heal`.
+type ServiceRestarts struct {
+	Service   string `json:"service"`
+	Container string `json:"container"`
+	Host      string `json:"host,omitempty"`   // daemon it runs on
+	Restarts  int    `json:"restarts"`         // times the daemon restarted it
+	Health    string `json:"health,omitempty"` // starting | healthy | unhealthy, with a healthcheck
+}
+
+// ServiceHealthState is what `runner heal` reports to the agent about a service.
+type ServiceHealthState string
+
+const (
+	ServiceDegraded  ServiceHealthState = "degraded"  // still failing after being recreated
+	ServiceRecovered ServiceHealthState = "recovered" // stopped failing after being reported degraded
+)
+
+// ServiceHealthReport tells the agent a service kept failing despite its restart
+// policy and a fresh container, or that it recovered.
+type ServiceHealthReport struct {
+	Job       uuid.UUID          `json:"job"`
+	Service   string             `json:"service"`
+	Container string             `json:"container"`
+	State     ServiceHealthState `json:"state"`
+	Restarts  int                `json:"restarts"`         // restarts since the last check
+	Health    string             `json:"health,omitempty"` // at the last check
+	Since     time.Time          `json:"since"`            // when the service started failing
+}
@@ -0,0 +1,13 @@
+package models
+
+// Healthcheck tells the platform how to probe a service, in Docker's form. Test is
+// ["CMD", "curl", "-f", "http://localhost/"], ["CMD-SHELL", "curl -f localhost"]
+// or ["NONE"] to turn off the image's own healthcheck. Unset durations and retries
+// use the platform's defaults.
+type Healthcheck struct {
+	Test        []string  `json:"test"`
+	Interval    *Duration `json:"interval,omitempty"`
+	Timeout     *Duration `json:"timeout,omitempty"`
+	Retries     *int      `json:"retries,omitempty"`
+	StartPeriod *Duration `json:"start_period,omitempty"` // failures don't count while the service starts
+}
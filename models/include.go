@@ -0,0 +1,30 @@
+package models
+
+import "encoding/json"
+
+// Include is one entry of Metadata.Includes: a file, URL or agent path, written
+// as a plain string or, to pin what it may contain, as {"ref", "sha256"}.
+type Include struct {
+	Ref    string `json:"ref"`
+	SHA256 string `json:"sha256,omitempty"` // hex digest of the document; required under a metadata_ref
+}
+
+// UnmarshalJSON accepts the plain string form as well as the object.
+func (i *Include) UnmarshalJSON(b []byte) error {
+	var ref string
+	if err := json.Unmarshal(b, &ref); err == nil {
+		*i = Include{Ref: ref}
+		return nil
+	}
+	type plain Include
+	return json.Unmarshal(b, (*plain)(i))
+}
+
+// MarshalJSON writes an include without a digest in the plain string form.
+func (i Include) MarshalJSON() ([]byte, error) {
+	if i.SHA256 == "" {
+		return json.Marshal(i.Ref)
+	}
+	type plain Include
+	return json.Marshal(plain(i))
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobExpiry tells the agent a job's ttl ran out and the runner is tearing it down.
+type JobExpiry struct {
+	Job     uuid.UUID `json:"job"`
+	Run     uuid.UUID `json:"run"` // the teardown run
+	TTL     Duration  `json:"ttl"`
+	Expires time.Time `json:"expires"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// LogLimit caps how fast a service's log lines are forwarded to the agent.
+// Lines over the limit are dropped and counted; the runner's own output keeps them.
+type LogLimit struct {
+	LinesPerSecond float64 `json:"lines_per_second"`
+	Burst          int     `json:"burst,omitempty"` // lines allowed at once, defaults to lines_per_second
+}
+
+// LogLine is one line of service output.
+type LogLine struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"` // stdout | stderr
+	Line   string    `json:"line"`
+}
+
+// LogBatch is a group of log lines forwarded to the agent for one service.
+type LogBatch struct {
+	Service string    `json:"service"`
+	Lines   []LogLine `json:"lines,omitempty"`
+	Dropped int64     `json:"dropped,omitempty"` // lines dropped by the rate limit since the previous batch
+}
@@ -0,0 +1,9 @@
+package models
+
+// UserMessage is a user-facing message: a stable code the agent UI can translate,
+// the params to fill into it, and the English text.
+type UserMessage struct {
+	Code   string            `json:"code"`
+	Params map[string]string `json:"params,omitempty"`
+	Text   string            `json:"text"`
+}
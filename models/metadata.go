@@ -1,9 +1,23 @@
 package models
 
 type Metadata struct {
+	Includes       []Include                  `json:"includes,omitempty"` // files, URLs or agent paths merged underneath this document
 	Services       map[string]MetadataService `json:"services,omitempty"`
 	RemoveServices *[]string                  `json:"remove_services,omitempty"`
 	Volumes        *[]string                  `json:"volumes,omitempty"`
 	RemoveVolumes  *[]string                  `json:"remove_volumes,omitempty"`
 	Connections    *ConnectionPlan            `json:"connections,omitempty"`
+
+	// Addressing of network groups, keyed by group name
+	Networks map[string]NetworkSpec `json:"networks,omitempty"`
+
+	// Initial contents of declared volumes, keyed by volume name
+	VolumeSources map[string]VolumeSource `json:"volume_sources,omitempty"`
+
+	// Operator labels put on everything the job creates: containers, networks and
+	// volumes (tags on ECS). Keys may not use ReservedLabelPrefix.
+	Labels map[string]string `json:"labels,omitempty"`
 }
+
+// ReservedLabelPrefix starts the labels the runner itself sets.
+const ReservedLabelPrefix = "deploy-commander."
@@ -0,0 +1,9 @@
+package models
+
+// MetadataRef points at metadata stored outside the configuration, so very large
+// deployments don't have to be pushed inline. Exactly one of URL and Path is set.
+type MetadataRef struct {
+	URL    string `json:"url,omitempty"`  // http(s) URL
+	Path   string `json:"path,omitempty"` // agent path, e.g. /v1/jobs/{id}/metadata
+	SHA256 string `json:"sha256"`         // hex digest of the document, required
+}
@@ -1,5 +1,11 @@
 package models
 
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
 type ServiceRole string
 
 const (
@@ -7,19 +13,102 @@ const (
 	ServiceRoleRunner  ServiceRole = "runner"  // runner step / job-like
 )
 
+// ServiceRoles lists every role, the default first.
+func ServiceRoles() []ServiceRole {
+	return []ServiceRole{ServiceRoleService, ServiceRoleRunner}
+}
+
+// Valid reports whether r is one of ServiceRoles.
+func (r ServiceRole) Valid() bool {
+	return slices.Contains(ServiceRoles(), r)
+}
+
+// UnmarshalJSON rejects unknown roles.
+func (r *ServiceRole) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("role must be a string: %w", err)
+	}
+	if !ServiceRole(s).Valid() {
+		return fmt.Errorf("unknown role %q (valid: %v)", s, ServiceRoles())
+	}
+	*r = ServiceRole(s)
+	return nil
+}
+
+// ServiceNamespacePrefix starts an ipc or pid mode that joins another service's
+// namespace, e.g. "service:db". For ipc, that service must use "shareable".
+const ServiceNamespacePrefix = "service:"
+
 type MetadataService struct {
 	// Required
 	Image string `json:"image"`
 
+	// Image variant to run, os/arch[/variant] such as "linux/arm64", for hosts
+	// that emulate other architectures. Defaults to the host's platform.
+	Platform *string `json:"platform,omitempty"`
+
+	// When to pull the image: always, if-not-present (the default) or never
+	PullPolicy *PullPolicy `json:"pull_policy,omitempty"`
+
+	// Override the image's ENTRYPOINT and CMD, exec form, e.g. ["migrate", "up"].
+	// Setting entrypoint also clears the image's CMD, as with docker run.
+	Entrypoint *[]string `json:"entrypoint,omitempty"`
+	Command    *[]string `json:"command,omitempty"`
+
+	// Run as this user instead of the image's, e.g. "1000:1000" or "app"
+	User *string `json:"user,omitempty"`
+
+	// How to tell the service is healthy. Where the platform supports it, setup
+	// waits for the service to become healthy before its dependents start.
+	Healthcheck *Healthcheck `json:"healthcheck,omitempty"`
+
+	// Operator labels for this service's containers, over metadata.labels
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Absolute directory the process starts in instead of the image's WORKDIR,
+	// e.g. a volume's mount_path
+	WorkingDir *string `json:"working_dir,omitempty"`
+
+	// Hostname (and NIS domain name) the container sees instead of its id, for
+	// software licensed to a host name
+	Hostname   *string `json:"hostname,omitempty"`
+	Domainname *string `json:"domainname,omitempty"`
+
 	// Identity helpers
 	Aliases *[]string `json:"aliases,omitempty"`
 
 	// A network group used to isolate services
 	NetworkGroups *[]string `json:"network_groups,omitempty"`
 
+	// Fixed addresses on network groups, keyed by group name; the group needs
+	// subnets in metadata.networks
+	Endpoints map[string]Endpoint `json:"endpoints,omitempty"`
+
+	// The network group that supplies the default route when the service joins
+	// several networks; without it the platform picks one
+	PrimaryNetwork *string `json:"primary_network,omitempty"`
+
+	// Resolver settings, e.g. an internal nameserver: dns replaces the platform's
+	// nameservers, dns_search its search domains, dns_options are resolv.conf options
+	DNS        []string `json:"dns,omitempty"`
+	DNSSearch  []string `json:"dns_search,omitempty"`
+	DNSOptions []string `json:"dns_options,omitempty"`
+
+	// Services (in depends_on) whose current addresses are written into this
+	// service's /etc/hosts at start, for images that resolve names once at boot.
+	// The service is recreated when they get new addresses
+	PinHosts []string `json:"pin_hosts,omitempty"`
+
 	// runner | service
 	Role *ServiceRole `json:"role,omitempty"`
 
+	// Deploy key and known_hosts for a runner step that fetches over ssh
+	SSH *SSHKey `json:"ssh,omitempty"`
+
+	// Makes this a built-in git checkout step; image and command are the runner's
+	Source *SourceStep `json:"source,omitempty"`
+
 	// Dependency graph (keys reference other services)
 	DependsOn *[]string `json:"depends_on,omitempty"`
 
@@ -29,15 +118,139 @@ type MetadataService struct {
 	// Resource connections required by this service
 	Connections *[]ResourceConnection `json:"connections,omitempty"`
 
+	// Wait up to this long for the connected resources to be ready before starting, e.g. "2m"
+	ResourceReadyTimeout *Duration `json:"resource_ready_timeout,omitempty"`
+
 	// Resource(s) produced by this service
 	Resources *[]CreateResourceSpec `json:"resources,omitempty"`
 
-	// Environment variables
+	// Environment variables. A value of the form secret://<backend>/<path>#<key>
+	// (backend vault, aws-sm or file) is read from the runner's secret backend at
+	// deploy time (see services/secrets)
 	Environment map[string]string `json:"environment,omitempty"`
 
+	// Environment variables read from agent-managed secrets at setup, variable
+	// name -> secret name, e.g. {"DATABASE_URL": "orders-db-url"}. Only the names
+	// are kept in the metadata, labels and state
+	Secrets map[string]string `json:"secrets,omitempty"`
+
 	// Volumes to attach (string = named volume, null = runner volume)
 	Volumes *[]VolumeMount `json:"volumes,omitempty"`
 
+	// Caches kept across the job's runs, for a runner step's dependencies
+	Caches []CacheMount `json:"caches,omitempty"`
+
+	// Small files (configs) written into the container
+	Files []FileMount `json:"files,omitempty"`
+
+	// Which host the service runs on, for platforms with several
+	Placement *Placement `json:"placement,omitempty"`
+
 	// Scaling intent
 	Scale *ScaleSpec `json:"scale,omitempty"`
+
+	// When to restart the container after it exits; the platform's
+	// restart_policy by default. Runner steps never restart.
+	Restart *RestartPolicy `json:"restart,omitempty"`
+
+	// Signal that asks the service to stop, e.g. "SIGINT"; SIGTERM by default
+	StopSignal *string `json:"stop_signal,omitempty"`
+
+	// How long to wait after the stop signal before killing the container, e.g. "30s"
+	StopGracePeriod *Duration `json:"stop_grace_period,omitempty"`
+
+	// CPU, memory and process limits ("resources" already names what the
+	// service produces)
+	Limits *ResourceLimits `json:"limits,omitempty"`
+
+	// Memory limit, e.g. "512Mi"; the older spelling of limits.memory
+	Memory *ByteSize `json:"memory,omitempty"`
+
+	// Memory plus swap the service may use, at least memory (equal means no swap);
+	// needs memory
+	MemorySwap *ByteSize `json:"memory_swap,omitempty"`
+	// How readily the kernel swaps the service's pages out, 0-100
+	MemorySwappiness *int64 `json:"memory_swappiness,omitempty"`
+	// Bias for the OOM killer, -1000 (never pick) to 1000 (pick first)
+	OomScoreAdj *int `json:"oom_score_adj,omitempty"`
+	// Keep the OOM killer away from the service entirely; needs memory
+	OomKillDisable *bool `json:"oom_kill_disable,omitempty"`
+
+	// Pin the service to host CPUs and memory (NUMA) nodes, as cpuset lists,
+	// e.g. "2-3" and "0"
+	CpusetCpus *string `json:"cpuset_cpus,omitempty"`
+	CpusetMems *string `json:"cpuset_mems,omitempty"`
+
+	// Size of /dev/shm, e.g. "1Gi", for services that outgrow Docker's 64MB
+	ShmSize *ByteSize `json:"shm_size,omitempty"`
+	// IPC namespace: private, shareable, host, none, or service:<name>
+	Ipc *string `json:"ipc,omitempty"`
+
+	// PID namespace: host, or service:<name> to see that service's processes
+	// (e.g. a profiling sidecar). host must be allowed by the platform data.
+	Pid *string `json:"pid,omitempty"`
+
+	// User namespace: host runs the service in the host's user namespace even
+	// where the daemon remaps the others (e.g. inspection tools that need real
+	// host UIDs). Unset keeps the platform's default.
+	UsernsMode *string `json:"userns_mode,omitempty"`
+
+	// Run with every capability and the host's devices, e.g. for a Docker-in-Docker
+	// runner step. Refused unless the runner sets RUNNER_ALLOW_PRIVILEGED=true
+	Privileged *bool `json:"privileged,omitempty"`
+
+	// Run a minimal init (e.g. tini) as PID 1 that forwards signals and reaps
+	// zombies, for services that spawn child processes
+	Init *bool `json:"init,omitempty"`
+
+	// Linux capabilities to add to and drop from the runtime's default set, e.g.
+	// ["NET_ADMIN"]; drop ["ALL"] and add back what the service needs
+	CapAdd  []string `json:"cap_add,omitempty"`
+	CapDrop []string `json:"cap_drop,omitempty"`
+
+	// Supplementary groups for the service's processes, by name (from the
+	// image's /etc/group) or GID, e.g. ["docker"] or ["999"] to reach a host
+	// socket mounted into the container
+	GroupAdd []string `json:"group_add,omitempty"`
+
+	// Hardening options in Docker's syntax: "no-new-privileges",
+	// "seccomp=/etc/seccomp/strict.json" (a profile on the runner's host) or
+	// "seccomp=unconfined", "apparmor=<profile>" and "label=<selinux option>"
+	SecurityOpt []string `json:"security_opt,omitempty"`
+
+	// Experimental: when an update recreates the service, checkpoint its processes
+	// with CRIU and restore them into the new container, keeping in-memory state.
+	// Needs an experimental docker daemon with CRIU and the platform's
+	// checkpoint_dir; falls back to a fresh start if either step fails
+	CheckpointOnUpdate *bool `json:"checkpoint_on_update,omitempty"`
+
+	// OCI runtime to run the service under, e.g. "runsc" (gVisor) or "kata" to
+	// sandbox untrusted code; "default" or unset uses the daemon's default. The
+	// runner may require one for runner steps with RUNNER_STEP_RUNTIMES
+	Runtime *string `json:"runtime,omitempty"`
+
+	// Host devices to map into the container, host[:container][:permissions],
+	// e.g. "/dev/ttyUSB0" or "/dev/kvm:/dev/kvm:rw". Refused unless the runner
+	// allows the host path in RUNNER_ALLOW_DEVICES
+	Devices []string `json:"devices,omitempty"`
+
+	// Devices such as GPUs to attach
+	DeviceRequests []DeviceRequest `json:"device_requests,omitempty"`
+
+	// Rate limit for forwarding log lines to the agent
+	LogLimit *LogLimit `json:"log_limit,omitempty"`
+
+	// Expected upper bound for setting the service up, e.g. "2m" (exceeding it is a warning)
+	DeployBudget *Duration `json:"deploy_budget,omitempty"`
+
+	// Hard limit for the service to be up (running, and healthy with a
+	// healthcheck), e.g. "5m"; past it the service has stalled and fails
+	ProgressDeadline *Duration `json:"progress_deadline,omitempty"`
+
+	// What a failure to set the service up does to the run (default abort)
+	OnFailure *FailurePolicy `json:"on_failure,omitempty"`
+
+	// How an update replaces the running service; defaults to the platform's
+	// first strategy (see PlatformCapabilities.Strategies)
+	Strategy *DeployStrategy `json:"strategy,omitempty"`
 }
@@ -0,0 +1,18 @@
+package models
+
+// MetricsProtocol selects how run metrics are pushed on completion.
+type MetricsProtocol string
+
+const (
+	MetricsProtocolPushgateway MetricsProtocol = "pushgateway" // Prometheus pushgateway, text format
+	MetricsProtocolOTLP        MetricsProtocol = "otlp"        // OTLP over HTTP with JSON encoding
+)
+
+// MetricsPush is where a run pushes its metrics when it finishes. Runs are too
+// short-lived to be scraped, so they push instead.
+type MetricsPush struct {
+	Protocol MetricsProtocol   `json:"protocol"`          // pushgateway | otlp
+	URL      string            `json:"url"`               // pushgateway base URL or OTLP endpoint
+	Headers  map[string]string `json:"headers,omitempty"` // e.g. Authorization
+	Timeout  *Duration         `json:"timeout,omitempty"` // defaults to 10s
+}
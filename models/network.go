@@ -0,0 +1,23 @@
+package models
+
+// NetworkSpec is the addressing of a network group, for services that need fixed
+// addresses on it. Groups without one get whatever subnet the platform picks.
+type NetworkSpec struct {
+	Subnets []NetworkSubnet `json:"subnets"`
+}
+
+// NetworkSubnet is one address pool of a network, e.g. {"subnet": "10.40.0.0/24"}.
+type NetworkSubnet struct {
+	Subnet  string `json:"subnet"`             // CIDR, IPv4 or IPv6
+	Gateway string `json:"gateway,omitempty"`  // inside subnet
+	IPRange string `json:"ip_range,omitempty"` // CIDR inside subnet that dynamic addresses come from
+}
+
+// Endpoint fixes a service's addresses on one network group. The addresses must
+// be inside the group's subnets; keep them out of ip_range so dynamic addresses
+// never collide with them.
+type Endpoint struct {
+	IPv4Address  string   `json:"ipv4_address,omitempty"`
+	IPv6Address  string   `json:"ipv6_address,omitempty"`
+	LinkLocalIPs []string `json:"link_local_ips,omitempty"` // extra link-local addresses, e.g. "169.254.10.5"
+}
@@ -0,0 +1,9 @@
+package models
+
+// Placement says where a service runs when the platform has more than one host.
+// On docker it picks one of the daemons in platform_data; on swarm it becomes node
+// constraints (node.hostname and node.labels).
+type Placement struct {
+	Host   string            `json:"host,omitempty"`   // a host by name
+	Labels map[string]string `json:"labels,omitempty"` // or any host carrying all of these labels
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// PlanOperation is one step the runner intends to take, in execution order.
+type PlanOperation struct {
+	Seq    int             `json:"seq"`
+	Phase  string          `json:"phase"`
+	Op     string          `json:"op"`     // create_volume | setup_service | remove_service | remove_volume | create_connection | remove_connection | teardown
+	Target string          `json:"target"` // logical name (service, volume, resource id, job)
+	Inputs json.RawMessage `json:"inputs,omitempty"`
+}
+
+// Plan is the audit record of what a run was going to do, computed before execution.
+// Digest covers everything but Digest and Signature; Signature is an HMAC-SHA256
+// of the digest when a signing key is configured.
+type Plan struct {
+	Job        uuid.UUID       `json:"job"`
+	Run        uuid.UUID       `json:"run"`
+	Action     Action          `json:"action"`
+	Operations []PlanOperation `json:"operations"`
+	Digest     string          `json:"digest"`
+	Signature  string          `json:"signature,omitempty"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "strconv"
+
+// PortForward is what action "port-forward" tunnels: connections to Listen on the
+// runner host reach Port of Service over the job network, without publishing a
+// host port on the platform.
+type PortForward struct {
+	Service string `json:"service"`          // key in the job's metadata.services
+	Port    int    `json:"port"`             // container port
+	Listen  string `json:"listen,omitempty"` // local address, default 127.0.0.1:<port>
+
+	// Image with socat for the helper that joins the job network (default alpine/socat)
+	Image string `json:"image,omitempty"`
+}
+
+// ListenAddr returns Listen or the loopback address on the same port.
+func (f PortForward) ListenAddr() string {
+	if f.Listen == "" {
+		return "127.0.0.1:" + strconv.Itoa(f.Port)
+	}
+	return f.Listen
+}
@@ -0,0 +1,19 @@
+package models
+
+// PullPolicy says when a service's image is pulled rather than taken from the
+// host.
+type PullPolicy string
+
+const (
+	PullAlways       PullPolicy = "always"         // pull on every setup, for mutable tags such as :latest
+	PullIfNotPresent PullPolicy = "if-not-present" // pull only when the host lacks the image
+	PullNever        PullPolicy = "never"          // use the host's image; fail if it is missing
+)
+
+// ImagePullPolicy returns the service's pull_policy, defaulting to if-not-present.
+func (s MetadataService) ImagePullPolicy() PullPolicy {
+	if s.PullPolicy == nil {
+		return PullIfNotPresent
+	}
+	return *s.PullPolicy
+}
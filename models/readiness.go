@@ -0,0 +1,9 @@
+package models
+
+// JobReadiness is whether a job as a whole is ready after a run: every service up
+// (and healthy, when it has a healthcheck), every runner step succeeded and every
+// resource registered with the agent. Reasons lists what is not, one per line.
+type JobReadiness struct {
+	Ready   bool     `json:"ready"`
+	Reasons []string `json:"reasons,omitempty"`
+}
@@ -0,0 +1,7 @@
+package models
+
+// ResourceHealth is the agent's view of whether a resource can take connections.
+type ResourceHealth struct {
+	Ready   bool   `json:"ready"`
+	Message string `json:"message,omitempty"` // why it is not ready, if known
+}
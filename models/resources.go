@@ -0,0 +1,19 @@
+package models
+
+// ResourceLimits bounds what a service may use. Limits are enforced; the memory
+// reservation is a soft floor the host tries to keep available under pressure.
+type ResourceLimits struct {
+	Cpus              *float64  `json:"cpus,omitempty"`               // CPUs' worth of time, e.g. 0.5
+	Memory            *ByteSize `json:"memory,omitempty"`             // hard memory limit, e.g. "512Mi"
+	MemoryReservation *ByteSize `json:"memory_reservation,omitempty"` // at most memory
+	PidsLimit         *int64    `json:"pids_limit,omitempty"`         // processes and threads
+}
+
+// MemoryLimit returns the service's memory limit from limits.memory or, for
+// older metadata, memory.
+func (s MetadataService) MemoryLimit() *ByteSize {
+	if s.Limits != nil && s.Limits.Memory != nil {
+		return s.Limits.Memory
+	}
+	return s.Memory
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RestartPolicy says when a service's container is restarted after it exits: no,
+// always, unless-stopped, or on-failure with an optional retry limit, e.g.
+// "on-failure:5".
+type RestartPolicy string
+
+const (
+	RestartNo            RestartPolicy = "no"
+	RestartAlways        RestartPolicy = "always"
+	RestartUnlessStopped RestartPolicy = "unless-stopped" // like always, but not after an explicit stop
+	RestartOnFailure     RestartPolicy = "on-failure"     // only after a non-zero exit
+)
+
+// Mode splits the policy into its mode and the on-failure retry limit, 0 for
+// none.
+func (r RestartPolicy) Mode() (RestartPolicy, int, error) {
+	mode, limit, hasLimit := strings.Cut(string(r), ":")
+	switch RestartPolicy(mode) {
+	case RestartNo, RestartAlways, RestartUnlessStopped:
+		if hasLimit {
+			return "", 0, fmt.Errorf("restart %q takes no retry limit", mode)
+		}
+		return RestartPolicy(mode), 0, nil
+	case RestartOnFailure:
+		if !hasLimit {
+			return RestartOnFailure, 0, nil
+		}
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return "", 0, fmt.Errorf("invalid retry limit %q in restart %q", limit, r)
+		}
+		return RestartOnFailure, n, nil
+	}
+	return "", 0, fmt.Errorf("unknown restart %q (valid: no, always, unless-stopped, on-failure[:max])", r)
+}
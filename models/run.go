@@ -0,0 +1,90 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RunStatus string
+
+const (
+	RunStatusRunning         RunStatus = "running"
+	RunStatusSucceeded       RunStatus = "succeeded"
+	RunStatusFailed          RunStatus = "failed"
+	RunStatusCancelRequested RunStatus = "cancel_requested" // set by the agent to abort an in-flight run
+	RunStatusCancelled       RunStatus = "cancelled"
+	RunStatusDeferred        RunStatus = "deferred" // refused outside the deploy windows; retry at not_before
+)
+
+type Run struct {
+	ID     uuid.UUID `json:"id"`
+	Job    uuid.UUID `json:"job"`
+	Status RunStatus `json:"status"`
+
+	// Order of the run among the job's runs; later runs are higher
+	Generation int64 `json:"generation,omitempty"`
+}
+
+type RunStatusUpdate struct {
+	Status RunStatus `json:"status"`
+	Error  *string   `json:"error,omitempty"` // final error, if any
+	Cause  *string   `json:"cause,omitempty"` // cancellation cause: signal | timeout | agent abort
+
+	// When a deferred run may start, the opening of the next deploy window
+	NotBefore *time.Time `json:"not_before,omitempty"`
+
+	// Where the error happened: job, run, service, phase, op, target
+	ErrorContext map[string]string `json:"error_context,omitempty"`
+
+	// What to show the user, see services/messages
+	Message *UserMessage `json:"message,omitempty"`
+
+	Outcome  RunOutcome      `json:"outcome"`
+	Warnings []string        `json:"warnings,omitempty"`
+	Services []ServiceTiming `json:"services,omitempty"` // slowest first
+
+	Readiness *JobReadiness `json:"readiness,omitempty"`
+}
+
+// RunOutcome classifies how a run ended so the agent can pick retry, rollback, or ignore.
+type RunOutcome string
+
+const (
+	RunOutcomeSucceeded             RunOutcome = "succeeded"
+	RunOutcomeSucceededWithWarnings RunOutcome = "succeeded_with_warnings"
+	RunOutcomeFailedBeforeChanges   RunOutcome = "failed_before_changes" // safe to retry
+	RunOutcomeFailedPartial         RunOutcome = "failed_partial"        // some changes were applied
+)
+
+// RunResult is what a platform reports about a run besides its error.
+type RunResult struct {
+	Changed  bool     // the run modified platform or agent state
+	Warnings []string // non-fatal problems worth surfacing
+
+	Services []ServiceTiming // setup time per service, slowest first
+
+	Readiness *JobReadiness // set after a successful deploy, when the platform can report status
+}
+
+// ServiceTiming is how long one service took to set up, against its deploy_budget.
+type ServiceTiming struct {
+	Service    string    `json:"service"`
+	Duration   Duration  `json:"duration"`
+	Budget     *Duration `json:"budget,omitempty"`
+	OverBudget bool      `json:"over_budget,omitempty"`
+}
+
+// Outcome classifies the run given its final error.
+func (r RunResult) Outcome(err error) RunOutcome {
+	switch {
+	case err != nil && r.Changed:
+		return RunOutcomeFailedPartial
+	case err != nil:
+		return RunOutcomeFailedBeforeChanges
+	case len(r.Warnings) > 0:
+		return RunOutcomeSucceededWithWarnings
+	default:
+		return RunOutcomeSucceeded
+	}
+}
@@ -0,0 +1,8 @@
+package models
+
+// SecretValue is an agent-managed secret, as returned for a job that references
+// it in a service's secrets.
+type SecretValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SnapshotManifest describes a bundle written by action "snapshot": the job's
+// resolved metadata with every service image pinned to the digest it was running,
+// and an archive of each volume. Action "clone" deploys it under another job.
+type SnapshotManifest struct {
+	Job      uuid.UUID `json:"job"`      // job that was captured
+	Run      uuid.UUID `json:"run"`      // the snapshot run
+	Platform string    `json:"platform"` // platform the job ran on
+	Created  time.Time `json:"created"`
+
+	Metadata Metadata          `json:"metadata"`         // images already pinned
+	Images   map[string]string `json:"images,omitempty"` // service -> image as configured, for the ones pinned
+
+	Volumes []SnapshotVolume `json:"volumes,omitempty"`
+}
+
+// SnapshotVolume is one volume archive in a snapshot bundle.
+type SnapshotVolume struct {
+	Name string `json:"name"` // key in metadata.volumes
+	File string `json:"file"` // tar archive, relative to the bundle
+	Size int64  `json:"size"` // bytes
+}
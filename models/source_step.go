@@ -0,0 +1,24 @@
+package models
+
+// SourceStep makes a runner step a built-in git checkout into the runner volume,
+// e.g. {"repo": "git@github.com:acme/app.git", "ref": "v1.4.0", "depth": 1}.
+// The runner supplies the image and command; pair it with ssh for private
+// repositories. Later steps find the checkout at ${steps.<name>.outputs.path}
+// and its commit at ${steps.<name>.outputs.commit}.
+type SourceStep struct {
+	// Repository URL: https://..., ssh://... or scp-like git@host:path
+	Repo string `json:"repo"`
+
+	// Branch, tag or full commit id; the remote's default branch when unset
+	Ref string `json:"ref,omitempty"`
+
+	// Fetch only this many commits (submodules too); 0 fetches the full history
+	Depth int `json:"depth,omitempty"`
+
+	// Check out submodules, recursively
+	Submodules bool `json:"submodules,omitempty"`
+
+	// Directory in the runner volume to check out into, replaced on every run;
+	// source/<step> when unset
+	Path string `json:"path,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// SSHKey gives a runner step git/ssh access with a deploy key, e.g.
+// {"key": "secret://vault/ci/deploy#key", "known_hosts": "github.com ssh-ed25519 AAAA..."}.
+// Both are written into the step's container, owned by its user, and removed
+// with it; GIT_SSH_COMMAND points git at them.
+type SSHKey struct {
+	// Private key (OpenSSH or PEM), normally a secret:// reference
+	Key string `json:"key"`
+
+	// known_hosts lines for the hosts the step connects to. Host keys are always
+	// checked, so connections to hosts not listed fail
+	KnownHosts string `json:"known_hosts"`
+}
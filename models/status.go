@@ -0,0 +1,13 @@
+package models
+
+// ServiceStatus is the live state of one deployed service container.
+type ServiceStatus struct {
+	Service   string `json:"service"`
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	State     string `json:"state"`            // created | running | exited | ...
+	Status    string `json:"status"`           // human readable, e.g. "Up 3 hours"
+	Health    string `json:"health,omitempty"` // starting | healthy | unhealthy, with a healthcheck
+	Run       string `json:"run"`              // run that last applied it
+	Host      string `json:"host,omitempty"`   // daemon it runs on, when the platform has several
+}
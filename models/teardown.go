@@ -0,0 +1,28 @@
+package models
+
+import "github.com/google/uuid"
+
+type TeardownFailure struct {
+	Kind  string `json:"kind"` // container | service | config | volume | network | connection | resource
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// TeardownSummary is what a teardown removed and what it could not.
+// It is sent to the agent so it can mark the job undeployed.
+type TeardownSummary struct {
+	Job         uuid.UUID         `json:"job"`
+	Containers  []string          `json:"containers"`
+	Services    []string          `json:"services,omitempty"` // swarm services
+	Volumes     []string          `json:"volumes"`
+	Networks    []string          `json:"networks"`
+	Connections []uuid.UUID       `json:"connections"`
+	Resources   []string          `json:"resources"`
+	Failures    []TeardownFailure `json:"failures,omitempty"`
+}
+
+// Fail records a failure and returns err so callers can collect it.
+func (s *TeardownSummary) Fail(kind, name string, err error) error {
+	s.Failures = append(s.Failures, TeardownFailure{Kind: kind, Name: name, Error: err.Error()})
+	return err
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration written as a Go duration string in JSON, e.g. "30s" or "1m30s".
+// Bare numbers are rejected so nobody has to guess the unit.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\", got %s", b)
+	}
+	v, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	if v < 0 {
+		return fmt.Errorf("duration %q must not be negative", s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ByteSize is a size in bytes written with an explicit unit in JSON, e.g. "512Mi" or "1G".
+// Binary (Ki, Mi, Gi, Ti) and decimal (k, M, G, T) suffixes are accepted, plus "B" for bytes.
+// Bare numbers are rejected so nobody has to guess the unit.
+type ByteSize int64
+
+var byteSizeUnits = map[string]int64{
+	"B":  1,
+	"k":  1000,
+	"K":  1000,
+	"M":  1000 * 1000,
+	"G":  1000 * 1000 * 1000,
+	"T":  1000 * 1000 * 1000 * 1000,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+}
+
+// ParseByteSize parses a size like "512Mi".
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i <= 0 {
+		return 0, fmt.Errorf("invalid size %q (want a number and a unit, e.g. \"512Mi\")", s)
+	}
+
+	num, unit := s[:i], s[i:]
+	mult, ok := byteSizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q (valid: B, k, M, G, T, Ki, Mi, Gi, Ti)", s, unit)
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	bytes := n * float64(mult)
+	// float64(math.MaxInt64) rounds up to 2^63, which is already out of range.
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: out of range", s)
+	}
+	if bytes != float64(int64(bytes)) {
+		return 0, fmt.Errorf("invalid size %q: not a whole number of bytes", s)
+	}
+	return ByteSize(bytes), nil
+}
+
+func (b ByteSize) String() string {
+	for _, u := range []string{"Ti", "Gi", "Mi", "Ki"} {
+		if m := byteSizeUnits[u]; b != 0 && int64(b)%m == 0 {
+			return fmt.Sprintf("%d%s", int64(b)/m, u)
+		}
+	}
+	return fmt.Sprintf("%dB", int64(b))
+}
+
+func (b ByteSize) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.String())
+}
+
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("size must be a string like \"512Mi\", got %s", data)
+	}
+	v, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want ByteSize
+		err  string
+	}{
+		{in: "512Mi", want: 512 << 20},
+		{in: "1.5k", want: 1500},
+		{in: "8388607Ti", want: 8388607 << 40},
+		{in: "8388608Ti", err: "out of range"},
+		{in: "9999999999T", err: "out of range"},
+		{in: "1.5B", err: "not a whole number"},
+		{in: "512", err: "want a number and a unit"},
+	} {
+		got, err := ParseByteSize(tc.in)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("ParseByteSize(%q) = %d, %v; want an error about %s", tc.in, got, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ParseByteSize(%q) = %d, %v; want %d", tc.in, got, err, tc.want)
+		}
+	}
+}
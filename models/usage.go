@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ContainerSpan is when one of a job's containers last ran. Finished is zero
+// while it still runs.
+type ContainerSpan struct {
+	Started  time.Time
+	Finished time.Time
+}
+
+// UsageSample is what a platform measures of a job at one moment.
+type UsageSample struct {
+	Containers  []ContainerSpan
+	ImageBytes  int64 // images the job's containers run, each counted once
+	VolumeBytes int64
+}
+
+// JobUsage is what a job has used, reported to the agent for chargeback. Runtime
+// accumulates across runs and samples; storage is as of the last sample.
+type JobUsage struct {
+	Job            uuid.UUID `json:"job"`
+	Platform       string    `json:"platform"`
+	RuntimeSeconds float64   `json:"runtime_seconds"` // container seconds, summed over services and replicas
+	ImageBytes     int64     `json:"image_bytes"`
+	VolumeBytes    int64     `json:"volume_bytes"`
+	Since          time.Time `json:"since"`   // first sample
+	Sampled        time.Time `json:"sampled"` // last sample
+}
+
+// Add accumulates a sample taken at now: the time each container ran since the
+// last sample, and the storage the job holds now. Containers that came and went
+// between two samples are not seen, which is why runs sample before they replace
+// or remove any.
+func (u *JobUsage) Add(s UsageSample, now time.Time) {
+	for _, c := range s.Containers {
+		from, to := c.Started, c.Finished
+		if to.IsZero() || to.After(now) {
+			to = now
+		}
+		if from.Before(u.Sampled) {
+			from = u.Sampled
+		}
+		if to.After(from) {
+			u.RuntimeSeconds += to.Sub(from).Seconds()
+		}
+	}
+	u.ImageBytes = s.ImageBytes
+	u.VolumeBytes = s.VolumeBytes
+	if u.Since.IsZero() {
+		u.Since = now
+	}
+	u.Sampled = now
+}
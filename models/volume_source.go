@@ -0,0 +1,14 @@
+package models
+
+// VolumeSource fills a volume from a directory of an image when the volume is
+// first created, e.g. {"image": "registry/app-config:3", "path": "/config"}. A
+// portable alternative to bind-mounting files from the host. Existing volumes
+// are left as they are.
+type VolumeSource struct {
+	Image string `json:"image"`
+	Path  string `json:"path"` // absolute directory in the image
+
+	// Expected checksum of the copied tree ("sha256:<hex>", see services/checksum);
+	// a volume that doesn't match is removed again and the run fails
+	Checksum string `json:"checksum,omitempty"`
+}
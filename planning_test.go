@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/noop"
+	"github.com/ezenkico/deploy-commander/runner/services/plan"
+	"github.com/ezenkico/deploy-commander/runner/services/schema"
+	"github.com/ezenkico/deploy-commander/runner/services/validate"
+)
+
+// largeConfiguration generates a setup of n services as configuration JSON,
+// shaped like a big job: every service has environment, a port, a volume and
+// network groups, and most depend on the previous one, so launch order takes
+// many passes. Version 1 documents use string volumes and leave schema_version
+// out.
+func largeConfiguration(n, version int) []byte {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	if version > 1 {
+		fmt.Fprintf(&b, `"schema_version":%d,`, version)
+	}
+	b.WriteString(`"job":"5b6f0d1e-7d3a-4f0e-9a53-2c2f2f1f6a11","run":"7b6f0d1e-7d3a-4f0e-9a53-2c2f2f1f6a11","platform":"noop","action":"setup","metadata":{"volumes":[`)
+	for i := range n {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `"data-%05d"`, i)
+	}
+	b.WriteString(`],"services":{`)
+	for i := range n {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `"svc-%05d":{"image":"registry.example.com/app/svc-%05d:1.0.%d","environment":{"SERVICE":"svc-%05d","LOG_LEVEL":"info","UPSTREAM":"svc-%05d:8080"},`, i, i, i, i, (i+1)%n)
+		volume := fmt.Sprintf(`{"name":"data-%05d","mount_path":"/data"}`, i)
+		if version == 1 {
+			volume = fmt.Sprintf(`"data-%05d:/data"`, i)
+		}
+		fmt.Fprintf(&b, `"bindings":[{"container_port":8080}],"volumes":[%s],"network_groups":["app","group-%d"]`, volume, i%10)
+		if i%10 != 0 {
+			fmt.Fprintf(&b, `,"depends_on":["svc-%05d"]`, i-1)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString(`}}}`)
+	return b.Bytes()
+}
+
+func largeConfig(tb testing.TB, n int) models.Configuration {
+	tb.Helper()
+	var cfg models.Configuration
+	if err := json.Unmarshal(largeConfiguration(n, schema.Current), &cfg); err != nil {
+		tb.Fatal(err)
+	}
+	return cfg
+}
+
+const benchmarkServices = 500
+
+func BenchmarkValidateConfiguration(b *testing.B) {
+	cfg := largeConfig(b, benchmarkServices)
+	for b.Loop() {
+		if validate.HasErrors(validate.Configuration(cfg)) {
+			b.Fatal("generated configuration is invalid")
+		}
+	}
+}
+
+func BenchmarkLint(b *testing.B) {
+	cfg := largeConfig(b, benchmarkServices)
+	for b.Loop() {
+		if _, err := validate.Lint(cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCheckCapabilities(b *testing.B) {
+	cfg := largeConfig(b, benchmarkServices)
+	caps := noop.NewNoopPlatform(nil).Capabilities()
+	for b.Loop() {
+		validate.Capabilities(cfg, caps)
+	}
+}
+
+func BenchmarkServiceOrder(b *testing.B) {
+	cfg := largeConfig(b, benchmarkServices)
+	for b.Loop() {
+		if _, err := plan.ServiceOrder(cfg.Metadata.Services); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPlanBuild(b *testing.B) {
+	cfg := largeConfig(b, benchmarkServices)
+	for b.Loop() {
+		if _, err := plan.Build(cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestLargeConfigurationPlans(t *testing.T) {
+	cfg := largeConfig(t, benchmarkServices)
+	for _, f := range validate.Configuration(cfg) {
+		if f.Severity == validate.SeverityError {
+			t.Errorf("generated configuration: %s", f)
+		}
+	}
+	order, err := plan.ServiceOrder(cfg.Metadata.Services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != benchmarkServices {
+		t.Fatalf("ordered %d services, want %d", len(order), benchmarkServices)
+	}
+	pos := make(map[string]int, len(order))
+	for i, name := range order {
+		pos[name] = i
+	}
+	for name, svc := range cfg.Metadata.Services {
+		if svc.DependsOn == nil {
+			continue
+		}
+		for _, dep := range *svc.DependsOn {
+			if pos[dep] > pos[name] {
+				t.Errorf("%s is ordered before its dependency %s", name, dep)
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+// Platforms compiled into the runner. Each registers itself with services/platforms;
+// add a blank import here to build in another (including out-of-tree) platform.
+import (
+	_ "github.com/ezenkico/deploy-commander/runner/services/containerd"
+	_ "github.com/ezenkico/deploy-commander/runner/services/docker"
+	_ "github.com/ezenkico/deploy-commander/runner/services/ecs"
+	_ "github.com/ezenkico/deploy-commander/runner/services/noop"
+)
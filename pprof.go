@@ -0,0 +1,25 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	_ "net/http/pprof" // registers /debug/pprof/ on http.DefaultServeMux
+	"os"
+	"strings"
+)
+
+// startProfiling serves the pprof endpoints on RUNNER_PPROF_ADDR (e.g. "127.0.0.1:6060").
+// It is off unless the variable is set.
+func startProfiling() {
+	addr := strings.TrimSpace(os.Getenv("RUNNER_PPROF_ADDR"))
+	if addr == "" {
+		return
+	}
+
+	go func() {
+		log.Printf("pprof listening on http://%s/debug/pprof/", addr)
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			log.Printf("pprof server: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// checkPrivileged refuses metadata with privileged services unless whoever runs
+// the runner allowed them with RUNNER_ALLOW_PRIVILEGED=true. The setting is the
+// runner's, not the job's, since a privileged container owns its host.
+func checkPrivileged(cfg models.Configuration) error {
+	if cfg.Metadata == nil {
+		return nil
+	}
+	var privileged []string
+	for _, name := range slices.Sorted(maps.Keys(cfg.Metadata.Services)) {
+		if p := cfg.Metadata.Services[name].Privileged; p != nil && *p {
+			privileged = append(privileged, name)
+		}
+	}
+	if len(privileged) == 0 {
+		return nil
+	}
+	if allowed, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv("RUNNER_ALLOW_PRIVILEGED"))); !allowed {
+		return fmt.Errorf("service(s) %s are privileged; set RUNNER_ALLOW_PRIVILEGED=true on the runner to allow it", strings.Join(privileged, ", "))
+	}
+	return nil
+}
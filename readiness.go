@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+
+	"github.com/ezenkico/deploy-commander/runner/interfaces"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/readiness"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+)
+
+// Actions that leave a job deployed, so its readiness means something.
+var deployActions = []models.Action{models.ActionSetup, models.ActionUpdate, models.ActionClone}
+
+// checkReadiness works out whether the job a run deployed is ready as a whole, so
+// the agent and callers don't have to infer it from service states. It returns
+// nil for other actions and for platforms that cannot report status.
+func checkReadiness(ctx context.Context, p interfaces.Platform, comm *agent.AgentCommunication, cfg models.Configuration) *models.JobReadiness {
+	if !slices.Contains(deployActions, cfg.Action) {
+		return nil
+	}
+	inspector, ok := p.(interfaces.Inspector)
+	if !ok {
+		return nil
+	}
+	statuses, err := inspector.Status(runerr.WithRun(ctx, cfg.Job, cfg.Run), cfg.Job)
+	if err != nil {
+		// The run itself succeeded; an unknown readiness is reported as such.
+		log.Printf("check readiness: %v", err)
+		return &models.JobReadiness{Reasons: []string{"status unavailable: " + err.Error()}}
+	}
+	pending := 0
+	if comm != nil {
+		pending = comm.Outbox.Queued()
+	}
+	r := readiness.Job(cfg.Metadata, statuses, pending)
+	return &r
+}
@@ -1,16 +1,25 @@
 package agent
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/events"
+	"github.com/google/uuid"
 )
 
 type AgentCommunication struct {
@@ -22,9 +31,35 @@ type AgentCommunication struct {
 	BaseURL    string
 
 	Token string // bearer token
+
+	// RunID is sent as X-Run-ID on every request so agent logs can be correlated with the run
+	RunID uuid.UUID
+
+	// Outbox, when set, keeps resource, connection and run status writes that still
+	// fail after retries so they can be replayed later (see DrainOutbox)
+	Outbox *Outbox
+
+	// CacheTTL controls how long GetResource/GetConnection responses are reused (0 disables caching)
+	CacheTTL time.Duration
+
+	// Compress gzips request bodies of at least compressThreshold bytes. Only
+	// agents that accept Content-Encoding: gzip can take them, so it is opt-in
+	// (AGENT_COMPRESS).
+	Compress bool
+
+	resourceCache   *ttlCache[models.Resource]
+	connectionCache *ttlCache[models.Connection]
+
+	clientOnce sync.Once
+	client     *http.Client
+	clientErr  error
 }
 
-// NewAgentCommunicationFromEnv loads and parses AGENT_ENDPOINT.
+// Request bodies at least this large are sent gzip-compressed.
+const compressThreshold = 8 << 10
+
+// NewAgentCommunicationFromEnv loads and parses AGENT_ENDPOINT. AGENT_COMPRESS
+// set to true turns on request compression.
 func NewAgentCommunicationFromEnv() (*AgentCommunication, error) {
 	endpoint := strings.TrimSpace(os.Getenv("AGENT_ENDPOINT"))
 	if endpoint == "" {
@@ -42,6 +77,15 @@ func NewAgentCommunicationFromEnv() (*AgentCommunication, error) {
 	}
 
 	ac.Token = token
+
+	if v := strings.TrimSpace(os.Getenv("AGENT_COMPRESS")); v != "" {
+		// Callers drop the agent on error, which a typo here doesn't deserve.
+		compress, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Printf("invalid AGENT_COMPRESS %q, not compressing: %v", v, err)
+		}
+		ac.Compress = compress
+	}
 	return ac, nil
 }
 
@@ -55,7 +99,12 @@ func NewAgentCommunication(endpoint string) (*AgentCommunication, error) {
 		return nil, fmt.Errorf("invalid AGENT_ENDPOINT %q: %w", endpoint, err)
 	}
 
-	ac := &AgentCommunication{Endpoint: endpoint}
+	ac := &AgentCommunication{
+		Endpoint:        endpoint,
+		CacheTTL:        defaultCacheTTL,
+		resourceCache:   newTTLCache[models.Resource](),
+		connectionCache: newTTLCache[models.Connection](),
+	}
 
 	switch strings.ToLower(u.Scheme) {
 	case "unix":
@@ -87,35 +136,57 @@ func NewAgentCommunication(endpoint string) (*AgentCommunication, error) {
 }
 
 // Client returns an *http.Client configured to talk to the agent over tcp or unix,
-// plus the BaseURL to use for requests.
+// plus the BaseURL to use for requests. The client is built once and reused so
+// keep-alive connections are shared across calls.
 func (a *AgentCommunication) Client() (*http.Client, string, error) {
+	a.clientOnce.Do(func() {
+		a.client, a.clientErr = a.newClient()
+	})
+	if a.clientErr != nil {
+		return nil, "", a.clientErr
+	}
+	return a.client, a.BaseURL, nil
+}
+
+func (a *AgentCommunication) newClient() (*http.Client, error) {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	// The runner talks to a single agent, so keep a few idle connections around
+	// and let Go negotiate gzip responses (DisableCompression stays false).
+	tr := &http.Transport{
+		MaxIdleConns:          8,
+		MaxIdleConnsPerHost:   8,
+		IdleConnTimeout:       90 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
 	switch a.Type {
 	case "tcp":
 		// Plain HTTP over TCP. (If you later want TLS, you can switch BaseURL to https://
 		// and configure TLS settings on the Transport.)
-		return &http.Client{
-			Timeout: 60 * time.Second,
-		}, a.BaseURL, nil
+		tr.DialContext = dialer.DialContext
+		tr.ForceAttemptHTTP2 = true
 
 	case "unix":
 		// HTTP over Unix domain socket via custom DialContext.
-		dialer := &net.Dialer{Timeout: 10 * time.Second}
-
-		tr := &http.Transport{
-			// IMPORTANT: ignore the addr and always dial the unix socket path
-			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				return dialer.DialContext(ctx, "unix", a.SocketPath)
-			},
+		// IMPORTANT: ignore the addr and always dial the unix socket path
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", a.SocketPath)
 		}
 
-		return &http.Client{
-			Transport: tr,
-			Timeout:   60 * time.Second,
-		}, a.BaseURL, nil
-
 	default:
-		return nil, "", fmt.Errorf("invalid agent communication type %q", a.Type)
+		return nil, fmt.Errorf("invalid agent communication type %q", a.Type)
 	}
+
+	// Writes are recorded in the run's event log.
+	return &http.Client{
+		Transport: events.Transport("agent", tr),
+		Timeout:   60 * time.Second,
+	}, nil
 }
 
 func (a *AgentCommunication) NewRequest(
@@ -125,6 +196,29 @@ func (a *AgentCommunication) NewRequest(
 	body io.Reader,
 ) (*http.Request, error) {
 
+	// Large payloads (logs, run results) are gzip-compressed when the agent
+	// accepts it.
+	gzipped := false
+	if body != nil && a.Compress {
+		b, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) >= compressThreshold {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			if _, err := zw.Write(b); err != nil {
+				return nil, err
+			}
+			if err := zw.Close(); err != nil {
+				return nil, err
+			}
+			b = buf.Bytes()
+			gzipped = true
+		}
+		body = bytes.NewReader(b)
+	}
+
 	req, err := http.NewRequestWithContext(
 		ctx,
 		method,
@@ -137,6 +231,26 @@ func (a *AgentCommunication) NewRequest(
 
 	req.Header.Set("Authorization", "Bearer "+a.Token)
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", uuid.NewString())
+	if a.RunID != uuid.Nil {
+		req.Header.Set("X-Run-ID", a.RunID.String())
+	}
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 
 	return req, nil
 }
+
+// responseError builds the error for an unexpected agent response. It includes the
+// request id (as echoed by the agent, or the one we sent) so both sides' logs line up.
+func responseError(op string, resp *http.Response) error {
+	b, _ := io.ReadAll(resp.Body)
+
+	id := resp.Header.Get("X-Request-ID")
+	if id == "" && resp.Request != nil {
+		id = resp.Request.Header.Get("X-Request-ID")
+	}
+
+	return &StatusError{Op: op, Code: resp.StatusCode, RequestID: id, Body: string(b)}
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/google/uuid"
+)
+
+// newTestServer serves one resource for any GET and accepts any write. It
+// returns the endpoint and the resource's id.
+func newTestServer(tb testing.TB) (string, uuid.UUID) {
+	tb.Helper()
+	id := uuid.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(models.Resource{ID: id})
+	}))
+	tb.Cleanup(srv.Close)
+	return "tcp://" + strings.TrimPrefix(srv.URL, "http://"), id
+}
+
+func newTestAgent(tb testing.TB, endpoint string) *AgentCommunication {
+	tb.Helper()
+	a, err := NewAgentCommunication(endpoint)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	a.Token = "test"
+	return a
+}
+
+func benchmarkGetResource(b *testing.B, ttl time.Duration) {
+	endpoint, id := newTestServer(b)
+	a := newTestAgent(b, endpoint)
+	a.CacheTTL = ttl
+	ctx := context.Background()
+	for b.Loop() {
+		if _, err := a.GetResource(ctx, id); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetResourceCached(b *testing.B) { benchmarkGetResource(b, defaultCacheTTL) }
+
+func BenchmarkGetResourceUncached(b *testing.B) { benchmarkGetResource(b, 0) }
+
+// BenchmarkGetResourceNewClient builds a client per call, as the runner did
+// before the transport was shared, so every request dials the agent.
+func BenchmarkGetResourceNewClient(b *testing.B) {
+	endpoint, id := newTestServer(b)
+	ctx := context.Background()
+	for b.Loop() {
+		a := newTestAgent(b, endpoint)
+		a.CacheTTL = 0
+		if _, err := a.GetResource(ctx, id); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkNewRequest measures building requests around compressThreshold,
+// with and without compression.
+func BenchmarkNewRequest(b *testing.B) {
+	endpoint, _ := newTestServer(b)
+	a := newTestAgent(b, endpoint)
+	ctx := context.Background()
+	for _, compress := range []bool{false, true} {
+		for _, size := range []int{compressThreshold / 2, compressThreshold - 1, compressThreshold, 8 * compressThreshold} {
+			body := bytes.Repeat([]byte(`{"line":"building service"}`+"\n"), size/28+1)[:size]
+			name := fmt.Sprintf("compress=%t/size=%d", compress, size)
+			b.Run(name, func(b *testing.B) {
+				a.Compress = compress
+				b.SetBytes(int64(size))
+				for b.Loop() {
+					if _, err := a.NewRequest(ctx, http.MethodPost, "/v1/logs", bytes.NewReader(body)); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestNewRequestCompressesOnlyWhenEnabled(t *testing.T) {
+	endpoint, _ := newTestServer(t)
+	a := newTestAgent(t, endpoint)
+	body := bytes.Repeat([]byte("x"), compressThreshold)
+	for _, compress := range []bool{false, true} {
+		a.Compress = compress
+		req, err := a.NewRequest(context.Background(), http.MethodPost, "/v1/logs", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get("Content-Encoding") == "gzip"; got != compress {
+			t.Errorf("Compress=%t: gzip encoding %t", compress, got)
+		}
+	}
+
+	a.Compress = true
+	req, err := a.NewRequest(context.Background(), http.MethodPost, "/v1/logs", bytes.NewReader(body[:compressThreshold-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get("Content-Encoding") != "" {
+		t.Error("body below the threshold was compressed")
+	}
+}
@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"sync"
+	"time"
+)
+
+// Default lifetime of cached GetResource/GetConnection responses.
+const defaultCacheTTL = 30 * time.Second
+
+type cacheEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// ttlCache is a small in-memory cache for agent GETs. Writes through the
+// agent client invalidate the affected entries explicitly.
+// A nil cache is valid and caches nothing.
+type ttlCache[V any] struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry[V]
+}
+
+func newTTLCache[V any]() *ttlCache[V] {
+	return &ttlCache[V]{entries: make(map[string]cacheEntry[V])}
+}
+
+func (c *ttlCache[V]) get(key string) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (c *ttlCache[V]) put(key string, value V, ttl time.Duration) {
+	if c == nil || ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry[V]{value: value, expires: time.Now().Add(ttl)}
+}
+
+func (c *ttlCache[V]) invalidate(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+func (c *ttlCache[V]) clear() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
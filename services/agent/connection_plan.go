@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+)
+
+// ApplyConnectionPlan creates and removes the connections in plan. It is shared by
+// every platform since connections only live on the agent. It returns how many
+// connections it created or removed, even when it fails part way.
+func (a *AgentCommunication) ApplyConnectionPlan(ctx context.Context, connectionPlan *models.ConnectionPlan) (int, error) {
+	if connectionPlan == nil {
+		return 0, nil
+	}
+	changes := 0
+
+	// Helper: resolve ResourceRef -> resource UUID
+	resolveResourceID := func(ref models.ResourceRef) (uuid.UUID, error) {
+		if ref.ID != nil {
+			return *ref.ID, nil
+		}
+		// At the runner layer, we currently have no lookup mechanism for (Service, Name) -> UUID.
+		// If you later add one (e.g. comm.ResolveResource(service,name)), plug it in here.
+		if ref.Service != nil || ref.Name != nil {
+			return uuid.Nil, fmt.Errorf("cannot resolve resource by service/name in runner; ResourceRef.id is required (service=%v name=%v)", ref.Service, ref.Name)
+		}
+		return uuid.Nil, fmt.Errorf("resource ref is empty; ResourceRef.id is required")
+	}
+
+	// 1) Post new connections
+	if connectionPlan.Create != nil {
+		for _, spec := range *connectionPlan.Create {
+			resourceID, err := resolveResourceID(spec.Resource)
+			if err != nil {
+				return changes, runerr.Wrap(ctx, "create connection", "", err)
+			}
+
+			_, err = a.CreateConnection(ctx, models.CreateConnectionRequest{
+				Resource: resourceID,
+				Job:      spec.Job,
+				Metadata: spec.Metadata,
+			})
+			if err != nil {
+				return changes, runerr.Wrap(ctx, "create connection", resourceID.String(), err)
+			}
+			changes++
+		}
+	}
+
+	// 2) Remove connections
+	if connectionPlan.Remove != nil {
+		for _, spec := range *connectionPlan.Remove {
+			// With the current API, DeleteConnection needs BOTH the resource UUID and the connection UUID.
+			// So we only support remove when spec includes BOTH:
+			// - spec.ID (connection id)
+			// - spec.Resource (to resolve resource id)
+			if spec.ID != nil {
+				if spec.Resource == nil {
+					return changes, runerr.Errorf(ctx, "remove connection", spec.ID.String(), "resource ref is required (DeleteConnection needs resourceID + connectionID)")
+				}
+				resourceID, err := resolveResourceID(*spec.Resource)
+				if err != nil {
+					return changes, runerr.Wrap(ctx, "remove connection", spec.ID.String(), err)
+				}
+
+				if err := a.DeleteConnection(ctx, resourceID, *spec.ID); err != nil {
+					return changes, runerr.Wrap(ctx, "delete connection", resourceID.String()+"/"+spec.ID.String(), err)
+				}
+				changes++
+				continue
+			}
+
+			// Resource-only removal ("remove all connections for resource") is not possible with the current API
+			// because we have no "list connections for resource" endpoint here.
+			if spec.Resource != nil {
+				return changes, runerr.Errorf(ctx, "remove connections for resource", "", "unsupported with current API (need list-connections or delete-by-resource endpoint)")
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// DeleteJobConnections deletes every connection record the job holds, recording
+// deleted connections and failures in summary. It lists the job's connections
+// first, so a job without any costs one request. Deleting addresses a connection
+// by its resource, which the listing leaves out, so it then pages through the
+// resources looking for them and stops once all are found.
+func (a *AgentCommunication) DeleteJobConnections(ctx context.Context, job uuid.UUID, summary *models.TeardownSummary) error {
+	ids, err := a.ListAllConnections(ctx, &job, nil)
+	if err != nil {
+		return summary.Fail("connection", job.String(), runerr.Wrap(ctx, "list connections", job.String(), err))
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	left := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		left[id] = true
+	}
+
+	var errs []error
+	limit := listPageSize
+	for offset := uint32(0); len(left) > 0; offset += limit {
+		resources, err := a.ListResources(ctx, nil, &limit, &offset)
+		if err != nil {
+			return errors.Join(append(errs, summary.Fail("connection", job.String(), runerr.Wrap(ctx, "list resources", "", err)))...)
+		}
+		for _, resourceID := range resources {
+			if len(left) == 0 {
+				break
+			}
+			ids, err := a.ListAllConnections(ctx, &job, &resourceID)
+			if err != nil {
+				errs = append(errs, summary.Fail("connection", resourceID.String(), runerr.Wrap(ctx, "list connections", resourceID.String(), err)))
+				continue
+			}
+			for _, id := range ids {
+				delete(left, id)
+				if err := a.DeleteConnection(ctx, resourceID, id); err != nil {
+					errs = append(errs, summary.Fail("connection", id.String(), runerr.Wrap(ctx, "delete connection", resourceID.String()+"/"+id.String(), err)))
+					continue
+				}
+				summary.Connections = append(summary.Connections, id)
+			}
+		}
+		if uint32(len(resources)) < limit {
+			break
+		}
+	}
+
+	return errors.Join(errs...)
+}
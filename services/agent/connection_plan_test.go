@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/google/uuid"
+)
+
+// fakeConnections serves the agent's resource and connection listings and
+// connection deletes, counting the requests it gets.
+type fakeConnections struct {
+	mu          sync.Mutex
+	resources   []uuid.UUID
+	connections map[uuid.UUID]map[uuid.UUID]uuid.UUID // job by connection, by resource
+	requests    int
+}
+
+func (f *fakeConnections) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+
+	q := r.URL.Query()
+	page := func(ids []uuid.UUID) []uuid.UUID {
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		ids = ids[min(offset, len(ids)):]
+		return ids[:min(limit, len(ids))]
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == agentResourcesPath:
+		_ = json.NewEncoder(w).Encode(page(f.resources))
+	case r.Method == http.MethodGet && r.URL.Path == agentConnectionsPath:
+		ids := []uuid.UUID{}
+		for _, res := range f.resources {
+			if q.Has("resource") && q.Get("resource") != res.String() {
+				continue
+			}
+			for id, job := range f.connections[res] {
+				if !q.Has("job") || q.Get("job") == job.String() {
+					ids = append(ids, id)
+				}
+			}
+		}
+		slices.SortFunc(ids, func(a, b uuid.UUID) int { return strings.Compare(a.String(), b.String()) })
+		_ = json.NewEncoder(w).Encode(page(ids))
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, agentConnectionsPath+"/"):
+		res, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, agentConnectionsPath+"/"), "/")
+		delete(f.connections[uuid.MustParse(res)], uuid.MustParse(id))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeConnections(t *testing.T, resources int) (*fakeConnections, *AgentCommunication) {
+	t.Helper()
+	f := &fakeConnections{connections: map[uuid.UUID]map[uuid.UUID]uuid.UUID{}}
+	for range resources {
+		res := uuid.New()
+		f.resources = append(f.resources, res)
+		f.connections[res] = map[uuid.UUID]uuid.UUID{}
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, newTestAgent(t, "tcp://"+strings.TrimPrefix(srv.URL, "http://"))
+}
+
+func TestDeleteJobConnectionsWithoutConnections(t *testing.T) {
+	f, a := newFakeConnections(t, 250)
+	f.connections[f.resources[0]][uuid.New()] = uuid.New() // another job's
+
+	var summary models.TeardownSummary
+	if err := a.DeleteJobConnections(context.Background(), uuid.New(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if f.requests != 1 {
+		t.Errorf("%d request(s) to tear down a job without connections, want 1", f.requests)
+	}
+}
+
+func TestDeleteJobConnectionsDeletesOnlyTheJobs(t *testing.T) {
+	f, a := newFakeConnections(t, 250)
+	job, other := uuid.New(), uuid.New()
+	mine := []uuid.UUID{uuid.New(), uuid.New()}
+	theirs := uuid.New()
+	f.connections[f.resources[2]][mine[0]] = job
+	f.connections[f.resources[2]][theirs] = other
+	f.connections[f.resources[4]][mine[1]] = job
+
+	var summary models.TeardownSummary
+	if err := a.DeleteJobConnections(context.Background(), job, &summary); err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(mine, func(a, b uuid.UUID) int { return strings.Compare(a.String(), b.String()) })
+	slices.SortFunc(summary.Connections, func(a, b uuid.UUID) int { return strings.Compare(a.String(), b.String()) })
+	if !slices.Equal(summary.Connections, mine) {
+		t.Errorf("deleted %v, want %v", summary.Connections, mine)
+	}
+	if _, ok := f.connections[f.resources[2]][theirs]; !ok {
+		t.Error("another job's connection was deleted")
+	}
+	// One listing of the job's connections, one page of resources, five
+	// resources searched and two deletes: the other 245 are never asked about.
+	if want := 1 + 1 + 5 + 2; f.requests != want {
+		t.Errorf("%d request(s), want %d", f.requests, want)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 
@@ -16,10 +15,24 @@ import (
 // Connection Interactions
 const agentConnectionsPath = "/v1/connections"
 
+// CreateConnection records a connection. Transient failures are retried and then
+// queued in the outbox (if any), in which case it returns uuid.Nil and no error.
 func (a *AgentCommunication) CreateConnection(
 	ctx context.Context,
 	body models.CreateConnectionRequest,
 ) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := a.write(ctx, outboxCreateConnection, uuid.Nil, body, func() (err error) {
+		id, err = a.createConnection(ctx, body)
+		return err
+	})
+	return id, err
+}
+
+func (a *AgentCommunication) createConnection(
+	ctx context.Context,
+	body models.CreateConnectionRequest,
+) (uuid.UUID, error) {
 
 	client, _, err := a.Client()
 	if err != nil {
@@ -43,8 +56,7 @@ func (a *AgentCommunication) CreateConnection(
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		rb, _ := io.ReadAll(resp.Body)
-		return uuid.Nil, fmt.Errorf("create connection failed (%d): %s", resp.StatusCode, string(rb))
+		return uuid.Nil, responseError("create connection", resp)
 	}
 
 	var out models.CreateConnectionResponse
@@ -100,8 +112,7 @@ func (a *AgentCommunication) ListConnections(
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		rb, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("list connections failed (%d): %s", resp.StatusCode, string(rb))
+		return nil, responseError("list connections", resp)
 	}
 
 	var ids []uuid.UUID
@@ -112,18 +123,43 @@ func (a *AgentCommunication) ListConnections(
 	return ids, nil
 }
 
+// ListAllConnections pages through ListConnections until the agent returns a short page.
+func (a *AgentCommunication) ListAllConnections(
+	ctx context.Context,
+	job *uuid.UUID,
+	resource *uuid.UUID,
+) ([]uuid.UUID, error) {
+
+	var all []uuid.UUID
+	limit := listPageSize
+	for offset := uint32(0); ; offset += limit {
+		page, err := a.ListConnections(ctx, job, resource, &limit, &offset)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if uint32(len(page)) < limit {
+			return all, nil
+		}
+	}
+}
+
 func (a *AgentCommunication) GetConnection(
 	ctx context.Context,
 	resourceID uuid.UUID,
 	id uuid.UUID,
 ) (*models.Connection, error) {
 
+	path := fmt.Sprintf("%s/%s/%s", agentConnectionsPath, resourceID.String(), id.String())
+	if cached, ok := a.connectionCache.get(path); ok {
+		return &cached, nil
+	}
+
 	client, _, err := a.Client()
 	if err != nil {
 		return nil, err
 	}
 
-	path := fmt.Sprintf("%s/%s/%s", agentConnectionsPath, resourceID.String(), id.String())
 	req, err := a.NewRequest(ctx, http.MethodGet, path, nil)
 	if err != nil {
 		return nil, err
@@ -136,8 +172,7 @@ func (a *AgentCommunication) GetConnection(
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		rb, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("get connection failed (%d): %s", resp.StatusCode, string(rb))
+		return nil, responseError("get connection", resp)
 	}
 
 	var conn models.Connection
@@ -145,6 +180,7 @@ func (a *AgentCommunication) GetConnection(
 		return nil, err
 	}
 
+	a.connectionCache.put(path, conn, a.CacheTTL)
 	return &conn, nil
 }
 
@@ -172,9 +208,9 @@ func (a *AgentCommunication) DeleteConnection(
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusNoContent {
-		rb, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("delete connection failed (%d): %s", resp.StatusCode, string(rb))
+		return responseError("delete connection", resp)
 	}
 
+	a.connectionCache.invalidate(path)
 	return nil
 }
@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/google/uuid"
+)
+
+// Job interactions
+const agentJobsPath = "/v1/jobs"
+
+// NotifyTeardown tells the agent the job's deployment is gone, with a summary of
+// what was removed and what failed.
+func (a *AgentCommunication) NotifyTeardown(
+	ctx context.Context,
+	job uuid.UUID,
+	summary models.TeardownSummary,
+) error {
+
+	client, _, err := a.Client()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	req, err := a.NewRequest(
+		ctx,
+		http.MethodDelete,
+		fmt.Sprintf("%s/%s/deployment", agentJobsPath, job.String()),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError("notify teardown", resp)
+	}
+
+	return nil
+}
+
+// NotifyExpired tells the agent the job's ttl expired, before the runner tears it
+// down, so the agent can tell an expiry from an operator's teardown.
+func (a *AgentCommunication) NotifyExpired(ctx context.Context, expiry models.JobExpiry) error {
+
+	client, _, err := a.Client()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(expiry)
+	if err != nil {
+		return err
+	}
+
+	req, err := a.NewRequest(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf("%s/%s/expired", agentJobsPath, expiry.Job.String()),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError("notify expiry", resp)
+	}
+
+	return nil
+}
+
+// ReportUsage sends the job's accumulated usage to the agent for chargeback. Each
+// report carries the totals, so a later one replaces a lost one.
+func (a *AgentCommunication) ReportUsage(ctx context.Context, usage models.JobUsage) error {
+
+	client, _, err := a.Client()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+
+	req, err := a.NewRequest(
+		ctx,
+		http.MethodPut,
+		fmt.Sprintf("%s/%s/usage", agentJobsPath, usage.Job.String()),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError("report usage", resp)
+	}
+
+	return nil
+}
+
+// ReportServiceHealth tells the agent a service of the job is degraded, or
+// recovered, so a service that keeps failing does not go unnoticed.
+func (a *AgentCommunication) ReportServiceHealth(ctx context.Context, report models.ServiceHealthReport) error {
+
+	client, _, err := a.Client()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	req, err := a.NewRequest(
+		ctx,
+		http.MethodPut,
+		fmt.Sprintf("%s/%s/services/%s/health", agentJobsPath, report.Job.String(), url.PathEscape(report.Service)),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError("report service health", resp)
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// FetchMetadata downloads a metadata document from an agent path (see models.MetadataRef).
+// The caller verifies the checksum.
+func (a *AgentCommunication) FetchMetadata(
+	ctx context.Context,
+	path string,
+) ([]byte, error) {
+
+	client, _, err := a.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	req, err := a.NewRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("fetch metadata", resp)
+	}
+
+	return io.ReadAll(resp.Body)
+}
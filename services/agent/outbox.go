@@ -0,0 +1,282 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/google/uuid"
+)
+
+// Retries for agent writes before they are spooled to the outbox.
+const (
+	writeAttempts = 3
+	writeBackoff  = 500 * time.Millisecond
+)
+
+// Writes the outbox knows how to replay.
+const (
+	outboxCreateResource   = "create_resource"
+	outboxCreateConnection = "create_connection"
+	outboxRunStatus        = "run_status"
+)
+
+// StatusError is an unexpected agent response.
+type StatusError struct {
+	Op        string
+	Code      int
+	RequestID string
+	Body      string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s failed (%d, request %s): %s", e.Op, e.Code, e.RequestID, e.Body)
+}
+
+// transient reports whether a failed agent call may succeed if retried: network
+// errors, timeouts, 429 and 5xx responses.
+func transient(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code == http.StatusTooManyRequests || se.Code >= 500
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// OutboxEntry is one agent write waiting to be replayed.
+type OutboxEntry struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Run       uuid.UUID       `json:"run,omitempty"` // for run_status
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+}
+
+// Outbox is a durable local queue of agent writes that failed transiently, kept
+// as one JSON file per entry so a later invocation can replay them in order.
+// Entries the agent rejects outright are moved to the dead/ subdirectory.
+type Outbox struct {
+	Dir string
+
+	mu     sync.Mutex
+	queued int
+}
+
+func NewOutbox(dir string) *Outbox {
+	return &Outbox{Dir: dir}
+}
+
+// Queued returns how many writes this process spooled.
+func (o *Outbox) Queued() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.queued
+}
+
+func (o *Outbox) add(kind string, run uuid.UUID, payload any, cause error) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	e := OutboxEntry{
+		// Names sort by creation time, which is the replay order.
+		ID:        fmt.Sprintf("%020d-%s", now.UnixNano(), uuid.NewString()),
+		Kind:      kind,
+		Run:       run,
+		Payload:   b,
+		CreatedAt: now,
+		Attempts:  writeAttempts,
+		LastError: cause.Error(),
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.save(e); err != nil {
+		return err
+	}
+	o.queued++
+	return nil
+}
+
+// save writes an entry atomically (temp file + rename).
+func (o *Outbox) save(e OutboxEntry) error {
+	if err := os.MkdirAll(o.Dir, 0o700); err != nil {
+		return fmt.Errorf("create outbox dir: %w", err)
+	}
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(o.Dir, ".entry-*")
+	if err != nil {
+		return fmt.Errorf("write outbox entry: %w", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write outbox entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write outbox entry: %w", err)
+	}
+	return os.Rename(tmp.Name(), filepath.Join(o.Dir, e.ID+".json"))
+}
+
+// pending lists the queued entries in replay order.
+func (o *Outbox) pending() ([]OutboxEntry, error) {
+	names, err := filepath.Glob(filepath.Join(o.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	entries := make([]OutboxEntry, 0, len(names))
+	for _, name := range names {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		var e OutboxEntry
+		if err := json.Unmarshal(b, &e); err != nil {
+			return nil, fmt.Errorf("outbox entry %s: %w", filepath.Base(name), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// write runs send with retries. If it still fails transiently and an outbox is
+// configured, the write is spooled for replay and write returns nil.
+func (a *AgentCommunication) write(ctx context.Context, kind string, run uuid.UUID, payload any, send func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = send(); err == nil || !transient(err) {
+			return err
+		}
+		if attempt == writeAttempts || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(writeBackoff << (attempt - 1)):
+		}
+	}
+
+	if a.Outbox == nil {
+		return err
+	}
+	if qerr := a.Outbox.add(kind, run, payload, err); qerr != nil {
+		return errors.Join(err, fmt.Errorf("queue for retry: %w", qerr))
+	}
+	log.Printf("agent unavailable, queued %s for retry: %v", kind, err)
+	return nil
+}
+
+// DrainOutbox replays queued writes in order until one fails transiently (the
+// agent is presumably still down) and returns how many are left. Writes the agent
+// rejects are moved to the dead-letter directory.
+func (a *AgentCommunication) DrainOutbox(ctx context.Context) (int, error) {
+	if a.Outbox == nil {
+		return 0, nil
+	}
+	o := a.Outbox
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries, err := o.pending()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, e := range entries {
+		err := a.replay(ctx, e)
+		path := filepath.Join(o.Dir, e.ID+".json")
+		switch {
+		case err == nil:
+			if rerr := os.Remove(path); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+				return len(entries) - i, rerr
+			}
+		case transient(err):
+			e.Attempts++
+			e.LastError = err.Error()
+			if serr := o.save(e); serr != nil {
+				return len(entries) - i, serr
+			}
+			return len(entries) - i, nil
+		default:
+			log.Printf("agent rejected queued %s %s, moving it to dead letters: %v", e.Kind, e.ID, err)
+			dead := filepath.Join(o.Dir, "dead")
+			if merr := os.MkdirAll(dead, 0o700); merr != nil {
+				return len(entries) - i, merr
+			}
+			if merr := os.Rename(path, filepath.Join(dead, e.ID+".json")); merr != nil {
+				return len(entries) - i, merr
+			}
+		}
+	}
+	return 0, nil
+}
+
+// WatchOutbox drains the outbox every interval until ctx is done.
+func (a *AgentCommunication) WatchOutbox(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := a.DrainOutbox(ctx); err != nil {
+				log.Printf("drain outbox: %v", err)
+			}
+		}
+	}
+}
+
+func (a *AgentCommunication) replay(ctx context.Context, e OutboxEntry) error {
+	switch e.Kind {
+	case outboxCreateResource:
+		var r models.CreateResource
+		if err := json.Unmarshal(e.Payload, &r); err != nil {
+			return err
+		}
+		_, err := a.createResource(ctx, r)
+		return err
+	case outboxCreateConnection:
+		var c models.CreateConnectionRequest
+		if err := json.Unmarshal(e.Payload, &c); err != nil {
+			return err
+		}
+		_, err := a.createConnection(ctx, c)
+		return err
+	case outboxRunStatus:
+		var u models.RunStatusUpdate
+		if err := json.Unmarshal(e.Payload, &u); err != nil {
+			return err
+		}
+		return a.updateRunStatus(ctx, e.Run, u)
+	default:
+		return fmt.Errorf("unknown outbox entry kind %q", e.Kind)
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 
@@ -16,10 +16,51 @@ import (
 // Resource interactions
 const agentResourcesPath = "/v1/resources"
 
+// Page size used by the ListAll* helpers
+const listPageSize uint32 = 100
+
+// CreateResource registers a resource. Transient failures are retried and then
+// queued in the outbox (if any), in which case it returns uuid.Nil and no error.
 func (a *AgentCommunication) CreateResource(
 	ctx context.Context,
 	resource models.CreateResource,
 ) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := a.write(ctx, outboxCreateResource, uuid.Nil, resource, func() (err error) {
+		id, err = a.createResource(ctx, resource)
+		return err
+	})
+	return id, err
+}
+
+// CreateResources registers a service's resources in order and returns how many
+// were registered. If one fails, the ones before it are deleted again, so the
+// agent is not left with half of a service; failures to delete are joined to
+// the error.
+func (a *AgentCommunication) CreateResources(
+	ctx context.Context,
+	resources []models.CreateResource,
+) (int, error) {
+	for i, resource := range resources {
+		if _, err := a.CreateResource(ctx, resource); err != nil {
+			errs := []error{err}
+			// The run context may be what failed the registration.
+			dctx := context.WithoutCancel(ctx)
+			for _, done := range resources[:i] {
+				if derr := a.DeleteResourceByName(dctx, done.Name); derr != nil {
+					errs = append(errs, fmt.Errorf("delete resource %q again: %w", done.Name, derr))
+				}
+			}
+			return i, errors.Join(errs...)
+		}
+	}
+	return len(resources), nil
+}
+
+func (a *AgentCommunication) createResource(
+	ctx context.Context,
+	resource models.CreateResource,
+) (uuid.UUID, error) {
 
 	client, _, err := a.Client()
 	if err != nil {
@@ -48,8 +89,7 @@ func (a *AgentCommunication) CreateResource(
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		b, _ := io.ReadAll(resp.Body)
-		return uuid.Nil, fmt.Errorf("create resource failed (%d): %s", resp.StatusCode, string(b))
+		return uuid.Nil, responseError("create resource", resp)
 	}
 
 	var out struct {
@@ -103,8 +143,7 @@ func (a *AgentCommunication) ListResources(
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("list resources failed (%d): %s", resp.StatusCode, string(b))
+		return nil, responseError("list resources", resp)
 	}
 
 	var ids []uuid.UUID
@@ -115,11 +154,35 @@ func (a *AgentCommunication) ListResources(
 	return ids, nil
 }
 
+// ListAllResources pages through ListResources until the agent returns a short page.
+func (a *AgentCommunication) ListAllResources(
+	ctx context.Context,
+	resourceType *string,
+) ([]uuid.UUID, error) {
+
+	var all []uuid.UUID
+	limit := listPageSize
+	for offset := uint32(0); ; offset += limit {
+		page, err := a.ListResources(ctx, resourceType, &limit, &offset)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if uint32(len(page)) < limit {
+			return all, nil
+		}
+	}
+}
+
 func (a *AgentCommunication) GetResource(
 	ctx context.Context,
 	id uuid.UUID,
 ) (*models.Resource, error) {
 
+	if cached, ok := a.resourceCache.get(id.String()); ok {
+		return &cached, nil
+	}
+
 	client, _, err := a.Client()
 	if err != nil {
 		return nil, err
@@ -142,8 +205,7 @@ func (a *AgentCommunication) GetResource(
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("get resource failed (%d): %s", resp.StatusCode, string(b))
+		return nil, responseError("get resource", resp)
 	}
 
 	var resource models.Resource
@@ -151,6 +213,7 @@ func (a *AgentCommunication) GetResource(
 		return nil, err
 	}
 
+	a.resourceCache.put(id.String(), resource, a.CacheTTL)
 	return &resource, nil
 }
 
@@ -181,10 +244,10 @@ func (a *AgentCommunication) DeleteResource(
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusNoContent {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("delete resource failed (%d): %s", resp.StatusCode, string(b))
+		return responseError("delete resource", resp)
 	}
 
+	a.resourceCache.invalidate(id.String())
 	return nil
 }
 
@@ -215,9 +278,55 @@ func (a *AgentCommunication) DeleteResourceByName(
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusNoContent {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("delete resource failed (%d): %s", resp.StatusCode, string(b))
+		return responseError("delete resource", resp)
 	}
 
+	// Cache entries are keyed by ID, so drop everything.
+	a.resourceCache.clear()
 	return nil
 }
+
+// ErrNoResourceHealth is returned by ResourceHealth when the agent has no health
+// information for the resource (or predates the health endpoint).
+var ErrNoResourceHealth = errors.New("agent has no health for resource")
+
+// ResourceHealth asks the agent whether a resource is ready to take connections.
+func (a *AgentCommunication) ResourceHealth(
+	ctx context.Context,
+	id uuid.UUID,
+) (*models.ResourceHealth, error) {
+
+	client, _, err := a.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := a.NewRequest(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf("%s/%s/health", agentResourcesPath, id.String()),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNoResourceHealth
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("get resource health", resp)
+	}
+
+	var health models.ResourceHealth
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
@@ -0,0 +1,256 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/phase"
+	"github.com/google/uuid"
+)
+
+// Run interactions
+const agentRunsPath = "/v1/runs"
+
+func (a *AgentCommunication) GetRun(
+	ctx context.Context,
+	id uuid.UUID,
+) (*models.Run, error) {
+
+	client, _, err := a.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := a.NewRequest(ctx, http.MethodGet, fmt.Sprintf("%s/%s", agentRunsPath, id.String()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("get run", resp)
+	}
+
+	var run models.Run
+	if err := json.NewDecoder(resp.Body).Decode(&run); err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// UpdateRunStatus reports a run's status. Transient failures are retried and then
+// queued in the outbox (if any), in which case it returns no error.
+func (a *AgentCommunication) UpdateRunStatus(
+	ctx context.Context,
+	id uuid.UUID,
+	update models.RunStatusUpdate,
+) error {
+	return a.write(ctx, outboxRunStatus, id, update, func() error {
+		return a.updateRunStatus(ctx, id, update)
+	})
+}
+
+func (a *AgentCommunication) updateRunStatus(
+	ctx context.Context,
+	id uuid.UUID,
+	update models.RunStatusUpdate,
+) error {
+
+	client, _, err := a.Client()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+
+	req, err := a.NewRequest(
+		ctx,
+		http.MethodPut,
+		fmt.Sprintf("%s/%s/status", agentRunsPath, id.String()),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError("update run status", resp)
+	}
+
+	return nil
+}
+
+// UploadPlan stores the run's computed plan on the agent for auditing.
+func (a *AgentCommunication) UploadPlan(
+	ctx context.Context,
+	id uuid.UUID,
+	plan models.Plan,
+) error {
+
+	client, _, err := a.Client()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+
+	req, err := a.NewRequest(
+		ctx,
+		http.MethodPut,
+		fmt.Sprintf("%s/%s/plan", agentRunsPath, id.String()),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return responseError("upload plan", resp)
+	}
+
+	return nil
+}
+
+// WatchRunCancellation polls the run status every interval and cancels the run
+// context with phase.ErrAgentAbort once the agent requests cancellation.
+// It returns when ctx is done. Poll errors are logged and retried.
+func (a *AgentCommunication) WatchRunCancellation(
+	ctx context.Context,
+	id uuid.UUID,
+	interval time.Duration,
+	cancel context.CancelCauseFunc,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		run, err := a.GetRun(ctx, id)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("poll run %s status: %v", id, err)
+			}
+			continue
+		}
+
+		if run.Status == models.RunStatusCancelRequested || run.Status == models.RunStatusCancelled {
+			cancel(fmt.Errorf("%w (run %s)", phase.ErrAgentAbort, id))
+			return
+		}
+	}
+}
+
+// ReportCapabilities tells the agent what the run's platform can honor.
+func (a *AgentCommunication) ReportCapabilities(
+	ctx context.Context,
+	id uuid.UUID,
+	capabilities models.PlatformCapabilities,
+) error {
+
+	client, _, err := a.Client()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(capabilities)
+	if err != nil {
+		return err
+	}
+
+	req, err := a.NewRequest(
+		ctx,
+		http.MethodPut,
+		fmt.Sprintf("%s/%s/capabilities", agentRunsPath, id.String()),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError("report capabilities", resp)
+	}
+
+	return nil
+}
+
+// SendLogs forwards a batch of a run's service log lines to the agent.
+func (a *AgentCommunication) SendLogs(
+	ctx context.Context,
+	id uuid.UUID,
+	batch models.LogBatch,
+) error {
+
+	client, _, err := a.Client()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	req, err := a.NewRequest(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf("%s/%s/logs", agentRunsPath, id.String()),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return responseError("send logs", resp)
+	}
+
+	return nil
+}
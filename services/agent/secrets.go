@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/google/uuid"
+)
+
+// GetSecret reads an agent-managed secret for the job, which the agent checks is
+// allowed to use it. Values are never cached, so a rotated secret takes effect
+// on the next deploy.
+func (a *AgentCommunication) GetSecret(
+	ctx context.Context,
+	job uuid.UUID,
+	name string,
+) (string, error) {
+
+	client, _, err := a.Client()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := a.NewRequest(
+		ctx,
+		http.MethodGet,
+		fmt.Sprintf("%s/%s/secrets/%s", agentJobsPath, job.String(), url.PathEscape(name)),
+		nil,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError("get secret", resp)
+	}
+
+	var secret models.SecretValue
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", err
+	}
+
+	return secret.Value, nil
+}
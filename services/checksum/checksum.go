@@ -0,0 +1,51 @@
+package checksum
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Prefix marks the algorithm of a checksum, as in "sha256:<hex>".
+const Prefix = "sha256:"
+
+// Tar sums the directory tree in a tar archive whose entries all sit under one
+// top directory, as Docker's archive API returns it. Entries are taken by their
+// path below that directory, type, permissions, link target and content, in
+// path order, so the sum doesn't depend on archive order, owners or times.
+func Tar(r io.Reader) (string, error) {
+	var lines []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("read archive: %w", err)
+		}
+		_, rel, _ := strings.Cut(path.Clean(hdr.Name), "/")
+		content := ""
+		if hdr.Typeflag == tar.TypeReg {
+			h := sha256.New()
+			if _, err := io.Copy(h, tr); err != nil {
+				return "", fmt.Errorf("read %s: %w", hdr.Name, err)
+			}
+			content = hex.EncodeToString(h.Sum(nil))
+		}
+		lines = append(lines, fmt.Sprintf("%q %c %o %q %s\n", rel, hdr.Typeflag, hdr.Mode&0o7777, hdr.Linkname, content))
+	}
+	sort.Strings(lines)
+
+	h := sha256.New()
+	for _, l := range lines {
+		io.WriteString(h, l)
+	}
+	return Prefix + hex.EncodeToString(h.Sum(nil)), nil
+}
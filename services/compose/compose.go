@@ -0,0 +1,847 @@
+package compose
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"gopkg.in/yaml.v3"
+)
+
+// File is the subset of the compose specification the runner understands.
+type File struct {
+	Services map[string]Service  `yaml:"services"`
+	Volumes  map[string]*Volume  `yaml:"volumes"`
+	Networks map[string]*Network `yaml:"networks"`
+	Configs  map[string]*Config  `yaml:"configs"`
+}
+
+type Service struct {
+	Image           string         `yaml:"image"`
+	Build           any            `yaml:"build"`
+	ContainerName   string         `yaml:"container_name"`
+	Entrypoint      any            `yaml:"entrypoint"` // string or list
+	Command         any            `yaml:"command"`    // string or list
+	User            string         `yaml:"user"`
+	WorkingDir      string         `yaml:"working_dir"`
+	Hostname        string         `yaml:"hostname"`
+	Domainname      string         `yaml:"domainname"`
+	Cpuset          string         `yaml:"cpuset"`
+	ShmSize         any            `yaml:"shm_size"` // bytes or a size string
+	Ipc             string         `yaml:"ipc"`
+	Pid             string         `yaml:"pid"`
+	UsernsMode      string         `yaml:"userns_mode"`
+	Platform        string         `yaml:"platform"`
+	PullPolicy      string         `yaml:"pull_policy"`
+	Runtime         string         `yaml:"runtime"`
+	Privileged      bool           `yaml:"privileged"`
+	Init            *bool          `yaml:"init"`
+	CapAdd          []string       `yaml:"cap_add"`
+	CapDrop         []string       `yaml:"cap_drop"`
+	GroupAdd        []string       `yaml:"group_add"` // names or GIDs
+	SecurityOpt     []string       `yaml:"security_opt"`
+	Devices         []string       `yaml:"devices"`    // short syntax
+	DNS             any            `yaml:"dns"`        // string or list
+	DNSSearch       any            `yaml:"dns_search"` // string or list
+	DNSOpt          []string       `yaml:"dns_opt"`
+	Environment     any            `yaml:"environment"` // map or list of KEY=VALUE
+	Labels          any            `yaml:"labels"`      // map or list of key=value
+	Ports           []any          `yaml:"ports"`       // short or long syntax
+	Volumes         []any          `yaml:"volumes"`     // short or long syntax
+	Configs         []any          `yaml:"configs"`     // short or long syntax
+	DependsOn       any            `yaml:"depends_on"`  // list or map
+	Networks        any            `yaml:"networks"`    // list or map
+	Restart         string         `yaml:"restart"`
+	StopSignal      string         `yaml:"stop_signal"`
+	StopGracePeriod string         `yaml:"stop_grace_period"`
+	Healthcheck     *Healthcheck   `yaml:"healthcheck"`
+	Deploy          *Deploy        `yaml:"deploy"`
+	Extra           map[string]any `yaml:",inline"`
+}
+
+type Deploy struct {
+	Mode      string `yaml:"mode"`
+	Replicas  *int   `yaml:"replicas"`
+	Resources struct {
+		Limits struct {
+			Cpus   any    `yaml:"cpus"` // number or string
+			Memory string `yaml:"memory"`
+			Pids   *int64 `yaml:"pids"`
+		} `yaml:"limits"`
+		Reservations struct {
+			Memory  string   `yaml:"memory"`
+			Devices []Device `yaml:"devices"`
+		} `yaml:"reservations"`
+	} `yaml:"resources"`
+}
+
+type Healthcheck struct {
+	Test        any    `yaml:"test"` // string (run by the shell) or list
+	Interval    string `yaml:"interval"`
+	Timeout     string `yaml:"timeout"`
+	StartPeriod string `yaml:"start_period"`
+	Retries     *int   `yaml:"retries"`
+	Disable     bool   `yaml:"disable"`
+}
+
+type Device struct {
+	Driver       string            `yaml:"driver"`
+	Count        any               `yaml:"count"` // number or "all"
+	DeviceIDs    []string          `yaml:"device_ids"`
+	Capabilities []string          `yaml:"capabilities"`
+	Options      map[string]string `yaml:"options"`
+}
+
+type Volume struct {
+	External bool `yaml:"external"`
+}
+
+// Config is a top-level config. Only inline content is supported; the runner
+// has no files next to the compose file to read.
+type Config struct {
+	Content     string `yaml:"content"`
+	File        string `yaml:"file"`
+	Environment string `yaml:"environment"`
+	External    bool   `yaml:"external"`
+}
+
+type Network struct {
+	External bool   `yaml:"external"`
+	Name     string `yaml:"name"`
+	IPAM     struct {
+		Config []struct {
+			Subnet  string `yaml:"subnet"`
+			Gateway string `yaml:"gateway"`
+			IPRange string `yaml:"ip_range"`
+		} `yaml:"config"`
+	} `yaml:"ipam"`
+}
+
+// Convert turns a compose file into metadata. Keys the runner cannot honor are
+// returned as warnings; anything that would change behavior silently (build,
+// bind mounts) is an error.
+func Convert(b []byte) (*models.Metadata, []string, error) {
+	var f File
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, nil, fmt.Errorf("parse compose file: %w", err)
+	}
+	if len(f.Services) == 0 {
+		return nil, nil, fmt.Errorf("compose file has no services")
+	}
+
+	var warnings []string
+	warnf := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	md := &models.Metadata{Services: make(map[string]models.MetadataService, len(f.Services))}
+
+	// Declared (non-external) volumes are created by the run; external ones must exist.
+	var volumes []string
+	for name, v := range f.Volumes {
+		if v != nil && v.External {
+			continue
+		}
+		volumes = append(volumes, name)
+	}
+	sort.Strings(volumes)
+	if len(volumes) > 0 {
+		md.Volumes = &volumes
+	}
+
+	names := make([]string, 0, len(f.Services))
+	for name := range f.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cs := f.Services[name]
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("compose service %q: %s", name, fmt.Sprintf(format, args...))
+		}
+
+		if cs.Build != nil {
+			return nil, nil, fail("build is not supported; push the image and reference it with image")
+		}
+		if cs.Image == "" {
+			return nil, nil, fail("image is required")
+		}
+		svc := models.MetadataService{Image: cs.Image}
+
+		if cs.ContainerName != "" {
+			warnf("compose service %q: container_name is ignored (containers are named per job)", name)
+		}
+		for key := range cs.Extra {
+			warnf("compose service %q: %s is not supported and was ignored", name, key)
+		}
+
+		env, err := environment(cs.Environment)
+		if err != nil {
+			return nil, nil, fail("%v", err)
+		}
+		if len(env) > 0 {
+			svc.Environment = env
+		}
+		labels, err := labelMap(cs.Labels)
+		if err != nil {
+			return nil, nil, fail("%v", err)
+		}
+		if len(labels) > 0 {
+			svc.Labels = labels
+		}
+
+		for _, c := range cs.Configs {
+			file, err := configFile(c, f.Configs)
+			if err != nil {
+				return nil, nil, fail("configs: %v", err)
+			}
+			svc.Files = append(svc.Files, file)
+		}
+
+		if len(cs.Ports) > 0 {
+			bindings := make([]models.BindingSpec, 0, len(cs.Ports))
+			for _, p := range cs.Ports {
+				b, err := port(p)
+				if err != nil {
+					return nil, nil, fail("ports: %v", err)
+				}
+				bindings = append(bindings, b)
+			}
+			svc.Bindings = &bindings
+		}
+
+		if len(cs.Volumes) > 0 {
+			mounts := make([]models.VolumeMount, 0, len(cs.Volumes))
+			for _, v := range cs.Volumes {
+				m, err := volumeMount(v)
+				if err != nil {
+					return nil, nil, fail("volumes: %v", err)
+				}
+				mounts = append(mounts, m)
+			}
+			svc.Volumes = &mounts
+		}
+
+		entrypoint, err := commandLine(cs.Entrypoint)
+		if err != nil {
+			return nil, nil, fail("entrypoint: %v", err)
+		}
+		if entrypoint != nil {
+			svc.Entrypoint = &entrypoint
+		}
+		command, err := commandLine(cs.Command)
+		if err != nil {
+			return nil, nil, fail("command: %v", err)
+		}
+		if command != nil {
+			svc.Command = &command
+		}
+
+		deps, err := keysOrList(cs.DependsOn)
+		if err != nil {
+			return nil, nil, fail("depends_on: %v", err)
+		}
+		if len(deps) > 0 {
+			svc.DependsOn = &deps
+		}
+
+		nets, err := keysOrList(cs.Networks)
+		if err != nil {
+			return nil, nil, fail("networks: %v", err)
+		}
+		if len(nets) > 0 {
+			svc.NetworkGroups = &nets
+		}
+		primary, err := primaryNetwork(cs.Networks)
+		if err != nil {
+			return nil, nil, fail("networks: %v", err)
+		}
+		svc.PrimaryNetwork = primary
+		eps, err := endpoints(cs.Networks)
+		if err != nil {
+			return nil, nil, fail("networks: %v", err)
+		}
+		svc.Endpoints = eps
+
+		if cs.User != "" {
+			user := cs.User
+			svc.User = &user
+		}
+		if cs.WorkingDir != "" {
+			dir := cs.WorkingDir
+			svc.WorkingDir = &dir
+		}
+		if cs.Hostname != "" {
+			hostname := cs.Hostname
+			svc.Hostname = &hostname
+		}
+		if cs.Domainname != "" {
+			domainname := cs.Domainname
+			svc.Domainname = &domainname
+		}
+		if cs.Cpuset != "" {
+			cpus := cs.Cpuset
+			svc.CpusetCpus = &cpus
+		}
+		if cs.ShmSize != nil {
+			// Compose sizes use Docker's binary units ("64m" is 64 MiB).
+			n, err := units.RAMInBytes(fmt.Sprint(cs.ShmSize))
+			if err != nil {
+				return nil, nil, fail("shm_size: %v", err)
+			}
+			shm := models.ByteSize(n)
+			svc.ShmSize = &shm
+		}
+		if cs.Ipc != "" {
+			if strings.HasPrefix(cs.Ipc, "container:") {
+				return nil, nil, fail("ipc: %q refers to a container outside the project", cs.Ipc)
+			}
+			ipc := cs.Ipc
+			svc.Ipc = &ipc
+		}
+		if cs.Pid != "" {
+			if strings.HasPrefix(cs.Pid, "container:") {
+				return nil, nil, fail("pid: %q refers to a container outside the project", cs.Pid)
+			}
+			pid := cs.Pid
+			svc.Pid = &pid
+		}
+		if cs.UsernsMode != "" {
+			userns := cs.UsernsMode
+			svc.UsernsMode = &userns
+		}
+		if cs.Privileged {
+			privileged := true
+			svc.Privileged = &privileged
+		}
+		svc.Init = cs.Init
+		svc.CapAdd = cs.CapAdd
+		svc.CapDrop = cs.CapDrop
+		svc.GroupAdd = cs.GroupAdd
+		svc.SecurityOpt = cs.SecurityOpt
+		svc.Devices = cs.Devices
+		if svc.DNS, err = stringOrList(cs.DNS); err != nil {
+			return nil, nil, fail("dns: %v", err)
+		}
+		if svc.DNSSearch, err = stringOrList(cs.DNSSearch); err != nil {
+			return nil, nil, fail("dns_search: %v", err)
+		}
+		svc.DNSOptions = cs.DNSOpt
+		if cs.Platform != "" {
+			platform := cs.Platform
+			svc.Platform = &platform
+		}
+		if cs.PullPolicy != "" {
+			policy, err := pullPolicy(cs.PullPolicy)
+			if err != nil {
+				return nil, nil, fail("pull_policy: %v", err)
+			}
+			svc.PullPolicy = &policy
+		}
+		if cs.Runtime != "" {
+			runtime := cs.Runtime
+			svc.Runtime = &runtime
+		}
+		if cs.Restart != "" {
+			restart := models.RestartPolicy(cs.Restart)
+			svc.Restart = &restart
+		}
+		if cs.StopSignal != "" {
+			sig := cs.StopSignal
+			svc.StopSignal = &sig
+		}
+		if cs.StopGracePeriod != "" {
+			d, err := time.ParseDuration(cs.StopGracePeriod)
+			if err != nil {
+				return nil, nil, fail("stop_grace_period: %v", err)
+			}
+			grace := models.Duration(d)
+			svc.StopGracePeriod = &grace
+		}
+
+		if cs.Healthcheck != nil {
+			hc, err := healthcheck(cs.Healthcheck)
+			if err != nil {
+				return nil, nil, fail("healthcheck: %v", err)
+			}
+			svc.Healthcheck = hc
+		}
+
+		if d := cs.Deploy; d != nil {
+			switch {
+			case d.Mode == "global":
+				svc.Scale = &models.ScaleSpec{Mode: string(models.ScaleModeGlobal)}
+			case d.Replicas != nil && *d.Replicas > 1:
+				svc.Scale = &models.ScaleSpec{Mode: string(models.ScaleModeAutoscale), Min: d.Replicas, Max: d.Replicas}
+			}
+			limits, err := resourceLimits(d)
+			if err != nil {
+				return nil, nil, fail("deploy.resources.%v", err)
+			}
+			svc.Limits = limits
+			for i, dev := range d.Resources.Reservations.Devices {
+				req := models.DeviceRequest{
+					Driver:       dev.Driver,
+					DeviceIDs:    dev.DeviceIDs,
+					Capabilities: dev.Capabilities,
+					Options:      dev.Options,
+				}
+				switch c := dev.Count.(type) {
+				case nil:
+				case int:
+					req.Count = c
+				case string:
+					if c != "all" {
+						return nil, nil, fail("deploy.resources.reservations.devices[%d].count: want a number or all, got %q", i, c)
+					}
+					req.Count = -1
+				default:
+					return nil, nil, fail("deploy.resources.reservations.devices[%d].count: want a number or all", i)
+				}
+				if req.Count == 0 && len(req.DeviceIDs) == 0 {
+					// Compose reserves every device when neither is given.
+					req.Count = -1
+				}
+				svc.DeviceRequests = append(svc.DeviceRequests, req)
+			}
+		}
+
+		md.Services[name] = svc
+	}
+
+	for name, n := range f.Networks {
+		if n != nil && n.External {
+			warnf("compose network %q is external; connect to it through a platform connection instead", name)
+			continue
+		}
+		if n == nil || len(n.IPAM.Config) == 0 {
+			continue
+		}
+		var spec models.NetworkSpec
+		for _, c := range n.IPAM.Config {
+			spec.Subnets = append(spec.Subnets, models.NetworkSubnet{Subnet: c.Subnet, Gateway: c.Gateway, IPRange: c.IPRange})
+		}
+		if md.Networks == nil {
+			md.Networks = map[string]models.NetworkSpec{}
+		}
+		md.Networks[name] = spec
+	}
+
+	return md, warnings, nil
+}
+
+func environment(v any) (map[string]string, error) {
+	env := map[string]string{}
+	switch e := v.(type) {
+	case nil:
+	case map[string]any:
+		for k, val := range e {
+			if val == nil {
+				return nil, fmt.Errorf("environment %s has no value (values from the host environment are not supported)", k)
+			}
+			env[k] = fmt.Sprint(val)
+		}
+	case []any:
+		for _, item := range e {
+			k, val, ok := strings.Cut(fmt.Sprint(item), "=")
+			if !ok {
+				return nil, fmt.Errorf("environment %s has no value (values from the host environment are not supported)", k)
+			}
+			env[k] = val
+		}
+	default:
+		return nil, fmt.Errorf("environment must be a map or a list")
+	}
+	return env, nil
+}
+
+// labelMap reads labels as a map or a list of key=value; a list item without a
+// value is a label with an empty one, as in compose.
+func labelMap(v any) (map[string]string, error) {
+	labels := map[string]string{}
+	switch l := v.(type) {
+	case nil:
+	case map[string]any:
+		for k, val := range l {
+			if val != nil {
+				labels[k] = fmt.Sprint(val)
+			} else {
+				labels[k] = ""
+			}
+		}
+	case []any:
+		for _, item := range l {
+			k, val, _ := strings.Cut(fmt.Sprint(item), "=")
+			labels[k] = val
+		}
+	default:
+		return nil, fmt.Errorf("labels must be a map or a list")
+	}
+	return labels, nil
+}
+
+// port parses "80", "8080:80", "127.0.0.1:8080:80" (optionally with /tcp or /udp)
+// and the long {target, published, host_ip} syntax.
+func port(v any) (models.BindingSpec, error) {
+	var b models.BindingSpec
+
+	if long, ok := v.(map[string]any); ok {
+		target, err := intValue(long["target"])
+		if err != nil {
+			return b, fmt.Errorf("target: %w", err)
+		}
+		b.ContainerPort = &target
+		if long["published"] != nil {
+			published, err := intValue(long["published"])
+			if err != nil {
+				return b, fmt.Errorf("published: %w", err)
+			}
+			b.HostPort = &published
+		}
+		if ip, ok := long["host_ip"].(string); ok && ip != "" {
+			b.HostIP = &ip
+		}
+		return b, nil
+	}
+
+	s := fmt.Sprint(v)
+	s, _, _ = strings.Cut(s, "/") // both tcp and udp are always exposed
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 || strings.Contains(s, "-") {
+		return b, fmt.Errorf("unsupported port %q (ranges and IPv6 short syntax are not supported)", v)
+	}
+
+	target, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return b, fmt.Errorf("invalid port %q", v)
+	}
+	b.ContainerPort = &target
+	if len(parts) >= 2 {
+		published, err := strconv.Atoi(parts[len(parts)-2])
+		if err != nil {
+			return b, fmt.Errorf("invalid port %q", v)
+		}
+		b.HostPort = &published
+	}
+	if len(parts) == 3 {
+		ip := parts[0]
+		b.HostIP = &ip
+	}
+	return b, nil
+}
+
+// volumeMount parses "name:/path[:rw]", "/path" (anonymous, mapped to the runner volume)
+// and the long {type: volume, source, target} syntax. Bind mounts are rejected, and so
+// are read-only mounts, which metadata cannot express.
+func volumeMount(v any) (models.VolumeMount, error) {
+	var source, target, typ string
+
+	if long, ok := v.(map[string]any); ok {
+		typ, _ = long["type"].(string)
+		source, _ = long["source"].(string)
+		target, _ = long["target"].(string)
+		if ro, _ := long["read_only"].(bool); ro {
+			return models.VolumeMount{}, fmt.Errorf("%v: read-only mounts are not supported", v)
+		}
+	} else {
+		parts := strings.Split(fmt.Sprint(v), ":")
+		switch len(parts) {
+		case 1:
+			target = parts[0]
+		default:
+			source, target = parts[0], parts[1]
+		}
+		if len(parts) > 2 {
+			for _, opt := range strings.Split(parts[2], ",") {
+				switch opt {
+				case "rw":
+				case "ro":
+					return models.VolumeMount{}, fmt.Errorf("%v: read-only mounts are not supported", v)
+				default:
+					return models.VolumeMount{}, fmt.Errorf("%v: unsupported mount option %q", v, opt)
+				}
+			}
+		}
+		typ = "volume"
+		if strings.HasPrefix(source, ".") || strings.HasPrefix(source, "/") || strings.HasPrefix(source, "~") {
+			typ = "bind"
+		}
+	}
+
+	if typ != "" && typ != "volume" {
+		return models.VolumeMount{}, fmt.Errorf("%v: only named volumes are supported (no %s mounts)", v, typ)
+	}
+	if target == "" {
+		return models.VolumeMount{}, fmt.Errorf("%v: target path is required", v)
+	}
+
+	m := models.VolumeMount{MountPath: target}
+	if source != "" {
+		m.Name = &source
+	}
+	return m, nil
+}
+
+// configFile turns a service's config reference into a file.
+func configFile(v any, configs map[string]*Config) (models.FileMount, error) {
+	var source, target string
+	var mode any
+	if long, ok := v.(map[string]any); ok {
+		source, _ = long["source"].(string)
+		target, _ = long["target"].(string)
+		mode = long["mode"]
+	} else {
+		source = fmt.Sprint(v)
+	}
+	c, ok := configs[source]
+	if !ok || c == nil {
+		return models.FileMount{}, fmt.Errorf("config %q is not declared", source)
+	}
+	if c.File != "" || c.Environment != "" || c.External {
+		return models.FileMount{}, fmt.Errorf("config %q: only inline content is supported (no file, environment or external configs)", source)
+	}
+	if target == "" {
+		target = "/" + source
+	}
+
+	file := models.FileMount{Path: target, Content: c.Content}
+	switch m := mode.(type) {
+	case nil:
+	case int:
+		file.Mode = fmt.Sprintf("%04o", m)
+	case string:
+		file.Mode = m
+	default:
+		return models.FileMount{}, fmt.Errorf("config %q: invalid mode %v", source, mode)
+	}
+	return file, nil
+}
+
+func keysOrList(v any) ([]string, error) {
+	var out []string
+	switch x := v.(type) {
+	case nil:
+	case []any:
+		for _, item := range x {
+			out = append(out, fmt.Sprint(item))
+		}
+	case map[string]any:
+		for k := range x {
+			out = append(out, k)
+		}
+		sort.Strings(out)
+	default:
+		return nil, fmt.Errorf("must be a list or a map")
+	}
+	return out, nil
+}
+
+// stringOrList reads a value that may be a single string or a list of them.
+func stringOrList(v any) ([]string, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{x}, nil
+	case []any:
+		out := make([]string, 0, len(x))
+		for _, item := range x {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("must be a string or a list")
+}
+
+// primaryNetwork picks the network with the highest gw_priority in the map form of
+// a service's networks, or nil when none sets one.
+func primaryNetwork(v any) (*string, error) {
+	nets, ok := v.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	names := make([]string, 0, len(nets))
+	for name := range nets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var primary *string
+	best := 0
+	for _, name := range names {
+		opts, _ := nets[name].(map[string]any)
+		raw, ok := opts["gw_priority"]
+		if !ok {
+			continue
+		}
+		prio, ok := raw.(int)
+		if !ok {
+			return nil, fmt.Errorf("%s.gw_priority: want a number, got %v", name, raw)
+		}
+		if primary == nil || prio > best {
+			n := name
+			primary, best = &n, prio
+		}
+	}
+	return primary, nil
+}
+
+// endpoints reads the fixed addresses in the map form of a service's networks.
+func endpoints(v any) (map[string]models.Endpoint, error) {
+	nets, ok := v.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	var out map[string]models.Endpoint
+	for name, raw := range nets {
+		opts, _ := raw.(map[string]any)
+		var ep models.Endpoint
+		if s, ok := opts["ipv4_address"]; ok {
+			ep.IPv4Address = fmt.Sprint(s)
+		}
+		if s, ok := opts["ipv6_address"]; ok {
+			ep.IPv6Address = fmt.Sprint(s)
+		}
+		if l, ok := opts["link_local_ips"]; ok {
+			ips, ok := l.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s.link_local_ips: must be a list", name)
+			}
+			for _, ip := range ips {
+				ep.LinkLocalIPs = append(ep.LinkLocalIPs, fmt.Sprint(ip))
+			}
+		}
+		if ep.IPv4Address == "" && ep.IPv6Address == "" && len(ep.LinkLocalIPs) == 0 {
+			continue
+		}
+		if out == nil {
+			out = map[string]models.Endpoint{}
+		}
+		out[name] = ep
+	}
+	return out, nil
+}
+
+// commandLine reads a command in list form, or in string form split on spaces.
+// Quoting in the string form is not interpreted, so it is rejected.
+func commandLine(v any) ([]string, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if strings.ContainsAny(x, `"'\`) {
+			return nil, fmt.Errorf("quoted strings are not supported; use the list form")
+		}
+		return strings.Fields(x), nil
+	case []any:
+		out := make([]string, 0, len(x))
+		for _, item := range x {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("must be a string or a list")
+}
+
+// resourceLimits converts deploy.resources, or returns nil when it sets nothing.
+func resourceLimits(d *Deploy) (*models.ResourceLimits, error) {
+	var l models.ResourceLimits
+	if c := d.Resources.Limits.Cpus; c != nil {
+		cpus, err := strconv.ParseFloat(fmt.Sprint(c), 64)
+		if err != nil {
+			return nil, fmt.Errorf("limits.cpus: %v", err)
+		}
+		l.Cpus = &cpus
+	}
+	for _, m := range []struct {
+		key string
+		s   string
+		to  **models.ByteSize
+	}{
+		{"limits.memory", d.Resources.Limits.Memory, &l.Memory},
+		{"reservations.memory", d.Resources.Reservations.Memory, &l.MemoryReservation},
+	} {
+		if m.s == "" {
+			continue
+		}
+		// Compose sizes use Docker's binary units ("512m" is 512 MiB).
+		n, err := units.RAMInBytes(m.s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", m.key, err)
+		}
+		size := models.ByteSize(n)
+		*m.to = &size
+	}
+	l.PidsLimit = d.Resources.Limits.Pids
+	if l == (models.ResourceLimits{}) {
+		return nil, nil
+	}
+	return &l, nil
+}
+
+// healthcheck converts a compose healthcheck; disable turns off the image's own.
+func healthcheck(h *Healthcheck) (*models.Healthcheck, error) {
+	if h.Disable {
+		return &models.Healthcheck{Test: []string{"NONE"}}, nil
+	}
+	hc := &models.Healthcheck{Retries: h.Retries}
+	switch t := h.Test.(type) {
+	case string:
+		hc.Test = []string{"CMD-SHELL", t}
+	case []any:
+		for _, item := range t {
+			hc.Test = append(hc.Test, fmt.Sprint(item))
+		}
+	default:
+		return nil, fmt.Errorf("test must be a string or a list")
+	}
+	for _, d := range []struct {
+		key string
+		s   string
+		to  **models.Duration
+	}{
+		{"interval", h.Interval, &hc.Interval},
+		{"timeout", h.Timeout, &hc.Timeout},
+		{"start_period", h.StartPeriod, &hc.StartPeriod},
+	} {
+		if d.s == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", d.key, err)
+		}
+		md := models.Duration(v)
+		*d.to = &md
+	}
+	return hc, nil
+}
+
+func intValue(v any) (int, error) {
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case string:
+		return strconv.Atoi(n)
+	}
+	return 0, fmt.Errorf("want a port number, got %v", v)
+}
+
+// pullPolicy maps compose's pull_policy onto the runner's. Compose's missing is
+// the runner's if-not-present; build and refresh intervals have no equivalent.
+func pullPolicy(v string) (models.PullPolicy, error) {
+	switch v {
+	case "always":
+		return models.PullAlways, nil
+	case "missing", "if_not_present":
+		return models.PullIfNotPresent, nil
+	case "never":
+		return models.PullNever, nil
+	}
+	return "", fmt.Errorf("unsupported pull_policy %q (valid: always, missing, if_not_present, never)", v)
+}
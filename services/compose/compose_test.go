@@ -0,0 +1,43 @@
+package compose
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVolumeMount(t *testing.T) {
+	for _, tc := range []struct {
+		volume any
+		name   string
+		path   string
+		err    string
+	}{
+		{volume: "data:/var/lib/data", name: "data", path: "/var/lib/data"},
+		{volume: "data:/var/lib/data:rw", name: "data", path: "/var/lib/data"},
+		{volume: "/scratch", path: "/scratch"},
+		{volume: map[string]any{"type": "volume", "source": "data", "target": "/data"}, name: "data", path: "/data"},
+		{volume: "data:/var/lib/data:ro", err: "read-only"},
+		{volume: map[string]any{"type": "volume", "source": "data", "target": "/data", "read_only": true}, err: "read-only"},
+		{volume: "data:/var/lib/data:nocopy", err: "unsupported mount option"},
+		{volume: "./src:/src", err: "no bind mounts"},
+	} {
+		m, err := volumeMount(tc.volume)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: got error %v, want one about %s", tc.volume, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tc.volume, err)
+			continue
+		}
+		var name string
+		if m.Name != nil {
+			name = *m.Name
+		}
+		if name != tc.name || m.MountPath != tc.path {
+			t.Errorf("%v: got %q at %q, want %q at %q", tc.volume, name, m.MountPath, tc.name, tc.path)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/progress"
+)
+
+// Mode selects how a run is shown on the console.
+type Mode string
+
+const (
+	ModeAuto   Mode = "auto"   // pretty on a terminal, plain otherwise
+	ModePlain  Mode = "plain"  // log lines only, as the agent has always seen them
+	ModePretty Mode = "pretty" // phases, spinners and a summary table for people
+	ModeJSON   Mode = "json"   // one JSON event per line on stdout, for machines
+)
+
+var modes = []Mode{ModeAuto, ModePlain, ModePretty, ModeJSON}
+
+// ParseMode parses an --output value; empty means ModeAuto.
+func ParseMode(s string) (Mode, error) {
+	if s == "" {
+		return ModeAuto, nil
+	}
+	for _, m := range modes {
+		if string(m) == s {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output mode %q (valid: %v)", s, modes)
+}
+
+// Summary is how a run ended, rendered once at the end.
+type Summary struct {
+	Message  models.UserMessage
+	Job      string
+	Run      string
+	Action   string
+	Outcome  models.RunOutcome
+	Err      error
+	Warnings []string
+	Services []models.ServiceTiming
+	Elapsed  time.Duration
+
+	Readiness *models.JobReadiness // nil when not evaluated
+}
+
+// Renderer shows a run's progress and its summary.
+type Renderer interface {
+	progress.Reporter
+	Summary(s Summary)
+	Close()
+}
+
+// New returns the renderer for mode. Auto picks pretty when stderr is a terminal.
+// Pretty output takes over the log package's output so log lines don't tear
+// through the spinner; Close gives it back.
+func New(mode Mode) Renderer {
+	if mode == ModeAuto {
+		mode = ModePlain
+		if isTerminal(os.Stderr) && os.Getenv("TERM") != "dumb" {
+			mode = ModePretty
+		}
+	}
+
+	switch mode {
+	case ModePretty:
+		return newPretty(os.Stderr, os.Getenv("NO_COLOR") == "")
+	case ModeJSON:
+		return &jsonRenderer{enc: json.NewEncoder(os.Stdout)}
+	default:
+		return plain{}
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// plain keeps the runner's log output as it is and logs the outcome at the end.
+type plain struct {
+	progress.Nop
+}
+
+func (plain) Summary(s Summary) {
+	if s.Err != nil {
+		log.Printf("%s: %v", s.Outcome, s.Err)
+	} else if s.Outcome != models.RunOutcomeSucceeded {
+		log.Printf("%s: %d warning(s)", s.Outcome, len(s.Warnings))
+	}
+	if s.Readiness != nil && !s.Readiness.Ready {
+		log.Printf("job not ready: %s", strings.Join(s.Readiness.Reasons, "; "))
+	}
+}
+
+func (plain) Close() {}
+
+// jsonRenderer writes one JSON object per event.
+type jsonRenderer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+type jsonEvent struct {
+	Time      time.Time              `json:"time"`
+	Event     string                 `json:"event"`
+	Phase     string                 `json:"phase,omitempty"`
+	Service   string                 `json:"service,omitempty"`
+	ElapsedMS int64                  `json:"elapsed_ms,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Job       string                 `json:"job,omitempty"`
+	Run       string                 `json:"run,omitempty"`
+	Action    string                 `json:"action,omitempty"`
+	Outcome   models.RunOutcome      `json:"outcome,omitempty"`
+	Message   *models.UserMessage    `json:"message,omitempty"`
+	Warnings  []string               `json:"warnings,omitempty"`
+	Services  []models.ServiceTiming `json:"services,omitempty"`
+	Readiness *models.JobReadiness   `json:"readiness,omitempty"`
+}
+
+func (r *jsonRenderer) emit(e jsonEvent, elapsed time.Duration, err error) {
+	e.Time = time.Now().UTC()
+	e.ElapsedMS = elapsed.Milliseconds()
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.enc.Encode(e)
+}
+
+func (r *jsonRenderer) PhaseStarted(name string) {
+	r.emit(jsonEvent{Event: "phase_started", Phase: name}, 0, nil)
+}
+
+func (r *jsonRenderer) PhaseFinished(name string, elapsed time.Duration, err error) {
+	r.emit(jsonEvent{Event: "phase_finished", Phase: name}, elapsed, err)
+}
+
+func (r *jsonRenderer) ServiceStarted(name string) {
+	r.emit(jsonEvent{Event: "service_started", Service: name}, 0, nil)
+}
+
+func (r *jsonRenderer) ServiceFinished(name string, elapsed time.Duration, err error) {
+	r.emit(jsonEvent{Event: "service_finished", Service: name}, elapsed, err)
+}
+
+func (r *jsonRenderer) ServiceSkipped(name string) {
+	r.emit(jsonEvent{Event: "service_skipped", Service: name}, 0, nil)
+}
+
+func (r *jsonRenderer) Summary(s Summary) {
+	r.emit(jsonEvent{
+		Event:     "summary",
+		Job:       s.Job,
+		Run:       s.Run,
+		Action:    s.Action,
+		Outcome:   s.Outcome,
+		Message:   &s.Message,
+		Warnings:  s.Warnings,
+		Services:  s.Services,
+		Readiness: s.Readiness,
+	}, s.Elapsed, s.Err)
+}
+
+func (r *jsonRenderer) Close() {}
+
+// Colors, only used when color is on.
+const (
+	reset  = "\033[0m"
+	bold   = "\033[1m"
+	dim    = "\033[2m"
+	red    = "\033[31m"
+	green  = "\033[32m"
+	yellow = "\033[33m"
+	cyan   = "\033[36m"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+const spinnerInterval = 100 * time.Millisecond
+
+// pretty draws finished steps as lines and the services in flight on one spinner
+// line at the bottom, which is cleared and redrawn around everything else written.
+type pretty struct {
+	mu     sync.Mutex
+	out    io.Writer
+	color  bool
+	active map[string]time.Time
+	order  []string // active services in start order
+	frame  int
+	drawn  bool // the spinner line is on screen
+
+	logOut   io.Writer
+	logFlags int
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+func newPretty(out io.Writer, color bool) *pretty {
+	r := &pretty{
+		out:      out,
+		color:    color,
+		active:   map[string]time.Time{},
+		logOut:   log.Writer(),
+		logFlags: log.Flags(),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	log.SetOutput(logWriter{r})
+	log.SetFlags(0)
+	go r.spin()
+	return r
+}
+
+func (r *pretty) paint(color, s string) string {
+	if !r.color {
+		return s
+	}
+	return color + s + reset
+}
+
+// clear removes the spinner line. r.mu must be held.
+func (r *pretty) clear() {
+	if r.drawn {
+		fmt.Fprint(r.out, "\r\033[K")
+		r.drawn = false
+	}
+}
+
+// draw puts the spinner line back. r.mu must be held.
+func (r *pretty) draw() {
+	if len(r.order) == 0 {
+		return
+	}
+	started := r.active[r.order[0]]
+	line := fmt.Sprintf("%s %s %s", r.paint(cyan, spinnerFrames[r.frame%len(spinnerFrames)]),
+		strings.Join(r.order, ", "), r.paint(dim, round(time.Since(started)).String()))
+	fmt.Fprint(r.out, line)
+	r.drawn = true
+}
+
+// println writes a line above the spinner.
+func (r *pretty) println(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clear()
+	fmt.Fprintf(r.out, format+"\n", args...)
+	r.draw()
+}
+
+func (r *pretty) spin() {
+	defer close(r.stopped)
+	ticker := time.NewTicker(spinnerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		r.mu.Lock()
+		r.frame++
+		r.clear()
+		r.draw()
+		r.mu.Unlock()
+	}
+}
+
+func (r *pretty) PhaseStarted(name string) {
+	r.println("%s", r.paint(bold+cyan, "› "+name))
+}
+
+func (r *pretty) PhaseFinished(name string, elapsed time.Duration, err error) {
+	if err != nil {
+		r.println("%s %s", r.paint(red, "✗ "+name), r.paint(dim, round(elapsed).String()))
+		return
+	}
+	r.println("%s %s", r.paint(green, "✓ "+name), r.paint(dim, round(elapsed).String()))
+}
+
+func (r *pretty) ServiceStarted(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active[name] = time.Now()
+	r.order = append(r.order, name)
+	r.clear()
+	r.draw()
+}
+
+func (r *pretty) ServiceFinished(name string, elapsed time.Duration, err error) {
+	r.mu.Lock()
+	delete(r.active, name)
+	for i, n := range r.order {
+		if n == name {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		r.println("  %s %s %s", r.paint(red, "✗"), name, r.paint(dim, round(elapsed).String()))
+		return
+	}
+	r.println("  %s %s %s", r.paint(green, "✓"), name, r.paint(dim, round(elapsed).String()))
+}
+
+func (r *pretty) ServiceSkipped(name string) {
+	r.println("  %s", r.paint(dim, "- "+name+" (unchanged)"))
+}
+
+func (r *pretty) Summary(s Summary) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clear()
+
+	fmt.Fprintln(r.out)
+	if len(s.Services) > 0 {
+		width := len("SERVICE")
+		for _, t := range s.Services {
+			width = max(width, len(t.Service))
+		}
+		fmt.Fprintln(r.out, r.paint(bold, fmt.Sprintf("%-*s  %10s  %10s", width, "SERVICE", "DURATION", "BUDGET")))
+		for _, t := range s.Services {
+			budget := "-"
+			if t.Budget != nil {
+				budget = round(time.Duration(*t.Budget)).String()
+			}
+			row := fmt.Sprintf("%-*s  %10s  %10s", width, t.Service, round(time.Duration(t.Duration)), budget)
+			if t.OverBudget {
+				row = r.paint(yellow, row)
+			}
+			fmt.Fprintln(r.out, row)
+		}
+		fmt.Fprintln(r.out)
+	}
+
+	for _, w := range s.Warnings {
+		fmt.Fprintln(r.out, r.paint(yellow, "! "+w))
+	}
+	if s.Readiness != nil && !s.Readiness.Ready {
+		fmt.Fprintln(r.out, r.paint(bold+yellow, "job not ready:"))
+		for _, reason := range s.Readiness.Reasons {
+			fmt.Fprintln(r.out, r.paint(yellow, "  "+reason))
+		}
+	}
+
+	line := fmt.Sprintf("%s %s in %s", s.Action, s.Outcome, round(s.Elapsed))
+	switch {
+	case s.Err != nil:
+		fmt.Fprintln(r.out, r.paint(bold+red, line))
+		fmt.Fprintln(r.out, r.paint(red, s.Message.Text))
+		fmt.Fprintln(r.out, r.paint(dim, s.Err.Error()))
+	case s.Outcome == models.RunOutcomeSucceeded:
+		fmt.Fprintln(r.out, r.paint(bold+green, line))
+	default:
+		fmt.Fprintln(r.out, r.paint(bold+yellow, line))
+	}
+}
+
+func (r *pretty) Close() {
+	close(r.stop)
+	<-r.stopped
+
+	r.mu.Lock()
+	r.clear()
+	r.mu.Unlock()
+
+	log.SetOutput(r.logOut)
+	log.SetFlags(r.logFlags)
+}
+
+// logWriter routes log output above the spinner, dimmed.
+type logWriter struct {
+	r *pretty
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.r.println("%s", w.r.paint(dim, strings.TrimRight(string(p), "\n")))
+	return len(p), nil
+}
+
+// round keeps durations readable: tenths of a second, or whole seconds past a minute.
+func round(d time.Duration) time.Duration {
+	if d >= time.Minute {
+		return d.Round(time.Second)
+	}
+	return d.Round(100 * time.Millisecond)
+}
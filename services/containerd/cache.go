@@ -0,0 +1,113 @@
+package containerd
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+)
+
+// cacheDir backs a cache. The key is kept next to it, as the name is its hash.
+func (p *ContainerdPlatform) cacheDir(job uuid.UUID, key string) string {
+	return filepath.Join(p.jobDir(job), "caches", platforms.CacheID(key))
+}
+
+// cacheMounts creates the step's cache directories and returns where each is
+// mounted. They are not rolled back with the run's volumes.
+func (p *ContainerdPlatform) cacheMounts(ctx context.Context, job uuid.UUID, service *models.MetadataService) (map[string]string, error) {
+	if len(service.Caches) == 0 {
+		return nil, nil
+	}
+	st, err := p.steps.State(job)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	for _, c := range service.Caches {
+		key, err := platforms.CacheKey(c, p.steps.Lookup)
+		if err != nil {
+			return nil, runerr.Wrap(ctx, "resolve cache key", c.MountPath, err)
+		}
+		dir := p.cacheDir(job, key)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, runerr.Wrap(ctx, "create volume directory", dir, err)
+		}
+		out[dir] = c.MountPath
+		platforms.TouchCache(st, key)
+	}
+	if err := p.state.Save(st); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// evictCaches removes the job's least recently used caches once they outgrow
+// the cache limit. Caches only save time, so failures are warnings.
+func (p *ContainerdPlatform) evictCaches(job uuid.UUID, since time.Time) {
+	limit, err := platforms.CacheLimit()
+	if err != nil {
+		p.warn("evict caches: %v", err)
+		return
+	}
+	st, err := p.steps.State(job)
+	if err != nil {
+		p.warn("evict caches: %v", err)
+		return
+	}
+	sizes := map[string]int64{}
+	for key := range st.Caches {
+		size, err := dirSize(p.cacheDir(job, key))
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed some other way.
+			delete(st.Caches, key)
+			continue
+		}
+		if err != nil {
+			p.warn("evict caches: measure cache %q: %v", key, err)
+			return
+		}
+		sizes[key] = size
+	}
+
+	for _, key := range platforms.EvictCaches(sizes, maps.Clone(st.Caches), since, limit) {
+		if err := os.RemoveAll(p.cacheDir(job, key)); err != nil {
+			p.warn("evict cache %q: %v", key, err)
+			continue
+		}
+		delete(st.Caches, key)
+		p.changed()
+	}
+	if err := p.state.Save(st); err != nil {
+		p.warn("evict caches: %v", err)
+	}
+}
+
+// dirSize adds up the size of the regular files under dir.
+func dirSize(dir string) (int64, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return 0, err
+	}
+	var total int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
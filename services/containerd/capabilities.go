@@ -0,0 +1,34 @@
+package containerd
+
+import "github.com/ezenkico/deploy-commander/runner/models"
+
+// Capabilities reports what the containerd platform can honor. Containers share
+// the host network, so there is no port remapping, isolation or aliasing.
+func (p *ContainerdPlatform) Capabilities() models.PlatformCapabilities {
+	return models.PlatformCapabilities{
+		Platform:     "containerd",
+		ScaleModes:   []models.ScaleMode{models.ScaleModeSingle},
+		Strategies:   []models.DeployStrategy{models.StrategyRecreate},
+		Hostnames:    true,
+		MemoryLimits: true,
+		CPULimits:    true,
+		PidsLimits:   true,
+		CPUPinning:   true,
+		MemoryTuning: true,
+		SharedMemory: true,
+		KernelCaps:   true,
+		GroupAdd:     true,
+		CgroupParent: true,
+		UsernsMode:   true, // containers always share the host's user namespace
+		StopSignals:  true,
+		Restarts:     true,
+		SecurityOpts: true,
+		Privileged:   true,
+		Devices:      true,
+		RunnerSteps:  true,
+		SSHKeys:      true,
+		Caches:       true,
+		Files:        true,
+		PullPolicies: true,
+	}
+}
@@ -0,0 +1,249 @@
+package containerd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/phase"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+	"github.com/ezenkico/deploy-commander/runner/services/template"
+	"github.com/google/uuid"
+
+	containerd "github.com/containerd/containerd/v2/client"
+	"github.com/containerd/containerd/v2/pkg/namespaces"
+	"google.golang.org/grpc"
+)
+
+const (
+	defaultAddress  = "/run/containerd/containerd.sock"
+	defaultRoot     = "/var/lib/deploy-commander"
+	rollbackTimeout = 2 * time.Minute
+)
+
+// ContainerdPlatform implements interfaces.Platform on containerd directly, for hosts
+// without a Docker daemon. Each job gets its own containerd namespace; containers
+// share the host network and volumes are host directories under Root.
+type ContainerdPlatform struct {
+	client *containerd.Client
+	comm   *agent.AgentCommunication
+	state  *state.Store
+
+	// Host directory for per-job volumes and logs
+	root string
+
+	// The run's generation, recorded on the containers it creates
+	generation int64
+
+	// Runner-role steps: the job state, shared by update filtering and step
+	// recording, and the outputs of steps that ran (or were skipped) in this run
+	steps *platforms.Steps
+
+	// Run-time facts about services for templated connection metadata
+	facts template.Facts
+
+	// The run's metadata.labels, added to everything it creates
+	jobLabels map[string]string
+
+	// The run's cgroup_parent, if any
+	cgroupParent string
+
+	// Volume directories this run created, removed again on rollback
+	createdVolumes []string
+
+	// Whether this run changed anything and which non-fatal problems it hit
+	result models.RunResult
+}
+
+// NewContainerdPlatform connects to containerd at CONTAINERD_ADDRESS
+// (default /run/containerd/containerd.sock). data is the optional
+// models.ContainerdPlatformData.
+func NewContainerdPlatform(comm *agent.AgentCommunication, data *json.RawMessage) (*ContainerdPlatform, error) {
+	root := defaultRoot
+	if data != nil {
+		var pd models.ContainerdPlatformData
+		if err := json.Unmarshal(*data, &pd); err != nil {
+			return nil, fmt.Errorf("parse containerd platform_data: %w", err)
+		}
+		if pd.Root != "" {
+			root = pd.Root
+		}
+	}
+
+	address := os.Getenv("CONTAINERD_ADDRESS")
+	if address == "" {
+		address = defaultAddress
+	}
+
+	c, err := containerd.New(address, containerd.WithExtraDialOpts([]grpc.DialOption{grpc.WithChainUnaryInterceptor(recordEvents)}))
+	if err != nil {
+		return nil, fmt.Errorf("connect to containerd at %q: %w", address, err)
+	}
+
+	return &ContainerdPlatform{
+		client: c,
+		comm:   comm,
+		root:   root,
+	}, nil
+}
+
+// Namespace is the containerd namespace holding everything a job deployed.
+func Namespace(job uuid.UUID) string {
+	return "deploy-commander-" + job.String()
+}
+
+// Run executes the requested action (setup/update/teardown) for the given configuration.
+func (p *ContainerdPlatform) Run(ctx context.Context, config models.Configuration) (models.RunResult, error) {
+	p.result = models.RunResult{}
+	p.createdVolumes = nil
+	ctx = runerr.WithRun(ctx, config.Job, config.Run)
+	ctx = namespaces.WithNamespace(ctx, Namespace(config.Job))
+
+	err := p.run(ctx, config)
+	// A superseded run leaves the job to the run that replaced it.
+	rollback := (config.RollbackOnCancel && phase.Cause(err) != nil || platforms.RollbackRequested(err)) && !errors.Is(err, phase.ErrSuperseded)
+	if err != nil && rollback && config.Action != models.ActionTeardown {
+		// The run context may already be cancelled; give the rollback its own deadline.
+		rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+		defer cancel()
+		if rerr := p.Rollback(rctx, config.Run); rerr != nil {
+			return p.result, errors.Join(err, runerr.Wrap(rctx, "rollback run", config.Run.String(), rerr))
+		}
+	}
+	return p.result, err
+}
+
+// changed records that the run modified platform or agent state.
+func (p *ContainerdPlatform) changed() {
+	p.result.Changed = true
+}
+
+// warn logs a non-fatal problem and records it in the run result.
+func (p *ContainerdPlatform) warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("warning: %s", msg)
+	p.result.Warnings = append(p.result.Warnings, msg)
+}
+
+// jobDir is the host directory for the job's volumes and logs.
+func (p *ContainerdPlatform) jobDir(job uuid.UUID) string {
+	return filepath.Join(p.root, job.String())
+}
+
+func (p *ContainerdPlatform) volumeDir(job uuid.UUID, name string) string {
+	return filepath.Join(p.jobDir(job), "volumes", name)
+}
+
+// runnerVolumeDir backs the runner-provided volume (the one step outputs go to).
+func (p *ContainerdPlatform) runnerVolumeDir(job uuid.UUID) string {
+	return filepath.Join(p.jobDir(job), "runner")
+}
+
+// sshDir holds a runner step's ssh files while it runs.
+func (p *ContainerdPlatform) sshDir(job uuid.UUID, service string) string {
+	return filepath.Join(p.jobDir(job), "ssh", service)
+}
+
+// filesDir holds a service's files, bind-mounted one by one.
+func (p *ContainerdPlatform) filesDir(job uuid.UUID, service string) string {
+	return filepath.Join(p.jobDir(job), "files", service)
+}
+
+func (p *ContainerdPlatform) logPath(job uuid.UUID, service string) string {
+	return filepath.Join(p.jobDir(job), "logs", service+".log")
+}
+
+func (p *ContainerdPlatform) run(ctx context.Context, config models.Configuration) error {
+	timeouts, err := phase.Timeouts(config.PhaseTimeouts)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	p.state = state.New(config.WorkspaceDir())
+	p.generation = config.Generation
+	p.cgroupParent = config.CgroupParent
+	p.steps = platforms.NewSteps(p.state)
+	p.facts = template.Facts{}
+	p.jobLabels = nil
+	if config.Metadata != nil {
+		p.jobLabels = config.Metadata.Labels
+	}
+
+	var needsSetup platforms.ServiceFilter
+	switch config.Action {
+	case models.ActionTeardown:
+		return phase.Run(ctx, phase.Teardown, timeouts[phase.Teardown], func(ctx context.Context) error {
+			return p.Teardown(ctx, config.Job)
+		})
+	case models.ActionUpdate:
+		needsSetup, err = p.updateFilter(ctx, config.Job, config.Run)
+		if err != nil {
+			return err
+		}
+	case models.ActionSetup, models.ActionClone:
+	default:
+		// Port forwards and snapshots have their own entry points.
+		return runerr.Errorf(ctx, "parse action", string(config.Action), "the %s platform does not run action %q", p.Capabilities().Platform, config.Action)
+	}
+
+	metadata := config.Metadata
+	if metadata == nil {
+		return nil
+	}
+
+	err = phase.Run(ctx, phase.Check, timeouts[phase.Check], func(ctx context.Context) error {
+		return p.CheckMetadata(ctx, config.Job, metadata)
+	})
+	if err != nil {
+		return err
+	}
+	err = phase.Run(ctx, phase.Volumes, timeouts[phase.Volumes], func(ctx context.Context) error {
+		return p.VolumeSetup(ctx, config.Job, metadata)
+	})
+	if err != nil {
+		return err
+	}
+	err = phase.Run(ctx, phase.Services, timeouts[phase.Services], func(ctx context.Context) error {
+		return p.ServiceSetup(ctx, config.Job, config.Run, metadata, needsSetup)
+	})
+	if err != nil {
+		return err
+	}
+	err = phase.Run(ctx, phase.Removals, timeouts[phase.Removals], func(ctx context.Context) error {
+		if err := p.RemoveServices(ctx, config.Job, metadata.RemoveServices); err != nil {
+			return err
+		}
+		if err := p.RemoveVolumes(ctx, config.Job, metadata.RemoveVolumes); err != nil {
+			return err
+		}
+		p.evictCaches(config.Job, started)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return phase.Run(ctx, phase.Connections, timeouts[phase.Connections], func(ctx context.Context) error {
+		if p.comm == nil {
+			return nil
+		}
+		connectionPlan, err := template.ExpandConnectionPlan(metadata.Connections, template.Chain(p.facts.Lookup, p.steps.Lookup))
+		if err != nil {
+			return runerr.Wrap(ctx, "expand connection metadata", config.Job.String(), err)
+		}
+		changes, err := p.comm.ApplyConnectionPlan(ctx, connectionPlan)
+		if changes > 0 {
+			p.changed()
+		}
+		return err
+	})
+}
@@ -0,0 +1,42 @@
+package containerd
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/services/events"
+	"google.golang.org/grpc"
+)
+
+// Methods with these prefixes only read or wait.
+var readOnlyMethods = []string{"Get", "List", "Info", "Status", "Wait", "Stats", "Pids", "Version", "Read", "Subscribe", "Check"}
+
+// recordEvents records the client's mutating calls, e.g.
+// containerd.services.tasks.v1.Tasks/Start, in the run's event log.
+func recordEvents(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	name := path.Base(method)
+	for _, p := range readOnlyMethods {
+		if strings.HasPrefix(name, p) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+	}
+	started := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	events.Record(ctx, "containerd", strings.TrimPrefix(method, "/"), eventTarget(req), 0, started, err)
+	return err
+}
+
+// eventTarget is the container or object a request names, if any.
+func eventTarget(req any) string {
+	switch r := req.(type) {
+	case interface{ GetContainerID() string }:
+		return r.GetContainerID()
+	case interface{ GetID() string }:
+		return r.GetID()
+	case interface{ GetName() string }:
+		return r.GetName()
+	}
+	return ""
+}
@@ -0,0 +1,984 @@
+package containerd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containerd/errdefs"
+	cplatforms "github.com/containerd/platforms"
+	"github.com/distribution/reference"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/cpuset"
+	"github.com/ezenkico/deploy-commander/runner/services/device"
+	"github.com/ezenkico/deploy-commander/runner/services/linuxcap"
+	"github.com/ezenkico/deploy-commander/runner/services/logship"
+	"github.com/ezenkico/deploy-commander/runner/services/plan"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/progress"
+	"github.com/ezenkico/deploy-commander/runner/services/readiness"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/secopt"
+	"github.com/ezenkico/deploy-commander/runner/services/secrets"
+	"github.com/ezenkico/deploy-commander/runner/services/template"
+	"github.com/google/uuid"
+	"github.com/moby/sys/signal"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	containerd "github.com/containerd/containerd/v2/client"
+	"github.com/containerd/containerd/v2/contrib/apparmor"
+	"github.com/containerd/containerd/v2/contrib/seccomp"
+	"github.com/containerd/containerd/v2/core/containers"
+	"github.com/containerd/containerd/v2/core/runtime/restart"
+	"github.com/containerd/containerd/v2/pkg/cio"
+	"github.com/containerd/containerd/v2/pkg/identifiers"
+	"github.com/containerd/containerd/v2/pkg/oci"
+)
+
+// Stop timeout when a service sets no stop_grace_period (Docker's default).
+const defaultStopGracePeriod = 10 * time.Second
+
+// CFS period for limits.cpus, in microseconds (the kernel's default).
+const cfsPeriod = 100000
+
+// CheckMetadata validates the metadata against what containerd can run. Features it
+// cannot honor are reported up front from Capabilities.
+func (p *ContainerdPlatform) CheckMetadata(ctx context.Context, job uuid.UUID, metadata *models.Metadata) error {
+	declared, err := platforms.DeclaredVolumeSet(metadata.Volumes)
+	if err != nil {
+		return err
+	}
+	stragglers, err := platforms.CheckServiceVolumeMounts(metadata.Services, declared)
+	if err != nil {
+		return err
+	}
+	// Undeclared volumes must already exist from an earlier run.
+	for name := range *stragglers {
+		if _, err := os.Stat(p.volumeDir(job, name)); err != nil {
+			return runerr.Errorf(ctx, "find volume", name, "not declared in metadata.volumes and does not exist")
+		}
+	}
+
+	for name := range metadata.Services {
+		if err := identifiers.Validate(name); err != nil {
+			return fmt.Errorf("service %q cannot be a containerd container id: %w", name, err)
+		}
+	}
+	if err := checkIpc(metadata.Services); err != nil {
+		return err
+	}
+	return checkCpusets(metadata.Services)
+}
+
+// checkIpc rejects the ipc modes containerd has no equivalent for: tasks cannot
+// join each other's namespaces here, and every task gets a /dev/shm.
+func checkIpc(services map[string]models.MetadataService) error {
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		service := services[name]
+		if service.Ipc == nil {
+			continue
+		}
+		switch *service.Ipc {
+		case "private", "shareable", "host":
+		default:
+			return fmt.Errorf("service %q: ipc %q is not supported on containerd (use private, shareable or host)", name, *service.Ipc)
+		}
+	}
+	return nil
+}
+
+// checkCpusets makes sure cpuset_cpus and cpuset_mems only name CPUs and memory
+// nodes that are online on this host, which is the one containerd runs on.
+func checkCpusets(services map[string]models.MetadataService) error {
+	var cpus, mems []int
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		service := services[name]
+		if service.CpusetCpus == nil && service.CpusetMems == nil {
+			continue
+		}
+		if cpus == nil {
+			var err error
+			if cpus, mems, err = cpuset.Online(); err != nil {
+				return fmt.Errorf("read host cpus: %w", err)
+			}
+		}
+		if err := checkCpuset(service.CpusetCpus, cpus); err != nil {
+			return fmt.Errorf("service %q: cpuset_cpus: %w", name, err)
+		}
+		if err := checkCpuset(service.CpusetMems, mems); err != nil {
+			return fmt.Errorf("service %q: cpuset_mems: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func checkCpuset(value *string, have []int) error {
+	if value == nil {
+		return nil
+	}
+	want, err := cpuset.Parse(*value)
+	if err != nil {
+		return err
+	}
+	return cpuset.Within(want, have)
+}
+
+// VolumeSetup creates a host directory for each declared volume.
+func (p *ContainerdPlatform) VolumeSetup(ctx context.Context, job uuid.UUID, metadata *models.Metadata) error {
+	if metadata.Volumes == nil {
+		return nil
+	}
+	for _, name := range *metadata.Volumes {
+		if err := p.ensureDir(ctx, p.volumeDir(job, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureDir creates dir unless it exists, remembering it for rollback.
+func (p *ContainerdPlatform) ensureDir(ctx context.Context, dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return runerr.Wrap(ctx, "create volume directory", dir, err)
+	}
+	p.createdVolumes = append(p.createdVolumes, dir)
+	p.changed()
+	return nil
+}
+
+func (p *ContainerdPlatform) ServiceSetup(ctx context.Context,
+	job uuid.UUID,
+	run uuid.UUID,
+	metadata *models.Metadata,
+	needsSetup platforms.ServiceFilter) error {
+
+	services := metadata.Services
+	if services == nil {
+		return nil
+	}
+
+	// Launch in the same order the run plan records.
+	order, err := plan.ServiceOrder(services)
+	if err != nil {
+		return err
+	}
+
+	// Everything shares the host network, so every service is at the loopback
+	// address, known before any is set up.
+	for name, service := range services {
+		if !platforms.IsRunnerRole(&service) {
+			p.facts.Set(name, "address", "127.0.0.1")
+		}
+	}
+
+	failed := map[string]bool{} // left out under on_failure: continue
+	rep := progress.From(ctx)
+	for _, name := range order {
+		service := services[name]
+
+		// Stop launching new services once the run is cancelled.
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+
+		if needsSetup != nil {
+			needed, err := needsSetup(name, &service)
+			if err != nil {
+				return err
+			}
+			if !needed {
+				p.recordFacts(name, &service)
+				rep.ServiceSkipped(name)
+				continue
+			}
+		}
+
+		if dep := platforms.Blocker(&service, failed); dep != "" {
+			p.warn("service %q was not deployed: it depends on %q, which failed", name, dep)
+			failed[name] = true
+			rep.ServiceSkipped(name)
+			continue
+		}
+
+		started := time.Now()
+		rep.ServiceStarted(name)
+		sctx, cancel := platforms.WithProgressDeadline(runerr.WithService(ctx, name), &service)
+		err := p.SetupService(sctx, job, run, name, &service)
+		if err != nil && platforms.IsStalled(ctx, sctx) {
+			err = platforms.StallError(runerr.WithService(ctx, name), name, &service, "")
+		}
+		cancel()
+		rep.ServiceFinished(name, time.Since(started), err)
+		if err != nil {
+			if err := platforms.FailService(name, &service, err, p.warn); err != nil {
+				return err
+			}
+			if service.FailurePolicy() == models.FailurePolicyContinue {
+				failed[name] = true
+			}
+			continue
+		}
+		platforms.RecordServiceTiming(&p.result, p.warn, name, &service, time.Since(started))
+		p.recordFacts(name, &service)
+		if platforms.IsRunnerRole(&service) {
+			if err := p.steps.Record(job, run, name, &service); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// recordFacts stores what connection metadata can refer to about a long-running
+// service (see template.Facts). Everything shares the host network, so every
+// network is "host".
+func (p *ContainerdPlatform) recordFacts(name string, service *models.MetadataService) {
+	platforms.RecordFacts(p.facts, name, service, name, "host", func(string) string { return "host" })
+}
+
+// SetupService (re)creates the service's container in the job namespace. Long-running
+// services are kept running by containerd's restart monitor and log to a file under
+// the job directory; runner-role steps stream their output and are waited for.
+func (p *ContainerdPlatform) SetupService(
+	ctx context.Context,
+	job uuid.UUID,
+	run uuid.UUID,
+	serviceName string,
+	service *models.MetadataService,
+) error {
+	if service == nil {
+		return nil
+	}
+	isRunner := platforms.IsRunnerRole(service)
+
+	// Hold the service back until the resources it connects to can take connections.
+	if service.ResourceReadyTimeout != nil && service.Connections != nil {
+		if err := readiness.Wait(ctx, p.comm, *service.Connections, time.Duration(*service.ResourceReadyTimeout)); err != nil {
+			return err
+		}
+	}
+
+	// 1) Env (with ${JOB}, ${RUN}, ${services...}, ${steps...} and secret://
+	// references resolved)
+	env := []string{}
+	lookup := template.Chain(template.Vars(job, run), p.facts.Lookup, p.steps.Lookup)
+	for k, v := range service.Environment {
+		resolved, err := template.Interpolate(v, lookup)
+		if err != nil {
+			return runerr.Wrap(ctx, "resolve env", k, err)
+		}
+		if resolved, err = secrets.Resolve(ctx, resolved); err != nil {
+			return runerr.Wrap(ctx, "resolve secret", k, err)
+		}
+		env = append(env, fmt.Sprintf("%s=%s", k, resolved))
+	}
+	secretEnv, err := platforms.SecretEnv(ctx, p.comm, job, service)
+	if err != nil {
+		return err
+	}
+	env = append(env, secretEnv...)
+	if isRunner {
+		env = append(env, "DC_OUTPUTS="+platforms.StepOutputsPath(run, serviceName))
+	}
+	if isRunner && service.SSH != nil {
+		env = append(env, platforms.SSHEnv())
+	}
+
+	// 2) Volumes are host directories bind-mounted into the container
+	mounts := []specs.Mount{}
+	bind := func(source, target string) {
+		mounts = append(mounts, specs.Mount{
+			Type:        "bind",
+			Source:      source,
+			Destination: target,
+			Options:     []string{"rbind", "rw"},
+		})
+	}
+	if isRunner {
+		if err := p.ensureDir(ctx, p.runnerVolumeDir(job)); err != nil {
+			return err
+		}
+		bind(p.runnerVolumeDir(job), platforms.RunnerVolumeMountPath)
+	}
+	if isRunner && service.SSH != nil {
+		dir := p.sshDir(job, serviceName)
+		if err := p.writeSSHFiles(ctx, dir, service); err != nil {
+			return err
+		}
+		// Removed once the step is done, like the container the files are in.
+		defer os.RemoveAll(dir)
+		mounts = append(mounts, specs.Mount{
+			Type:        "bind",
+			Source:      dir,
+			Destination: platforms.SSHDir,
+			Options:     []string{"rbind", "ro"},
+		})
+	}
+	if isRunner {
+		caches, err := p.cacheMounts(ctx, job, service)
+		if err != nil {
+			return err
+		}
+		for _, dir := range slices.Sorted(maps.Keys(caches)) {
+			bind(dir, caches[dir])
+		}
+	}
+	if service.Volumes != nil {
+		for _, vm := range *service.Volumes {
+			source := p.runnerVolumeDir(job)
+			if vm.Name != nil {
+				source = p.volumeDir(job, *vm.Name)
+			} else if err := p.ensureDir(ctx, source); err != nil {
+				return err
+			}
+			bind(source, vm.MountPath)
+		}
+	}
+	if len(service.Files) > 0 {
+		dir := p.filesDir(job, serviceName)
+		files, err := p.writeFiles(ctx, dir, serviceName, service)
+		if err != nil {
+			return err
+		}
+		for i, f := range files {
+			mounts = append(mounts, specs.Mount{
+				Type:        "bind",
+				Source:      filepath.Join(dir, strconv.Itoa(i)),
+				Destination: f.Path,
+				Options:     []string{"rbind", "ro"},
+			})
+		}
+	}
+
+	// 3) Image
+	imagePlatform, err := platforms.ImagePlatform(service)
+	if err != nil {
+		return runerr.Wrap(ctx, "parse platform", serviceName, err)
+	}
+	image, err := p.ensureImage(ctx, service.Image, imagePlatform, service.ImagePullPolicy())
+	if err != nil {
+		return err
+	}
+
+	// 4) Replace an existing container, keeping the resources it registered
+	resourceNames := make(map[string]struct{})
+	if existing, err := p.client.LoadContainer(ctx, serviceName); err == nil {
+		labels, err := existing.Labels(ctx)
+		if err != nil {
+			return runerr.Wrap(ctx, "read labels of container", serviceName, err)
+		}
+		if err := p.fence(ctx, serviceName, labels); err != nil {
+			return err
+		}
+		p.collectResources(serviceName, labels, resourceNames)
+
+		p.changed()
+		if err := p.stopAndDelete(ctx, existing, labels); err != nil {
+			return err
+		}
+	} else if !errdefs.IsNotFound(err) {
+		return runerr.Wrap(ctx, "load container", serviceName, err)
+	}
+
+	resources := []models.CreateResource{}
+	if service.Resources != nil {
+		for _, spec := range *service.Resources {
+			// Everything shares the host network, so there is no platform connection to hand out.
+			resources = append(resources, models.CreateResource{
+				ResourceType:     spec.ResourceType,
+				Name:             spec.Name,
+				PublicConnection: spec.PublicConnection,
+				Metadata:         spec.Metadata,
+			})
+			if !isRunner {
+				resourceNames[spec.Name] = struct{}{}
+			}
+		}
+	}
+
+	// 5) Labels
+	specHash, err := platforms.ServiceSpecHash(service)
+	if err != nil {
+		return err
+	}
+	labels := map[string]string{
+		"deploy-commander.job":       job.String(),
+		"deploy-commander.run":       run.String(),
+		"deploy-commander.service":   serviceName,
+		"deploy-commander.spec-hash": specHash, // last-applied spec, compared on update
+	}
+	if p.generation > 0 {
+		labels["deploy-commander.generation"] = strconv.FormatInt(p.generation, 10)
+	}
+	if len(resourceNames) > 0 {
+		names := make([]string, 0, len(resourceNames))
+		for name := range resourceNames {
+			names = append(names, name)
+		}
+		b, err := json.Marshal(names)
+		if err != nil {
+			return runerr.Wrap(ctx, "marshal resource names label", serviceName, err)
+		}
+		labels["deploy-commander.resources"] = string(b)
+	}
+	if service.StopSignal != nil {
+		labels[containerd.StopSignalLabel] = *service.StopSignal
+	}
+	if service.StopGracePeriod != nil {
+		labels["deploy-commander.stop-grace-period"] = time.Duration(*service.StopGracePeriod).String()
+	}
+	labels = platforms.MergeLabels(labels, p.jobLabels, service.Labels)
+
+	// 6) Container
+	specOpts := []oci.SpecOpts{
+		oci.WithImageConfig(image),
+		oci.WithEnv(env),
+		oci.WithMounts(mounts),
+		oci.WithHostNamespace(specs.NetworkNamespace),
+		oci.WithHostHostsFile,
+		oci.WithHostResolvconf,
+	}
+	switch {
+	case service.Entrypoint != nil:
+		// Like docker run --entrypoint: the image's CMD goes too.
+		args := append([]string{}, *service.Entrypoint...)
+		if service.Command != nil {
+			args = append(args, *service.Command...)
+		}
+		specOpts = append(specOpts, oci.WithProcessArgs(args...))
+	case service.Command != nil:
+		specOpts = append(specOpts, oci.WithImageConfigArgs(image, *service.Command))
+	}
+	if service.User != nil {
+		// After the image config, which sets the image's user.
+		specOpts = append(specOpts, oci.WithUser(*service.User))
+	}
+	if len(service.GroupAdd) > 0 {
+		// After the user, whose own groups it adds to; names resolve against the
+		// image's /etc/group.
+		specOpts = append(specOpts, oci.WithAppendAdditionalGroups(service.GroupAdd...))
+	}
+	if p.cgroupParent != "" {
+		specOpts = append(specOpts, oci.WithCgroup(cgroupsPath(p.cgroupParent, serviceName)))
+	}
+	if service.WorkingDir != nil {
+		specOpts = append(specOpts, oci.WithProcessCwd(*service.WorkingDir))
+	}
+	if service.Hostname != nil {
+		specOpts = append(specOpts, oci.WithHostname(*service.Hostname))
+	}
+	if service.Domainname != nil {
+		specOpts = append(specOpts, oci.WithDomainname(*service.Domainname))
+	}
+	if mem := service.MemoryLimit(); mem != nil {
+		specOpts = append(specOpts, oci.WithMemoryLimit(uint64(*mem)))
+	}
+	if r := service.Limits; r != nil {
+		if r.Cpus != nil {
+			specOpts = append(specOpts, oci.WithCPUCFS(int64(math.Round(*r.Cpus*cfsPeriod)), cfsPeriod))
+		}
+		if r.MemoryReservation != nil {
+			specOpts = append(specOpts, withMemoryReservation(int64(*r.MemoryReservation)))
+		}
+		if r.PidsLimit != nil {
+			specOpts = append(specOpts, oci.WithPidsLimit(*r.PidsLimit))
+		}
+	}
+	if service.MemorySwap != nil {
+		specOpts = append(specOpts, oci.WithMemorySwap(int64(*service.MemorySwap)))
+	}
+	specOpts = append(specOpts, withOOMTuning(service))
+	if service.CpusetCpus != nil {
+		specOpts = append(specOpts, oci.WithCPUs(*service.CpusetCpus))
+	}
+	if service.CpusetMems != nil {
+		specOpts = append(specOpts, oci.WithCPUsMems(*service.CpusetMems))
+	}
+	if len(service.CapDrop) > 0 {
+		specOpts = append(specOpts, oci.WithDroppedCapabilities(linuxcap.Expand(service.CapDrop)))
+	}
+	if len(service.CapAdd) > 0 {
+		// After the drops, so dropping ALL and adding some back works as on docker.
+		specOpts = append(specOpts, oci.WithAddedCapabilities(linuxcap.Expand(service.CapAdd)))
+	}
+	devices, err := device.ParseAll(service.Devices)
+	if err != nil {
+		return runerr.Wrap(ctx, "parse devices", serviceName, err)
+	}
+	for _, d := range devices {
+		specOpts = append(specOpts, oci.WithDevices(d.Host, d.Container, d.Permissions))
+	}
+	secOpts, err := withSecurityOpts(service.SecurityOpt)
+	if err != nil {
+		return runerr.Wrap(ctx, "parse security_opt", serviceName, err)
+	}
+	specOpts = append(specOpts, secOpts...)
+	if service.Privileged != nil && *service.Privileged {
+		specOpts = append(specOpts, oci.WithPrivileged, oci.WithAllDevicesAllowed, oci.WithHostDevices)
+	}
+	if service.ShmSize != nil {
+		specOpts = append(specOpts, oci.WithDevShmSize((int64(*service.ShmSize)+1023)/1024))
+	}
+	if service.Ipc != nil && *service.Ipc == "host" {
+		specOpts = append(specOpts, oci.WithHostNamespace(specs.IPCNamespace), withHostShm)
+	}
+
+	containerOpts := []containerd.NewContainerOpts{
+		containerd.WithImage(image),
+		containerd.WithNewSnapshot(serviceName+"-snapshot", image),
+		containerd.WithNewSpec(specOpts...),
+		containerd.WithContainerLabels(labels),
+	}
+
+	logPath := p.logPath(job, serviceName)
+	if !isRunner {
+		if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err != nil {
+			return runerr.Wrap(ctx, "create log directory", filepath.Dir(logPath), err)
+		}
+		// The restart monitor restarts the task when it exits (as restart allows) and
+		// keeps logging to the same file.
+		logURI := (&url.URL{Scheme: "file", Path: logPath}).String()
+		containerOpts = append(containerOpts,
+			restart.WithStatus(containerd.Running),
+			restart.WithLogURIString(logURI),
+		)
+		if service.Restart != nil {
+			policy, err := restart.NewPolicy(string(*service.Restart))
+			if err != nil {
+				return runerr.Wrap(ctx, "parse restart", serviceName, err)
+			}
+			containerOpts = append(containerOpts, restart.WithPolicy(policy))
+		}
+	}
+
+	ctr, err := p.client.NewContainer(ctx, serviceName, containerOpts...)
+	if err != nil {
+		return runerr.Wrap(ctx, "create container", serviceName, err)
+	}
+	p.changed()
+
+	// 7) Task
+	if !isRunner {
+		task, err := ctr.NewTask(ctx, cio.LogFile(logPath))
+		if err != nil {
+			return runerr.Wrap(ctx, "create task", serviceName, err)
+		}
+		if err := task.Start(ctx); err != nil {
+			return runerr.Wrap(ctx, "start task", serviceName, err)
+		}
+		if err := platforms.RegisterResources(ctx, p.comm, resources, p.changed); err != nil {
+			// Nothing is left running that the agent does not know about.
+			rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+			defer cancel()
+			if derr := p.stopAndDelete(rctx, ctr, labels); derr != nil {
+				p.warn("remove %q after its resources failed to register: %v", serviceName, derr)
+			}
+			return err
+		}
+		return nil
+	}
+
+	ship := logship.New(ctx, p.comm, run, serviceName, service.LogLimit)
+	defer p.closeLogs(ship, serviceName)
+	stdout, stderr := ship.Tee(os.Stdout, os.Stderr)
+
+	code, err := p.runStep(ctx, ctr, serviceName, stdout, stderr)
+	if err != nil {
+		return err
+	}
+
+	// Collect outputs before the container goes away
+	if code == 0 {
+		outputs, err := p.readStepOutputs(ctx, job, run, serviceName)
+		if err != nil {
+			return err
+		}
+		p.steps.SetOutputs(serviceName, outputs)
+	}
+
+	if err := ctr.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
+		return runerr.Wrap(ctx, "remove container", serviceName, err)
+	}
+
+	// If it failed, surface that as an error after logs are printed
+	if code != 0 {
+		return runerr.Errorf(ctx, "run step", serviceName, "exited with status %d", code)
+	}
+
+	return platforms.RegisterResources(ctx, p.comm, resources, p.changed)
+}
+
+// writeSSHFiles writes a step's deploy key and known_hosts to dir, which is
+// bind-mounted at platforms.SSHDir. They are chowned to the step's user when it is
+// numeric; a user name cannot be resolved against the image here, so those
+// steps get root-owned files.
+func (p *ContainerdPlatform) writeSSHFiles(ctx context.Context, dir string, service *models.MetadataService) error {
+	files, err := platforms.SSHFiles(ctx, service.SSH)
+	if err != nil {
+		return err
+	}
+	uid, gid := -1, -1
+	if service.User != nil {
+		u, g, hasGroup := strings.Cut(*service.User, ":")
+		if n, err := strconv.Atoi(u); err == nil {
+			uid = n
+			if n, err := strconv.Atoi(g); hasGroup && err == nil {
+				gid = n
+			}
+		}
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return runerr.Wrap(ctx, "provision ssh key", dir, err)
+	}
+	if err := os.Lchown(dir, uid, gid); err != nil {
+		return runerr.Wrap(ctx, "provision ssh key", dir, err)
+	}
+	for _, f := range files {
+		name := filepath.Join(dir, f.Name)
+		if err := os.WriteFile(name, f.Content, f.Mode); err != nil {
+			return runerr.Wrap(ctx, "provision ssh key", name, err)
+		}
+		if err := os.Lchown(name, uid, gid); err != nil {
+			return runerr.Wrap(ctx, "provision ssh key", name, err)
+		}
+	}
+	return nil
+}
+
+// writeFiles writes a service's files to dir, named by their index, replacing
+// what an earlier run wrote. A container already running keeps the files it
+// was started with.
+func (p *ContainerdPlatform) writeFiles(ctx context.Context, dir, serviceName string, service *models.MetadataService) ([]platforms.File, error) {
+	files, err := platforms.Files(ctx, serviceName, service)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, runerr.Wrap(ctx, "provision files", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, runerr.Wrap(ctx, "provision files", dir, err)
+	}
+	for i, f := range files {
+		name := filepath.Join(dir, strconv.Itoa(i))
+		if err := os.WriteFile(name, f.Content, f.Mode); err != nil {
+			return nil, runerr.Wrap(ctx, "provision files", name, err)
+		}
+		// WriteFile's mode is masked by the umask.
+		if err := os.Chmod(name, f.Mode); err != nil {
+			return nil, runerr.Wrap(ctx, "provision files", name, err)
+		}
+	}
+	return files, nil
+}
+
+// runStep runs a runner-role container to completion with its output on stdout and
+// stderr and returns the exit code.
+func (p *ContainerdPlatform) runStep(ctx context.Context, ctr containerd.Container, name string, stdout, stderr io.Writer) (uint32, error) {
+	task, err := ctr.NewTask(ctx, cio.NewCreator(cio.WithStreams(nil, stdout, stderr)))
+	if err != nil {
+		return 0, runerr.Wrap(ctx, "create task", name, err)
+	}
+	defer task.Delete(context.WithoutCancel(ctx), containerd.WithProcessKill)
+
+	// Wait must be set up before Start so a fast exit is not missed.
+	exitC, err := task.Wait(ctx)
+	if err != nil {
+		return 0, runerr.Wrap(ctx, "wait task", name, err)
+	}
+	if err := task.Start(ctx); err != nil {
+		return 0, runerr.Wrap(ctx, "start task", name, err)
+	}
+
+	select {
+	case status := <-exitC:
+		code, _, err := status.Result()
+		if err != nil {
+			return 0, runerr.Wrap(ctx, "wait task", name, err)
+		}
+		return code, nil
+	case <-ctx.Done():
+		return 0, context.Cause(ctx)
+	}
+}
+
+// readStepOutputs reads a finished step's outputs file from the runner volume directory.
+// A step that wrote no outputs file has no outputs.
+func (p *ContainerdPlatform) readStepOutputs(ctx context.Context, job uuid.UUID, run uuid.UUID, step string) (map[string]string, error) {
+	rel := strings.TrimPrefix(platforms.StepOutputsPath(run, step), platforms.RunnerVolumeMountPath)
+	f, err := os.Open(filepath.Join(p.runnerVolumeDir(job), filepath.FromSlash(rel)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return nil, runerr.Wrap(ctx, "read outputs of step", step, err)
+	}
+	defer f.Close()
+	return platforms.ParseStepOutputs(f)
+}
+
+// ensureImage returns the image from the job namespace, pulling and unpacking it
+// as policy asks: again, if missing, or never.
+func (p *ContainerdPlatform) ensureImage(ctx context.Context, ref string, platform *ocispec.Platform, policy models.PullPolicy) (containerd.Image, error) {
+	named, err := reference.ParseDockerRef(ref)
+	if err != nil {
+		return nil, runerr.Wrap(ctx, "parse image", ref, err)
+	}
+	name := named.String()
+
+	pullOpts := []containerd.RemoteOpt{containerd.WithPullUnpack}
+	image, err := p.client.GetImage(ctx, name)
+	if platform != nil {
+		matcher := cplatforms.Only(*platform)
+		pullOpts = append(pullOpts, containerd.WithPlatformMatcher(matcher))
+		if err == nil {
+			// The image may only have been pulled for the host's platform.
+			image = containerd.NewImageWithPlatform(p.client, image.Metadata(), matcher)
+			if _, err = image.Config(ctx); err != nil && !errdefs.IsNotFound(err) {
+				return nil, runerr.Wrap(ctx, "inspect image", name, err)
+			}
+		}
+	}
+	if err == nil && policy != models.PullAlways {
+		return image, nil
+	}
+	if err != nil && !errdefs.IsNotFound(err) {
+		return nil, runerr.Wrap(ctx, "inspect image", name, err)
+	}
+	if err != nil && policy == models.PullNever {
+		return nil, runerr.Wrap(ctx, "inspect image", name, fmt.Errorf("pull_policy is never: %w", err))
+	}
+
+	var had digest.Digest
+	if err == nil {
+		had = image.Target().Digest
+	}
+	image, err = p.client.Pull(ctx, name, pullOpts...)
+	if err != nil {
+		return nil, runerr.Wrap(ctx, "pull image", name, err)
+	}
+	// Pulling an unmoved tag again changes nothing.
+	if image.Target().Digest != had {
+		p.changed()
+	}
+	return image, nil
+}
+
+// stopAndDelete stops the container's task (its stop signal, SIGTERM by default,
+// then SIGKILL after its stop grace period) and deletes the container and its
+// snapshot.
+func (p *ContainerdPlatform) stopAndDelete(ctx context.Context, ctr containerd.Container, labels map[string]string) error {
+	// Tell the restart monitor to leave the container alone first.
+	if _, ok := labels[restart.StatusLabel]; ok {
+		if _, err := ctr.SetLabels(ctx, map[string]string{restart.StatusLabel: string(containerd.Stopped)}); err != nil {
+			return runerr.Wrap(ctx, "disable restarts of container", ctr.ID(), err)
+		}
+	}
+
+	sig := syscall.SIGTERM
+	if v, ok := labels[containerd.StopSignalLabel]; ok {
+		if s, err := signal.ParseSignal(v); err == nil {
+			sig = s
+		}
+	}
+	grace := defaultStopGracePeriod
+	if v, ok := labels["deploy-commander.stop-grace-period"]; ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			grace = d
+		}
+	}
+
+	task, err := ctr.Task(ctx, nil)
+	if err == nil {
+		exitC, err := task.Wait(ctx)
+		if err != nil {
+			return runerr.Wrap(ctx, "wait task", ctr.ID(), err)
+		}
+		if err := task.Kill(ctx, sig); err != nil && !errdefs.IsNotFound(err) {
+			return runerr.Wrap(ctx, "stop task", ctr.ID(), err)
+		}
+		select {
+		case <-exitC:
+		case <-time.After(grace):
+			_ = task.Kill(ctx, syscall.SIGKILL)
+			<-exitC
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+		if _, err := task.Delete(ctx); err != nil && !errdefs.IsNotFound(err) {
+			return runerr.Wrap(ctx, "delete task", ctr.ID(), err)
+		}
+	} else if !errdefs.IsNotFound(err) {
+		return runerr.Wrap(ctx, "load task", ctr.ID(), err)
+	}
+
+	if err := ctr.Delete(ctx, containerd.WithSnapshotCleanup); err != nil && !errdefs.IsNotFound(err) {
+		return runerr.Wrap(ctx, "remove container", ctr.ID(), err)
+	}
+	return nil
+}
+
+// fence refuses to replace or remove a container a newer run created.
+func (p *ContainerdPlatform) fence(ctx context.Context, container string, labels map[string]string) error {
+	if err := platforms.Fence(labels, "deploy-commander.generation", p.generation); err != nil {
+		return runerr.Wrap(ctx, "fence run", container, err)
+	}
+	return nil
+}
+
+// collectResources adds the names in a container's deploy-commander.resources label to names.
+func (p *ContainerdPlatform) collectResources(container string, labels map[string]string, names map[string]struct{}) {
+	v, ok := labels["deploy-commander.resources"]
+	if !ok || v == "" {
+		return
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(v), &list); err != nil {
+		p.warn("container %q has a malformed deploy-commander.resources label: %v", container, err)
+		return
+	}
+	for _, n := range list {
+		if n != "" {
+			names[n] = struct{}{}
+		}
+	}
+}
+
+// labelFilter is a containerd container filter matching label key=value.
+func labelFilter(key, value string) string {
+	return "labels." + strconv.Quote(key) + "==" + value
+}
+
+// closeLogs finishes forwarding a step's logs and warns if the rate limit dropped any.
+func (p *ContainerdPlatform) closeLogs(ship *logship.Shipper, serviceName string) {
+	if n := ship.Close(); n > 0 {
+		p.warn("service %q: %d log line(s) over the log limit were not forwarded to the agent", serviceName, n)
+	}
+}
+
+// withHostShm replaces the task's own /dev/shm with the host's, which is what
+// sharing the host's IPC namespace means for POSIX shared memory.
+func withHostShm(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+	for i, m := range s.Mounts {
+		if filepath.Clean(m.Destination) == "/dev/shm" {
+			s.Mounts[i] = specs.Mount{Destination: "/dev/shm", Type: "bind", Source: "/dev/shm", Options: []string{"rbind", "rw"}}
+			return nil
+		}
+	}
+	return nil
+}
+
+// cgroupsPath places a container under the job's cgroup parent: a systemd
+// slice takes runc's slice:prefix:name form, anything else is a cgroupfs path.
+func cgroupsPath(parent, id string) string {
+	if strings.HasSuffix(parent, ".slice") {
+		return parent + ":deploy-commander:" + id
+	}
+	return filepath.Join("/", parent, id)
+}
+
+// withMemoryReservation sets the soft memory limit, which oci has no option for.
+func withMemoryReservation(bytes int64) oci.SpecOpts {
+	return func(ctx context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		if s.Linux == nil {
+			s.Linux = &specs.Linux{}
+		}
+		if s.Linux.Resources == nil {
+			s.Linux.Resources = &specs.LinuxResources{}
+		}
+		if s.Linux.Resources.Memory == nil {
+			s.Linux.Resources.Memory = &specs.LinuxMemory{}
+		}
+		s.Linux.Resources.Memory.Reservation = &bytes
+		return nil
+	}
+}
+
+// withSecurityOpts maps security_opt onto the spec. The default spec already
+// sets no_new_privileges and has no seccomp profile, so no-new-privileges=false
+// and seccomp=unconfined undo those; SELinux labels are not supported.
+func withSecurityOpts(entries []string) ([]oci.SpecOpts, error) {
+	opts, err := secopt.ParseAll(entries)
+	if err != nil {
+		return nil, err
+	}
+	var out []oci.SpecOpts
+	for _, o := range opts {
+		switch o.Kind {
+		case secopt.NoNewPrivileges:
+			if o.Value == "true" {
+				out = append(out, oci.WithNoNewPrivileges)
+			} else {
+				out = append(out, oci.WithNewPrivileges)
+			}
+		case secopt.Seccomp:
+			if o.Custom() {
+				out = append(out, seccomp.WithProfile(o.Value))
+			} else {
+				out = append(out, withoutSeccomp)
+			}
+		case secopt.AppArmor:
+			if o.Value != secopt.Unconfined {
+				out = append(out, apparmor.WithProfile(o.Value))
+			}
+		case secopt.Label:
+			return nil, fmt.Errorf("security_opt %q: SELinux labels are not supported on containerd", o.Kind+"="+o.Value)
+		}
+	}
+	return out, nil
+}
+
+func withoutSeccomp(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+	if s.Linux != nil {
+		s.Linux.Seccomp = nil
+	}
+	return nil
+}
+
+// withOOMTuning applies memory_swappiness, oom_kill_disable and oom_score_adj,
+// which oci has no options for.
+func withOOMTuning(service *models.MetadataService) oci.SpecOpts {
+	return func(ctx context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		if s.Process != nil && service.OomScoreAdj != nil {
+			adj := *service.OomScoreAdj
+			s.Process.OOMScoreAdj = &adj
+		}
+		if service.MemorySwappiness == nil && service.OomKillDisable == nil {
+			return nil
+		}
+		if s.Linux == nil {
+			s.Linux = &specs.Linux{}
+		}
+		if s.Linux.Resources == nil {
+			s.Linux.Resources = &specs.LinuxResources{}
+		}
+		if s.Linux.Resources.Memory == nil {
+			s.Linux.Resources.Memory = &specs.LinuxMemory{}
+		}
+		if service.MemorySwappiness != nil {
+			swappiness := uint64(*service.MemorySwappiness)
+			s.Linux.Resources.Memory.Swappiness = &swappiness
+		}
+		s.Linux.Resources.Memory.DisableOOMKiller = service.OomKillDisable
+		return nil
+	}
+}
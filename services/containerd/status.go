@@ -0,0 +1,59 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+
+	containerd "github.com/containerd/containerd/v2/client"
+	"github.com/containerd/containerd/v2/pkg/namespaces"
+)
+
+// Status lists the job's containers with their task state, sorted by service name.
+func (p *ContainerdPlatform) Status(ctx context.Context, job uuid.UUID) ([]models.ServiceStatus, error) {
+	ctx = namespaces.WithNamespace(ctx, Namespace(job))
+
+	containers, err := p.client.Containers(ctx, labelFilter("deploy-commander.job", job.String()))
+	if err != nil {
+		return nil, runerr.Wrap(ctx, "list containers", job.String(), err)
+	}
+
+	out := make([]models.ServiceStatus, 0, len(containers))
+	for _, ctr := range containers {
+		info, err := ctr.Info(ctx)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				continue
+			}
+			return nil, runerr.Wrap(ctx, "inspect container", ctr.ID(), err)
+		}
+
+		state := "created"
+		status := ""
+		if task, err := ctr.Task(ctx, nil); err == nil {
+			if s, err := task.Status(ctx); err == nil {
+				state = string(s.Status)
+				if s.Status == containerd.Stopped {
+					status = fmt.Sprintf("exited (%d)", s.ExitStatus)
+				}
+			}
+		}
+
+		out = append(out, models.ServiceStatus{
+			Service:   info.Labels["deploy-commander.service"],
+			Container: ctr.ID(),
+			Image:     info.Image,
+			State:     state,
+			Status:    status,
+			Run:       info.Labels["deploy-commander.run"],
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Service < out[j].Service })
+	return out, nil
+}
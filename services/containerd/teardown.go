@@ -0,0 +1,214 @@
+package containerd
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+
+	containerd "github.com/containerd/containerd/v2/client"
+	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+)
+
+// removeLabeledContainers stops and removes every container in the job namespace
+// matching the label, then deletes the agent resources they registered.
+// It keeps going after individual failures; they are recorded in summary and joined.
+func (p *ContainerdPlatform) removeLabeledContainers(ctx context.Context, key, value string, summary *models.TeardownSummary) error {
+	containers, err := p.client.Containers(ctx, labelFilter(key, value))
+	if err != nil {
+		return summary.Fail("container", value, runerr.Wrap(ctx, "list containers", value, err))
+	}
+
+	var errs []error
+	resourceNames := make(map[string]struct{})
+	for _, ctr := range containers {
+		labels, err := ctr.Labels(ctx)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				continue
+			}
+			errs = append(errs, summary.Fail("container", ctr.ID(), runerr.Wrap(ctx, "read labels of container", ctr.ID(), err)))
+			continue
+		}
+		p.collectResources(ctr.ID(), labels, resourceNames)
+
+		if err := p.stopAndDelete(ctx, ctr, labels); err != nil {
+			errs = append(errs, summary.Fail("container", ctr.ID(), err))
+			continue
+		}
+		summary.Containers = append(summary.Containers, ctr.ID())
+	}
+
+	if p.comm != nil {
+		for resource := range resourceNames {
+			if err := p.comm.DeleteResourceByName(ctx, resource); err != nil {
+				errs = append(errs, summary.Fail("resource", resource, runerr.Wrap(ctx, "delete resource", resource, err)))
+				continue
+			}
+			summary.Resources = append(summary.Resources, resource)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// TearDownVolumes removes the job's volume, runner and log directories.
+func (p *ContainerdPlatform) TearDownVolumes(ctx context.Context, job uuid.UUID, summary *models.TeardownSummary) error {
+	entries, err := os.ReadDir(p.volumeDir(job, ""))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return summary.Fail("volume", job.String(), runerr.Wrap(ctx, "list volumes", p.volumeDir(job, ""), err))
+	}
+
+	if err := os.RemoveAll(p.jobDir(job)); err != nil {
+		return summary.Fail("volume", job.String(), runerr.Wrap(ctx, "remove job directory", p.jobDir(job), err))
+	}
+	for _, e := range entries {
+		summary.Volumes = append(summary.Volumes, e.Name())
+	}
+	return nil
+}
+
+// tearDownNamespace deletes the job's images and then its namespace. Leftovers
+// (e.g. content still referenced elsewhere) only produce a warning.
+func (p *ContainerdPlatform) tearDownNamespace(ctx context.Context, job uuid.UUID) {
+	images, err := p.client.ImageService().List(ctx)
+	if err != nil {
+		p.warn("list images of job %s: %v", job, err)
+		return
+	}
+	for _, image := range images {
+		if err := p.client.ImageService().Delete(ctx, image.Name); err != nil && !errdefs.IsNotFound(err) {
+			p.warn("delete image %q: %v", image.Name, err)
+		}
+	}
+	if err := p.client.NamespaceService().Delete(ctx, Namespace(job)); err != nil && !errdefs.IsNotFound(err) {
+		p.warn("delete namespace %q: %v", Namespace(job), err)
+	}
+}
+
+// Teardown removes everything the job owns. It is best-effort: every step runs
+// even if an earlier one failed, and the agent is notified with a summary.
+func (p *ContainerdPlatform) Teardown(ctx context.Context, job uuid.UUID) error {
+	summary := models.TeardownSummary{Job: job}
+
+	var connErr error
+	if p.comm != nil {
+		connErr = p.comm.DeleteJobConnections(ctx, job, &summary)
+	}
+	err := errors.Join(
+		connErr,
+		p.removeLabeledContainers(ctx, "deploy-commander.job", job.String(), &summary),
+		p.TearDownVolumes(ctx, job, &summary),
+	)
+	if err == nil {
+		p.tearDownNamespace(ctx, job)
+	}
+
+	if len(summary.Containers)+len(summary.Volumes)+len(summary.Connections)+len(summary.Resources) > 0 {
+		p.changed()
+	}
+
+	if p.comm != nil {
+		if nerr := p.comm.NotifyTeardown(ctx, job, summary); nerr != nil {
+			err = errors.Join(err, runerr.Wrap(ctx, "notify agent of teardown", job.String(), nerr))
+		}
+	}
+
+	return err
+}
+
+// Rollback removes the containers labeled with the run and the volume directories
+// this run created. Used when a run is cancelled mid-flight.
+func (p *ContainerdPlatform) Rollback(ctx context.Context, run uuid.UUID) error {
+	summary := models.TeardownSummary{}
+	errs := []error{p.removeLabeledContainers(ctx, "deploy-commander.run", run.String(), &summary)}
+
+	for _, dir := range p.createdVolumes {
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, runerr.Wrap(ctx, "remove volume directory", dir, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RemoveServices removes the named services' containers and the resources they
+// registered. Containers are found by their service label, whatever their id,
+// and by the service's own name, which covers containers created before they
+// were labeled.
+func (p *ContainerdPlatform) RemoveServices(ctx context.Context, job uuid.UUID, removeServices *[]string) error {
+	if removeServices == nil {
+		return nil
+	}
+
+	resourceNames := make(map[string]struct{})
+	for _, service := range *removeServices {
+		ctx := runerr.WithService(ctx, service)
+
+		ctrs, err := p.client.Containers(ctx, labelFilter("deploy-commander.job", job.String())+","+labelFilter("deploy-commander.service", service))
+		if err != nil {
+			return runerr.Wrap(ctx, "list containers", service, err)
+		}
+		if !slices.ContainsFunc(ctrs, func(c containerd.Container) bool { return c.ID() == service }) {
+			ctr, err := p.client.LoadContainer(ctx, service)
+			if err != nil && !errdefs.IsNotFound(err) {
+				return runerr.Wrap(ctx, "load container", service, err)
+			}
+			if err == nil {
+				ctrs = append(ctrs, ctr)
+			}
+		}
+
+		for _, ctr := range ctrs {
+			labels, err := ctr.Labels(ctx)
+			if errdefs.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return runerr.Wrap(ctx, "read labels of container", ctr.ID(), err)
+			}
+			if err := p.fence(ctx, ctr.ID(), labels); err != nil {
+				return err
+			}
+			p.collectResources(ctr.ID(), labels, resourceNames)
+
+			if err := p.stopAndDelete(ctx, ctr, labels); err != nil {
+				return err
+			}
+			p.changed()
+		}
+	}
+
+	if p.comm != nil {
+		for resource := range resourceNames {
+			if err := p.comm.DeleteResourceByName(ctx, resource); err != nil {
+				p.warn("delete resource %q of removed service: %v", resource, err)
+				continue
+			}
+			p.changed()
+		}
+	}
+
+	return nil
+}
+
+// RemoveVolumes deletes the named volume directories.
+func (p *ContainerdPlatform) RemoveVolumes(ctx context.Context, job uuid.UUID, removeVolumes *[]string) error {
+	if removeVolumes == nil {
+		return nil
+	}
+	for _, name := range *removeVolumes {
+		dir := p.volumeDir(job, name)
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return runerr.Wrap(ctx, "remove volume", name, err)
+		}
+		p.changed()
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package containerd
+
+import (
+	"context"
+
+	"github.com/containerd/errdefs"
+	"github.com/distribution/reference"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+
+	containerd "github.com/containerd/containerd/v2/client"
+)
+
+// updateFilter builds the ServiceFilter for action "update", with the same rules as
+// the Docker platform: a service is re-applied when its spec hash label differs, or
+// its container is missing, not running, or runs another image. Runner-role steps
+// that already succeeded for this run are never re-run.
+func (p *ContainerdPlatform) updateFilter(ctx context.Context, job uuid.UUID, run uuid.UUID) (platforms.ServiceFilter, error) {
+	st, err := p.steps.State(job)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(name string, service *models.MetadataService) (bool, error) {
+		if platforms.IsRunnerRole(service) {
+			return !p.steps.Done(st, run, name), nil
+		}
+
+		desired, err := platforms.ServiceSpecHash(service)
+		if err != nil {
+			return false, err
+		}
+
+		ctr, err := p.client.LoadContainer(ctx, name)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				return true, nil
+			}
+			return false, runerr.Wrap(ctx, "load container", name, err)
+		}
+		info, err := ctr.Info(ctx)
+		if err != nil {
+			return false, runerr.Wrap(ctx, "inspect container", name, err)
+		}
+		if info.Labels["deploy-commander.spec-hash"] != desired {
+			return true, nil
+		}
+		if named, err := reference.ParseDockerRef(service.Image); err != nil || info.Image != named.String() {
+			return true, nil
+		}
+
+		task, err := ctr.Task(ctx, nil)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				return true, nil
+			}
+			return false, runerr.Wrap(ctx, "load task", name, err)
+		}
+		status, err := task.Status(ctx)
+		if err != nil {
+			return false, runerr.Wrap(ctx, "inspect task", name, err)
+		}
+		return status.Status != containerd.Running, nil
+	}, nil
+}
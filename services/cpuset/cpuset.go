@@ -0,0 +1,93 @@
+package cpuset
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Highest id accepted, well past any real host, so a typo can't expand into
+// billions of ids.
+const maxID = 1 << 16
+
+// Parse reads a Linux cpuset list such as "0-3,8,10-11" (the format of
+// cpuset_cpus, cpuset_mems and /sys/devices/system/*/online) and returns the ids
+// in it, sorted and without duplicates.
+func Parse(s string) ([]int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("empty cpuset")
+	}
+	var ids []int
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil || first < 0 || first > maxID {
+			return nil, fmt.Errorf("invalid cpuset %q: bad id %q", s, lo)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(hi); err != nil || last < first || last > maxID {
+				return nil, fmt.Errorf("invalid cpuset %q: bad range %q", s, part)
+			}
+		}
+		for id := first; id <= last; id++ {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids), nil
+}
+
+// Within returns an error naming the first id of want that is not in have.
+func Within(want, have []int) error {
+	for _, id := range want {
+		if !slices.Contains(have, id) {
+			return fmt.Errorf("%d is not among %s", id, Format(have))
+		}
+	}
+	return nil
+}
+
+// Format writes ids back as a list, with consecutive ids as ranges.
+func Format(ids []int) string {
+	var b strings.Builder
+	for i := 0; i < len(ids); {
+		j := i
+		for j+1 < len(ids) && ids[j+1] == ids[j]+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(ids[i]))
+		if j > i {
+			b.WriteString("-" + strconv.Itoa(ids[j]))
+		}
+		i = j + 1
+	}
+	return b.String()
+}
+
+// Online returns this host's online CPUs and memory (NUMA) nodes from sysfs.
+func Online() (cpus, mems []int, err error) {
+	if cpus, err = readList("/sys/devices/system/cpu/online"); err != nil {
+		return nil, nil, err
+	}
+	mems, err = readList("/sys/devices/system/node/online")
+	if os.IsNotExist(err) {
+		// Kernels without NUMA support have a single node.
+		return cpus, []int{0}, nil
+	}
+	return cpus, mems, err
+}
+
+func readList(path string) ([]int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(string(b))
+}
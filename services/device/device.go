@@ -0,0 +1,67 @@
+package device
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Mapping is one devices entry: a host device made available in the container.
+type Mapping struct {
+	Host        string
+	Container   string
+	Permissions string // cgroup permissions, some of r, w and m
+}
+
+// Parse reads an entry in Docker's syntax, host[:container][:permissions], e.g.
+// "/dev/ttyUSB0" or "/dev/kvm:/dev/kvm:rw". The container path defaults to the
+// host path and the permissions to rwm.
+func Parse(s string) (Mapping, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	m := Mapping{Host: parts[0], Container: parts[0], Permissions: "rwm"}
+	switch len(parts) {
+	case 1:
+	case 2:
+		if validPermissions(parts[1]) {
+			m.Permissions = parts[1]
+		} else {
+			m.Container = parts[1]
+		}
+	case 3:
+		m.Container, m.Permissions = parts[1], parts[2]
+	default:
+		return m, fmt.Errorf("invalid device %q: want host[:container][:permissions]", s)
+	}
+	if !path.IsAbs(m.Host) || !path.IsAbs(m.Container) {
+		return m, fmt.Errorf("invalid device %q: paths must be absolute", s)
+	}
+	if !validPermissions(m.Permissions) {
+		return m, fmt.Errorf("invalid device %q: permissions %q must be some of r, w and m", s, m.Permissions)
+	}
+	return m, nil
+}
+
+// ParseAll parses a service's devices.
+func ParseAll(entries []string) ([]Mapping, error) {
+	out := make([]Mapping, 0, len(entries))
+	for _, e := range entries {
+		m, err := Parse(e)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func validPermissions(s string) bool {
+	if s == "" || len(s) > 3 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("rwm", c) || strings.Count(s, string(c)) > 1 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package docker
+
+import (
+	"cmp"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// Number of services listed in the slowest-services report.
+const slowestServicesReported = 5
+
+// reportServiceTimings ranks the services set up so far, slowest first, and logs the top of the list.
+func (p *DockerPlatform) reportServiceTimings() {
+	timings := p.result.Services
+	if len(timings) == 0 {
+		return
+	}
+
+	slices.SortStableFunc(timings, func(a, b models.ServiceTiming) int {
+		return cmp.Compare(b.Duration, a.Duration)
+	})
+
+	var total time.Duration
+	for _, t := range timings {
+		total += time.Duration(t.Duration)
+	}
+
+	log.Printf("services set up in %s; slowest:", total.Round(time.Millisecond))
+	for i, t := range timings[:min(len(timings), slowestServicesReported)] {
+		share := float64(t.Duration) / float64(total) * 100
+		log.Printf("  %d. %s %s (%.0f%%)", i+1, t.Service, time.Duration(t.Duration).Round(time.Millisecond), share)
+	}
+}
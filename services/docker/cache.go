@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+	"github.com/google/uuid"
+	"github.com/moby/moby/api/types/mount"
+	"github.com/moby/moby/client"
+)
+
+func DockerCacheVolumeName(jobID, key string) string {
+	return fmt.Sprintf("%s-cache-%s", jobID, platforms.CacheID(key))
+}
+
+// cacheMounts creates the step's caches and returns their mounts. Caches belong
+// to the job rather than the run that created them, so they carry no run label
+// and a rollback keeps them.
+func (p *DockerPlatform) cacheMounts(ctx context.Context, job uuid.UUID, service *models.MetadataService) ([]mount.Mount, error) {
+	if len(service.Caches) == 0 {
+		return nil, nil
+	}
+	var st *state.JobState
+	if p.state != nil {
+		var err error
+		if st, err = p.steps.State(job); err != nil {
+			return nil, err
+		}
+	}
+	var out []mount.Mount
+	for _, c := range service.Caches {
+		key, err := platforms.CacheKey(c, p.steps.Lookup)
+		if err != nil {
+			return nil, runerr.Wrap(ctx, "resolve cache key", c.MountPath, err)
+		}
+		name := DockerCacheVolumeName(job.String(), key)
+		err = p.ensureVolume(ctx, name, map[string]string{
+			p.label("job"):   job.String(),
+			p.label("kind"):  "cache",
+			p.label("cache"): key,
+		})
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, mount.Mount{Type: mount.TypeVolume, Source: name, Target: c.MountPath})
+		if st != nil {
+			platforms.TouchCache(st, key)
+		}
+	}
+	if st != nil {
+		if err := p.state.Save(st); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// evictCaches removes the job's least recently used caches, on every daemon,
+// once they outgrow the cache limit. Caches only save time, so failures are
+// warnings.
+func (p *DockerPlatform) evictCaches(ctx context.Context, job uuid.UUID, since time.Time) {
+	if p.state == nil {
+		return
+	}
+	limit, err := platforms.CacheLimit()
+	if err != nil {
+		p.warn("evict caches: %v", err)
+		return
+	}
+	sizes := map[string]int64{}
+	err = p.eachHost(func(hp *DockerPlatform) error {
+		du, err := hp.client.DiskUsage(ctx, client.DiskUsageOptions{Volumes: true, Verbose: true})
+		if err != nil {
+			return err
+		}
+		for _, v := range du.Volumes.Items {
+			if v.Labels[p.label("job")] != job.String() || v.Labels[p.label("kind")] != "cache" {
+				continue
+			}
+			var size int64
+			if v.UsageData != nil && v.UsageData.Size > 0 {
+				size = v.UsageData.Size
+			}
+			sizes[v.Labels[p.label("cache")]] += size
+		}
+		return nil
+	})
+	if err != nil {
+		p.warn("evict caches: measure caches: %v", err)
+		return
+	}
+	st, err := p.steps.State(job)
+	if err != nil {
+		p.warn("evict caches: %v", err)
+		return
+	}
+	// Forget caches removed some other way.
+	maps.DeleteFunc(st.Caches, func(key string, _ time.Time) bool {
+		_, ok := sizes[key]
+		return !ok
+	})
+
+	for _, key := range platforms.EvictCaches(sizes, st.Caches, since, limit) {
+		name := DockerCacheVolumeName(job.String(), key)
+		err := p.eachHost(func(hp *DockerPlatform) error {
+			_, err := hp.client.VolumeRemove(ctx, name, client.VolumeRemoveOptions{})
+			if errdefs.IsNotFound(err) {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			p.warn("evict cache %q: %v", key, err)
+			continue
+		}
+		delete(st.Caches, key)
+		p.changed()
+	}
+	if err := p.state.Save(st); err != nil {
+		p.warn("evict caches: %v", err)
+	}
+}
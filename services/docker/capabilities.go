@@ -0,0 +1,84 @@
+package docker
+
+import "github.com/ezenkico/deploy-commander/runner/models"
+
+// Capabilities reports what plain Docker, or swarm mode, can honor.
+func (p *DockerPlatform) Capabilities() models.PlatformCapabilities {
+	if p.swarm {
+		return models.PlatformCapabilities{
+			Platform: "swarm",
+			ScaleModes: []models.ScaleMode{
+				models.ScaleModeSingle,
+				models.ScaleModeAutoscale, // starts at min; swarm has no autoscaler
+				models.ScaleModeAutoscaleCore,
+				models.ScaleModeGlobal,
+			},
+			Strategies:     []models.DeployStrategy{models.StrategyRolling, models.StrategyRecreate},
+			Replicas:       true,
+			HostPorts:      true,
+			NetworkGroups:  true,
+			Aliases:        true,
+			DNS:            true,
+			Hostnames:      true, // hostname only; swarm has no domainname
+			Healthchecks:   true,
+			KernelCaps:     true,
+			GroupAdd:       true,
+			Init:           true,
+			StopSignals:    true,
+			Restarts:       true,
+			SecurityOpts:   true,
+			MemoryLimits:   true,
+			CPULimits:      true,
+			PidsLimits:     true,
+			RollingUpdates: true,
+			RunnerSteps:    true,
+			SSHKeys:        true,
+			Caches:         true,
+			Files:          true,
+			Placement:      true,
+		}
+	}
+
+	return models.PlatformCapabilities{
+		Platform:       "docker",
+		ScaleModes:     []models.ScaleMode{models.ScaleModeSingle},
+		Strategies:     Strategies(),
+		HostPorts:      true,
+		HostIP:         true,
+		GPU:            true,
+		Devices:        true,
+		NetworkGroups:  true,
+		Aliases:        true,
+		PrimaryNetwork: true,
+		Addressing:     true,
+		DNS:            true,
+		Hostnames:      true,
+		PinHosts:       true,
+		VolumeSources:  true,
+		Healthchecks:   true,
+		MemoryLimits:   true,
+		CPULimits:      true,
+		PidsLimits:     true,
+		CPUPinning:     true,
+		MemoryTuning:   true,
+		SharedMemory:   true,
+		PIDNamespaces:  true,
+		UsernsMode:     true,
+		Runtimes:       true,
+		KernelCaps:     true,
+		GroupAdd:       true,
+		CgroupParent:   true,
+		Init:           true,
+		StopSignals:    true,
+		Restarts:       true,
+		SecurityOpts:   true,
+		Privileged:     true,
+		Checkpoints:    true,
+		RunnerSteps:    true,
+		SSHKeys:        true,
+		Caches:         true,
+		Files:          true,
+		Placement:      len(p.clients) > 1,
+		PullPolicies:   true,
+	}
+}
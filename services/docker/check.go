@@ -2,35 +2,234 @@ package docker
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
 
 	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/cpuset"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
 	"github.com/google/uuid"
 
 	"github.com/moby/moby/client"
 )
 
 func (p *DockerPlatform) CheckVolumes(ctx context.Context, job string, services map[string]models.MetadataService, volumes *[]string) error {
-	declared, err := DeclaredVolumeSet(volumes)
+	declared, err := platforms.DeclaredVolumeSet(volumes)
 	if err != nil {
 		return err
 	}
 
-	stragglers, err := CheckServiceVolumeMounts(services, declared)
+	stragglers, err := platforms.CheckServiceVolumeMounts(services, declared)
 
 	if err != nil {
 		return err
 	}
 
-	// If volumes already exist in Docker, ensure they belong to this job
+	// If volumes already exist in Docker, ensure they belong to this job, on every
+	// daemon that mounts them
 	if stragglers != nil && len(*stragglers) > 0 {
-		if err := p.checkExistingDockerVolumes(ctx, job, *stragglers); err != nil {
+		hosts, err := p.volumeHosts(services)
+		if err != nil {
 			return err
 		}
+		for _, h := range p.hostNames() {
+			onHost := map[string]struct{}{}
+			for name := range *stragglers {
+				if slices.Contains(hosts[name], h) {
+					onHost[name] = struct{}{}
+				}
+			}
+			if len(onHost) == 0 {
+				continue
+			}
+			if err := p.on(h).checkExistingDockerVolumes(ctx, job, onHost); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
+// CheckPlacement makes sure every service can be placed on one of the daemons.
+func (p *DockerPlatform) CheckPlacement(services map[string]models.MetadataService) error {
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		service := services[name]
+		if _, err := p.hostFor(name, &service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckLabels rejects operator labels under the runner's label prefix, which may
+// be configured to something other than the one validate knows about.
+func (p *DockerPlatform) CheckLabels(metadata *models.Metadata) error {
+	check := func(labels map[string]string, where string) error {
+		for k := range labels {
+			if strings.HasPrefix(k, p.labelPrefix) {
+				return fmt.Errorf("%s: label %q uses the runner's label prefix %q", where, k, p.labelPrefix)
+			}
+		}
+		return nil
+	}
+	if err := check(metadata.Labels, "metadata.labels"); err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(metadata.Services)) {
+		if err := check(metadata.Services[name].Labels, fmt.Sprintf("service %q", name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckCpusets makes sure each service's cpuset_cpus only names CPUs its daemon's
+// host has. Memory nodes are not in the daemon's info; it rejects unknown ones
+// when the container is created.
+func (p *DockerPlatform) CheckCpusets(ctx context.Context, services map[string]models.MetadataService) error {
+	if p.swarm {
+		return nil
+	}
+	ncpu := map[string]int{}
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		service := services[name]
+		if service.CpusetCpus == nil {
+			continue
+		}
+		want, err := cpuset.Parse(*service.CpusetCpus)
+		if err != nil {
+			return fmt.Errorf("service %q: cpuset_cpus: %w", name, err)
+		}
+		host, err := p.hostFor(name, &service)
+		if err != nil {
+			return err
+		}
+		if _, ok := ncpu[host]; !ok {
+			info, err := p.on(host).client.Info(ctx, client.InfoOptions{})
+			if err != nil {
+				return runerr.Wrap(runerr.WithService(ctx, name), "inspect docker host", host, err)
+			}
+			ncpu[host] = info.Info.NCPU
+		}
+		have := make([]int, ncpu[host])
+		for i := range have {
+			have[i] = i
+		}
+		if err := cpuset.Within(want, have); err != nil {
+			return fmt.Errorf("service %q: cpuset_cpus: %w (the host has %d CPUs)", name, err, ncpu[host])
+		}
+	}
+	return nil
+}
+
+// CheckRuntimes makes sure every service's runtime is registered with its daemon,
+// so a typo fails before anything is created.
+func (p *DockerPlatform) CheckRuntimes(ctx context.Context, services map[string]models.MetadataService) error {
+	if p.swarm {
+		return nil
+	}
+	runtimes := map[string][]string{}
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		service := services[name]
+		if service.Runtime == nil || *service.Runtime == "default" {
+			continue
+		}
+		host, err := p.hostFor(name, &service)
+		if err != nil {
+			return err
+		}
+		if _, ok := runtimes[host]; !ok {
+			info, err := p.on(host).client.Info(ctx, client.InfoOptions{})
+			if err != nil {
+				return runerr.Wrap(runerr.WithService(ctx, name), "inspect docker host", host, err)
+			}
+			runtimes[host] = slices.Sorted(maps.Keys(info.Info.Runtimes))
+		}
+		if !slices.Contains(runtimes[host], *service.Runtime) {
+			return fmt.Errorf("service %q: runtime %q is not configured on docker host %q (have %s)", name, *service.Runtime, host, strings.Join(runtimes[host], ", "))
+		}
+	}
+	return nil
+}
+
+// CheckCheckpoints makes sure services with checkpoint_on_update can be
+// checkpointed: checkpoint_dir is set and each service's daemon runs with
+// experimental features. Whether CRIU is installed only shows at checkpoint time.
+func (p *DockerPlatform) CheckCheckpoints(ctx context.Context, services map[string]models.MetadataService) error {
+	if p.swarm {
+		return nil
+	}
+	experimental := map[string]bool{}
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		service := services[name]
+		if service.CheckpointOnUpdate == nil || !*service.CheckpointOnUpdate {
+			continue
+		}
+		if p.checkpointDir == "" {
+			return fmt.Errorf("service %q: checkpoint_on_update needs checkpoint_dir in platform_data", name)
+		}
+		host, err := p.hostFor(name, &service)
+		if err != nil {
+			return err
+		}
+		if _, ok := experimental[host]; !ok {
+			info, err := p.on(host).client.Info(ctx, client.InfoOptions{})
+			if err != nil {
+				return runerr.Wrap(runerr.WithService(ctx, name), "inspect docker host", host, err)
+			}
+			experimental[host] = info.Info.ExperimentalBuild
+		}
+		if !experimental[host] {
+			return fmt.Errorf("service %q: checkpoint_on_update needs experimental features on docker host %q", name, host)
+		}
+	}
+	return nil
+}
+
+// CheckNamespaces makes sure a service joining another's IPC or PID namespace is
+// placed on the same daemon, since namespaces are not shared across hosts, and
+// that pid "host" is allowed by the platform data.
+func (p *DockerPlatform) CheckNamespaces(services map[string]models.MetadataService) error {
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		service := services[name]
+		if service.Pid != nil && *service.Pid == "host" && !p.allowHostPID {
+			return fmt.Errorf("service %q: pid host is not allowed (set allow_host_pid in platform_data)", name)
+		}
+		for _, ns := range []struct {
+			kind string
+			mode *string
+		}{{"ipc", service.Ipc}, {"pid", service.Pid}} {
+			if ns.mode == nil {
+				continue
+			}
+			target, ok := strings.CutPrefix(*ns.mode, models.ServiceNamespacePrefix)
+			if !ok {
+				continue
+			}
+			other, ok := services[target]
+			if !ok {
+				return fmt.Errorf("service %q: %s service %q does not exist", name, ns.kind, target)
+			}
+			host, err := p.hostFor(name, &service)
+			if err != nil {
+				return err
+			}
+			otherHost, err := p.hostFor(target, &other)
+			if err != nil {
+				return err
+			}
+			if host != otherHost {
+				return fmt.Errorf("service %q: %s service %q runs on host %q, not %q", name, ns.kind, target, otherHost, host)
+			}
+		}
+	}
+	return nil
+}
+
 func (p *DockerPlatform) checkExistingDockerVolumes(
 	ctx context.Context,
 	jobID string,
@@ -53,12 +252,20 @@ func (p *DockerPlatform) CheckMetadata(ctx context.Context, job uuid.UUID, metad
 		return nil
 	}
 
+	if err := p.CheckLabels(metadata); err != nil {
+		return err
+	}
+
 	if metadata.Services != nil && len(metadata.Services) > 0 {
-		err := CheckDependsOnServicesExist(metadata.Services)
+		err := platforms.CheckDependsOnServicesExist(metadata.Services)
 		if err != nil {
 			return err
 		}
-		err = CheckCircularDependencies(metadata.Services)
+		err = platforms.CheckCircularDependencies(metadata.Services)
+		if err != nil {
+			return err
+		}
+		err = p.CheckPlacement(metadata.Services)
 		if err != nil {
 			return err
 		}
@@ -66,6 +273,22 @@ func (p *DockerPlatform) CheckMetadata(ctx context.Context, job uuid.UUID, metad
 		if err != nil {
 			return err
 		}
+		err = p.CheckCpusets(ctx, metadata.Services)
+		if err != nil {
+			return err
+		}
+		err = p.CheckRuntimes(ctx, metadata.Services)
+		if err != nil {
+			return err
+		}
+		err = p.CheckCheckpoints(ctx, metadata.Services)
+		if err != nil {
+			return err
+		}
+		err = p.CheckNamespaces(metadata.Services)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
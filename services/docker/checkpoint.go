@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"context"
+	"path"
+
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+	"github.com/moby/moby/client"
+)
+
+// checkpoint is a CRIU checkpoint taken of a service's container before it is
+// recreated, to restore into the new one.
+type checkpoint struct {
+	id  string
+	dir string // on the daemon's host, so it outlives the old container
+}
+
+// checkpointForUpdate checkpoints the running container and stops it. Failing to
+// checkpoint is a warning; the service is then recreated from scratch.
+func (p *DockerPlatform) checkpointForUpdate(ctx context.Context, job, run uuid.UUID, containerName string) *checkpoint {
+	cp := &checkpoint{
+		id:  "update-" + run.String(),
+		dir: path.Join(p.checkpointDir, job.String(), containerName),
+	}
+	_, err := p.client.CheckpointCreate(ctx, containerName, client.CheckpointCreateOptions{
+		CheckpointID:  cp.id,
+		CheckpointDir: cp.dir,
+		Exit:          true,
+	})
+	if err != nil {
+		p.warn("container %q: checkpoint failed, recreating without its in-memory state: %v", containerName, err)
+		return nil
+	}
+	return cp
+}
+
+// startRestored starts the new container from the checkpoint, falling back to a
+// fresh start if the restore fails, and then discards the checkpoint.
+func (p *DockerPlatform) startRestored(ctx context.Context, containerID, containerName string, cp *checkpoint) error {
+	_, err := p.client.ContainerStart(ctx, containerID, client.ContainerStartOptions{
+		CheckpointID:  cp.id,
+		CheckpointDir: cp.dir,
+	})
+	if err != nil {
+		p.warn("container %q: restore from checkpoint failed, starting fresh: %v", containerName, err)
+		if _, err := p.client.ContainerStart(ctx, containerID, client.ContainerStartOptions{}); err != nil {
+			return runerr.Wrap(ctx, "start container", containerName, err)
+		}
+	}
+	_, err = p.client.CheckpointRemove(context.WithoutCancel(ctx), containerID, client.CheckpointRemoveOptions{
+		CheckpointID:  cp.id,
+		CheckpointDir: cp.dir,
+	})
+	if err != nil {
+		p.warn("container %q: could not remove checkpoint %s in %s: %v", containerName, cp.id, cp.dir, err)
+	}
+	return nil
+}
@@ -2,65 +2,256 @@ package docker
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/ezenkico/deploy-commander/runner/models"
 	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/phase"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+	"github.com/ezenkico/deploy-commander/runner/services/template"
 
+	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/client"
 )
 
+const (
+	rollbackTimeout    = 2 * time.Minute
+	defaultLabelPrefix = "deploy-commander."
+)
+
 // DockerPlatform implements interfaces.Platform for plain Docker (Engine API).
 type DockerPlatform struct {
 	client *client.Client
+	host   string // name of the daemon client talks to
 	comm   *agent.AgentCommunication
+	state  *state.Store
+
+	// Every daemon by name, including the default one; see placement.go
+	clients    map[string]*client.Client
+	hostLabels map[string]map[string]string
+
+	// Settings from models.DockerPlatformData
+	labelPrefix   string
+	networkDriver string
+	restartPolicy container.RestartPolicyMode
+	allowHostPID  bool
+	checkpointDir string
+
+	// Run long-running services as Docker Swarm services (platform "swarm")
+	swarm bool
+
+	// The run's generation, recorded on what it creates; see fence.go
+	generation int64
+
+	// Runner-role steps: the job state, shared by update filtering and step
+	// recording, and the outputs of steps that ran (or were skipped) in this run
+	steps *platforms.Steps
+
+	// Run-time facts about services for templated connection metadata
+	facts template.Facts
+
+	// The run's metadata.labels, added to everything it creates
+	jobLabels map[string]string
+
+	// The run's cgroup_parent, if any
+	cgroupParent string
+
+	// The run's metadata.networks, used when creating network groups
+	networkSpecs map[string]models.NetworkSpec
+
+	// The run's metadata.volume_sources, whose checksums runner steps verify
+	volumeSources map[string]models.VolumeSource
+
+	// Networks already created or verified in this run, so each is inspected once per daemon
+	createdNetworks map[networkKey]struct{}
+
+	// Whether this run changed anything and which non-fatal problems it hit.
+	// A pointer so the per-daemon views in placement.go report into the same result.
+	result *models.RunResult
 }
 
 // NewDockerPlatform initializes the Docker platform using environment variables
-// (e.g. DOCKER_HOST) and API version negotiation.
-func NewDockerPlatform(comm *agent.AgentCommunication) (*DockerPlatform, error) {
-	c, err := client.New(
-		client.FromEnv,
-	)
+// (e.g. DOCKER_HOST) and API version negotiation. data is the optional
+// models.DockerPlatformData; its host, TLS files and API version override the
+// environment, and its hosts add daemons that services can be placed on.
+func NewDockerPlatform(comm *agent.AgentCommunication, data *json.RawMessage) (*DockerPlatform, error) {
+	pd, err := parsePlatformData(data)
 	if err != nil {
 		return nil, err
 	}
 
-	return &DockerPlatform{
-		client: c,
-		comm:   comm,
-	}, nil
+	p := &DockerPlatform{
+		comm:          comm,
+		host:          defaultHost,
+		clients:       map[string]*client.Client{},
+		hostLabels:    map[string]map[string]string{defaultHost: pd.Labels},
+		labelPrefix:   defaultLabelPrefix,
+		networkDriver: pd.NetworkDriver,
+		restartPolicy: container.RestartPolicyAlways,
+		allowHostPID:  pd.AllowHostPID,
+		checkpointDir: pd.CheckpointDir,
+		result:        &models.RunResult{},
+	}
+	if pd.LabelPrefix != "" {
+		p.labelPrefix = strings.TrimSuffix(pd.LabelPrefix, ".") + "."
+	}
+	if pd.RestartPolicy != "" {
+		p.restartPolicy = container.RestartPolicyMode(pd.RestartPolicy)
+	}
+
+	c, err := newClient(defaultHost, pd.DockerHost)
+	if err != nil {
+		return nil, err
+	}
+	p.client = c
+	p.clients[defaultHost] = c
+
+	for name, h := range pd.Hosts {
+		c, err := newClient(name, h)
+		if err != nil {
+			return nil, err
+		}
+		p.clients[name] = c
+		p.hostLabels[name] = h.Labels
+	}
+
+	return p, nil
+}
+
+// NewSwarmPlatform is NewDockerPlatform for a Docker Swarm manager: long-running
+// services become swarm services (replicas, rolling updates, overlay networks).
+func NewSwarmPlatform(comm *agent.AgentCommunication, data *json.RawMessage) (*DockerPlatform, error) {
+	p, err := NewDockerPlatform(comm, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.clients) > 1 {
+		return nil, fmt.Errorf("swarm: platform_data hosts are not supported; place services on swarm nodes instead")
+	}
+	p.swarm = true
+	return p, nil
 }
 
 // Run executes the requested action (run/teardown/update) for the given configuration.
-// Implementation will be filled in later.
-func (p *DockerPlatform) Run(ctx context.Context, config models.Configuration) error {
-	if config.Action == "teardown" {
-		return p.Teardown(ctx, config.Job)
+// Each phase runs in its own child context so deadlines and cancellation causes
+// are reported per phase.
+func (p *DockerPlatform) Run(ctx context.Context, config models.Configuration) (models.RunResult, error) {
+	*p.result = models.RunResult{}
+	ctx = runerr.WithRun(ctx, config.Job, config.Run)
+
+	err := p.run(ctx, config)
+	// A superseded run leaves the job to the run that replaced it.
+	rollback := (config.RollbackOnCancel && phase.Cause(err) != nil || platforms.RollbackRequested(err)) && !errors.Is(err, phase.ErrSuperseded)
+	if err != nil && rollback && config.Action != models.ActionTeardown {
+		// The run context may already be cancelled; give the rollback its own deadline.
+		rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+		defer cancel()
+		if rerr := p.Rollback(rctx, config.Run); rerr != nil {
+			return *p.result, errors.Join(err, runerr.Wrap(rctx, "rollback run", config.Run.String(), rerr))
+		}
 	}
-	metadata := config.Metadata
-	if metadata != nil {
-		err := p.CheckMetadata(ctx, config.Job, metadata)
+	return *p.result, err
+}
+
+// label returns the full name of one of the runner's labels, e.g. "deploy-commander.job".
+func (p *DockerPlatform) label(key string) string {
+	return p.labelPrefix + key
+}
+
+// changed records that the run modified platform or agent state.
+func (p *DockerPlatform) changed() {
+	p.result.Changed = true
+}
+
+// warn logs a non-fatal problem and records it in the run result.
+func (p *DockerPlatform) warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("warning: %s", msg)
+	p.result.Warnings = append(p.result.Warnings, msg)
+}
+
+func (p *DockerPlatform) run(ctx context.Context, config models.Configuration) error {
+	timeouts, err := phase.Timeouts(config.PhaseTimeouts)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	p.state = state.New(config.WorkspaceDir())
+	p.generation = config.Generation
+	p.cgroupParent = config.CgroupParent
+	p.steps = platforms.NewSteps(p.state)
+	p.facts = template.Facts{}
+	p.jobLabels = nil
+	p.networkSpecs = nil
+	p.volumeSources = nil
+	if config.Metadata != nil {
+		p.jobLabels = config.Metadata.Labels
+		p.networkSpecs = config.Metadata.Networks
+		p.volumeSources = config.Metadata.VolumeSources
+	}
+
+	var needsSetup platforms.ServiceFilter
+	switch config.Action {
+	case models.ActionTeardown:
+		return phase.Run(ctx, phase.Teardown, timeouts[phase.Teardown], func(ctx context.Context) error {
+			return p.Teardown(ctx, config.Job)
+		})
+	case models.ActionUpdate:
+		needsSetup, err = p.updateFilter(ctx, config.Job, config.Run)
 		if err != nil {
 			return err
 		}
+	case models.ActionSetup, models.ActionClone:
+	default:
+		// Port forwards and snapshots have their own entry points.
+		return runerr.Errorf(ctx, "parse action", string(config.Action), "the %s platform does not run action %q", p.Capabilities().Platform, config.Action)
+	}
 
-		err = p.VolumeSetup(ctx, config.Job, config.Run, metadata)
+	metadata := config.Metadata
+	if metadata != nil {
+		err := phase.Run(ctx, phase.Check, timeouts[phase.Check], func(ctx context.Context) error {
+			return p.CheckMetadata(ctx, config.Job, metadata)
+		})
 		if err != nil {
 			return err
 		}
-		err = p.ServiceSetup(ctx, config.Job, config.Run, metadata)
+
+		err = phase.Run(ctx, phase.Volumes, timeouts[phase.Volumes], func(ctx context.Context) error {
+			return p.VolumeSetup(ctx, config.Job, config.Run, metadata)
+		})
 		if err != nil {
 			return err
 		}
-		err = p.RemoveServices(ctx, config.Job, metadata.RemoveServices)
+		err = phase.Run(ctx, phase.Services, timeouts[phase.Services], func(ctx context.Context) error {
+			return p.ServiceSetup(ctx, config.Job, config.Run, metadata, needsSetup)
+		})
 		if err != nil {
 			return err
 		}
-		err = p.RemoveVolumes(ctx, config.Job, metadata.RemoveVolumes)
+		err = phase.Run(ctx, phase.Removals, timeouts[phase.Removals], func(ctx context.Context) error {
+			if err := p.RemoveServices(ctx, config.Job, metadata.RemoveServices); err != nil {
+				return err
+			}
+			if err := p.RemoveVolumes(ctx, config.Job, metadata.RemoveVolumes); err != nil {
+				return err
+			}
+			p.evictCaches(ctx, config.Job, started)
+			return nil
+		})
 		if err != nil {
 			return err
 		}
-		err = p.SetupConnections(ctx, metadata.Connections)
+		err = phase.Run(ctx, phase.Connections, timeouts[phase.Connections], func(ctx context.Context) error {
+			return p.SetupConnections(ctx, config.Job, metadata)
+		})
 		if err != nil {
 			return err
 		}
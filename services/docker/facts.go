@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"context"
+	"slices"
+	"strconv"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/template"
+	"github.com/google/uuid"
+
+	"github.com/moby/moby/client"
+)
+
+// recordFacts stores what connection metadata can refer to about a long-running
+// service (see template.Facts). It reads the live container, so it also works for
+// services an update left alone.
+func (p *DockerPlatform) recordFacts(ctx context.Context, job uuid.UUID, name string, service *models.MetadataService) error {
+	if platforms.IsRunnerRole(service) {
+		return nil
+	}
+	containerName := DockerServiceName(job.String(), name)
+	p.facts.Set(name, "container", containerName)
+	p.facts.Set(name, "alias", ServiceAddress(job, name, service))
+
+	if service.Resources != nil {
+		for _, spec := range *service.Resources {
+			p.facts.Set(name, "resources."+spec.Name+".network", DockerNetworkResourceName(job.String(), spec.Name))
+		}
+	}
+
+	if p.swarm {
+		// Swarm publishes through the routing mesh on the configured ports.
+		if service.Bindings != nil {
+			for _, b := range *service.Bindings {
+				if b.ContainerPort != nil && b.HostPort != nil {
+					p.facts.Set(name, "host_port."+strconv.Itoa(*b.ContainerPort), strconv.Itoa(*b.HostPort))
+				}
+			}
+		}
+		if service.NetworkGroups != nil && len(*service.NetworkGroups) > 0 {
+			p.facts.Set(name, "network", DockerNetworkName(job.String(), (*service.NetworkGroups)[0]))
+		}
+		return nil
+	}
+
+	inspect, err := p.client.ContainerInspect(ctx, containerName, client.ContainerInspectOptions{})
+	if err != nil {
+		return runerr.Wrap(ctx, "inspect container", containerName, err)
+	}
+	settings := inspect.Container.NetworkSettings
+	if settings == nil {
+		return nil
+	}
+
+	// Ports the daemon allocated (host_port 0) only show up here.
+	for port, bindings := range settings.Ports {
+		if port.Proto() != "tcp" || len(bindings) == 0 {
+			continue
+		}
+		p.facts.Set(name, "host_port."+strconv.Itoa(int(port.Num())), bindings[0].HostPort)
+	}
+
+	networks := make([]string, 0, len(settings.Networks))
+	for n := range settings.Networks {
+		networks = append(networks, n)
+	}
+	slices.Sort(networks)
+	if service.NetworkGroups != nil && len(*service.NetworkGroups) > 0 {
+		p.facts.Set(name, "network", DockerNetworkName(job.String(), (*service.NetworkGroups)[0]))
+	} else if len(networks) > 0 {
+		p.facts.Set(name, "network", networks[0])
+	}
+	return nil
+}
+
+// ServiceAddress is the name other services on its networks reach a service at:
+// its first alias, or its container (swarm service) name.
+func ServiceAddress(job uuid.UUID, name string, service *models.MetadataService) string {
+	if service.Aliases != nil && len(*service.Aliases) > 0 {
+		return (*service.Aliases)[0]
+	}
+	return DockerServiceName(job.String(), name)
+}
+
+// templateLookup resolves ${services...} facts and ${steps...} outputs.
+func (p *DockerPlatform) templateLookup() template.Lookup {
+	return template.Chain(p.facts.Lookup, p.steps.Lookup)
+}
@@ -0,0 +1,61 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/google/uuid"
+	"github.com/moby/moby/client"
+)
+
+// How many log lines a stall report includes, and how long gathering it may take.
+const (
+	stallLogLines = 20
+	stallTimeout  = 10 * time.Second
+)
+
+// stallDetail describes how far a stalled service's container got: its state,
+// last healthcheck output and last log lines. Swarm services have no single
+// container to look at.
+func (p *DockerPlatform) stallDetail(ctx context.Context, job uuid.UUID, name string, service *models.MetadataService) string {
+	if p.swarm && !platforms.IsRunnerRole(service) {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, stallTimeout)
+	defer cancel()
+
+	containerName := DockerServiceName(job.String(), name)
+	inspect, err := p.client.ContainerInspect(ctx, containerName, client.ContainerInspectOptions{})
+	if err != nil {
+		return " (no container yet; pulling the image or creating it did not finish)"
+	}
+	var b strings.Builder
+	if st := inspect.Container.State; st != nil {
+		fmt.Fprintf(&b, " (container %s", st.Status)
+		if st.Health != nil {
+			fmt.Fprintf(&b, ", %s%s", st.Health.Status, lastProbe(st.Health))
+		}
+		b.WriteString(")")
+	}
+
+	rc, err := p.client.ContainerLogs(ctx, containerName, client.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       strconv.Itoa(stallLogLines),
+	})
+	if err != nil {
+		return b.String()
+	}
+	defer rc.Close()
+	var logs bytes.Buffer
+	if err := DemuxDockerLogs(&logs, &logs, rc); err == nil && logs.Len() > 0 {
+		fmt.Fprintf(&b, "; last logs:\n%s", strings.TrimRight(logs.String(), "\n"))
+	}
+	return b.String()
+}
@@ -0,0 +1,25 @@
+package docker
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+)
+
+// generationLabels adds the run's generation to labels, if it has one.
+func (p *DockerPlatform) generationLabels(labels map[string]string) map[string]string {
+	if p.generation > 0 {
+		labels[p.label("generation")] = strconv.FormatInt(p.generation, 10)
+	}
+	return labels
+}
+
+// fence checks an existing object's labels before the run replaces it.
+func (p *DockerPlatform) fence(ctx context.Context, name string, labels map[string]string) error {
+	if err := platforms.Fence(labels, p.label("generation"), p.generation); err != nil {
+		return runerr.Wrap(ctx, "fence run", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+)
+
+// Swarm configs are immutable, so each is named by its content and shared by
+// the job's services.
+func DockerFileConfigName(jobID string, content []byte) string {
+	sum := sha256.Sum256(content)
+	return fmt.Sprintf("%s-file-%s", jobID, hex.EncodeToString(sum[:6]))
+}
+
+// copyFiles writes the files, owned by root, into a created (not yet started)
+// container. Missing parent directories are created.
+func (p *DockerPlatform) copyFiles(ctx context.Context, containerID, containerName string, files []platforms.File) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	now := time.Now()
+	for _, f := range files {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: strings.TrimPrefix(f.Path, "/"), Mode: int64(f.Mode), Size: int64(len(f.Content)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return runerr.Wrap(ctx, "provision files", containerName, err)
+		}
+		if _, err := tw.Write(f.Content); err != nil {
+			return runerr.Wrap(ctx, "provision files", containerName, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return runerr.Wrap(ctx, "provision files", containerName, err)
+	}
+
+	_, err := p.client.CopyToContainer(ctx, containerID, client.CopyToContainerOptions{
+		DestinationPath: "/",
+		Content:         &buf,
+	})
+	if err != nil {
+		return runerr.Wrap(ctx, "provision files", containerName, err)
+	}
+	return nil
+}
+
+// swarmConfigs creates a swarm config per file (unless one with the same
+// content exists) and returns the references that mount them.
+func (p *DockerPlatform) swarmConfigs(ctx context.Context, job, run uuid.UUID, files []platforms.File) ([]*swarm.ConfigReference, error) {
+	var refs []*swarm.ConfigReference
+	for _, f := range files {
+		name := DockerFileConfigName(job.String(), f.Content)
+		var id string
+		existing, err := p.client.ConfigInspect(ctx, name, client.ConfigInspectOptions{})
+		switch {
+		case err == nil:
+			id = existing.Config.ID
+		case errdefs.IsNotFound(err):
+			created, err := p.client.ConfigCreate(ctx, client.ConfigCreateOptions{Spec: swarm.ConfigSpec{
+				Annotations: swarm.Annotations{
+					Name: name,
+					Labels: platforms.MergeLabels(map[string]string{
+						p.label("job"):  job.String(),
+						p.label("run"):  run.String(),
+						p.label("kind"): "file",
+					}, p.jobLabels),
+				},
+				Data: f.Content,
+			}})
+			if err != nil {
+				return nil, runerr.Wrap(ctx, "create swarm config", name, err)
+			}
+			p.changed()
+			id = created.ID
+		default:
+			return nil, runerr.Wrap(ctx, "inspect swarm config", name, err)
+		}
+		refs = append(refs, &swarm.ConfigReference{
+			File:       &swarm.ConfigReferenceFileTarget{Name: f.Path, UID: "0", GID: "0", Mode: f.Mode},
+			ConfigID:   id,
+			ConfigName: name,
+		})
+	}
+	return refs, nil
+}
+
+// removeLabeledSwarmConfigs removes the files' swarm configs matching the label
+// selector. Run after the services using them are removed; swarm refuses to
+// remove a config a service still uses.
+func (p *DockerPlatform) removeLabeledSwarmConfigs(ctx context.Context, selector string, summary *models.TeardownSummary) error {
+	f := make(client.Filters).
+		Add("label", selector).
+		Add("label", p.label("kind")+"=file")
+
+	configs, err := p.client.ConfigList(ctx, client.ConfigListOptions{Filters: f})
+	if err != nil {
+		return summary.Fail("config", selector, runerr.Wrap(ctx, "list swarm configs", selector, err))
+	}
+	var errs []error
+	for _, c := range configs.Items {
+		if _, err := p.client.ConfigRemove(ctx, c.ID, client.ConfigRemoveOptions{}); err != nil && !errdefs.IsNotFound(err) {
+			errs = append(errs, summary.Fail("config", c.Spec.Name, runerr.Wrap(ctx, "remove swarm config", c.Spec.Name, err)))
+		}
+	}
+	return errors.Join(errs...)
+}
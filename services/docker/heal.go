@@ -0,0 +1,195 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/network"
+	"github.com/moby/moby/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Restarts reports the job's long-running containers on every daemon: those
+// with a restart policy, which the daemon restarts on its own.
+func (p *DockerPlatform) Restarts(ctx context.Context, job uuid.UUID) ([]models.ServiceRestarts, error) {
+	if p.swarm {
+		return nil, fmt.Errorf("heal is not supported on swarm, which reschedules failed tasks itself")
+	}
+	var out []models.ServiceRestarts
+	err := p.eachHost(func(hp *DockerPlatform) error {
+		restarts, err := hp.hostRestarts(ctx, job)
+		out = append(out, restarts...)
+		return err
+	})
+	return out, err
+}
+
+func (p *DockerPlatform) hostRestarts(ctx context.Context, job uuid.UUID) ([]models.ServiceRestarts, error) {
+	containers, err := p.client.ContainerList(ctx, client.ContainerListOptions{
+		All:     true,
+		Filters: make(client.Filters).Add("label", p.label("job")+"="+job.String()).Add("label", p.label("service")),
+	})
+	if err != nil {
+		return nil, runerr.Wrap(ctx, "list containers", job.String(), err)
+	}
+
+	var out []models.ServiceRestarts
+	for _, c := range containers.Items {
+		inspect, err := p.client.ContainerInspect(ctx, c.ID, client.ContainerInspectOptions{})
+		if errdefs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, runerr.Wrap(ctx, "inspect container", c.ID, err)
+		}
+		ctr := inspect.Container
+		// Runner steps never restart, and neither do services with restart "no".
+		if ctr.HostConfig == nil || ctr.HostConfig.RestartPolicy.IsNone() {
+			continue
+		}
+		r := models.ServiceRestarts{
+			Service:   ctr.Config.Labels[p.label("service")],
+			Container: strings.TrimPrefix(ctr.Name, "/"),
+			Host:      p.host,
+			Restarts:  ctr.RestartCount,
+		}
+		if st := ctr.State; st != nil && st.Health != nil && st.Health.Status != container.NoHealthcheck {
+			r.Health = string(st.Health.Status)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// Recreate replaces a container that keeps failing with an identical one from a
+// newly pulled image, carrying over the files the runner wrote into it.
+func (p *DockerPlatform) Recreate(ctx context.Context, job uuid.UUID, target models.ServiceRestarts) error {
+	if p.swarm {
+		return fmt.Errorf("heal is not supported on swarm, which reschedules failed tasks itself")
+	}
+	if _, ok := p.clients[target.Host]; !ok {
+		return fmt.Errorf("container %q is on unknown docker host %q", target.Container, target.Host)
+	}
+	return p.on(target.Host).recreate(ctx, job, target.Container)
+}
+
+func (p *DockerPlatform) recreate(ctx context.Context, job uuid.UUID, name string) error {
+	inspect, err := p.client.ContainerInspect(ctx, name, client.ContainerInspectOptions{})
+	if err != nil {
+		return runerr.Wrap(ctx, "inspect container", name, err)
+	}
+	old := inspect.Container
+	if old.Config == nil || old.Config.Labels[p.label("job")] != job.String() {
+		return runerr.Errorf(ctx, "recreate container", name, "container does not belong to job %s", job)
+	}
+
+	// Pull the image again for the platform the container runs
+	var platform *ocispec.Platform
+	if img, err := p.client.ImageInspect(ctx, old.Image); err == nil {
+		platform = &ocispec.Platform{OS: img.Os, Architecture: img.Architecture, Variant: img.Variant}
+	}
+	if err := p.ensureImage(ctx, old.Config.Image, platform, models.PullAlways); err != nil {
+		return err
+	}
+
+	files, err := p.readFiles(ctx, name, old.Config.Labels[p.label("files")])
+	if err != nil {
+		return err
+	}
+
+	cfg := *old.Config
+	if cfg.Hostname == shortID(old.ID) {
+		cfg.Hostname = "" // the daemon's default, which would keep the old ID
+	}
+	endpoints := map[string]*network.EndpointSettings{}
+	if old.NetworkSettings != nil {
+		for nw, ep := range old.NetworkSettings.Networks {
+			endpoints[nw] = &network.EndpointSettings{IPAMConfig: ep.IPAMConfig, Aliases: ep.Aliases, DriverOpts: ep.DriverOpts, GwPriority: ep.GwPriority}
+		}
+	}
+
+	_, _ = p.client.ContainerStop(ctx, name, client.ContainerStopOptions{})
+	if _, err := p.client.ContainerRemove(ctx, name, client.ContainerRemoveOptions{Force: true}); err != nil && !errdefs.IsNotFound(err) {
+		return runerr.Wrap(ctx, "remove existing container", name, err)
+	}
+	created, err := p.client.ContainerCreate(ctx, client.ContainerCreateOptions{
+		Name:             name,
+		Config:           &cfg,
+		HostConfig:       old.HostConfig,
+		NetworkingConfig: &network.NetworkingConfig{EndpointsConfig: endpoints},
+		Platform:         platform,
+	})
+	if err != nil {
+		return runerr.Wrap(ctx, "create container", name, err)
+	}
+	if len(files) > 0 {
+		if err := p.copyFiles(ctx, created.ID, name, files); err != nil {
+			return err
+		}
+	}
+	if _, err := p.client.ContainerStart(ctx, created.ID, client.ContainerStartOptions{}); err != nil {
+		return runerr.Wrap(ctx, "start container", name, err)
+	}
+	return nil
+}
+
+// readFiles reads back the files listed in a container's files label.
+func (p *DockerPlatform) readFiles(ctx context.Context, name, label string) ([]platforms.File, error) {
+	if label == "" {
+		return nil, nil
+	}
+	var paths []string
+	if err := json.Unmarshal([]byte(label), &paths); err != nil {
+		return nil, runerr.Wrap(ctx, "read files", name, err)
+	}
+	out := make([]platforms.File, 0, len(paths))
+	for _, fp := range paths {
+		res, err := p.client.CopyFromContainer(ctx, name, client.CopyFromContainerOptions{SourcePath: fp})
+		if err != nil {
+			return nil, runerr.Wrap(ctx, "read files", name, err)
+		}
+		f, err := readTarFile(res.Content, fp)
+		res.Content.Close()
+		if err != nil {
+			return nil, runerr.Wrap(ctx, "read files", name, err)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// readTarFile reads the single file of a copy-from-container archive.
+func readTarFile(r io.Reader, fp string) (platforms.File, error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return platforms.File{}, fmt.Errorf("%s: %w", fp, err)
+	}
+	if hdr.Typeflag != tar.TypeReg || hdr.Name != path.Base(fp) {
+		return platforms.File{}, fmt.Errorf("%s is not a regular file", fp)
+	}
+	b, err := io.ReadAll(tr)
+	if err != nil {
+		return platforms.File{}, fmt.Errorf("%s: %w", fp, err)
+	}
+	return platforms.File{Path: fp, Mode: fs.FileMode(hdr.Mode).Perm(), Content: b}, nil
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
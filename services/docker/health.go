@@ -0,0 +1,77 @@
+package docker
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+)
+
+const healthPollInterval = time.Second
+
+// healthConfig translates a service's healthcheck; nil keeps the image's own.
+func healthConfig(hc *models.Healthcheck) *container.HealthConfig {
+	if hc == nil {
+		return nil
+	}
+	out := &container.HealthConfig{Test: hc.Test}
+	if hc.Interval != nil {
+		out.Interval = time.Duration(*hc.Interval)
+	}
+	if hc.Timeout != nil {
+		out.Timeout = time.Duration(*hc.Timeout)
+	}
+	if hc.StartPeriod != nil {
+		out.StartPeriod = time.Duration(*hc.StartPeriod)
+	}
+	if hc.Retries != nil {
+		out.Retries = *hc.Retries
+	}
+	return out
+}
+
+// waitHealthy polls the container until its healthcheck passes. It fails as soon
+// as the container is reported unhealthy or stops running, with the last probe's
+// output; the services phase deadline bounds the wait otherwise.
+func (p *DockerPlatform) waitHealthy(ctx context.Context, id, name string) error {
+	ticker := time.NewTicker(healthPollInterval)
+	defer ticker.Stop()
+	for {
+		inspect, err := p.client.ContainerInspect(ctx, id, client.ContainerInspectOptions{})
+		if err != nil {
+			return runerr.Wrap(ctx, "inspect container", name, err)
+		}
+		st := inspect.Container.State
+		switch {
+		case st == nil:
+		case !st.Running:
+			return runerr.Errorf(ctx, "wait for healthy", name, "container stopped (exit code %d) before it was healthy", st.ExitCode)
+		case st.Health == nil || st.Health.Status == container.Healthy:
+			return nil
+		case st.Health.Status == container.Unhealthy:
+			return runerr.Errorf(ctx, "wait for healthy", name, "container is unhealthy%s", lastProbe(st.Health))
+		}
+
+		select {
+		case <-ctx.Done():
+			return runerr.Wrap(ctx, "wait for healthy", name, context.Cause(ctx))
+		case <-ticker.C:
+		}
+	}
+}
+
+// lastProbe formats the output of the most recent healthcheck run, if any.
+func lastProbe(h *container.Health) string {
+	if len(h.Log) == 0 {
+		return ""
+	}
+	out := strings.TrimSpace(h.Log[len(h.Log)-1].Output)
+	if out == "" {
+		return ""
+	}
+	return ": " + out
+}
@@ -3,13 +3,19 @@ package docker
 import (
 	"bufio"
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
 	"io"
-	"sort"
+	"math"
+	"net/netip"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/secopt"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/network"
+	"github.com/moby/moby/client"
 )
 
 func DemuxDockerLogs(dstOut, dstErr io.Writer, src io.Reader) error {
@@ -55,13 +61,6 @@ func DemuxDockerLogs(dstOut, dstErr io.Writer, src io.Reader) error {
 	}
 }
 
-func IsRunnerRole(service *models.MetadataService) bool {
-	if service == nil || service.Role == nil {
-		return false
-	}
-	return *service.Role == models.ServiceRoleRunner
-}
-
 func DockerServiceName(jobID, serviceKey string) string {
 	return fmt.Sprintf("%s-%s", jobID, strings.TrimSpace(serviceKey))
 }
@@ -88,195 +87,161 @@ func DockerVolumeName(jobID, volumeName string) string {
 	return fmt.Sprintf("dc-%s-%s", safe(jobID), safe(volumeName))
 }
 
-func CheckDependsOnServicesExist(services map[string]models.MetadataService) error {
-	// Stable iteration (nicer error messages)
-	keys := make([]string, 0, len(services))
-	for k := range services {
-		keys = append(keys, k)
+// namespaceMode turns an ipc or pid mode into Docker's, naming the container of a
+// service:<name> target.
+func namespaceMode(jobID, mode string) string {
+	if target, ok := strings.CutPrefix(mode, models.ServiceNamespacePrefix); ok {
+		return "container:" + DockerServiceName(jobID, target)
 	}
-	sort.Strings(keys)
-
-	for _, svcKey := range keys {
-		svc := services[svcKey]
-		if svc.DependsOn == nil || len(*svc.DependsOn) == 0 {
-			continue
-		}
+	return mode
+}
 
-		for _, depKey := range *svc.DependsOn {
-			if _, ok := services[depKey]; !ok {
-				return fmt.Errorf("service %q depends_on %q, but %q does not exist", svcKey, depKey, depKey)
-			}
-		}
+// deviceRequest translates a device request; its capabilities are the single set
+// Docker must match.
+func deviceRequest(d models.DeviceRequest) container.DeviceRequest {
+	out := container.DeviceRequest{
+		Driver:    d.Driver,
+		Count:     d.Count,
+		DeviceIDs: d.DeviceIDs,
+		Options:   d.Options,
 	}
-
-	return nil
+	if len(d.Capabilities) > 0 {
+		out.Capabilities = [][]string{d.Capabilities}
+	}
+	return out
 }
 
-func GetPlatformData(connection models.ResourceConnection) *json.RawMessage {
-	if connection.Type != models.ResourceConnectionTypePlatform {
-		return nil
+// joinPorts writes ports as a label value, e.g. "5432,6379".
+func joinPorts(ports []int) string {
+	s := make([]string, len(ports))
+	for i, port := range ports {
+		s[i] = strconv.Itoa(port)
 	}
-	return &connection.Data
+	return strings.Join(s, ",")
 }
 
-func CheckCircularDependencies(services map[string]models.MetadataService) error {
-	const (
-		unvisited = 0
-		visiting  = 1
-		visited   = 2
-	)
-
-	state := make(map[string]uint8, len(services))
-	parent := make(map[string]string, len(services))
-
-	var dfs func(string) error
-	dfs = func(node string) error {
-		switch state[node] {
-		case visiting:
-			// Found a back-edge; reconstruct cycle path using parent pointers.
-			cycle := reconstructCycle(parent, node)
-			return fmt.Errorf("circular dependency detected: %s", cycle)
-		case visited:
-			return nil
-		}
-
-		state[node] = visiting
-
-		svc := services[node]
-		if svc.DependsOn != nil {
-			for _, dep := range *svc.DependsOn {
-				// Existence is checked elsewhere; skip unknown just in case.
-				if _, ok := services[dep]; !ok {
-					continue
-				}
-				// Track parent for reconstruction (only set if not already set).
-				if _, ok := parent[dep]; !ok {
-					parent[dep] = node
-				}
-				if err := dfs(dep); err != nil {
-					return err
-				}
-			}
+// dnsServers parses a service's dns nameservers.
+func dnsServers(servers []string) ([]netip.Addr, error) {
+	var out []netip.Addr
+	for _, s := range servers {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, err
 		}
+		out = append(out, addr)
+	}
+	return out, nil
+}
 
-		state[node] = visited
-		return nil
+// restartPolicy returns the service's restart policy, or that of the platform
+// when it sets none.
+func restartPolicy(service *models.MetadataService, platform container.RestartPolicyMode) (container.RestartPolicy, error) {
+	if service.Restart == nil {
+		return container.RestartPolicy{Name: platform}, nil
+	}
+	mode, retries, err := service.Restart.Mode()
+	if err != nil {
+		return container.RestartPolicy{}, err
 	}
+	return container.RestartPolicy{Name: container.RestartPolicyMode(mode), MaximumRetryCount: retries}, nil
+}
 
-	for node := range services {
-		if state[node] == unvisited {
-			if err := dfs(node); err != nil {
-				return err
+// securityOpts renders security_opt for HostConfig.SecurityOpt. A custom seccomp
+// profile is read here and sent inline, since the API takes the profile rather
+// than a path on the daemon's host.
+func securityOpts(entries []string) ([]string, error) {
+	opts, err := secopt.ParseAll(entries)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, o := range opts {
+		value := o.Value
+		if o.Custom() {
+			b, err := o.Profile()
+			if err != nil {
+				return nil, err
 			}
+			value = string(b)
 		}
+		out = append(out, o.Kind+"="+value)
 	}
-
-	return nil
+	return out, nil
 }
 
-func reconstructCycle(parent map[string]string, start string) string {
-	// Walk parent pointers until we repeat a node.
-	// Build list in reverse then format.
-	seen := map[string]bool{start: true}
-	path := []string{start}
-
-	cur := start
-	for {
-		p, ok := parent[cur]
-		if !ok {
-			// Fallback; shouldn't happen with a proper parent chain
-			break
-		}
-		path = append(path, p)
-		if seen[p] {
-			// Close cycle at p
-			break
-		}
-		seen[p] = true
-		cur = p
-	}
+// stopTimeout converts a stop grace period to the whole seconds Docker takes,
+// rounding up so a grace period is never shortened.
+func stopTimeout(d models.Duration) *int {
+	seconds := int((time.Duration(d) + time.Second - 1) / time.Second)
+	return &seconds
+}
 
-	// path currently like: start, parent(start), parent(...), ..., repeatedNode
-	// Reverse to make it read forward, then ensure closure at end.
-	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
-		path[i], path[j] = path[j], path[i]
+// stopOptions stops a container with the service's stop_signal and gives it its
+// stop_grace_period before the daemon kills it.
+func stopOptions(service *models.MetadataService) client.ContainerStopOptions {
+	var opts client.ContainerStopOptions
+	if service.StopSignal != nil {
+		opts.Signal = *service.StopSignal
 	}
-
-	// Ensure last equals first for readability
-	if len(path) > 0 && path[len(path)-1] != path[0] {
-		path = append(path, path[0])
+	if service.StopGracePeriod != nil {
+		opts.Timeout = stopTimeout(*service.StopGracePeriod)
 	}
+	return opts
+}
 
-	// Join manually to avoid extra deps
-	out := ""
-	for i, s := range path {
-		if i > 0 {
-			out += " -> "
-		}
-		out += fmt.Sprintf("%q", s)
-	}
-	return out
+// nanoCPUs converts a CPU count to Docker's billionths of a CPU.
+func nanoCPUs(cpus float64) int64 {
+	return int64(math.Round(cpus * 1e9))
 }
 
-func DeclaredVolumeSet(vols *[]string) (map[string]struct{}, error) {
-	set := map[string]struct{}{}
-	if vols == nil {
-		return set, nil
+// networkIPAM translates a network group's subnets, or returns nil to let Docker
+// pick one.
+func networkIPAM(spec models.NetworkSpec) (*network.IPAM, error) {
+	if len(spec.Subnets) == 0 {
+		return nil, nil
 	}
-
-	for _, v := range *vols {
-		name := strings.TrimSpace(v)
-		if name == "" {
-			return nil, fmt.Errorf("metadata.volumes contains an empty name")
+	ipam := &network.IPAM{}
+	for _, s := range spec.Subnets {
+		var cfg network.IPAMConfig
+		var err error
+		if cfg.Subnet, err = netip.ParsePrefix(s.Subnet); err != nil {
+			return nil, err
+		}
+		if s.Gateway != "" {
+			if cfg.Gateway, err = netip.ParseAddr(s.Gateway); err != nil {
+				return nil, err
+			}
 		}
-		if _, exists := set[name]; exists {
-			return nil, fmt.Errorf("metadata.volumes contains duplicate volume %q", name)
+		if s.IPRange != "" {
+			if cfg.IPRange, err = netip.ParsePrefix(s.IPRange); err != nil {
+				return nil, err
+			}
 		}
-		set[name] = struct{}{}
+		ipam.Config = append(ipam.Config, cfg)
 	}
-
-	return set, nil
+	return ipam, nil
 }
 
-func CheckServiceVolumeMounts(services map[string]models.MetadataService, declared map[string]struct{}) (*map[string]struct{}, error) {
-	stragglers := make(map[string]struct{})
-	for svcKey, svc := range services {
-		if svc.Volumes == nil || len(*svc.Volumes) == 0 {
-			continue
+// endpointIPAM translates a service's fixed addresses on one network.
+func endpointIPAM(ep models.Endpoint) (*network.EndpointIPAMConfig, error) {
+	cfg := &network.EndpointIPAMConfig{}
+	var err error
+	if ep.IPv4Address != "" {
+		if cfg.IPv4Address, err = netip.ParseAddr(ep.IPv4Address); err != nil {
+			return nil, err
 		}
-
-		// Ensure no duplicate mount paths inside a service
-		seenMountPath := map[string]struct{}{}
-
-		for _, m := range *svc.Volumes {
-			mountPath := strings.TrimSpace(m.MountPath)
-			if mountPath == "" {
-				return nil, fmt.Errorf("service %q has a volume with empty mount_path", svcKey)
-			}
-			if !strings.HasPrefix(mountPath, "/") {
-				return nil, fmt.Errorf("service %q volume mount_path %q must be absolute", svcKey, mountPath)
-			}
-			if _, ok := seenMountPath[mountPath]; ok {
-				return nil, fmt.Errorf("service %q has duplicate volume mount_path %q", svcKey, mountPath)
-			}
-			seenMountPath[mountPath] = struct{}{}
-
-			// Name == nil means runner-provided volume (allowed)
-			if m.Name == nil {
-				continue
-			}
-
-			name := strings.TrimSpace(*m.Name)
-			if name == "" {
-				return nil, fmt.Errorf("service %q has a volume with empty name", svcKey)
-			}
-
-			// Must be declared in metadata.volumes
-			if _, ok := declared[name]; !ok {
-				stragglers[name] = struct{}{}
-			}
+	}
+	if ep.IPv6Address != "" {
+		if cfg.IPv6Address, err = netip.ParseAddr(ep.IPv6Address); err != nil {
+			return nil, err
 		}
 	}
-
-	return &stragglers, nil
+	for _, ip := range ep.LinkLocalIPs {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return nil, err
+		}
+		cfg.LinkLocalIPs = append(cfg.LinkLocalIPs, addr)
+	}
+	return cfg, nil
 }
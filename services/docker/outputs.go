@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+
+	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+
+	"github.com/moby/moby/client"
+)
+
+// readStepOutputs copies a finished step's outputs file out of its container.
+// A step that wrote no outputs file has no outputs.
+func (p *DockerPlatform) readStepOutputs(ctx context.Context, containerID string, run uuid.UUID, step string) (map[string]string, error) {
+	src := platforms.StepOutputsPath(run, step)
+
+	res, err := p.client.CopyFromContainer(ctx, containerID, client.CopyFromContainerOptions{SourcePath: src})
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return map[string]string{}, nil
+		}
+		return nil, runerr.Wrap(ctx, "copy outputs of step", step, err)
+	}
+	defer res.Content.Close()
+
+	tr := tar.NewReader(res.Content)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return map[string]string{}, nil
+		}
+		if err != nil {
+			return nil, runerr.Wrap(ctx, "read outputs of step", step, err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			return platforms.ParseStepOutputs(tr)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package docker
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+	"github.com/moby/moby/client"
+)
+
+// pinnedHosts resolves a service's pin_hosts to extra_hosts entries ("name:ip"),
+// one per DNS name and address each target has on a network the service joins.
+// Targets are in depends_on, so they are already set up and their addresses
+// are current. Entries are sorted so they compare stably across runs.
+func (p *DockerPlatform) pinnedHosts(ctx context.Context, job uuid.UUID, service *models.MetadataService, joins func(network string) bool) ([]string, error) {
+	var out []string
+	for _, target := range service.PinHosts {
+		containerName := DockerServiceName(job.String(), target)
+		inspect, err := p.client.ContainerInspect(ctx, containerName, client.ContainerInspectOptions{})
+		if err != nil {
+			return nil, runerr.Wrap(ctx, "pin hosts of", containerName, err)
+		}
+		settings := inspect.Container.NetworkSettings
+		if settings == nil {
+			continue
+		}
+		for _, n := range slices.Sorted(maps.Keys(settings.Networks)) {
+			es := settings.Networks[n]
+			if es == nil || !joins(n) {
+				continue
+			}
+			for _, name := range es.DNSNames {
+				// Skip the short container id Docker also registers.
+				if strings.HasPrefix(inspect.Container.ID, name) {
+					continue
+				}
+				if es.IPAddress.IsValid() {
+					out = append(out, name+":"+es.IPAddress.String())
+				}
+				if es.GlobalIPv6Address.IsValid() {
+					out = append(out, name+":"+es.GlobalIPv6Address.String())
+				}
+			}
+		}
+	}
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
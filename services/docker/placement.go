@@ -0,0 +1,121 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// Name of the daemon configured at the top level of platform_data (or by DOCKER_HOST).
+const defaultHost = "default"
+
+// networkKey names a network on one daemon; the same job network exists on every
+// daemon that runs one of the job's services.
+type networkKey struct {
+	host string
+	name string
+}
+
+// hostNames lists the daemons, the default one first and the rest by name.
+func (p *DockerPlatform) hostNames() []string {
+	names := make([]string, 0, len(p.clients))
+	for name := range p.clients {
+		if name != defaultHost {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{defaultHost}, names...)
+}
+
+// hostFor picks the daemon a service runs on: placement.host by name, or else the
+// first daemon (see hostNames) whose labels include all of placement.labels.
+// With a single daemon (and on swarm, which places through constraints) placement
+// has nothing to choose from and every service runs on the default daemon.
+func (p *DockerPlatform) hostFor(name string, service *models.MetadataService) (string, error) {
+	pl := service.Placement
+	if pl == nil || p.swarm || len(p.clients) < 2 {
+		return defaultHost, nil
+	}
+
+	if pl.Host != "" {
+		if _, ok := p.clients[pl.Host]; !ok {
+			return "", fmt.Errorf("service %q: placement host %q is not in platform_data hosts (have %v)", name, pl.Host, p.hostNames())
+		}
+		if !hasLabels(p.hostLabels[pl.Host], pl.Labels) {
+			return "", fmt.Errorf("service %q: placement host %q does not have labels %v", name, pl.Host, pl.Labels)
+		}
+		return pl.Host, nil
+	}
+
+	for _, h := range p.hostNames() {
+		if hasLabels(p.hostLabels[h], pl.Labels) {
+			return h, nil
+		}
+	}
+	return "", fmt.Errorf("service %q: no docker host has placement labels %v", name, pl.Labels)
+}
+
+func hasLabels(have, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := have[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// on returns the platform bound to the named daemon. The view shares the run's
+// state (result, facts, step outputs, created networks) with p; only the client differs.
+func (p *DockerPlatform) on(host string) *DockerPlatform {
+	if host == p.host {
+		return p
+	}
+	v := *p
+	v.client = p.clients[host]
+	v.host = host
+	return &v
+}
+
+// forService returns the platform bound to the daemon the service is placed on.
+func (p *DockerPlatform) forService(name string, service *models.MetadataService) (*DockerPlatform, error) {
+	host, err := p.hostFor(name, service)
+	if err != nil {
+		return nil, err
+	}
+	return p.on(host), nil
+}
+
+// eachHost runs fn on every daemon and joins the errors, so one unreachable host
+// doesn't stop the others from being cleaned up.
+func (p *DockerPlatform) eachHost(fn func(hp *DockerPlatform) error) error {
+	var errs []error
+	for _, h := range p.hostNames() {
+		if err := fn(p.on(h)); err != nil {
+			if len(p.clients) > 1 {
+				err = fmt.Errorf("docker host %q: %w", h, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// swarmConstraints turns placement into swarm node constraints.
+func swarmConstraints(pl *models.Placement) []string {
+	if pl == nil {
+		return nil
+	}
+	var out []string
+	if pl.Host != "" {
+		out = append(out, "node.hostname=="+pl.Host)
+	}
+	for _, k := range slices.Sorted(maps.Keys(pl.Labels)) {
+		out = append(out, fmt.Sprintf("node.labels.%s==%s", k, pl.Labels[k]))
+	}
+	return out
+}
@@ -0,0 +1,192 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/network"
+	"github.com/moby/moby/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const defaultForwardImage = "alpine/socat:latest"
+
+// PortForward accepts connections on fwd's listen address until ctx ends and
+// tunnels each one to fwd.Port of the service's container. Every connection gets
+// a short-lived helper container on the service's network running socat, attached
+// over the Docker API, so this works against remote daemons too and nothing is
+// published on the daemon's host.
+func (p *DockerPlatform) PortForward(ctx context.Context, job uuid.UUID, fwd models.PortForward) error {
+	if p.swarm {
+		return fmt.Errorf("port-forward is not supported on swarm")
+	}
+	ctx = runerr.WithService(ctx, fwd.Service)
+	containerName := DockerServiceName(job.String(), fwd.Service)
+
+	// Find the daemon the service runs on and a network it is attached to.
+	var hp *DockerPlatform
+	var netName string
+	for _, h := range p.hostNames() {
+		inspect, err := p.on(h).client.ContainerInspect(ctx, containerName, client.ContainerInspectOptions{})
+		if errdefs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return runerr.Wrap(ctx, "inspect container", containerName, err)
+		}
+		if inspect.Container.NetworkSettings == nil || len(inspect.Container.NetworkSettings.Networks) == 0 {
+			return runerr.Errorf(ctx, "find container network", containerName, "container is not attached to a network")
+		}
+		names := make([]string, 0, len(inspect.Container.NetworkSettings.Networks))
+		for name := range inspect.Container.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		hp, netName = p.on(h), names[0]
+		break
+	}
+	if hp == nil {
+		return runerr.Errorf(ctx, "find container", containerName, "no such container on any docker host")
+	}
+
+	image := fwd.Image
+	if image == "" {
+		image = defaultForwardImage
+	}
+	if err := hp.ensureImage(ctx, image, nil, models.PullIfNotPresent); err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", fwd.ListenAddr())
+	if err != nil {
+		return runerr.Wrap(ctx, "listen", fwd.ListenAddr(), err)
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	target := net.JoinHostPort(containerName, strconv.Itoa(fwd.Port))
+	log.Printf("forwarding %s to %s on network %s; stop with Ctrl-C", ln.Addr(), target, netName)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return runerr.Wrap(ctx, "accept connection", fwd.ListenAddr(), err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := hp.forwardConn(ctx, conn, job, image, netName, target); err != nil && ctx.Err() == nil {
+				log.Printf("port-forward %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// forwardConn pipes one connection through a socat helper container on netName.
+func (p *DockerPlatform) forwardConn(ctx context.Context, conn net.Conn, job uuid.UUID, image, netName, target string) error {
+	defer conn.Close()
+
+	created, err := p.client.ContainerCreate(ctx, client.ContainerCreateOptions{
+		Config: &container.Config{
+			Image:        image,
+			Entrypoint:   []string{"socat"},
+			Cmd:          []string{"STDIO", "TCP:" + target},
+			OpenStdin:    true,
+			StdinOnce:    true,
+			AttachStdin:  true,
+			AttachStdout: true,
+			AttachStderr: true,
+			Labels: map[string]string{
+				p.label("job"):  job.String(),
+				p.label("kind"): "port-forward",
+			},
+		},
+		HostConfig: &container.HostConfig{AutoRemove: true},
+		NetworkingConfig: &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{netName: {}},
+		},
+		Image: image,
+	})
+	if err != nil {
+		return fmt.Errorf("create helper container: %w", err)
+	}
+	defer p.client.ContainerRemove(context.WithoutCancel(ctx), created.ID, client.ContainerRemoveOptions{Force: true})
+
+	attached, err := p.client.ContainerAttach(ctx, created.ID, client.ContainerAttachOptions{
+		Stream: true,
+		Stdin:  true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return fmt.Errorf("attach helper container: %w", err)
+	}
+	defer attached.Close()
+
+	if _, err := p.client.ContainerStart(ctx, created.ID, client.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("start helper container: %w", err)
+	}
+
+	go func() {
+		_, _ = io.Copy(attached.Conn, conn)
+		_ = attached.CloseWrite()
+	}()
+
+	var stderr bytes.Buffer
+	if err := DemuxDockerLogs(conn, &stderr, attached.Reader); err != nil && ctx.Err() == nil {
+		return err
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("%s", msg)
+	}
+	return nil
+}
+
+// ensureImage makes sure the daemon has the image as policy asks: pulled again,
+// pulled if missing, or already there. A non-nil platform asks for that variant
+// of the image instead of the host's.
+func (p *DockerPlatform) ensureImage(ctx context.Context, image string, platform *ocispec.Platform, policy models.PullPolicy) error {
+	var inspectOpts []client.ImageInspectOption
+	pullOpts := client.ImagePullOptions{}
+	if platform != nil {
+		inspectOpts = append(inspectOpts, client.ImageInspectWithPlatform(platform))
+		pullOpts.Platforms = []ocispec.Platform{*platform}
+	}
+	if policy != models.PullAlways {
+		_, err := p.client.ImageInspect(ctx, image, inspectOpts...)
+		if err == nil {
+			return nil
+		}
+		if policy == models.PullNever {
+			return runerr.Wrap(ctx, "inspect image", image, fmt.Errorf("pull_policy is never: %w", err))
+		}
+	}
+	resp, err := p.client.ImagePull(ctx, image, pullOpts)
+	if err != nil {
+		return runerr.Wrap(ctx, "pull image", image, err)
+	}
+	if err := resp.Wait(ctx); err != nil {
+		return runerr.Wrap(ctx, "pull image", image, err)
+	}
+	return nil
+}
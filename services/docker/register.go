@@ -0,0 +1,18 @@
+package docker
+
+import (
+	"encoding/json"
+
+	"github.com/ezenkico/deploy-commander/runner/interfaces"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+)
+
+func init() {
+	platforms.Register("docker", func(comm *agent.AgentCommunication, data *json.RawMessage) (interfaces.Platform, error) {
+		return NewDockerPlatform(comm, data)
+	})
+	platforms.Register("swarm", func(comm *agent.AgentCommunication, data *json.RawMessage) (interfaces.Platform, error) {
+		return NewSwarmPlatform(comm, data)
+	})
+}
@@ -0,0 +1,191 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/events"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+)
+
+// parsePlatformData reads the optional models.DockerPlatformData.
+func parsePlatformData(data *json.RawMessage) (models.DockerPlatformData, error) {
+	var pd models.DockerPlatformData
+	if data == nil {
+		return pd, nil
+	}
+	if err := json.Unmarshal(*data, &pd); err != nil {
+		return pd, fmt.Errorf("parse docker platform_data: %w", err)
+	}
+	if _, ok := pd.Hosts[defaultHost]; ok {
+		return pd, fmt.Errorf("docker platform_data: host name %q is reserved for the top-level daemon", defaultHost)
+	}
+	switch container.RestartPolicyMode(pd.RestartPolicy) {
+	case "", container.RestartPolicyAlways, container.RestartPolicyUnlessStopped, container.RestartPolicyOnFailure, container.RestartPolicyDisabled:
+	default:
+		return pd, fmt.Errorf("docker platform_data: unknown restart_policy %q (valid: always, unless-stopped, on-failure, no)", pd.RestartPolicy)
+	}
+	return pd, nil
+}
+
+// clientOptions turns a daemon's settings into Docker client options. They are applied
+// after client.FromEnv, so anything set here wins over DOCKER_HOST and friends.
+func clientOptions(h models.DockerHost) ([]client.Opt, error) {
+	opts := []client.Opt{client.FromEnv}
+
+	if h.Host != "" {
+		u, err := url.Parse(h.Host)
+		if err != nil {
+			return nil, fmt.Errorf("docker platform_data host %q: %w", h.Host, err)
+		}
+		if u.Scheme == "ssh" {
+			// The client speaks HTTP over whatever the dialer returns; the host part
+			// only ends up in the Host header.
+			opts = append(opts, client.WithHost("http://docker.example.com"), client.WithDialContext(sshDialer(u)))
+		} else {
+			opts = append(opts, client.WithHost(h.Host))
+		}
+	}
+
+	if h.TLSCACert != "" || h.TLSCert != "" || h.TLSKey != "" {
+		opts = append(opts, client.WithTLSClientConfig(h.TLSCACert, h.TLSCert, h.TLSKey))
+	}
+	if h.APIVersion != "" {
+		opts = append(opts, client.WithAPIVersion(h.APIVersion))
+	}
+	return opts, nil
+}
+
+// newClient connects to one daemon. Its mutating requests are recorded in the
+// run's event log.
+func newClient(name string, h models.DockerHost) (*client.Client, error) {
+	opts, err := clientOptions(h)
+	if err != nil {
+		return nil, err
+	}
+	// The client only configures (TLS, unix sockets) an *http.Transport, so the
+	// recording transport goes around it once the client is built. Until then
+	// hc is set up the way the client's default one is.
+	hc := &http.Client{
+		Transport:     &http.Transport{MaxIdleConns: 6, IdleConnTimeout: 30 * time.Second},
+		CheckRedirect: client.CheckRedirect,
+	}
+	opts = append([]client.Opt{client.WithHTTPClient(hc), client.WithHost(client.DefaultDockerHost)}, opts...)
+	c, err := client.New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("docker host %q: %w", name, err)
+	}
+	hc.Transport = events.Transport("docker", hc.Transport)
+	return c, nil
+}
+
+// sshDialer reaches the daemon the way the docker CLI does for ssh:// hosts: it runs
+// `docker system dial-stdio` on the remote host and talks to it over the ssh session.
+// Authentication is left to ssh (agent, keys, ~/.ssh/config).
+func sshDialer(u *url.URL) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	args := []string{"-o", "ConnectTimeout=30"}
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		// The connection outlives the dial, so the command must not be tied to ctx.
+		cmd := exec.Command("ssh", args...)
+		stderr := &syncBuffer{}
+		cmd.Stderr = stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("ssh to docker host %q: %w", u.Host, err)
+		}
+		return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout, stderr: stderr, remote: u.Host}, nil
+	}
+}
+
+// commandConn is a net.Conn over a command's stdin and stdout.
+// Deadlines are not supported; the HTTP client's contexts bound each request instead.
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr *syncBuffer
+	remote string
+
+	closeOnce sync.Once
+}
+
+// Read reports what the command printed to stderr once its output ends, since a
+// bare EOF says nothing about why ssh gave up.
+func (c *commandConn) Read(b []byte) (int, error) {
+	n, err := c.stdout.Read(b)
+	if err == io.EOF {
+		if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+			return n, fmt.Errorf("ssh %s: %s", c.remote, msg)
+		}
+	}
+	return n, err
+}
+
+func (c *commandConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.stdin.Close()
+		_ = c.cmd.Process.Kill()
+		_ = c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return commandAddr("ssh") }
+func (c *commandConn) RemoteAddr() net.Addr { return commandAddr(c.remote) }
+
+func (c *commandConn) SetDeadline(time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(time.Time) error { return nil }
+
+// syncBuffer collects stderr, which exec writes from its own goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+type commandAddr string
+
+func (a commandAddr) Network() string { return "ssh" }
+func (a commandAddr) String() string  { return string(a) }
@@ -3,9 +3,11 @@ package docker
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
 	"github.com/google/uuid"
 
 	"github.com/moby/moby/client"
@@ -19,45 +21,132 @@ func (p *DockerPlatform) RemoveServices(ctx context.Context, job uuid.UUID, remo
 	resourceNames := make(map[string]struct{})
 
 	for _, service := range *removeServices {
-		containerName := DockerServiceName(job.String(), service)
-		inspect, err := p.client.ContainerInspect(ctx, containerName, client.ContainerInspectOptions{})
-		if err == nil {
-			// Extract prior resources
-			if inspect.Container.Config != nil && inspect.Container.Config.Labels != nil {
-				if v, ok := inspect.Container.Config.Labels["deploy-commander.resources"]; ok && v != "" {
-					var names []string
-					if je := json.Unmarshal([]byte(v), &names); je == nil {
-						for _, n := range names {
-							if n != "" {
-								resourceNames[n] = struct{}{}
-							}
-						}
-					}
-					// If JSON is malformed, ignore silently (or log if you have logger available).
-				}
+		ctx := runerr.WithService(ctx, service)
+		if p.swarm {
+			if err := p.removeSwarmServicesOf(ctx, job, service, resourceNames); err != nil {
+				return err
 			}
-
-			// Stop (best-effort) then remove
-			_, _ = p.client.ContainerStop(ctx, containerName, client.ContainerStopOptions{})
-			_, err := p.client.ContainerRemove(ctx, containerName, client.ContainerRemoveOptions{
-				Force:         true,
-				RemoveVolumes: false,
-			})
-			if err != nil {
-				return fmt.Errorf("remove existing container %q: %w", containerName, err)
+		}
+		// A removed service's placement is gone with its metadata, so look everywhere.
+		for _, h := range p.hostNames() {
+			if err := p.on(h).removeContainersOf(ctx, job, service, resourceNames); err != nil {
+				return err
 			}
 		}
 	}
 
 	if p.comm != nil {
 		for resource, _ := range resourceNames {
-			p.comm.DeleteResourceByName(ctx, resource)
+			if err := p.comm.DeleteResourceByName(ctx, resource); err != nil {
+				p.warn("delete resource %q of removed service: %v", resource, err)
+				continue
+			}
+			p.changed()
 		}
 	}
 
 	return nil
 }
 
+// serviceLabelFilters selects what was created for one of the job's services.
+func (p *DockerPlatform) serviceLabelFilters(job uuid.UUID, service string) client.Filters {
+	return make(client.Filters).
+		Add("label", p.label("job")+"="+job.String()).
+		Add("label", p.label("service")+"="+service)
+}
+
+// removeContainersOf removes every container labeled with the service, whatever
+// its name, then the one with the service's own name, which covers containers
+// created before they were labeled.
+func (p *DockerPlatform) removeContainersOf(ctx context.Context, job uuid.UUID, service string, resourceNames map[string]struct{}) error {
+	containers, err := p.client.ContainerList(ctx, client.ContainerListOptions{
+		All:     true,
+		Filters: p.serviceLabelFilters(job, service),
+	})
+	if err != nil {
+		return runerr.Wrap(ctx, "list containers", service, err)
+	}
+	for _, c := range containers.Items {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		if err := p.removeContainer(ctx, name, resourceNames); err != nil {
+			return err
+		}
+	}
+	return p.removeContainer(ctx, DockerServiceName(job.String(), service), resourceNames)
+}
+
+// removeSwarmServicesOf is removeContainersOf for swarm services.
+func (p *DockerPlatform) removeSwarmServicesOf(ctx context.Context, job uuid.UUID, service string, resourceNames map[string]struct{}) error {
+	services, err := p.client.ServiceList(ctx, client.ServiceListOptions{Filters: p.serviceLabelFilters(job, service)})
+	if err != nil {
+		return runerr.Wrap(ctx, "list swarm services", service, err)
+	}
+	names := make([]string, 0, len(services.Items)+1)
+	for _, s := range services.Items {
+		names = append(names, s.Spec.Name)
+	}
+	if name := DockerServiceName(job.String(), service); !slices.Contains(names, name) {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if err := p.priorSwarmResources(ctx, name, resourceNames); err != nil {
+			return err
+		}
+		if _, err := p.client.ServiceRemove(ctx, name, client.ServiceRemoveOptions{}); err != nil && !errdefs.IsNotFound(err) {
+			return runerr.Wrap(ctx, "remove swarm service", name, err)
+		} else if err == nil {
+			p.changed()
+		}
+	}
+	return nil
+}
+
+// removeContainer removes a service container if it exists, adding the resources
+// it recorded to resourceNames.
+func (p *DockerPlatform) removeContainer(ctx context.Context, containerName string, resourceNames map[string]struct{}) error {
+	inspect, err := p.client.ContainerInspect(ctx, containerName, client.ContainerInspectOptions{})
+	if err == nil {
+		if inspect.Container.Config != nil {
+			if err := p.fence(ctx, containerName, inspect.Container.Config.Labels); err != nil {
+				return err
+			}
+		}
+
+		// Extract prior resources
+		if inspect.Container.Config != nil && inspect.Container.Config.Labels != nil {
+			if v, ok := inspect.Container.Config.Labels[p.label("resources")]; ok && v != "" {
+				var names []string
+				if je := json.Unmarshal([]byte(v), &names); je == nil {
+					for _, n := range names {
+						if n != "" {
+							resourceNames[n] = struct{}{}
+						}
+					}
+				} else {
+					p.warn("container %q has a malformed %s label: %v", containerName, p.label("resources"), je)
+				}
+			}
+		}
+
+		// Stop (best-effort) then remove. Without options the daemon uses the stop
+		// signal and grace period the container was created with.
+		_, _ = p.client.ContainerStop(ctx, containerName, client.ContainerStopOptions{})
+		_, err := p.client.ContainerRemove(ctx, containerName, client.ContainerRemoveOptions{
+			Force:         true,
+			RemoveVolumes: false,
+		})
+		if err != nil {
+			return runerr.Wrap(ctx, "remove existing container", containerName, err)
+		}
+		p.changed()
+	}
+
+	return nil
+}
+
 func (p *DockerPlatform) RemoveVolumes(ctx context.Context, job uuid.UUID, removeVolumes *[]string) error {
 	if removeVolumes == nil {
 		return nil
@@ -70,15 +159,18 @@ func (p *DockerPlatform) RemoveVolumes(ctx context.Context, job uuid.UUID, remov
 
 		volumeName := DockerVolumeName(job.String(), volume)
 
-		// Idempotent remove:
+		// Idempotent remove, on every daemon:
 		// - if it doesn't exist, ignore
 		// - otherwise remove it
-		if _, err := p.client.VolumeRemove(ctx, volumeName, client.VolumeRemoveOptions{}); err != nil {
-			// If it was already gone, that's fine.
-			if errdefs.IsNotFound(err) {
-				continue
+		for _, h := range p.hostNames() {
+			if _, err := p.on(h).client.VolumeRemove(ctx, volumeName, client.VolumeRemoveOptions{}); err != nil {
+				// If it was already gone, that's fine.
+				if errdefs.IsNotFound(err) {
+					continue
+				}
+				return runerr.Wrap(ctx, "remove volume", volumeName, err)
 			}
-			return fmt.Errorf("remove volume %q: %w", volumeName, err)
+			p.changed()
 		}
 	}
 
@@ -0,0 +1,240 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/phase"
+	"github.com/google/uuid"
+	"github.com/moby/moby/client"
+)
+
+// fakeDaemon serves the parts of the Docker API that removing services uses:
+// listing containers and swarm services by label, inspecting, stopping and
+// removing them.
+type fakeDaemon struct {
+	mu         sync.Mutex
+	containers map[string]map[string]string // labels by name
+	services   map[string]map[string]string
+}
+
+var apiVersion = regexp.MustCompile(`^/v[0-9.]+`)
+
+func (d *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	path := apiVersion.ReplaceAllString(r.URL.Path, "")
+	switch {
+	case r.Method == http.MethodGet && path == "/containers/json":
+		var out []map[string]any
+		for _, name := range d.matching(d.containers, r) {
+			labels := d.containers[name]
+			out = append(out, map[string]any{"Id": name, "Names": []string{"/" + name}, "Labels": labels})
+		}
+		writeJSON(w, out)
+	case r.Method == http.MethodGet && path == "/services":
+		var out []map[string]any
+		for _, name := range d.matching(d.services, r) {
+			labels := d.services[name]
+			out = append(out, map[string]any{"ID": name, "Spec": map[string]any{"Name": name, "Labels": labels}})
+		}
+		writeJSON(w, out)
+	case strings.HasPrefix(path, "/containers/"):
+		name, action, _ := strings.Cut(strings.TrimPrefix(path, "/containers/"), "/")
+		labels, ok := d.containers[name]
+		if !ok {
+			notFound(w, "container", name)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && action == "json":
+			writeJSON(w, map[string]any{"Id": name, "Name": "/" + name, "Config": map[string]any{"Labels": labels}})
+		case r.Method == http.MethodPost && action == "stop":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodDelete && action == "":
+			delete(d.containers, name)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	case strings.HasPrefix(path, "/services/"):
+		name := strings.TrimPrefix(path, "/services/")
+		labels, ok := d.services[name]
+		if !ok {
+			notFound(w, "service", name)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, map[string]any{"ID": name, "Spec": map[string]any{"Name": name, "Labels": labels}})
+		case http.MethodDelete:
+			delete(d.services, name)
+		default:
+			http.NotFound(w, r)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// matching returns the objects whose labels satisfy every label filter of the
+// request, sorted by name.
+func (d *fakeDaemon) matching(objects map[string]map[string]string, r *http.Request) []string {
+	var filters map[string]map[string]bool
+	if f := r.URL.Query().Get("filters"); f != "" {
+		_ = json.Unmarshal([]byte(f), &filters)
+	}
+	var out []string
+	for name, labels := range objects {
+		ok := true
+		for sel := range filters["label"] {
+			k, v, _ := strings.Cut(sel, "=")
+			if labels[k] != v {
+				ok = false
+			}
+		}
+		if ok {
+			out = append(out, name)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func notFound(w http.ResponseWriter, kind, name string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": "no such " + kind + ": " + name})
+}
+
+// newFakePlatform returns a platform of the given run generation talking to d.
+func newFakePlatform(t *testing.T, d *fakeDaemon, generation int64, swarm bool) *DockerPlatform {
+	t.Helper()
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+	c, err := client.New(client.WithHost("tcp://"+strings.TrimPrefix(srv.URL, "http://")), client.WithAPIVersion("1.52"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &DockerPlatform{
+		client:      c,
+		host:        defaultHost,
+		clients:     map[string]*client.Client{defaultHost: c},
+		labelPrefix: defaultLabelPrefix,
+		swarm:       swarm,
+		generation:  generation,
+		result:      &models.RunResult{},
+	}
+}
+
+// labeled returns the labels of an object of the job's service, created by a run
+// of generation (0 for none).
+func labeled(job uuid.UUID, service string, generation int64) map[string]string {
+	labels := map[string]string{"deploy-commander.job": job.String(), "deploy-commander.service": service}
+	if generation > 0 {
+		labels["deploy-commander.generation"] = strconv.FormatInt(generation, 10)
+	}
+	return labels
+}
+
+func names(objects map[string]map[string]string) []string {
+	out := make([]string, 0, len(objects))
+	for name := range objects {
+		out = append(out, name)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestRemoveServicesMixedGenerations(t *testing.T) {
+	job := uuid.New()
+	web := DockerServiceName(job.String(), "web")
+	api := DockerServiceName(job.String(), "api")
+	d := &fakeDaemon{containers: map[string]map[string]string{
+		// From before containers were labeled: only its name ties it to the service.
+		web: {"deploy-commander.job": job.String()},
+		// Replicas and a sidecar of earlier generations, named freely.
+		web + "-2":       labeled(job, "web", 1),
+		web + "-sidecar": labeled(job, "web", 2),
+		// Another service of the job, and the same service of another job.
+		api:         labeled(job, "api", 2),
+		"other-web": labeled(uuid.New(), "web", 1),
+	}}
+
+	p := newFakePlatform(t, d, 2, false)
+	if err := p.RemoveServices(context.Background(), job, &[]string{"web"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(d.containers), []string{api, "other-web"}; !slices.Equal(got, want) {
+		t.Errorf("containers left = %v, want %v", got, want)
+	}
+	if !p.result.Changed {
+		t.Error("removing containers did not mark the run changed")
+	}
+}
+
+func TestRemoveServicesLeavesNewerGeneration(t *testing.T) {
+	job := uuid.New()
+	web := DockerServiceName(job.String(), "web")
+	d := &fakeDaemon{containers: map[string]map[string]string{
+		web + "-1": labeled(job, "web", 1),
+		web + "-3": labeled(job, "web", 3),
+	}}
+
+	p := newFakePlatform(t, d, 2, false)
+	err := p.RemoveServices(context.Background(), job, &[]string{"web"})
+	if !errors.Is(err, phase.ErrSuperseded) {
+		t.Fatalf("removing a newer generation's container: got %v, want ErrSuperseded", err)
+	}
+	if got, want := names(d.containers), []string{web + "-3"}; !slices.Equal(got, want) {
+		t.Errorf("containers left = %v, want %v", got, want)
+	}
+}
+
+func TestRemoveSwarmServicesMixedGenerations(t *testing.T) {
+	job := uuid.New()
+	web := DockerServiceName(job.String(), "web")
+	api := DockerServiceName(job.String(), "api")
+	d := &fakeDaemon{
+		services: map[string]map[string]string{
+			web:              {"deploy-commander.job": job.String()},
+			web + "-canary":  labeled(job, "web", 1),
+			web + "-sidecar": labeled(job, "web", 2),
+			api:              labeled(job, "api", 2),
+		},
+		containers: map[string]map[string]string{},
+	}
+
+	p := newFakePlatform(t, d, 2, true)
+	if err := p.RemoveServices(context.Background(), job, &[]string{"web"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(d.services), []string{api}; !slices.Equal(got, want) {
+		t.Errorf("swarm services left = %v, want %v", got, want)
+	}
+
+	d.services[web+"-3"] = labeled(job, "web", 3)
+	err := p.RemoveServices(context.Background(), job, &[]string{"web"})
+	if !errors.Is(err, phase.ErrSuperseded) {
+		t.Fatalf("removing a newer generation's swarm service: got %v, want ErrSuperseded", err)
+	}
+	if _, ok := d.services[web+"-3"]; !ok {
+		t.Error("swarm service of a newer generation was removed")
+	}
+}
@@ -4,14 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net/netip"
 	"os"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/containerd/errdefs"
 	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/device"
+	"github.com/ezenkico/deploy-commander/runner/services/logship"
+	"github.com/ezenkico/deploy-commander/runner/services/plan"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/progress"
+	"github.com/ezenkico/deploy-commander/runner/services/readiness"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/secrets"
+	"github.com/ezenkico/deploy-commander/runner/services/template"
 	"github.com/google/uuid"
 
 	"github.com/moby/moby/api/types/container"
@@ -20,6 +31,9 @@ import (
 	"github.com/moby/moby/client"
 )
 
+// VolumeSetup creates the declared volumes on every daemon with a service that
+// mounts them, or on the default daemon when none does, filling new ones from
+// their volume_sources.
 func (p *DockerPlatform) VolumeSetup(
 	ctx context.Context,
 	job uuid.UUID,
@@ -29,36 +43,140 @@ func (p *DockerPlatform) VolumeSetup(
 		return nil
 	}
 
+	hosts, err := p.volumeHosts(metadata.Services)
+	if err != nil {
+		return err
+	}
+
 	for _, volName := range *metadata.Volumes {
 		name := DockerVolumeName(job.String(), volName)
 
-		// If it already exists, treat as success.
-		_, err := p.client.VolumeInspect(ctx, name, client.VolumeInspectOptions{})
-		if err == nil {
+		on := hosts[volName]
+		if len(on) == 0 {
+			on = []string{defaultHost}
+		}
+		src, seeded := metadata.VolumeSources[volName]
+		for _, h := range on {
+			hp := p.on(h)
+			fresh := false
+			if seeded {
+				_, err := hp.client.VolumeInspect(ctx, name, client.VolumeInspectOptions{})
+				fresh = errdefs.IsNotFound(err)
+			}
+			err := hp.ensureVolume(ctx, name, map[string]string{
+				p.label("job"):    job.String(),
+				p.label("run"):    run.String(),
+				p.label("volume"): volName, // original logical name
+			})
+			if err != nil {
+				return err
+			}
+			// Only a volume this run created is filled; later runs keep its data.
+			if fresh {
+				sum, err := hp.seedVolume(ctx, job, name, src)
+				if err != nil {
+					return err
+				}
+				if err := p.recordVolumeChecksum(job, volName, sum); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// volumeHosts maps each named volume to the daemons of the services mounting it.
+func (p *DockerPlatform) volumeHosts(services map[string]models.MetadataService) (map[string][]string, error) {
+	out := map[string][]string{}
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		service := services[name]
+		if service.Volumes == nil {
 			continue
 		}
-		if !errdefs.IsNotFound(err) {
-			return fmt.Errorf("inspect volume %q: %w", name, err)
+		host, err := p.hostFor(name, &service)
+		if err != nil {
+			return nil, err
+		}
+		for _, vm := range *service.Volumes {
+			if vm.Name != nil && !slices.Contains(out[*vm.Name], host) {
+				out[*vm.Name] = append(out[*vm.Name], host)
+			}
 		}
+	}
+	return out, nil
+}
 
-		_, err = p.client.VolumeCreate(ctx, client.VolumeCreateOptions{
-			Name: name,
-			Labels: map[string]string{
-				"deploy-commander.job":    job.String(),
-				"deploy-commander.run":    run.String(),
-				"deploy-commander.volume": volName, // original logical name
-			},
-		})
+// ensureVolume creates the named volume with the given labels unless it already exists.
+func (p *DockerPlatform) ensureVolume(ctx context.Context, name string, labels map[string]string) error {
+	// If it already exists, treat as success.
+	_, err := p.client.VolumeInspect(ctx, name, client.VolumeInspectOptions{})
+	if err == nil {
+		return nil
+	}
+	if !errdefs.IsNotFound(err) {
+		return runerr.Wrap(ctx, "inspect volume", name, err)
+	}
+
+	_, err = p.client.VolumeCreate(ctx, client.VolumeCreateOptions{
+		Name:   name,
+		Labels: platforms.MergeLabels(labels, p.jobLabels),
+	})
+	if err != nil {
+		// If it was created concurrently, Docker will return a conflict; we can just continue.
+		// Rather than pattern match error strings, re-check inspect.
+		if _, ie := p.client.VolumeInspect(ctx, name, client.VolumeInspectOptions{}); ie == nil {
+			return nil
+		}
+		return runerr.Wrap(ctx, "create volume", name, err)
+	}
+
+	p.changed()
+	return nil
+}
+
+// ensureNetwork creates the named network with the given labels and, if not nil,
+// addressing unless it already exists. An existing network keeps its addressing.
+// Each network is only checked once per run.
+func (p *DockerPlatform) ensureNetwork(ctx context.Context, name string, labels map[string]string, ipam *network.IPAM) error {
+	key := networkKey{host: p.host, name: name}
+	if _, ok := p.createdNetworks[key]; ok {
+		return nil
+	}
+
+	opts := client.NetworkCreateOptions{
+		Labels: platforms.MergeLabels(labels, p.jobLabels),
+		IPAM:   ipam,
+	}
+	if ipam != nil && slices.ContainsFunc(ipam.Config, func(c network.IPAMConfig) bool { return c.Subnet.Addr().Is6() }) {
+		enable := true
+		opts.EnableIPv6 = &enable
+	}
+	if p.swarm {
+		// Overlay networks span the swarm; attachable so runner-step containers can join too.
+		opts.Driver = "overlay"
+		opts.Scope = "swarm"
+		opts.Attachable = true
+	}
+	if p.networkDriver != "" {
+		opts.Driver = p.networkDriver
+	}
+
+	_, err := p.client.NetworkInspect(ctx, name, client.NetworkInspectOptions{})
+	if err != nil {
+		_, err = p.client.NetworkCreate(ctx, name, opts)
 		if err != nil {
-			// If it was created concurrently, Docker will return a conflict; we can just continue.
-			// Rather than pattern match error strings, re-check inspect.
-			if _, ie := p.client.VolumeInspect(ctx, name, client.VolumeInspectOptions{}); ie == nil {
-				continue
+			// Race-safe: re-inspect
+			if _, ie := p.client.NetworkInspect(ctx, name, client.NetworkInspectOptions{}); ie != nil {
+				return runerr.Wrap(ctx, "create network", name, err)
 			}
-			return fmt.Errorf("create volume %q: %w", name, err)
+		} else {
+			p.changed()
 		}
 	}
 
+	p.createdNetworks[key] = struct{}{}
 	return nil
 }
 
@@ -66,59 +184,66 @@ func (p *DockerPlatform) SetupService(
 	ctx context.Context,
 	job uuid.UUID,
 	run uuid.UUID,
-	createdNetworks map[string]struct{},
 	serviceName string, // <-- pass the map key in (strongly recommended)
 	service *models.MetadataService,
-) (map[string]struct{}, error) {
+) error {
 
 	if service == nil {
-		return createdNetworks, nil
+		return nil
 	}
 
-	isRunner := IsRunnerRole(service)
+	// Hold the service back until the resources it connects to can take connections.
+	if service.ResourceReadyTimeout != nil && service.Connections != nil {
+		if err := readiness.Wait(ctx, p.comm, *service.Connections, time.Duration(*service.ResourceReadyTimeout)); err != nil {
+			return err
+		}
+	}
+
+	isRunner := platforms.IsRunnerRole(service)
+
+	// In swarm mode long-running services become swarm services; runner steps
+	// stay one-shot containers on the manager.
+	useSwarm := p.swarm && !isRunner
 
 	// 1) Create or verify networks exist or create or verify the job network exists (simple start)
 	networks := make(map[string]struct{})
+	groupOf := make(map[string]string) // network name -> group, for endpoints
 	if service.NetworkGroups != nil {
 		for _, group := range *service.NetworkGroups {
 			netName := DockerNetworkName(job.String(), group) // {job}-{group}
 
-			if _, ok := createdNetworks[netName]; !ok {
-				_, err := p.client.NetworkInspect(ctx, netName, client.NetworkInspectOptions{})
-				if err != nil {
-					_, err = p.client.NetworkCreate(ctx, netName, client.NetworkCreateOptions{
-						Labels: map[string]string{
-							"deploy-commander.job":  job.String(),
-							"deploy-commander.run":  run.String(),
-							"deploy-commander.net":  group, // logical group name
-							"deploy-commander.kind": "group",
-						},
-					})
-					if err != nil {
-						if _, ie := p.client.NetworkInspect(ctx, netName, client.NetworkInspectOptions{}); ie != nil {
-							return createdNetworks, fmt.Errorf("create network %q: %w", netName, err)
-						}
-					}
-				}
-				createdNetworks[netName] = struct{}{}
+			ipam, err := networkIPAM(p.networkSpecs[group])
+			if err != nil {
+				return runerr.Wrap(ctx, "parse network subnets", group, err)
+			}
+			err = p.ensureNetwork(ctx, netName, map[string]string{
+				p.label("job"):  job.String(),
+				p.label("run"):  run.String(),
+				p.label("net"):  group, // logical group name
+				p.label("kind"): "group",
+			}, ipam)
+			if err != nil {
+				return err
 			}
 
 			networks[netName] = struct{}{}
+			groupOf[netName] = group
 		}
 	}
+	var acl []models.ConnectionACL
 	if service.Connections != nil {
 		for _, conn := range *service.Connections {
-			data := GetPlatformData(conn)
+			data := platforms.GetPlatformData(conn)
 			if data == nil {
 				continue
 			}
 
 			var pc models.DockerPlatformConnection
 			if err := json.Unmarshal(*data, &pc); err != nil {
-				return createdNetworks, fmt.Errorf("invalid platform connection data: %w", err)
+				return runerr.Wrap(ctx, "parse platform connection", "", err)
 			}
 			if pc.Network == "" {
-				return createdNetworks, fmt.Errorf("platform connection network is required")
+				return runerr.Errorf(ctx, "parse platform connection", "", "network is required")
 			}
 
 			// IMPORTANT: connection networks are created by other jobs.
@@ -127,10 +252,11 @@ func (p *DockerPlatform) SetupService(
 
 			// Verify network exists. If it doesn't, that's a metadata/config error.
 			if _, err := p.client.NetworkInspect(ctx, netName, client.NetworkInspectOptions{}); err != nil {
-				return createdNetworks, fmt.Errorf("platform connection network %q not found: %w", netName, err)
+				return runerr.Wrap(ctx, "find platform connection network", netName, err)
 			}
 
 			networks[netName] = struct{}{}
+			acl = append(acl, models.ConnectionACL{Network: netName, Ports: pc.Ports})
 		}
 	}
 	resources := []models.CreateResource{}
@@ -149,34 +275,25 @@ func (p *DockerPlatform) SetupService(
 			}
 			netName := DockerNetworkResourceName(job.String(), spec.Name)
 
-			// Check if the network exists. If not, create it (race-safe).
-			if _, ok := createdNetworks[netName]; !ok {
-				_, err := p.client.NetworkInspect(ctx, netName, client.NetworkInspectOptions{})
-				if err != nil {
-					_, err = p.client.NetworkCreate(ctx, netName, client.NetworkCreateOptions{
-						Labels: map[string]string{
-							"deploy-commander.job":  job.String(),
-							"deploy-commander.run":  run.String(),
-							"deploy-commander.net":  spec.Name, // resource name (useful for debugging)
-							"deploy-commander.kind": "resource",
-						},
-					})
-					if err != nil {
-						// Race-safe: re-inspect
-						if _, ie := p.client.NetworkInspect(ctx, netName, client.NetworkInspectOptions{}); ie != nil {
-							return createdNetworks, fmt.Errorf("create resource network %q: %w", netName, err)
-						}
-					}
-				}
-				createdNetworks[netName] = struct{}{}
+			netLabels := map[string]string{
+				p.label("job"):  job.String(),
+				p.label("run"):  run.String(),
+				p.label("net"):  spec.Name, // resource name (useful for debugging)
+				p.label("kind"): "resource",
+			}
+			if len(spec.Ports) > 0 {
+				netLabels[p.label("ports")] = joinPorts(spec.Ports)
+			}
+			if err := p.ensureNetwork(ctx, netName, netLabels, nil); err != nil {
+				return err
 			}
 
-			// Build the platform connection payload for this resource (Network-only).
-			pc := models.DockerPlatformConnection{Network: netName}
+			// Build the platform connection payload for this resource.
+			pc := models.DockerPlatformConnection{Network: netName, Ports: spec.Ports}
 
 			b, err := json.Marshal(pc)
 			if err != nil {
-				return createdNetworks, fmt.Errorf("marshal platform connection for resource %q: %w", spec.Name, err)
+				return runerr.Wrap(ctx, "marshal platform connection for resource", spec.Name, err)
 			}
 
 			rm := json.RawMessage(b) // convert []byte -> json.RawMessage
@@ -198,24 +315,12 @@ func (p *DockerPlatform) SetupService(
 	}
 	if len(networks) < 1 {
 		jobNet := job.String()
-		if _, ok := createdNetworks[jobNet]; !ok {
-			// Create network if needed
-			_, err := p.client.NetworkInspect(ctx, jobNet, client.NetworkInspectOptions{})
-			if err != nil {
-				_, err = p.client.NetworkCreate(ctx, jobNet, client.NetworkCreateOptions{
-					Labels: map[string]string{
-						"deploy-commander.job": job.String(),
-						"deploy-commander.run": run.String(),
-					},
-				})
-				if err != nil {
-					// Race-safe: re-inspect
-					if _, ie := p.client.NetworkInspect(ctx, jobNet, client.NetworkInspectOptions{}); ie != nil {
-						return createdNetworks, fmt.Errorf("create network %q: %w", jobNet, err)
-					}
-				}
-			}
-			createdNetworks[jobNet] = struct{}{}
+		err := p.ensureNetwork(ctx, jobNet, map[string]string{
+			p.label("job"): job.String(),
+			p.label("run"): run.String(),
+		}, nil)
+		if err != nil {
+			return err
 		}
 		networks[jobNet] = struct{}{}
 	}
@@ -223,20 +328,84 @@ func (p *DockerPlatform) SetupService(
 	// 2) Container name (job-scoped)
 	containerName := DockerServiceName(job.String(), serviceName)
 
-	// 3) Env
+	// 3) Env (with ${JOB}, ${RUN}, ${services...}, ${steps...} and secret://
+	// references resolved)
 	env := []string{}
 	if service.Environment != nil {
+		lookup := template.Chain(template.Vars(job, run), p.templateLookup())
 		for k, v := range service.Environment {
-			env = append(env, fmt.Sprintf("%s=%s", k, v))
+			resolved, err := template.Interpolate(v, lookup)
+			if err != nil {
+				return runerr.Wrap(ctx, "resolve env", k, err)
+			}
+			if resolved, err = secrets.Resolve(ctx, resolved); err != nil {
+				return runerr.Wrap(ctx, "resolve secret", k, err)
+			}
+			env = append(env, fmt.Sprintf("%s=%s", k, resolved))
+		}
+	}
+	secretEnv, err := platforms.SecretEnv(ctx, p.comm, job, service)
+	if err != nil {
+		return err
+	}
+	env = append(env, secretEnv...)
+	if isRunner {
+		env = append(env, "DC_OUTPUTS="+platforms.StepOutputsPath(run, serviceName))
+	}
+	var sshFiles []platforms.SSHFile
+	if isRunner && service.SSH != nil {
+		var err error
+		if sshFiles, err = platforms.SSHFiles(ctx, service.SSH); err != nil {
+			return err
+		}
+		env = append(env, platforms.SSHEnv())
+	}
+
+	files, err := platforms.Files(ctx, serviceName, service)
+	if err != nil {
+		return err
+	}
+	imagePlatform, err := platforms.ImagePlatform(service)
+	if err != nil {
+		return runerr.Wrap(ctx, "parse platform", serviceName, err)
+	}
+
+	if isRunner {
+		if err := p.verifyVolumes(ctx, job, service); err != nil {
+			return err
 		}
 	}
 
 	// 4) Volume mounts (named volumes only; no host paths)
 	mounts := []mount.Mount{}
+	if isRunner {
+		// Runner steps always see the runner volume at a well-known path (used for outputs).
+		runnerVolume := DockerRunnerVolumeName(job.String())
+		err := p.ensureVolume(ctx, runnerVolume, map[string]string{
+			p.label("job"):  job.String(),
+			p.label("run"):  run.String(),
+			p.label("kind"): "runner",
+		})
+		if err != nil {
+			return err
+		}
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: runnerVolume,
+			Target: platforms.RunnerVolumeMountPath,
+		})
+	}
+	if isRunner {
+		caches, err := p.cacheMounts(ctx, job, service)
+		if err != nil {
+			return err
+		}
+		mounts = append(mounts, caches...)
+	}
 	if service.Volumes != nil {
 		for _, vm := range *service.Volumes {
 			if strings.TrimSpace(vm.MountPath) == "" {
-				return createdNetworks, fmt.Errorf("service %q volume mount_path is empty", serviceName)
+				return runerr.Errorf(ctx, "mount volume", "", "mount_path is empty")
 			}
 			target := vm.MountPath
 
@@ -288,7 +457,7 @@ func (p *DockerPlatform) SetupService(
 
 					addr, err := netip.ParseAddr(hostIP)
 					if err != nil {
-						return createdNetworks, fmt.Errorf("service %q has invalid host_ip %q: %w", serviceName, hostIP, err)
+						return runerr.Wrap(ctx, "parse host_ip", hostIP, err)
 					}
 
 					portMap[port] = append(portMap[port], network.PortBinding{
@@ -300,12 +469,23 @@ func (p *DockerPlatform) SetupService(
 		}
 	}
 
-	// 6) Remove container if it exists
+	// 6) Hand the existing container, if any, to the service's strategy
+	strategy, err := p.strategyFor(ctx, service, isRunner || useSwarm)
+	if err != nil {
+		return err
+	}
+	replacement := &Replacement{Job: job, Run: run, Name: containerName, Service: service}
 	inspect, err := p.client.ContainerInspect(ctx, containerName, client.ContainerInspectOptions{})
 	if err == nil {
+		if inspect.Container.Config != nil {
+			if err := p.fence(ctx, containerName, inspect.Container.Config.Labels); err != nil {
+				return err
+			}
+		}
+
 		// Extract prior resources (if labeled) so update/recreate doesn't lose them.
 		if inspect.Container.Config != nil && inspect.Container.Config.Labels != nil {
-			if v, ok := inspect.Container.Config.Labels["deploy-commander.resources"]; ok && v != "" {
+			if v, ok := inspect.Container.Config.Labels[p.label("resources")]; ok && v != "" {
 				var names []string
 				if je := json.Unmarshal([]byte(v), &names); je == nil {
 					for _, n := range names {
@@ -313,28 +493,40 @@ func (p *DockerPlatform) SetupService(
 							resourceNames[n] = struct{}{}
 						}
 					}
+				} else {
+					p.warn("container %q has a malformed %s label: %v", containerName, p.label("resources"), je)
 				}
-				// If JSON is malformed, ignore silently (or log if you have logger available).
 			}
 		}
 
-		// Stop (best-effort) then remove
-		_, _ = p.client.ContainerStop(ctx, containerName, client.ContainerStopOptions{})
-		_, err := p.client.ContainerRemove(ctx, containerName, client.ContainerRemoveOptions{
-			Force:         true,
-			RemoveVolumes: false,
-		})
-		if err != nil {
-			return createdNetworks, fmt.Errorf("remove existing container %q: %w", containerName, err)
+		replacement.Existing = true
+		replacement.Running = inspect.Container.State != nil && inspect.Container.State.Running
+	}
+	createName, err := strategy.Prepare(ctx, p, replacement)
+	if err != nil {
+		return err
+	}
+
+	// Swarm services keep their resources label on the service, not on a container.
+	if useSwarm {
+		if err := p.priorSwarmResources(ctx, containerName, resourceNames); err != nil {
+			return err
 		}
 	}
 
 	// 7) Labels
+	specHash, err := platforms.ServiceSpecHash(service)
+	if err != nil {
+		return err
+	}
+
 	labels := map[string]string{
-		"deploy-commander.job":     job.String(),
-		"deploy-commander.run":     run.String(),
-		"deploy-commander.service": serviceName,
+		p.label("job"):       job.String(),
+		p.label("run"):       run.String(),
+		p.label("service"):   serviceName,
+		p.label("spec-hash"): specHash, // last-applied spec, compared on update
 	}
+	p.generationLabels(labels)
 
 	namesLength := len(resourceNames)
 
@@ -346,10 +538,56 @@ func (p *DockerPlatform) SetupService(
 
 		b, err := json.Marshal(names)
 		if err != nil {
-			return nil, fmt.Errorf("marshal resource names label: %w", err)
+			return runerr.Wrap(ctx, "marshal resource names label", containerName, err)
+		}
+
+		labels[p.label("resources")] = string(b)
+	}
+	if len(acl) > 0 {
+		b, err := json.Marshal(acl)
+		if err != nil {
+			return runerr.Wrap(ctx, "marshal acl label", containerName, err)
+		}
+		labels[p.label("acl")] = string(b)
+	}
+	if len(files) > 0 && !useSwarm {
+		// So `runner heal` can carry them over to a new container
+		paths := make([]string, 0, len(files))
+		for _, f := range files {
+			paths = append(paths, f.Path)
+		}
+		b, err := json.Marshal(paths)
+		if err != nil {
+			return runerr.Wrap(ctx, "marshal files label", containerName, err)
 		}
+		labels[p.label("files")] = string(b)
+	}
+	var pins []string
+	if len(service.PinHosts) > 0 && !useSwarm {
+		pins, err = p.pinnedHosts(ctx, job, service, func(n string) bool {
+			_, ok := networks[n]
+			return ok
+		})
+		if err != nil {
+			return err
+		}
+		labels[p.label("pinned-hosts")] = strings.Join(pins, ",")
+	}
+	labels = platforms.MergeLabels(labels, p.jobLabels, service.Labels)
 
-		labels["deploy-commander.resources"] = string(b)
+	if useSwarm {
+		configs, err := p.swarmConfigs(ctx, job, run, files)
+		if err != nil {
+			return err
+		}
+		if err := p.applySwarmService(ctx, containerName, service, env, mounts, configs, networks, labels); err != nil {
+			return err
+		}
+		if err := platforms.RegisterResources(ctx, p.comm, resources, p.changed); err != nil {
+			p.withdraw(ctx, containerName, true)
+			return err
+		}
+		return nil
 	}
 
 	// 8) Container configs
@@ -359,13 +597,108 @@ func (p *DockerPlatform) SetupService(
 		Labels:       labels,
 		ExposedPorts: exposed,
 	}
+	if service.Entrypoint != nil {
+		cCfg.Entrypoint = *service.Entrypoint
+	}
+	if service.Command != nil {
+		cCfg.Cmd = *service.Command
+	}
+	if service.User != nil {
+		cCfg.User = *service.User
+	}
+	if service.WorkingDir != nil {
+		cCfg.WorkingDir = *service.WorkingDir
+	}
+	if service.Hostname != nil {
+		cCfg.Hostname = *service.Hostname
+	}
+	if service.Domainname != nil {
+		cCfg.Domainname = *service.Domainname
+	}
+	cCfg.Healthcheck = healthConfig(service.Healthcheck)
+	if service.StopSignal != nil {
+		cCfg.StopSignal = *service.StopSignal
+	}
+	if service.StopGracePeriod != nil {
+		cCfg.StopTimeout = stopTimeout(*service.StopGracePeriod)
+	}
 
+	restart, err := restartPolicy(service, p.restartPolicy)
+	if err != nil {
+		return runerr.Wrap(ctx, "parse restart", serviceName, err)
+	}
 	hCfg := &container.HostConfig{
-		Mounts:       mounts,
-		PortBindings: portMap,
-		RestartPolicy: container.RestartPolicy{
-			Name: container.RestartPolicyAlways,
-		},
+		Mounts:        mounts,
+		PortBindings:  portMap,
+		RestartPolicy: restart,
+	}
+	hCfg.CgroupParent = p.cgroupParent
+	if mem := service.MemoryLimit(); mem != nil {
+		hCfg.Memory = int64(*mem)
+	}
+	if r := service.Limits; r != nil {
+		if r.Cpus != nil {
+			hCfg.NanoCPUs = nanoCPUs(*r.Cpus)
+		}
+		if r.MemoryReservation != nil {
+			hCfg.MemoryReservation = int64(*r.MemoryReservation)
+		}
+		hCfg.PidsLimit = r.PidsLimit
+	}
+	if service.MemorySwap != nil {
+		hCfg.MemorySwap = int64(*service.MemorySwap)
+	}
+	hCfg.MemorySwappiness = service.MemorySwappiness
+	hCfg.OomKillDisable = service.OomKillDisable
+	if service.OomScoreAdj != nil {
+		hCfg.OomScoreAdj = *service.OomScoreAdj
+	}
+	if service.CpusetCpus != nil {
+		hCfg.CpusetCpus = *service.CpusetCpus
+	}
+	if service.CpusetMems != nil {
+		hCfg.CpusetMems = *service.CpusetMems
+	}
+	if service.ShmSize != nil {
+		hCfg.ShmSize = int64(*service.ShmSize)
+	}
+	if service.Privileged != nil {
+		hCfg.Privileged = *service.Privileged
+	}
+	hCfg.Init = service.Init
+	hCfg.CapAdd = service.CapAdd
+	hCfg.CapDrop = service.CapDrop
+	hCfg.GroupAdd = service.GroupAdd
+	if hCfg.SecurityOpt, err = securityOpts(service.SecurityOpt); err != nil {
+		return runerr.Wrap(ctx, "parse security_opt", containerName, err)
+	}
+	if service.Runtime != nil && *service.Runtime != "default" {
+		hCfg.Runtime = *service.Runtime
+	}
+	devices, err := device.ParseAll(service.Devices)
+	if err != nil {
+		return runerr.Wrap(ctx, "parse devices", containerName, err)
+	}
+	for _, d := range devices {
+		hCfg.Devices = append(hCfg.Devices, container.DeviceMapping{PathOnHost: d.Host, PathInContainer: d.Container, CgroupPermissions: d.Permissions})
+	}
+	for _, d := range service.DeviceRequests {
+		hCfg.DeviceRequests = append(hCfg.DeviceRequests, deviceRequest(d))
+	}
+	if hCfg.DNS, err = dnsServers(service.DNS); err != nil {
+		return runerr.Wrap(ctx, "parse dns", containerName, err)
+	}
+	hCfg.ExtraHosts = pins
+	hCfg.DNSSearch = service.DNSSearch
+	hCfg.DNSOptions = service.DNSOptions
+	if service.Ipc != nil {
+		hCfg.IpcMode = container.IpcMode(namespaceMode(job.String(), *service.Ipc))
+	}
+	if service.Pid != nil {
+		hCfg.PidMode = container.PidMode(namespaceMode(job.String(), *service.Pid))
+	}
+	if service.UsernsMode != nil {
+		hCfg.UsernsMode = container.UsernsMode(*service.UsernsMode)
 	}
 
 	if isRunner {
@@ -374,12 +707,27 @@ func (p *DockerPlatform) SetupService(
 		}
 	}
 
+	primary := ""
+	if service.PrimaryNetwork != nil {
+		primary = DockerNetworkName(job.String(), *service.PrimaryNetwork)
+	}
 	endpointConfigs := make(map[string]*network.EndpointSettings)
 	for net := range networks {
 		es := &network.EndpointSettings{}
 		if service.Aliases != nil && len(*service.Aliases) > 0 {
 			es.Aliases = *service.Aliases
 		}
+		if ep, ok := service.Endpoints[groupOf[net]]; ok {
+			cfg, err := endpointIPAM(ep)
+			if err != nil {
+				return runerr.Wrap(ctx, "parse endpoint addresses", groupOf[net], err)
+			}
+			es.IPAMConfig = cfg
+		}
+		if net == primary {
+			// The endpoint with the highest priority provides the default gateway.
+			es.GwPriority = 1
+		}
 		endpointConfigs[net] = es
 	}
 
@@ -391,28 +739,63 @@ func (p *DockerPlatform) SetupService(
 
 	// 9) Create container
 
+	// Creating a container does not pull its image.
+	if err := p.ensureImage(ctx, service.Image, imagePlatform, service.ImagePullPolicy()); err != nil {
+		return err
+	}
+
 	// Now create a fresh container
 	created, err := p.client.ContainerCreate(ctx, client.ContainerCreateOptions{
 		Config:           cCfg,
 		HostConfig:       hCfg,
 		NetworkingConfig: nCfg,
-		Name:             containerName,
+		Platform:         imagePlatform,
+		Name:             createName,
 		Image:            service.Image,
 	})
 	if err != nil {
 		// Race-safe: if something else created it, inspect and proceed
-		inspected, ie := p.client.ContainerInspect(ctx, containerName, client.ContainerInspectOptions{})
+		inspected, ie := p.client.ContainerInspect(ctx, createName, client.ContainerInspectOptions{})
 		if ie != nil {
-			return createdNetworks, fmt.Errorf("create container %q: %w", containerName, err)
+			return runerr.Wrap(ctx, "create container", containerName, err)
 		}
 		containerID = inspected.Container.ID
 	} else {
 		containerID = created.ID
+		p.changed()
 	}
 
-	// Start the container
-	if _, err := p.client.ContainerStart(ctx, containerID, client.ContainerStartOptions{}); err != nil {
-		return createdNetworks, fmt.Errorf("start container %q: %w", containerName, err)
+	// Start the container; the strategy retires the old one once it is up
+	err = func() error {
+		if len(sshFiles) > 0 {
+			if err := p.copySSHFiles(ctx, containerID, containerName, sshFiles); err != nil {
+				return err
+			}
+		}
+		if len(files) > 0 {
+			if err := p.copyFiles(ctx, containerID, containerName, files); err != nil {
+				return err
+			}
+		}
+
+		if cp := replacement.checkpoint; cp != nil {
+			if err := p.startRestored(ctx, containerID, containerName, cp); err != nil {
+				return err
+			}
+		} else if _, err := p.client.ContainerStart(ctx, containerID, client.ContainerStartOptions{}); err != nil {
+			return runerr.Wrap(ctx, "start container", containerName, err)
+		}
+
+		// Dependents start once it is healthy, not just running
+		if !isRunner && cCfg.Healthcheck != nil && cCfg.Healthcheck.Test[0] != "NONE" {
+			if err := p.waitHealthy(ctx, containerID, containerName); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err := strategy.Finish(ctx, p, replacement, containerID, err); err != nil {
+		return err
 	}
 
 	// 10) If runner
@@ -426,13 +809,17 @@ func (p *DockerPlatform) SetupService(
 			Since:      "0",
 		})
 		if err != nil {
-			return createdNetworks, fmt.Errorf("logs container %q: %w", containerName, err)
+			return runerr.Wrap(ctx, "logs container", containerName, err)
 		}
 		defer rc.Close()
 
+		ship := logship.New(ctx, p.comm, run, serviceName, service.LogLimit)
+		defer p.closeLogs(ship, serviceName)
+		stdout, stderr := ship.Tee(os.Stdout, os.Stderr)
+
 		logDone := make(chan error, 1)
 		go func() {
-			logDone <- DemuxDockerLogs(os.Stdout, os.Stderr, rc)
+			logDone <- DemuxDockerLogs(stdout, stderr, rc)
 		}()
 
 		// Wait for completion
@@ -442,7 +829,7 @@ func (p *DockerPlatform) SetupService(
 		select {
 		case err := <-waitBodyC.Error:
 			if err != nil {
-				return createdNetworks, fmt.Errorf("wait container %q: %w", containerName, err)
+				return runerr.Wrap(ctx, "wait container", containerName, err)
 			}
 		case res := <-waitBodyC.Result:
 			statusCode = res.StatusCode
@@ -452,7 +839,16 @@ func (p *DockerPlatform) SetupService(
 		if err := <-logDone; err != nil {
 			// If the container exited, sometimes the log stream ends with EOF — that's fine.
 			// io.Copy returns nil on clean EOF; anything else is worth surfacing.
-			return createdNetworks, fmt.Errorf("stream logs for %q: %w", containerName, err)
+			return runerr.Wrap(ctx, "stream logs for", containerName, err)
+		}
+
+		// Collect outputs before the container goes away
+		if statusCode == 0 {
+			outputs, err := p.readStepOutputs(ctx, containerID, run, serviceName)
+			if err != nil {
+				return err
+			}
+			p.steps.SetOutputs(serviceName, outputs)
 		}
 
 		// Remove container after completion
@@ -460,33 +856,48 @@ func (p *DockerPlatform) SetupService(
 			Force:         true,
 			RemoveVolumes: false,
 		}); err != nil {
-			return createdNetworks, fmt.Errorf("remove container %q: %w", containerName, err)
+			return runerr.Wrap(ctx, "remove container", containerName, err)
 		}
 
 		// If it failed, surface that as an error after logs are printed
 		if statusCode != 0 {
-			return createdNetworks, fmt.Errorf("runner container %q exited with status %d", containerName, statusCode)
+			return runerr.Errorf(ctx, "run step", containerName, "exited with status %d", statusCode)
 		}
 
 	}
 
 	// 11) Setup the resources
-	if p.comm != nil {
-		for _, resource := range resources {
-			_, err := p.comm.CreateResource(ctx, resource)
-			if err != nil {
-				return createdNetworks, fmt.Errorf("Failed to send resource %s", resource.Name)
-			}
+	if err := platforms.RegisterResources(ctx, p.comm, resources, p.changed); err != nil {
+		if !isRunner {
+			p.withdraw(ctx, containerName, false)
 		}
+		return err
 	}
+	return nil
+}
 
-	return createdNetworks, nil
+// withdraw removes a service the run started once the agent refused its
+// resources, so nothing is left running that the agent does not know about.
+func (p *DockerPlatform) withdraw(ctx context.Context, name string, swarmService bool) {
+	// The run context may be what failed the registration.
+	rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+	var err error
+	if swarmService {
+		_, err = p.client.ServiceRemove(rctx, name, client.ServiceRemoveOptions{})
+	} else {
+		_, err = p.client.ContainerRemove(rctx, name, client.ContainerRemoveOptions{Force: true})
+	}
+	if err != nil && !errdefs.IsNotFound(err) {
+		p.warn("remove %q after its resources failed to register: %v", name, err)
+	}
 }
 
 func (p *DockerPlatform) ServiceSetup(ctx context.Context,
 	job uuid.UUID,
 	run uuid.UUID,
-	metadata *models.Metadata) error {
+	metadata *models.Metadata,
+	needsSetup platforms.ServiceFilter) error {
 
 	services := metadata.Services
 
@@ -494,110 +905,111 @@ func (p *DockerPlatform) ServiceSetup(ctx context.Context,
 		return nil
 	}
 
-	ranServices := []string{}
-	createdNetworks := make(map[string]struct{})
-	var err error = nil
+	// Launch in the same order the run plan records.
+	order, err := plan.ServiceOrder(services)
+	if err != nil {
+		return err
+	}
 
-	for len(services) > 0 {
-		notRun := make(map[string]models.MetadataService)
+	p.createdNetworks = make(map[networkKey]struct{})
 
-		for name, service := range services {
-			if service.DependsOn != nil {
-				cantRun := false
-				for _, dependency := range *service.DependsOn {
-					if !slices.Contains(ranServices, dependency) {
-						cantRun = true
-						break
-					}
-				}
-				if cantRun {
-					notRun[name] = service
-					continue
-				}
-			}
-
-			createdNetworks, err = p.SetupService(ctx, job, run, createdNetworks, name, &service)
-			if err != nil {
-				return err
-			}
-			ranServices = append(ranServices, name)
+	// Addresses follow from the metadata, so environment values can refer to
+	// services set up later in the run.
+	for name, service := range services {
+		if !platforms.IsRunnerRole(&service) {
+			p.facts.Set(name, "address", ServiceAddress(job, name, &service))
 		}
-		services = notRun
 	}
 
-	return nil
-}
+	defer p.reportServiceTimings()
 
-func (p *DockerPlatform) SetupConnections(ctx context.Context, connectionPlan *models.ConnectionPlan) error {
-	if connectionPlan == nil {
-		return nil
-	}
-	comm := p.comm
-	if comm == nil {
-		return nil
-	}
+	failed := map[string]bool{} // left out under on_failure: continue
+	rep := progress.From(ctx)
+	for _, name := range order {
+		service := services[name]
 
-	// Helper: resolve ResourceRef -> resource UUID
-	resolveResourceID := func(ref models.ResourceRef) (uuid.UUID, error) {
-		if ref.ID != nil {
-			return *ref.ID, nil
-		}
-		// At the runner layer, we currently have no lookup mechanism for (Service, Name) -> UUID.
-		// If you later add one (e.g. comm.ResolveResource(service,name)), plug it in here.
-		if ref.Service != nil || ref.Name != nil {
-			return uuid.Nil, fmt.Errorf("cannot resolve resource by service/name in runner; ResourceRef.id is required (service=%v name=%v)", ref.Service, ref.Name)
+		// Stop launching new services once the run is cancelled.
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
 		}
-		return uuid.Nil, fmt.Errorf("resource ref is empty; ResourceRef.id is required")
-	}
 
-	// 1) Post new connections
-	if connectionPlan.Create != nil {
-		for _, spec := range *connectionPlan.Create {
-			resourceID, err := resolveResourceID(spec.Resource)
-			if err != nil {
-				return fmt.Errorf("create connection: %w", err)
-			}
+		hp, err := p.forService(name, &service)
+		if err != nil {
+			return err
+		}
 
-			_, err = comm.CreateConnection(ctx, models.CreateConnectionRequest{
-				Resource: resourceID,
-				Job:      spec.Job,
-				Metadata: spec.Metadata,
-			})
+		if needsSetup != nil {
+			needed, err := needsSetup(name, &service)
 			if err != nil {
-				return fmt.Errorf("create connection (resource=%s job=%s): %w", resourceID, spec.Job, err)
+				return err
 			}
-		}
-	}
-
-	// 2) Remove connections
-	if connectionPlan.Remove != nil {
-		for _, spec := range *connectionPlan.Remove {
-			// With the current comm API, DeleteConnection needs BOTH the resource UUID and the connection UUID.
-			// So we only support remove when spec includes BOTH:
-			// - spec.ID (connection id)
-			// - spec.Resource (to resolve resource id)
-			if spec.ID != nil {
-				if spec.Resource == nil {
-					return fmt.Errorf("remove connection %s: resource ref is required (DeleteConnection needs resourceID + connectionID)", spec.ID.String())
-				}
-				resourceID, err := resolveResourceID(*spec.Resource)
-				if err != nil {
-					return fmt.Errorf("remove connection %s: %w", spec.ID.String(), err)
-				}
-
-				if err := comm.DeleteConnection(ctx, resourceID, *spec.ID); err != nil {
-					return fmt.Errorf("delete connection (resource=%s id=%s): %w", resourceID, spec.ID.String(), err)
+			if !needed {
+				if err := hp.recordFacts(runerr.WithService(ctx, name), job, name, &service); err != nil {
+					return err
 				}
+				rep.ServiceSkipped(name)
 				continue
 			}
+		}
+		if dep := platforms.Blocker(&service, failed); dep != "" {
+			p.warn("service %q was not deployed: it depends on %q, which failed", name, dep)
+			failed[name] = true
+			rep.ServiceSkipped(name)
+			continue
+		}
 
-			// Resource-only removal ("remove all connections for resource") is not possible with the current comm API
-			// because we have no "list connections for resource" endpoint here.
-			if spec.Resource != nil {
-				return fmt.Errorf("remove connections for resource: unsupported with current API (need list-connections or delete-by-resource endpoint)")
+		started := time.Now()
+		rep.ServiceStarted(name)
+		sctx, cancel := platforms.WithProgressDeadline(runerr.WithService(ctx, name), &service)
+		err = hp.SetupService(sctx, job, run, name, &service)
+		if err != nil && platforms.IsStalled(ctx, sctx) {
+			err = platforms.StallError(runerr.WithService(ctx, name), name, &service, hp.stallDetail(ctx, job, name, &service))
+		}
+		cancel()
+		rep.ServiceFinished(name, time.Since(started), err)
+		if err != nil {
+			if err := platforms.FailService(name, &service, err, p.warn); err != nil {
+				return err
+			}
+			if service.FailurePolicy() == models.FailurePolicyContinue {
+				failed[name] = true
+			}
+			continue
+		}
+		platforms.RecordServiceTiming(p.result, p.warn, name, &service, time.Since(started))
+		if err := hp.recordFacts(runerr.WithService(ctx, name), job, name, &service); err != nil {
+			return err
+		}
+		if platforms.IsRunnerRole(&service) {
+			if err := p.steps.Record(job, run, name, &service); err != nil {
+				return err
 			}
 		}
 	}
 
 	return nil
 }
+
+// SetupConnections applies the metadata's connection plan, filling in
+// ${services...} and ${steps...} references in connection metadata first.
+func (p *DockerPlatform) SetupConnections(ctx context.Context, job uuid.UUID, metadata *models.Metadata) error {
+	if p.comm == nil {
+		return nil
+	}
+	connectionPlan, err := template.ExpandConnectionPlan(metadata.Connections, p.templateLookup())
+	if err != nil {
+		return runerr.Wrap(ctx, "expand connection metadata", job.String(), err)
+	}
+	changes, err := p.comm.ApplyConnectionPlan(ctx, connectionPlan)
+	if changes > 0 {
+		p.changed()
+	}
+	return err
+}
+
+// closeLogs finishes forwarding a step's logs and warns if the rate limit dropped any.
+func (p *DockerPlatform) closeLogs(ship *logship.Shipper, serviceName string) {
+	if n := ship.Close(); n > 0 {
+		p.warn("service %q: %d log line(s) over the log limit were not forwarded to the agent", serviceName, n)
+	}
+}
@@ -0,0 +1,215 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/mount"
+	"github.com/moby/moby/client"
+)
+
+// Where the volume is mounted in the snapshot helper container. Archives hold the
+// directory itself, so copying one back to / lands it on the mount again.
+const snapshotMountPath = "/snapshot"
+
+// ImageDigests inspects each service's container and returns the repo digest of
+// the image it runs, preferring the repository the service names.
+func (p *DockerPlatform) ImageDigests(ctx context.Context, job uuid.UUID, metadata *models.Metadata) (map[string]string, error) {
+	if p.swarm {
+		return nil, fmt.Errorf("snapshot is not supported on swarm")
+	}
+	out := map[string]string{}
+	for _, name := range slices.Sorted(maps.Keys(metadata.Services)) {
+		service := metadata.Services[name]
+		sctx := runerr.WithService(ctx, name)
+		hp, err := p.forService(name, &service)
+		if err != nil {
+			return nil, err
+		}
+
+		containerName := DockerServiceName(job.String(), name)
+		inspect, err := hp.client.ContainerInspect(sctx, containerName, client.ContainerInspectOptions{})
+		if errdefs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, runerr.Wrap(sctx, "inspect container", containerName, err)
+		}
+		img, err := hp.client.ImageInspect(sctx, inspect.Container.Image)
+		if err != nil {
+			return nil, runerr.Wrap(sctx, "inspect image", inspect.Container.Image, err)
+		}
+		if ref := repoDigest(service.Image, img.RepoDigests); ref != "" {
+			out[name] = ref
+		}
+	}
+	return out, nil
+}
+
+// repoDigest picks the digest of image's repository, or the first one. Images
+// that were built locally and never pushed have none.
+func repoDigest(image string, digests []string) string {
+	repo, _, _ := strings.Cut(image, "@")
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	for _, d := range digests {
+		if r, _, _ := strings.Cut(d, "@"); r == repo || strings.TrimPrefix(r, "docker.io/library/") == repo {
+			return d
+		}
+	}
+	if len(digests) > 0 {
+		return digests[0]
+	}
+	return ""
+}
+
+// ExportVolume copies the volume's contents into a tar archive.
+func (p *DockerPlatform) ExportVolume(ctx context.Context, job uuid.UUID, metadata *models.Metadata, volume, archive string) error {
+	hp, image, err := p.volumeHelper(metadata, volume)
+	if err != nil {
+		return err
+	}
+	name := DockerVolumeName(job.String(), volume)
+
+	id, err := hp.createVolumeHelper(ctx, job, image, name)
+	if err != nil {
+		return err
+	}
+	defer hp.client.ContainerRemove(context.WithoutCancel(ctx), id, client.ContainerRemoveOptions{Force: true})
+
+	res, err := hp.client.CopyFromContainer(ctx, id, client.CopyFromContainerOptions{SourcePath: snapshotMountPath})
+	if err != nil {
+		return runerr.Wrap(ctx, "export volume", name, err)
+	}
+	defer res.Content.Close()
+
+	f, err := os.Create(archive)
+	if err != nil {
+		return runerr.Wrap(ctx, "export volume", name, err)
+	}
+	if _, err := io.Copy(f, res.Content); err != nil {
+		f.Close()
+		return runerr.Wrap(ctx, "export volume", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return runerr.Wrap(ctx, "export volume", name, err)
+	}
+	return nil
+}
+
+// ImportVolume creates the volume on every daemon that mounts it and unpacks the
+// archive into it.
+func (p *DockerPlatform) ImportVolume(ctx context.Context, job, run uuid.UUID, metadata *models.Metadata, volume, archive string) error {
+	if p.swarm {
+		return fmt.Errorf("clone is not supported on swarm")
+	}
+	_, image, err := p.volumeHelper(metadata, volume)
+	if err != nil {
+		return err
+	}
+	hosts, err := p.volumeHosts(metadata.Services)
+	if err != nil {
+		return err
+	}
+	name := DockerVolumeName(job.String(), volume)
+
+	for _, h := range hosts[volume] {
+		hp := p.on(h)
+		err := hp.ensureVolume(ctx, name, map[string]string{
+			p.label("job"):    job.String(),
+			p.label("run"):    run.String(),
+			p.label("volume"): volume,
+		})
+		if err != nil {
+			return err
+		}
+		if err := hp.ensureImage(ctx, image, nil, models.PullIfNotPresent); err != nil {
+			return err
+		}
+		if err := hp.importArchive(ctx, job, image, name, archive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *DockerPlatform) importArchive(ctx context.Context, job uuid.UUID, image, name, archive string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return runerr.Wrap(ctx, "import volume", name, err)
+	}
+	defer f.Close()
+
+	id, err := p.createVolumeHelper(ctx, job, image, name)
+	if err != nil {
+		return err
+	}
+	defer p.client.ContainerRemove(context.WithoutCancel(ctx), id, client.ContainerRemoveOptions{Force: true})
+
+	_, err = p.client.CopyToContainer(ctx, id, client.CopyToContainerOptions{
+		DestinationPath: "/",
+		Content:         f,
+		CopyUIDGID:      true,
+	})
+	if err != nil {
+		return runerr.Wrap(ctx, "import volume", name, err)
+	}
+	return nil
+}
+
+// volumeHelper returns the daemon holding the volume and an image to mount it
+// with: that of the first service mounting it, which the daemon already has (or
+// pulls for the service anyway).
+func (p *DockerPlatform) volumeHelper(metadata *models.Metadata, volume string) (*DockerPlatform, string, error) {
+	for _, name := range slices.Sorted(maps.Keys(metadata.Services)) {
+		service := metadata.Services[name]
+		if service.Volumes == nil {
+			continue
+		}
+		for _, vm := range *service.Volumes {
+			if vm.Name != nil && *vm.Name == volume {
+				hp, err := p.forService(name, &service)
+				if err != nil {
+					return nil, "", err
+				}
+				return hp, service.Image, nil
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("volume %q is not mounted by any service", volume)
+}
+
+// createVolumeHelper creates (but never starts) a container with the volume at
+// snapshotMountPath, which is all the archive API needs.
+func (p *DockerPlatform) createVolumeHelper(ctx context.Context, job uuid.UUID, image, volume string) (string, error) {
+	created, err := p.client.ContainerCreate(ctx, client.ContainerCreateOptions{
+		Config: &container.Config{
+			Image: image,
+			// Never run; set so images without a default command can be created.
+			Entrypoint: []string{"true"},
+			Labels: map[string]string{
+				p.label("job"):  job.String(),
+				p.label("kind"): "snapshot",
+			},
+		},
+		HostConfig: &container.HostConfig{
+			Mounts: []mount.Mount{{Type: mount.TypeVolume, Source: volume, Target: snapshotMountPath}},
+		},
+		Image: image,
+	})
+	if err != nil {
+		return "", runerr.Wrap(ctx, "create volume helper", volume, err)
+	}
+	return created.ID, nil
+}
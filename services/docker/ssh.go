@@ -0,0 +1,49 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/moby/moby/client"
+)
+
+// copySSHFiles writes the files into a created (not yet started) container.
+// The daemon chowns them to the container's user, so the key is only readable
+// by the step.
+func (p *DockerPlatform) copySSHFiles(ctx context.Context, containerID, containerName string, files []platforms.SSHFile) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	dir := strings.TrimPrefix(platforms.SSHDir, "/")
+	now := time.Now()
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0o700, ModTime: now}); err != nil {
+		return runerr.Wrap(ctx, "provision ssh key", containerName, err)
+	}
+	for _, f := range files {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: path.Join(dir, f.Name), Mode: int64(f.Mode), Size: int64(len(f.Content)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return runerr.Wrap(ctx, "provision ssh key", containerName, err)
+		}
+		if _, err := tw.Write(f.Content); err != nil {
+			return runerr.Wrap(ctx, "provision ssh key", containerName, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return runerr.Wrap(ctx, "provision ssh key", containerName, err)
+	}
+
+	_, err := p.client.CopyToContainer(ctx, containerID, client.CopyToContainerOptions{
+		DestinationPath: "/",
+		Content:         &buf,
+		CopyUIDGID:      true,
+	})
+	if err != nil {
+		return runerr.Wrap(ctx, "provision ssh key", containerName, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package docker
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+)
+
+// Status lists the job's containers on every daemon with their live state, sorted
+// by service name.
+func (p *DockerPlatform) Status(ctx context.Context, job uuid.UUID) ([]models.ServiceStatus, error) {
+	var out []models.ServiceStatus
+	err := p.eachHost(func(hp *DockerPlatform) error {
+		statuses, err := hp.hostStatus(ctx, job)
+		out = append(out, statuses...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Service < out[j].Service })
+	return out, nil
+}
+
+func (p *DockerPlatform) hostStatus(ctx context.Context, job uuid.UUID) ([]models.ServiceStatus, error) {
+	f := make(client.Filters).
+		Add("label", p.label("job")+"="+job.String())
+
+	containers, err := p.client.ContainerList(ctx, client.ContainerListOptions{
+		All:     true,
+		Filters: f,
+	})
+	if err != nil {
+		return nil, runerr.Wrap(ctx, "list containers", job.String(), err)
+	}
+
+	out := make([]models.ServiceStatus, 0, len(containers.Items))
+	for _, c := range containers.Items {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		status := models.ServiceStatus{
+			Service:   c.Labels[p.label("service")],
+			Container: name,
+			Image:     c.Image,
+			State:     string(c.State),
+			Status:    c.Status,
+			Run:       c.Labels[p.label("run")],
+		}
+		if c.Health != nil && c.Health.Status != container.NoHealthcheck {
+			status.Health = string(c.Health.Status)
+		}
+		if len(p.clients) > 1 {
+			status.Host = p.host
+		}
+		out = append(out, status)
+	}
+	return out, nil
+}
@@ -0,0 +1,144 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+	"github.com/moby/moby/client"
+)
+
+// Strategy is how SetupService replaces a service's container. The new
+// container is created under the name Prepare returns, then started (and, with
+// a healthcheck, waited on) before Finish is called with the outcome.
+// Strategies are registered in strategies by name.
+type Strategy interface {
+	// Prepare runs once the existing container, if any, has been inspected and
+	// returns the name to create the new one under.
+	Prepare(ctx context.Context, p *DockerPlatform, r *Replacement) (string, error)
+
+	// Finish runs after the new container, id, was started, or failed to with
+	// err, and returns the service's outcome.
+	Finish(ctx context.Context, p *DockerPlatform, r *Replacement, id string, err error) error
+}
+
+// Replacement is one service's container being replaced.
+type Replacement struct {
+	Job     uuid.UUID
+	Run     uuid.UUID
+	Name    string // the service's container name
+	Service *models.MetadataService
+
+	Existing bool // a container of that name exists
+	Running  bool // and is running
+
+	// Set by Prepare when the processes' state is carried over (recreate only)
+	checkpoint *checkpoint
+}
+
+var strategies = map[models.DeployStrategy]Strategy{
+	models.StrategyRecreate:  recreate{},
+	models.StrategyBlueGreen: blueGreen{},
+}
+
+// Strategies lists the strategies standalone docker honors, the default first.
+func Strategies() []models.DeployStrategy {
+	return []models.DeployStrategy{models.StrategyRecreate, models.StrategyBlueGreen}
+}
+
+// strategyFor returns the service's strategy. Runner steps and swarm services
+// (whose swarm update order carries the strategy) only ever have a stale
+// container recreated.
+func (p *DockerPlatform) strategyFor(ctx context.Context, service *models.MetadataService, containerOnly bool) (Strategy, error) {
+	if containerOnly || service.Strategy == nil {
+		return recreate{}, nil
+	}
+	s, ok := strategies[*service.Strategy]
+	if !ok {
+		return nil, runerr.Errorf(ctx, "parse strategy", string(*service.Strategy), "platform %s does not support strategy %q", p.Capabilities().Platform, *service.Strategy)
+	}
+	return s, nil
+}
+
+// recreate stops and removes the old container before the new one is created,
+// so the service is down in between.
+type recreate struct{}
+
+func (recreate) Prepare(ctx context.Context, p *DockerPlatform, r *Replacement) (string, error) {
+	if !r.Existing {
+		return r.Name, nil
+	}
+
+	// Carry the processes' state over to the new container if asked to
+	service := r.Service
+	if !p.swarm && !platforms.IsRunnerRole(service) && service.CheckpointOnUpdate != nil && *service.CheckpointOnUpdate && r.Running {
+		r.checkpoint = p.checkpointForUpdate(ctx, r.Job, r.Run, r.Name)
+	}
+
+	// Stop (best-effort) with the service's signal and grace period, so it
+	// can flush before the forced remove
+	p.changed()
+	_, _ = p.client.ContainerStop(ctx, r.Name, stopOptions(service))
+	_, err := p.client.ContainerRemove(ctx, r.Name, client.ContainerRemoveOptions{
+		Force:         true,
+		RemoveVolumes: false,
+	})
+	if err != nil {
+		return "", runerr.Wrap(ctx, "remove existing container", r.Name, err)
+	}
+	return r.Name, nil
+}
+
+func (recreate) Finish(_ context.Context, _ *DockerPlatform, _ *Replacement, _ string, err error) error {
+	return err
+}
+
+// blueGreen starts the new container beside the old one under a temporary name
+// and only retires the old one once the new one is up, so a failed update
+// leaves the old version serving.
+type blueGreen struct{}
+
+func (blueGreen) Prepare(ctx context.Context, p *DockerPlatform, r *Replacement) (string, error) {
+	if !r.Existing {
+		return r.Name, nil
+	}
+	if err := platforms.BlueGreenConflict(r.Service); err != nil {
+		return "", runerr.Wrap(ctx, "parse strategy", string(models.StrategyBlueGreen), err)
+	}
+	// A green container left by an interrupted update is stale.
+	green := r.Name + "-green"
+	if _, err := p.client.ContainerRemove(ctx, green, client.ContainerRemoveOptions{Force: true}); err != nil && !errdefs.IsNotFound(err) {
+		return "", runerr.Wrap(ctx, "remove existing container", green, err)
+	}
+	return green, nil
+}
+
+func (blueGreen) Finish(ctx context.Context, p *DockerPlatform, r *Replacement, id string, err error) error {
+	if !r.Existing {
+		return err
+	}
+	if err != nil {
+		// Keep the old version serving.
+		if id != "" {
+			rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+			defer cancel()
+			if _, rerr := p.client.ContainerRemove(rctx, id, client.ContainerRemoveOptions{Force: true}); rerr != nil && !errdefs.IsNotFound(rerr) {
+				p.warn("remove new container of %q after it failed: %v", r.Name, rerr)
+			}
+		}
+		return err
+	}
+
+	p.changed()
+	_, _ = p.client.ContainerStop(ctx, r.Name, stopOptions(r.Service))
+	if _, err := p.client.ContainerRemove(ctx, r.Name, client.ContainerRemoveOptions{Force: true}); err != nil && !errdefs.IsNotFound(err) {
+		return runerr.Wrap(ctx, "remove existing container", r.Name, err)
+	}
+	if _, err := p.client.ContainerRename(ctx, id, client.ContainerRenameOptions{NewName: r.Name}); err != nil {
+		return runerr.Wrap(ctx, "rename container", r.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,436 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/secopt"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/mount"
+	"github.com/moby/moby/api/types/network"
+	"github.com/moby/moby/api/types/swarm"
+	"github.com/moby/moby/client"
+)
+
+// swarmReplicas maps ScaleSpec onto a swarm service mode. Autoscale modes start at
+// their minimum; swarm has no autoscaler of its own.
+func swarmReplicas(scale *models.ScaleSpec) swarm.ServiceMode {
+	if scale != nil && models.ScaleMode(scale.Mode) == models.ScaleModeGlobal {
+		return swarm.ServiceMode{Global: &swarm.GlobalService{}}
+	}
+
+	replicas := uint64(1)
+	if scale != nil && scale.Min != nil && *scale.Min > 0 {
+		replicas = uint64(*scale.Min)
+	}
+	return swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}}
+}
+
+// swarmRestartPolicy maps a container restart policy onto swarm's conditions;
+// unless-stopped is any, as swarm tasks are never stopped by hand.
+func swarmRestartPolicy(policy container.RestartPolicy) *swarm.RestartPolicy {
+	out := &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionAny}
+	switch policy.Name {
+	case container.RestartPolicyOnFailure:
+		out.Condition = swarm.RestartPolicyConditionOnFailure
+	case container.RestartPolicyDisabled:
+		out.Condition = swarm.RestartPolicyConditionNone
+	}
+	if policy.MaximumRetryCount > 0 {
+		attempts := uint64(policy.MaximumRetryCount)
+		out.MaxAttempts = &attempts
+	}
+	return out
+}
+
+// swarmPrivileges maps security_opt onto a task's privileges. Swarm can only turn
+// AppArmor off, not pick a profile, so a named AppArmor profile is an error.
+func swarmPrivileges(entries []string) (*swarm.Privileges, error) {
+	opts, err := secopt.ParseAll(entries)
+	if err != nil || len(opts) == 0 {
+		return nil, err
+	}
+	out := &swarm.Privileges{}
+	for _, o := range opts {
+		switch o.Kind {
+		case secopt.NoNewPrivileges:
+			out.NoNewPrivileges = o.Value == "true"
+		case secopt.Seccomp:
+			out.Seccomp = &swarm.SeccompOpts{Mode: swarm.SeccompModeUnconfined}
+			if o.Custom() {
+				b, err := o.Profile()
+				if err != nil {
+					return nil, err
+				}
+				out.Seccomp = &swarm.SeccompOpts{Mode: swarm.SeccompModeCustom, Profile: b}
+			}
+		case secopt.AppArmor:
+			if o.Value != secopt.Unconfined {
+				return nil, fmt.Errorf("swarm cannot apply AppArmor profile %q, only apparmor=unconfined", o.Value)
+			}
+			out.AppArmor = &swarm.AppArmorOpts{Mode: swarm.AppArmorModeDisabled}
+		case secopt.Label:
+			if out.SELinuxContext == nil {
+				out.SELinuxContext = &swarm.SELinuxContext{}
+			}
+			if err := selinuxLabel(out.SELinuxContext, o.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+// selinuxLabel applies one label option: disable, or user:, role:, type: or
+// level: followed by its value.
+func selinuxLabel(c *swarm.SELinuxContext, label string) error {
+	if label == "disable" {
+		c.Disable = true
+		return nil
+	}
+	key, value, _ := strings.Cut(label, ":")
+	switch key {
+	case "user":
+		c.User = value
+	case "role":
+		c.Role = value
+	case "type":
+		c.Type = value
+	case "level":
+		c.Level = value
+	default:
+		return fmt.Errorf("invalid SELinux label %q (valid: disable, user:, role:, type:, level:)", label)
+	}
+	return nil
+}
+
+// swarmResources returns the service's limits and reservation, or nil for none.
+func swarmResources(service *models.MetadataService) *swarm.ResourceRequirements {
+	var res swarm.ResourceRequirements
+	if mem := service.MemoryLimit(); mem != nil {
+		res.Limits = &swarm.Limit{MemoryBytes: int64(*mem)}
+	}
+	if r := service.Limits; r != nil {
+		if r.Cpus != nil || r.PidsLimit != nil {
+			if res.Limits == nil {
+				res.Limits = &swarm.Limit{}
+			}
+			if r.Cpus != nil {
+				res.Limits.NanoCPUs = nanoCPUs(*r.Cpus)
+			}
+			if r.PidsLimit != nil {
+				res.Limits.Pids = *r.PidsLimit
+			}
+		}
+		if r.MemoryReservation != nil {
+			res.Reservations = &swarm.Resources{MemoryBytes: int64(*r.MemoryReservation)}
+		}
+	}
+	if res.Limits == nil && res.Reservations == nil {
+		return nil
+	}
+	return &res
+}
+
+// swarmPorts publishes bindings through the routing mesh. Swarm cannot bind a
+// published port to a single host IP, so host_ip is ignored with a warning.
+func (p *DockerPlatform) swarmPorts(name string, service *models.MetadataService) []swarm.PortConfig {
+	if service.Bindings == nil {
+		return nil
+	}
+
+	var ports []swarm.PortConfig
+	for _, b := range *service.Bindings {
+		if b.ContainerPort == nil || b.HostPort == nil {
+			continue
+		}
+		if b.HostIP != nil {
+			p.warn("service %q: host_ip %q is not supported by swarm and was ignored", name, *b.HostIP)
+		}
+		for _, proto := range []network.IPProtocol{"tcp", "udp"} {
+			ports = append(ports, swarm.PortConfig{
+				Protocol:      proto,
+				TargetPort:    uint32(*b.ContainerPort),
+				PublishedPort: uint32(*b.HostPort),
+				PublishMode:   swarm.PortConfigPublishModeIngress,
+			})
+		}
+	}
+	return ports
+}
+
+// applySwarmService creates the swarm service or updates it in place; swarm then
+// rolls the tasks over (start-first, rolling back on failure).
+func (p *DockerPlatform) applySwarmService(
+	ctx context.Context,
+	name string,
+	service *models.MetadataService,
+	env []string,
+	mounts []mount.Mount,
+	configs []*swarm.ConfigReference,
+	networks map[string]struct{},
+	labels map[string]string,
+) error {
+
+	netNames := make([]string, 0, len(networks))
+	for n := range networks {
+		netNames = append(netNames, n)
+	}
+	sort.Strings(netNames)
+
+	attachments := make([]swarm.NetworkAttachmentConfig, 0, len(netNames))
+	for _, n := range netNames {
+		a := swarm.NetworkAttachmentConfig{Target: n}
+		if service.Aliases != nil {
+			a.Aliases = *service.Aliases
+		}
+		attachments = append(attachments, a)
+	}
+
+	cs := &swarm.ContainerSpec{
+		Image:   service.Image,
+		Env:     env,
+		Labels:  labels,
+		Mounts:  mounts,
+		Configs: configs,
+	}
+	// Swarm calls the entrypoint Command and the command Args.
+	if service.Entrypoint != nil {
+		cs.Command = *service.Entrypoint
+	}
+	if service.Command != nil {
+		cs.Args = *service.Command
+	}
+	if service.User != nil {
+		cs.User = *service.User
+	}
+	if service.WorkingDir != nil {
+		cs.Dir = *service.WorkingDir
+	}
+	if service.Hostname != nil {
+		cs.Hostname = *service.Hostname
+	}
+	cs.Healthcheck = healthConfig(service.Healthcheck)
+	cs.Init = service.Init
+	cs.CapabilityAdd = service.CapAdd
+	cs.CapabilityDrop = service.CapDrop
+	cs.Groups = service.GroupAdd
+	privileges, err := swarmPrivileges(service.SecurityOpt)
+	if err != nil {
+		return runerr.Wrap(ctx, "parse security_opt", name, err)
+	}
+	cs.Privileges = privileges
+	if len(service.DNS) > 0 || len(service.DNSSearch) > 0 || len(service.DNSOptions) > 0 {
+		servers, err := dnsServers(service.DNS)
+		if err != nil {
+			return runerr.Wrap(ctx, "parse dns", name, err)
+		}
+		cs.DNSConfig = &swarm.DNSConfig{Nameservers: servers, Search: service.DNSSearch, Options: service.DNSOptions}
+	}
+	if service.StopSignal != nil {
+		cs.StopSignal = *service.StopSignal
+	}
+	if service.StopGracePeriod != nil {
+		d := time.Duration(*service.StopGracePeriod)
+		cs.StopGracePeriod = &d
+	}
+
+	restart, err := restartPolicy(service, p.restartPolicy)
+	if err != nil {
+		return runerr.Wrap(ctx, "parse restart", name, err)
+	}
+
+	order, err := swarmUpdateOrder(service)
+	if err != nil {
+		return runerr.Wrap(ctx, "parse strategy", name, err)
+	}
+
+	spec := swarm.ServiceSpec{
+		Annotations: swarm.Annotations{Name: name, Labels: labels},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: cs,
+			Networks:      attachments,
+			RestartPolicy: swarmRestartPolicy(restart),
+			Placement:     &swarm.Placement{Constraints: swarmConstraints(service.Placement)},
+		},
+		Mode: swarmReplicas(service.Scale),
+		UpdateConfig: &swarm.UpdateConfig{
+			Parallelism:   1,
+			Order:         order,
+			FailureAction: swarm.UpdateFailureActionRollback,
+		},
+		EndpointSpec: &swarm.EndpointSpec{Ports: p.swarmPorts(name, service)},
+	}
+	spec.TaskTemplate.Resources = swarmResources(service)
+	// Swarm has each node pull its own variant, so the platform picks the nodes.
+	imagePlatform, err := platforms.ImagePlatform(service)
+	if err != nil {
+		return runerr.Wrap(ctx, "parse platform", name, err)
+	}
+	if imagePlatform != nil {
+		spec.TaskTemplate.Placement.Platforms = []swarm.Platform{{Architecture: imagePlatform.Architecture, OS: imagePlatform.OS}}
+	}
+
+	// Nodes pull for themselves. Resolving the tag to its current digest is what
+	// makes them pull a moved tag again, so that is what always means here.
+	queryRegistry := service.ImagePullPolicy() == models.PullAlways
+
+	existing, err := p.client.ServiceInspect(ctx, name, client.ServiceInspectOptions{})
+	if err != nil {
+		if !errdefs.IsNotFound(err) {
+			return runerr.Wrap(ctx, "inspect swarm service", name, err)
+		}
+		res, err := p.client.ServiceCreate(ctx, client.ServiceCreateOptions{Spec: spec, QueryRegistry: queryRegistry})
+		if err != nil {
+			return runerr.Wrap(ctx, "create swarm service", name, err)
+		}
+		p.changed()
+		for _, w := range res.Warnings {
+			p.warn("create swarm service %q: %s", name, w)
+		}
+		return nil
+	}
+
+	// Checked again just before the update: a newer run may have got here first.
+	if err := p.fence(ctx, name, existing.Service.Spec.Labels); err != nil {
+		return err
+	}
+	res, err := p.client.ServiceUpdate(ctx, existing.Service.ID, client.ServiceUpdateOptions{
+		Version:       existing.Service.Version,
+		Spec:          spec,
+		QueryRegistry: queryRegistry,
+	})
+	if err != nil {
+		return runerr.Wrap(ctx, "update swarm service", name, err)
+	}
+	p.changed()
+	for _, w := range res.Warnings {
+		p.warn("update swarm service %q: %s", name, w)
+	}
+	return nil
+}
+
+// swarmUpdateOrder maps the service's strategy onto how swarm replaces tasks:
+// rolling (the default) starts each new task before stopping its old one,
+// recreate stops it first.
+func swarmUpdateOrder(service *models.MetadataService) (swarm.UpdateOrder, error) {
+	if service.Strategy == nil {
+		return swarm.UpdateOrderStartFirst, nil
+	}
+	switch *service.Strategy {
+	case models.StrategyRolling:
+		return swarm.UpdateOrderStartFirst, nil
+	case models.StrategyRecreate:
+		return swarm.UpdateOrderStopFirst, nil
+	}
+	return "", fmt.Errorf("platform swarm does not support strategy %q", *service.Strategy)
+}
+
+// priorSwarmResources adds the resources recorded on an existing swarm service to names,
+// so an update doesn't forget them. It refuses services a newer run created.
+func (p *DockerPlatform) priorSwarmResources(ctx context.Context, name string, names map[string]struct{}) error {
+	existing, err := p.client.ServiceInspect(ctx, name, client.ServiceInspectOptions{})
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		return runerr.Wrap(ctx, "inspect swarm service", name, err)
+	}
+	if err := p.fence(ctx, name, existing.Service.Spec.Labels); err != nil {
+		return err
+	}
+
+	v := existing.Service.Spec.Labels[p.label("resources")]
+	if v == "" {
+		return nil
+	}
+	var prior []string
+	if err := json.Unmarshal([]byte(v), &prior); err != nil {
+		p.warn("swarm service %q has a malformed %s label: %v", name, p.label("resources"), err)
+		return nil
+	}
+	for _, n := range prior {
+		if n != "" {
+			names[n] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// removeLabeledSwarmServices removes every swarm service matching the label selector
+// and deletes the agent resources they registered. Failures are recorded in summary.
+func (p *DockerPlatform) removeLabeledSwarmServices(ctx context.Context, selector string, summary *models.TeardownSummary) error {
+	f := make(client.Filters).
+		Add("label", selector)
+
+	services, err := p.client.ServiceList(ctx, client.ServiceListOptions{Filters: f})
+	if err != nil {
+		return summary.Fail("service", selector, runerr.Wrap(ctx, "list swarm services", selector, err))
+	}
+
+	var errs []error
+	resourceNames := make(map[string]struct{})
+	for _, s := range services.Items {
+		if v := s.Spec.Labels[p.label("resources")]; v != "" {
+			var names []string
+			if json.Unmarshal([]byte(v), &names) == nil {
+				for _, n := range names {
+					if n != "" {
+						resourceNames[n] = struct{}{}
+					}
+				}
+			}
+		}
+
+		if _, err := p.client.ServiceRemove(ctx, s.ID, client.ServiceRemoveOptions{}); err != nil && !errdefs.IsNotFound(err) {
+			errs = append(errs, summary.Fail("service", s.Spec.Name, runerr.Wrap(ctx, "remove swarm service", s.Spec.Name, err)))
+			continue
+		}
+		summary.Services = append(summary.Services, s.Spec.Name)
+	}
+
+	if p.comm != nil {
+		for resource := range resourceNames {
+			if err := p.comm.DeleteResourceByName(ctx, resource); err != nil {
+				errs = append(errs, summary.Fail("resource", resource, runerr.Wrap(ctx, "delete resource", resource, err)))
+				continue
+			}
+			summary.Resources = append(summary.Resources, resource)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// swarmServiceNeedsUpdate is the swarm half of updateFilter: the live service is
+// compared by spec hash and image.
+func (p *DockerPlatform) swarmServiceNeedsUpdate(ctx context.Context, name string, desired string, image string) (bool, error) {
+	existing, err := p.client.ServiceInspect(ctx, name, client.ServiceInspectOptions{})
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return true, nil
+		}
+		return false, runerr.Wrap(ctx, "inspect swarm service", name, err)
+	}
+
+	spec := existing.Service.Spec
+	if spec.Labels[p.label("spec-hash")] != desired {
+		return true, nil
+	}
+	cs := spec.TaskTemplate.ContainerSpec
+	// Swarm pins images by digest (image:tag@sha256:...), so compare the prefix.
+	if cs == nil || len(cs.Image) < len(image) || cs.Image[:len(image)] != image {
+		return true, nil
+	}
+	return false, nil
+}
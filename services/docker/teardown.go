@@ -3,45 +3,75 @@ package docker
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 
 	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
 	"github.com/google/uuid"
 
 	"github.com/moby/moby/client"
 )
 
-func (p *DockerPlatform) TearDownServices(ctx context.Context, job uuid.UUID) error {
-	resourceNames := make(map[string]struct{})
+func (p *DockerPlatform) TearDownServices(ctx context.Context, job uuid.UUID, summary *models.TeardownSummary) error {
+	selector := p.label("job") + "=" + job.String()
+
+	// Swarm services go first, otherwise swarm would replace their task containers.
+	var swarmErr error
+	if p.swarm {
+		swarmErr = errors.Join(
+			p.removeLabeledSwarmServices(ctx, selector, summary),
+			p.removeLabeledSwarmConfigs(ctx, selector, summary),
+		)
+	}
 
 	// Get services from job (containers with the job in the label "deploy-commander.job")
+	return errors.Join(swarmErr, p.eachHost(func(hp *DockerPlatform) error {
+		return hp.removeLabeledContainers(ctx, selector, summary)
+	}))
+}
+
+// removeLabeledContainers stops and removes every container matching the label
+// selector, then deletes the agent resources they registered.
+// It keeps going after individual failures; they are recorded in summary and joined.
+func (p *DockerPlatform) removeLabeledContainers(ctx context.Context, selector string, summary *models.TeardownSummary) error {
+	resourceNames := make(map[string]struct{})
+
 	f := make(client.Filters).
-		Add("label", "deploy-commander.job="+job.String())
+		Add("label", selector)
 
 	containers, err := p.client.ContainerList(ctx, client.ContainerListOptions{
 		All:     true,
 		Filters: f,
 	})
 	if err != nil {
-		return fmt.Errorf("list job containers (job=%s): %w", job.String(), err)
+		return summary.Fail("container", selector, runerr.Wrap(ctx, "list containers", selector, err))
 	}
 
+	var errs []error
+
 	// For each service:
 	// - extract resources
 	// - stop + remove container
 	for _, c := range containers.Items {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = c.Names[0]
+		}
+
 		inspect, err := p.client.ContainerInspect(ctx, c.ID, client.ContainerInspectOptions{})
 		if err != nil {
 			// If it vanished between list and inspect, ignore.
 			if errdefs.IsNotFound(err) {
 				continue
 			}
-			return fmt.Errorf("inspect container %q: %w", c.ID, err)
+			errs = append(errs, summary.Fail("container", name, runerr.Wrap(ctx, "inspect container", c.ID, err)))
+			continue
 		}
 
 		// Extract resource names from labels (Option A JSON label).
 		if inspect.Container.Config != nil && inspect.Container.Config.Labels != nil {
-			if v, ok := inspect.Container.Config.Labels["deploy-commander.resources"]; ok && v != "" {
+			if v, ok := inspect.Container.Config.Labels[p.label("resources")]; ok && v != "" {
 				var names []string
 				if je := json.Unmarshal([]byte(v), &names); je == nil {
 					for _, n := range names {
@@ -53,38 +83,53 @@ func (p *DockerPlatform) TearDownServices(ctx context.Context, job uuid.UUID) er
 			}
 		}
 
-		// Stop (best-effort) then remove
+		// Stop (best-effort) then remove. Without options the daemon uses the stop
+		// signal and grace period the container was created with.
 		_, _ = p.client.ContainerStop(ctx, c.ID, client.ContainerStopOptions{})
 		_, err = p.client.ContainerRemove(ctx, c.ID, client.ContainerRemoveOptions{
 			Force:         true,
 			RemoveVolumes: false,
 		})
 		if err != nil && !errdefs.IsNotFound(err) {
-			return fmt.Errorf("remove container %q: %w", c.ID, err)
+			errs = append(errs, summary.Fail("container", name, runerr.Wrap(ctx, "remove container", c.ID, err)))
+			continue
 		}
+		summary.Containers = append(summary.Containers, name)
 	}
 
 	if p.comm != nil {
-		for resource, _ := range resourceNames {
-			p.comm.DeleteResourceByName(ctx, resource)
+		for resource := range resourceNames {
+			if err := p.comm.DeleteResourceByName(ctx, resource); err != nil {
+				errs = append(errs, summary.Fail("resource", resource, runerr.Wrap(ctx, "delete resource", resource, err)))
+				continue
+			}
+			summary.Resources = append(summary.Resources, resource)
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
-func (p *DockerPlatform) TearDownVolumes(ctx context.Context, job uuid.UUID) error {
+func (p *DockerPlatform) TearDownVolumes(ctx context.Context, job uuid.UUID, summary *models.TeardownSummary) error {
 	// Get volumes for the job (volumes with the job in the label "deploy-commander.job")
+	return p.eachHost(func(hp *DockerPlatform) error {
+		return hp.removeLabeledVolumes(ctx, p.label("job")+"="+job.String(), summary)
+	})
+}
+
+func (p *DockerPlatform) removeLabeledVolumes(ctx context.Context, selector string, summary *models.TeardownSummary) error {
 	f := make(client.Filters).
-		Add("label", "deploy-commander.job="+job.String())
+		Add("label", selector)
 
 	vols, err := p.client.VolumeList(ctx, client.VolumeListOptions{
 		Filters: f,
 	})
 	if err != nil {
-		return fmt.Errorf("list job volumes (job=%s): %w", job.String(), err)
+		return summary.Fail("volume", selector, runerr.Wrap(ctx, "list volumes", selector, err))
 	}
 
+	var errs []error
+
 	// Remove each volume
 	for _, v := range vols.Items {
 		if v.Name == "" {
@@ -96,25 +141,35 @@ func (p *DockerPlatform) TearDownVolumes(ctx context.Context, job uuid.UUID) err
 			if errdefs.IsNotFound(err) {
 				continue
 			}
-			return fmt.Errorf("remove volume %q: %w", v.Name, err)
+			errs = append(errs, summary.Fail("volume", v.Name, runerr.Wrap(ctx, "remove volume", v.Name, err)))
+			continue
 		}
+		summary.Volumes = append(summary.Volumes, v.Name)
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
-func (p *DockerPlatform) TearDownNetworks(ctx context.Context, job uuid.UUID) error {
+func (p *DockerPlatform) TearDownNetworks(ctx context.Context, job uuid.UUID, summary *models.TeardownSummary) error {
 	// Get networks for the job (networks with the job in the label "deploy-commander.job")
+	return p.eachHost(func(hp *DockerPlatform) error {
+		return hp.removeLabeledNetworks(ctx, p.label("job")+"="+job.String(), summary)
+	})
+}
+
+func (p *DockerPlatform) removeLabeledNetworks(ctx context.Context, selector string, summary *models.TeardownSummary) error {
 	f := make(client.Filters).
-		Add("label", "deploy-commander.job="+job.String())
+		Add("label", selector)
 
 	nets, err := p.client.NetworkList(ctx, client.NetworkListOptions{
 		Filters: f,
 	})
 	if err != nil {
-		return fmt.Errorf("list job networks (job=%s): %w", job.String(), err)
+		return summary.Fail("network", selector, runerr.Wrap(ctx, "list networks", selector, err))
 	}
 
+	var errs []error
+
 	// Remove each network
 	for _, n := range nets.Items {
 		if n.Name == "" || n.ID == "" {
@@ -127,27 +182,64 @@ func (p *DockerPlatform) TearDownNetworks(ctx context.Context, job uuid.UUID) er
 			if errdefs.IsNotFound(err) {
 				continue
 			}
-			return fmt.Errorf("remove network %q (%s): %w", n.Name, n.ID, err)
+			errs = append(errs, summary.Fail("network", n.Name, runerr.Wrap(ctx, "remove network", n.Name, err)))
+			continue
 		}
+		summary.Networks = append(summary.Networks, n.Name)
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
+// TearDownConnections deletes every connection record the job holds on the agent.
+func (p *DockerPlatform) TearDownConnections(ctx context.Context, job uuid.UUID, summary *models.TeardownSummary) error {
+	if p.comm == nil {
+		return nil
+	}
+	return p.comm.DeleteJobConnections(ctx, job, summary)
+}
+
+// Teardown removes everything the job owns. It is best-effort: every step runs
+// even if an earlier one failed, and the agent is notified with a summary.
 func (p *DockerPlatform) Teardown(ctx context.Context, job uuid.UUID) error {
+	summary := models.TeardownSummary{Job: job}
 
-	err := p.TearDownServices(ctx, job)
-	if err != nil {
-		return err
+	err := errors.Join(
+		p.TearDownConnections(ctx, job, &summary),
+		p.TearDownServices(ctx, job, &summary),
+		p.TearDownVolumes(ctx, job, &summary),
+		p.TearDownNetworks(ctx, job, &summary),
+	)
+
+	if len(summary.Containers)+len(summary.Services)+len(summary.Volumes)+len(summary.Networks)+len(summary.Connections)+len(summary.Resources) > 0 {
+		p.changed()
 	}
-	err = p.TearDownVolumes(ctx, job)
-	if err != nil {
-		return err
+
+	if p.comm != nil {
+		if nerr := p.comm.NotifyTeardown(ctx, job, summary); nerr != nil {
+			err = errors.Join(err, runerr.Wrap(ctx, "notify agent of teardown", job.String(), nerr))
+		}
 	}
-	err = p.TearDownNetworks(ctx, job)
-	if err != nil {
-		return err
+
+	return err
+}
+
+// Rollback removes the containers, volumes and networks created by a single run
+// (objects labeled "deploy-commander.run"). Used when a run is cancelled mid-flight.
+func (p *DockerPlatform) Rollback(ctx context.Context, run uuid.UUID) error {
+	selector := p.label("run") + "=" + run.String()
+	summary := models.TeardownSummary{}
+
+	var swarmErr error
+	if p.swarm {
+		swarmErr = p.removeLabeledSwarmServices(ctx, selector, &summary)
 	}
 
-	return nil
+	return errors.Join(swarmErr, p.eachHost(func(hp *DockerPlatform) error {
+		return errors.Join(
+			hp.removeLabeledContainers(ctx, selector, &summary),
+			hp.removeLabeledVolumes(ctx, selector, &summary),
+			hp.removeLabeledNetworks(ctx, selector, &summary),
+		)
+	}))
 }
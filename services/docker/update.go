@@ -0,0 +1,82 @@
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+
+	"github.com/moby/moby/client"
+)
+
+// updateFilter builds the ServiceFilter for action "update". A service is only
+// re-applied when a three-way comparison says so:
+//   - desired vs last-applied: the spec hash label on the live container
+//   - last-applied vs live: the container is missing, stopped, or runs another image
+//
+// Runner-role steps that already succeeded for this run are never re-run.
+func (p *DockerPlatform) updateFilter(ctx context.Context, job uuid.UUID, run uuid.UUID) (platforms.ServiceFilter, error) {
+	st, err := p.steps.State(job)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(name string, service *models.MetadataService) (bool, error) {
+		if platforms.IsRunnerRole(service) {
+			return !p.steps.Done(st, run, name), nil
+		}
+
+		desired, err := platforms.ServiceSpecHash(service)
+		if err != nil {
+			return false, err
+		}
+
+		containerName := DockerServiceName(job.String(), name)
+		if p.swarm {
+			return p.swarmServiceNeedsUpdate(ctx, containerName, desired, service.Image)
+		}
+
+		hp, err := p.forService(name, service)
+		if err != nil {
+			return false, err
+		}
+		inspect, err := hp.client.ContainerInspect(ctx, containerName, client.ContainerInspectOptions{})
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				return true, nil
+			}
+			return false, runerr.Wrap(ctx, "inspect container", containerName, err)
+		}
+
+		live := inspect.Container
+		if live.Config == nil || live.Config.Labels == nil {
+			return true, nil
+		}
+		if live.Config.Labels[p.label("spec-hash")] != desired {
+			return true, nil
+		}
+		if live.Config.Image != service.Image {
+			return true, nil
+		}
+		if live.State == nil || !live.State.Running {
+			return true, nil
+		}
+		if len(service.PinHosts) > 0 && live.NetworkSettings != nil {
+			// Pinned addresses go stale once a target is recreated, e.g. earlier in this run.
+			// A failed lookup is left for the setup to report.
+			pins, err := hp.pinnedHosts(ctx, job, service, func(n string) bool {
+				_, ok := live.NetworkSettings.Networks[n]
+				return ok
+			})
+			if err != nil || strings.Join(pins, ",") != live.Config.Labels[p.label("pinned-hosts")] {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}, nil
+}
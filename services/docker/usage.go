@@ -0,0 +1,98 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerd/errdefs"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+	"github.com/moby/moby/client"
+)
+
+// Usage measures the job on every daemon: when each of its containers ran, the
+// size of the images they run and of its volumes.
+func (p *DockerPlatform) Usage(ctx context.Context, job uuid.UUID) (models.UsageSample, error) {
+	var out models.UsageSample
+	if p.swarm {
+		return out, fmt.Errorf("usage is not supported on swarm")
+	}
+	err := p.eachHost(func(hp *DockerPlatform) error {
+		return hp.hostUsage(ctx, job, &out)
+	})
+	return out, err
+}
+
+func (p *DockerPlatform) hostUsage(ctx context.Context, job uuid.UUID, out *models.UsageSample) error {
+	selector := p.label("job") + "=" + job.String()
+	containers, err := p.client.ContainerList(ctx, client.ContainerListOptions{
+		All:     true,
+		Filters: make(client.Filters).Add("label", selector),
+	})
+	if err != nil {
+		return runerr.Wrap(ctx, "list containers", job.String(), err)
+	}
+
+	images := map[string]struct{}{}
+	for _, c := range containers.Items {
+		inspect, err := p.client.ContainerInspect(ctx, c.ID, client.ContainerInspectOptions{})
+		if errdefs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return runerr.Wrap(ctx, "inspect container", c.ID, err)
+		}
+		if st := inspect.Container.State; st != nil {
+			if span, ok := containerSpan(st.StartedAt, st.FinishedAt, st.Running); ok {
+				out.Containers = append(out.Containers, span)
+			}
+		}
+
+		if _, ok := images[c.ImageID]; ok || c.ImageID == "" {
+			continue
+		}
+		images[c.ImageID] = struct{}{}
+		img, err := p.client.ImageInspect(ctx, c.ImageID)
+		if errdefs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return runerr.Wrap(ctx, "inspect image", c.ImageID, err)
+		}
+		out.ImageBytes += img.Size
+	}
+
+	// Volume sizes are only computed by the disk usage endpoint.
+	du, err := p.client.DiskUsage(ctx, client.DiskUsageOptions{Volumes: true, Verbose: true})
+	if err != nil {
+		return runerr.Wrap(ctx, "measure volumes", job.String(), err)
+	}
+	for _, v := range du.Volumes.Items {
+		if v.Labels[p.label("job")] == job.String() && v.UsageData != nil && v.UsageData.Size > 0 {
+			out.VolumeBytes += v.UsageData.Size
+		}
+	}
+	return nil
+}
+
+// containerSpan reads a container's last start and finish. Containers that never
+// started have none.
+func containerSpan(started, finished string, running bool) (models.ContainerSpan, bool) {
+	var span models.ContainerSpan
+	s, err := time.Parse(time.RFC3339Nano, started)
+	if err != nil || s.Year() <= 1 {
+		return span, false
+	}
+	span.Started = s
+	if !running {
+		if f, err := time.Parse(time.RFC3339Nano, finished); err == nil && f.After(s) {
+			span.Finished = f
+		} else {
+			// Stopped without a usable finish time: nothing to count.
+			span.Finished = s
+		}
+	}
+	return span, true
+}
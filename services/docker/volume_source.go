@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"context"
+	"log"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/checksum"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/mount"
+	"github.com/moby/moby/client"
+)
+
+// seedVolume copies the source's directory into a freshly created volume and
+// returns the checksum of what it copied. Docker copies an image's content at a
+// mount point into an empty volume when a container is created with it mounted
+// there, so creating (never starting) and removing a container is all it takes.
+// A volume that doesn't match the source's checksum is removed again.
+func (p *DockerPlatform) seedVolume(ctx context.Context, job uuid.UUID, name string, src models.VolumeSource) (string, error) {
+	if err := p.ensureImage(ctx, src.Image, nil, models.PullIfNotPresent); err != nil {
+		return "", err
+	}
+	created, err := p.client.ContainerCreate(ctx, client.ContainerCreateOptions{
+		Config: &container.Config{
+			Image: src.Image,
+			// Never run; set so images without a default command can be created.
+			Entrypoint: []string{"true"},
+			Labels: map[string]string{
+				p.label("job"):  job.String(),
+				p.label("kind"): "volume-source",
+			},
+		},
+		HostConfig: &container.HostConfig{
+			Mounts: []mount.Mount{{Type: mount.TypeVolume, Source: name, Target: src.Path}},
+		},
+		Image: src.Image,
+	})
+	if err != nil {
+		return "", runerr.Wrap(ctx, "seed volume", name, err)
+	}
+	if _, err := p.client.ContainerRemove(ctx, created.ID, client.ContainerRemoveOptions{Force: true}); err != nil {
+		return "", runerr.Wrap(ctx, "seed volume", name, err)
+	}
+
+	sum, err := p.volumeChecksum(ctx, job, src.Image, name)
+	if err != nil {
+		return "", err
+	}
+	if src.Checksum != "" && sum != src.Checksum {
+		// Remove it so the next run fills it again rather than keeping bad contents.
+		if _, rerr := p.client.VolumeRemove(ctx, name, client.VolumeRemoveOptions{}); rerr != nil {
+			log.Printf("warning: remove volume %s: %v", name, rerr)
+		}
+		return "", runerr.Errorf(ctx, "verify volume", name, "contents are %s, expected %s; the volume was removed", sum, src.Checksum)
+	}
+	return sum, nil
+}
+
+// volumeChecksum sums a volume's contents (see checksum.Tar), reading them through
+// a helper container of image, which the daemon already has.
+func (p *DockerPlatform) volumeChecksum(ctx context.Context, job uuid.UUID, image, name string) (string, error) {
+	id, err := p.createVolumeHelper(ctx, job, image, name)
+	if err != nil {
+		return "", err
+	}
+	defer p.client.ContainerRemove(context.WithoutCancel(ctx), id, client.ContainerRemoveOptions{Force: true})
+
+	res, err := p.client.CopyFromContainer(ctx, id, client.CopyFromContainerOptions{SourcePath: snapshotMountPath})
+	if err != nil {
+		return "", runerr.Wrap(ctx, "checksum volume", name, err)
+	}
+	defer res.Content.Close()
+	sum, err := checksum.Tar(res.Content)
+	if err != nil {
+		return "", runerr.Wrap(ctx, "checksum volume", name, err)
+	}
+	return sum, nil
+}
+
+// recordVolumeChecksum remembers what a volume held right after it was filled,
+// for verifyVolumes.
+func (p *DockerPlatform) recordVolumeChecksum(job uuid.UUID, volume, sum string) error {
+	if p.state == nil {
+		return nil
+	}
+	st, err := p.steps.State(job)
+	if err != nil {
+		return err
+	}
+	if st.VolumeChecksums == nil {
+		st.VolumeChecksums = map[string]string{}
+	}
+	st.VolumeChecksums[volume] = sum
+	return p.state.Save(st)
+}
+
+// verifyVolumes checks that the filled volumes a runner step mounts still hold
+// what they were filled with, so a step never runs on tampered or partial
+// contents. Volumes filled before checksums were recorded are not checked.
+func (p *DockerPlatform) verifyVolumes(ctx context.Context, job uuid.UUID, service *models.MetadataService) error {
+	if p.state == nil || service.Volumes == nil {
+		return nil
+	}
+	st, err := p.steps.State(job)
+	if err != nil {
+		return err
+	}
+	for _, vm := range *service.Volumes {
+		if vm.Name == nil {
+			continue
+		}
+		src, ok := p.volumeSources[*vm.Name]
+		want := st.VolumeChecksums[*vm.Name]
+		if !ok || want == "" {
+			continue
+		}
+		name := DockerVolumeName(job.String(), *vm.Name)
+		got, err := p.volumeChecksum(ctx, job, src.Image, name)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return runerr.Errorf(ctx, "verify volume", name, "contents changed since the volume was filled (%s, was %s)", got, want)
+		}
+	}
+	return nil
+}
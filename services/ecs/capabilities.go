@@ -0,0 +1,26 @@
+package ecs
+
+import "github.com/ezenkico/deploy-commander/runner/models"
+
+// Capabilities reports what the ecs platform can honor. ECS keeps a desired count
+// of tasks and replaces them with rolling deployments; tasks get their own network
+// interfaces, so there are no host ports, and only resources get DNS names.
+func (p *ECSPlatform) Capabilities() models.PlatformCapabilities {
+	return models.PlatformCapabilities{
+		Platform:       "ecs",
+		ScaleModes:     []models.ScaleMode{models.ScaleModeSingle, models.ScaleModeAutoscale},
+		Strategies:     []models.DeployStrategy{models.StrategyRolling},
+		Replicas:       true,
+		NetworkGroups:  true,
+		Healthchecks:   true,
+		KernelCaps:     true,
+		Init:           true,
+		Privileged:     true, // EC2 launch type only
+		MemoryLimits:   true,
+		CPULimits:      true,
+		RollingUpdates: true,
+		RunnerSteps:    true,
+		SharedMemory:   p.data.LaunchType == "EC2", // shm_size and ipc are EC2 only
+		Devices:        p.data.LaunchType == "EC2",
+	}
+}
@@ -0,0 +1,243 @@
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/servicediscovery"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/phase"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+	"github.com/ezenkico/deploy-commander/runner/services/template"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultLaunchType = "FARGATE"
+	defaultCPU        = "256"
+	rollbackTimeout   = 5 * time.Minute
+)
+
+// ECSPlatform implements interfaces.Platform on AWS ECS. Each service becomes a task
+// definition and an ECS service (runner-role steps run as one-off tasks), network
+// groups and resources become security groups, and resources are registered in
+// Cloud Map when the platform has a namespace. Everything is tagged with the job,
+// which is how update, status and teardown find it again.
+type ECSPlatform struct {
+	ecs       *ecs.Client
+	ec2       *ec2.Client
+	discovery *servicediscovery.Client
+	comm      *agent.AgentCommunication
+	state     *state.Store
+	data      models.ECSPlatformData
+
+	// DNS name of the Cloud Map namespace, looked up once
+	namespaceName string
+
+	// Runner-role steps: the job state, shared by update filtering and step
+	// recording, and the outputs of steps that ran (or were skipped) in this run
+	steps *platforms.Steps
+
+	// Run-time facts about services for templated connection metadata
+	facts template.Facts
+
+	// The run's metadata.labels, added to everything it creates
+	jobLabels map[string]string
+
+	// Security groups by name, found or created in this run
+	groups map[string]string
+
+	// Security groups and Cloud Map services this run created, removed again on rollback
+	createdGroups    []string
+	createdDiscovery []string
+
+	// Whether this run changed anything and which non-fatal problems it hit
+	result models.RunResult
+}
+
+// NewECSPlatform loads AWS credentials and builds the ECS, EC2 and Cloud Map clients.
+// data is the required models.ECSPlatformData.
+func NewECSPlatform(comm *agent.AgentCommunication, data *json.RawMessage) (*ECSPlatform, error) {
+	if data == nil {
+		return nil, errors.New("ecs platform requires platform_data with cluster, vpc_id and subnets")
+	}
+	var pd models.ECSPlatformData
+	if err := json.Unmarshal(*data, &pd); err != nil {
+		return nil, fmt.Errorf("parse ecs platform_data: %w", err)
+	}
+	if pd.Cluster == "" || pd.VpcID == "" || len(pd.Subnets) == 0 {
+		return nil, errors.New("ecs platform_data: cluster, vpc_id and subnets are required")
+	}
+	if pd.LaunchType == "" {
+		pd.LaunchType = defaultLaunchType
+	}
+	pd.LaunchType = strings.ToUpper(pd.LaunchType)
+	if pd.LaunchType != "FARGATE" && pd.LaunchType != "EC2" {
+		return nil, fmt.Errorf("ecs platform_data: launch_type %q must be FARGATE or EC2", pd.LaunchType)
+	}
+	if pd.CPU == "" {
+		pd.CPU = defaultCPU
+	}
+
+	opts := []func(*config.LoadOptions) error{config.WithAPIOptions([]func(*middleware.Stack) error{recordEvents})}
+	if pd.Region != "" {
+		opts = append(opts, config.WithRegion(pd.Region))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("ecs platform: no AWS region (set platform_data.region or AWS_REGION)")
+	}
+	pd.Region = cfg.Region
+
+	return &ECSPlatform{
+		ecs:       ecs.NewFromConfig(cfg),
+		ec2:       ec2.NewFromConfig(cfg),
+		discovery: servicediscovery.NewFromConfig(cfg),
+		comm:      comm,
+		data:      pd,
+	}, nil
+}
+
+// Run executes the requested action (setup/update/teardown) for the given configuration.
+func (p *ECSPlatform) Run(ctx context.Context, config models.Configuration) (models.RunResult, error) {
+	p.result = models.RunResult{}
+	p.createdGroups = nil
+	p.createdDiscovery = nil
+	ctx = runerr.WithRun(ctx, config.Job, config.Run)
+
+	err := p.run(ctx, config)
+	// A superseded run leaves the job to the run that replaced it.
+	rollback := (config.RollbackOnCancel && phase.Cause(err) != nil || platforms.RollbackRequested(err)) && !errors.Is(err, phase.ErrSuperseded)
+	if err != nil && rollback && config.Action != models.ActionTeardown {
+		// The run context may already be cancelled; give the rollback its own deadline.
+		rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+		defer cancel()
+		if rerr := p.Rollback(rctx, config.Run); rerr != nil {
+			return p.result, errors.Join(err, runerr.Wrap(rctx, "rollback run", config.Run.String(), rerr))
+		}
+	}
+	return p.result, err
+}
+
+// changed records that the run modified platform or agent state.
+func (p *ECSPlatform) changed() {
+	p.result.Changed = true
+}
+
+// warn logs a non-fatal problem and records it in the run result.
+func (p *ECSPlatform) warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("warning: %s", msg)
+	p.result.Warnings = append(p.result.Warnings, msg)
+}
+
+// serviceName is the ECS service and task definition family of a job's service.
+func serviceName(job uuid.UUID, service string) string {
+	return "dc-" + job.String() + "-" + service
+}
+
+// groupName is the name of a job-scoped security group.
+func groupName(job uuid.UUID, name string) string {
+	return "dc-" + job.String() + "-" + name
+}
+
+func (p *ECSPlatform) run(ctx context.Context, config models.Configuration) error {
+	timeouts, err := phase.Timeouts(config.PhaseTimeouts)
+	if err != nil {
+		return err
+	}
+
+	p.state = state.New(config.WorkspaceDir())
+	p.steps = platforms.NewSteps(p.state)
+	p.facts = template.Facts{}
+	p.jobLabels = nil
+	if config.Metadata != nil {
+		p.jobLabels = config.Metadata.Labels
+	}
+	p.groups = make(map[string]string)
+
+	var needsSetup platforms.ServiceFilter
+	switch config.Action {
+	case models.ActionTeardown:
+		return phase.Run(ctx, phase.Teardown, timeouts[phase.Teardown], func(ctx context.Context) error {
+			return p.Teardown(ctx, config.Job)
+		})
+	case models.ActionUpdate:
+		needsSetup, err = p.updateFilter(ctx, config.Job, config.Run)
+		if err != nil {
+			return err
+		}
+	case models.ActionSetup, models.ActionClone:
+	default:
+		// Port forwards and snapshots have their own entry points.
+		return runerr.Errorf(ctx, "parse action", string(config.Action), "the %s platform does not run action %q", p.Capabilities().Platform, config.Action)
+	}
+
+	metadata := config.Metadata
+	if metadata == nil {
+		return nil
+	}
+
+	err = phase.Run(ctx, phase.Check, timeouts[phase.Check], func(ctx context.Context) error {
+		return p.CheckMetadata(ctx, config.Job, metadata)
+	})
+	if err != nil {
+		return err
+	}
+	err = phase.Run(ctx, phase.Services, timeouts[phase.Services], func(ctx context.Context) error {
+		return p.ServiceSetup(ctx, config.Job, config.Run, metadata, needsSetup)
+	})
+	if err != nil {
+		return err
+	}
+	err = phase.Run(ctx, phase.Removals, timeouts[phase.Removals], func(ctx context.Context) error {
+		return p.RemoveServices(ctx, config.Job, metadata.RemoveServices)
+	})
+	if err != nil {
+		return err
+	}
+	return phase.Run(ctx, phase.Connections, timeouts[phase.Connections], func(ctx context.Context) error {
+		if p.comm == nil {
+			return nil
+		}
+		connectionPlan, err := template.ExpandConnectionPlan(metadata.Connections, template.Chain(p.facts.Lookup, p.steps.Lookup))
+		if err != nil {
+			return runerr.Wrap(ctx, "expand connection metadata", config.Job.String(), err)
+		}
+		changes, err := p.comm.ApplyConnectionPlan(ctx, connectionPlan)
+		if changes > 0 {
+			p.changed()
+		}
+		return err
+	})
+}
+
+// awsTags is the platform's tags in a stable order, in whichever tag type the API wants.
+func awsTags[T any](tags map[string]string, mk func(k, v string) T) []T {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]T, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, mk(k, tags[k]))
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package ecs
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/ezenkico/deploy-commander/runner/services/events"
+)
+
+// Operations with these prefixes only read.
+var readOnlyOperations = []string{"Describe", "List", "Get", "Discover"}
+
+// recordEvents adds a middleware that records each mutating AWS call, retries
+// included, in the run's event log.
+func recordEvents(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("RecordEvents", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		op := awsmiddleware.GetOperationName(ctx)
+		for _, p := range readOnlyOperations {
+			if strings.HasPrefix(op, p) {
+				return next.HandleInitialize(ctx, in)
+			}
+		}
+		started := time.Now()
+		out, md, err := next.HandleInitialize(ctx, in)
+		events.Record(ctx, "ecs", awsmiddleware.GetServiceID(ctx)+" "+op, eventTarget(in.Parameters), 0, started, err)
+		return out, md, err
+	}), middleware.After)
+}
+
+// Input fields that name what a call operates on, most specific first.
+var targetFields = []string{"ServiceName", "Service", "Family", "TaskDefinition", "Task", "Name", "Id"}
+
+// eventTarget is what an API input names, if any.
+func eventTarget(params any) string {
+	v := reflect.Indirect(reflect.ValueOf(params))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	for _, name := range targetFields {
+		f := v.FieldByName(name)
+		if !f.IsValid() || !f.CanInterface() {
+			continue
+		}
+		if s, ok := f.Interface().(*string); ok && s != nil {
+			return *s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,231 @@
+package ecs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/servicediscovery"
+	sdtypes "github.com/aws/aws-sdk-go-v2/service/servicediscovery/types"
+	"github.com/aws/smithy-go"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+)
+
+// Security groups can't be deleted while tasks' network interfaces still use them,
+// which lasts a little while after their service is gone.
+const (
+	groupDeleteTimeout = 3 * time.Minute
+	groupDeleteRetry   = 10 * time.Second
+)
+
+// ensureGroup returns the id of the named security group in the VPC, creating it if
+// needed. Groups stand in for the Docker platform's networks: members may reach each
+// other on any port, which a rule referencing the group itself allows.
+func (p *ECSPlatform) ensureGroup(ctx context.Context, name string, tags map[string]string) (string, error) {
+	if id, ok := p.groups[name]; ok {
+		return id, nil
+	}
+
+	out, err := p.ec2.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: []ec2types.Filter{
+			{Name: aws.String("vpc-id"), Values: []string{p.data.VpcID}},
+			{Name: aws.String("group-name"), Values: []string{name}},
+		},
+	})
+	if err != nil {
+		return "", runerr.Wrap(ctx, "find security group", name, err)
+	}
+	if len(out.SecurityGroups) > 0 {
+		id := aws.ToString(out.SecurityGroups[0].GroupId)
+		p.groups[name] = id
+		return id, nil
+	}
+
+	created, err := p.ec2.CreateSecurityGroup(ctx, &ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(name),
+		Description: aws.String("deploy-commander " + name),
+		VpcId:       aws.String(p.data.VpcID),
+		TagSpecifications: []ec2types.TagSpecification{{
+			ResourceType: ec2types.ResourceTypeSecurityGroup,
+			Tags: awsTags(tags, func(k, v string) ec2types.Tag {
+				return ec2types.Tag{Key: aws.String(k), Value: aws.String(v)}
+			}),
+		}},
+	})
+	if err != nil {
+		return "", runerr.Wrap(ctx, "create security group", name, err)
+	}
+	id := aws.ToString(created.GroupId)
+	p.groups[name] = id
+	p.createdGroups = append(p.createdGroups, id)
+	p.changed()
+
+	_, err = p.ec2.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId: aws.String(id),
+		IpPermissions: []ec2types.IpPermission{{
+			IpProtocol:       aws.String("-1"),
+			UserIdGroupPairs: []ec2types.UserIdGroupPair{{GroupId: aws.String(id)}},
+		}},
+	})
+	if err != nil {
+		return "", runerr.Wrap(ctx, "allow traffic within security group", name, err)
+	}
+	return id, nil
+}
+
+// jobGroups lists the ids of the security groups tagged with key=value.
+func (p *ECSPlatform) jobGroups(ctx context.Context, key, value string) ([]ec2types.SecurityGroup, error) {
+	var groups []ec2types.SecurityGroup
+	pages := ec2.NewDescribeSecurityGroupsPaginator(p.ec2, &ec2.DescribeSecurityGroupsInput{
+		Filters: []ec2types.Filter{
+			{Name: aws.String("vpc-id"), Values: []string{p.data.VpcID}},
+			{Name: aws.String("tag:" + key), Values: []string{value}},
+		},
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, page.SecurityGroups...)
+	}
+	return groups, nil
+}
+
+// deleteGroup deletes a security group, retrying while network interfaces of
+// stopping tasks still hold on to it.
+func (p *ECSPlatform) deleteGroup(ctx context.Context, id string) error {
+	deadline := time.Now().Add(groupDeleteTimeout)
+	for {
+		_, err := p.ec2.DeleteSecurityGroup(ctx, &ec2.DeleteSecurityGroupInput{GroupId: aws.String(id)})
+		if err == nil || apiErrorCode(err) == "InvalidGroup.NotFound" {
+			return nil
+		}
+		if apiErrorCode(err) != "DependencyViolation" || time.Now().After(deadline) {
+			return runerr.Wrap(ctx, "delete security group", id, err)
+		}
+		select {
+		case <-time.After(groupDeleteRetry):
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// discoveryName is the Cloud Map service name of a job's resource. The job id keeps
+// resources of different jobs in one namespace apart.
+func discoveryName(job uuid.UUID, resource string) string {
+	return resource + "-" + job.String()
+}
+
+// lookupNamespace reads the DNS name of the configured Cloud Map namespace.
+func (p *ECSPlatform) lookupNamespace(ctx context.Context) (string, error) {
+	if p.namespaceName != "" {
+		return p.namespaceName, nil
+	}
+	out, err := p.discovery.GetNamespace(ctx, &servicediscovery.GetNamespaceInput{Id: aws.String(p.data.Namespace)})
+	if err != nil {
+		return "", runerr.Wrap(ctx, "find cloud map namespace", p.data.Namespace, err)
+	}
+	p.namespaceName = aws.ToString(out.Namespace.Name)
+	return p.namespaceName, nil
+}
+
+// ensureDiscovery returns the ARN of the resource's Cloud Map service and its DNS
+// name, creating the service if needed. ECS registers the tasks of services that
+// reference it.
+func (p *ECSPlatform) ensureDiscovery(ctx context.Context, job uuid.UUID, resource string, tags map[string]string) (string, string, error) {
+	namespace, err := p.lookupNamespace(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	name := discoveryName(job, resource)
+	hostname := name + "." + namespace
+
+	existing, err := p.discoveryServices(ctx, "-"+job.String())
+	if err != nil {
+		return "", "", runerr.Wrap(ctx, "list cloud map services", name, err)
+	}
+	for _, s := range existing {
+		if aws.ToString(s.Name) == name {
+			return aws.ToString(s.Arn), hostname, nil
+		}
+	}
+
+	out, err := p.discovery.CreateService(ctx, &servicediscovery.CreateServiceInput{
+		Name:        aws.String(name),
+		NamespaceId: aws.String(p.data.Namespace),
+		DnsConfig: &sdtypes.DnsConfig{
+			DnsRecords:    []sdtypes.DnsRecord{{Type: sdtypes.RecordTypeA, TTL: aws.Int64(10)}},
+			RoutingPolicy: sdtypes.RoutingPolicyMultivalue,
+		},
+		HealthCheckCustomConfig: &sdtypes.HealthCheckCustomConfig{FailureThreshold: aws.Int32(1)},
+		Tags: awsTags(tags, func(k, v string) sdtypes.Tag {
+			return sdtypes.Tag{Key: aws.String(k), Value: aws.String(v)}
+		}),
+	})
+	if err != nil {
+		return "", "", runerr.Wrap(ctx, "create cloud map service", name, err)
+	}
+	p.createdDiscovery = append(p.createdDiscovery, aws.ToString(out.Service.Id))
+	p.changed()
+	return aws.ToString(out.Service.Arn), hostname, nil
+}
+
+// discoveryServices lists the namespace's Cloud Map services whose name ends in suffix.
+func (p *ECSPlatform) discoveryServices(ctx context.Context, suffix string) ([]sdtypes.ServiceSummary, error) {
+	if p.data.Namespace == "" {
+		return nil, nil
+	}
+	var out []sdtypes.ServiceSummary
+	pages := servicediscovery.NewListServicesPaginator(p.discovery, &servicediscovery.ListServicesInput{
+		Filters: []sdtypes.ServiceFilter{{
+			Name:      sdtypes.ServiceFilterNameNamespaceId,
+			Values:    []string{p.data.Namespace},
+			Condition: sdtypes.FilterConditionEq,
+		}},
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range page.Services {
+			if strings.HasSuffix(aws.ToString(s.Name), suffix) {
+				out = append(out, s)
+			}
+		}
+	}
+	return out, nil
+}
+
+// deleteDiscovery deletes a Cloud Map service. ECS deregisters the instances of a
+// deleted service asynchronously, so a service still in use is only a warning.
+func (p *ECSPlatform) deleteDiscovery(ctx context.Context, id, name string) error {
+	_, err := p.discovery.DeleteService(ctx, &servicediscovery.DeleteServiceInput{Id: aws.String(id)})
+	if err == nil {
+		return nil
+	}
+	switch apiErrorCode(err) {
+	case "ServiceNotFound":
+		return nil
+	case "ResourceInUse":
+		p.warn("cloud map service %q still has registered instances; delete it once they are gone", name)
+		return nil
+	}
+	return runerr.Wrap(ctx, "delete cloud map service", name, err)
+}
+
+// apiErrorCode is the AWS error code of err, or "" if it is not an API error.
+func apiErrorCode(err error) string {
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		return ae.ErrorCode()
+	}
+	return ""
+}
@@ -0,0 +1,15 @@
+package ecs
+
+import (
+	"encoding/json"
+
+	"github.com/ezenkico/deploy-commander/runner/interfaces"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+)
+
+func init() {
+	platforms.Register("ecs", func(comm *agent.AgentCommunication, data *json.RawMessage) (interfaces.Platform, error) {
+		return NewECSPlatform(comm, data)
+	})
+}
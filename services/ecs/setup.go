@@ -0,0 +1,753 @@
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/device"
+	"github.com/ezenkico/deploy-commander/runner/services/linuxcap"
+	"github.com/ezenkico/deploy-commander/runner/services/plan"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/progress"
+	"github.com/ezenkico/deploy-commander/runner/services/readiness"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/secrets"
+	"github.com/ezenkico/deploy-commander/runner/services/template"
+	"github.com/google/uuid"
+)
+
+const (
+	// Task memory when a service sets none, in MiB (the smallest Fargate size at 256 CPU units)
+	defaultMemoryMiB = 512
+
+	// ECS caps a container's stop timeout at two minutes.
+	maxStopTimeout = 120 * time.Second
+
+	// Upper bound for waiting on deployments and steps; phase timeouts usually end it first.
+	maxWait = 12 * time.Hour
+)
+
+// ECS service names and task definition families allow letters, digits, - and _;
+// Cloud Map service names are DNS labels.
+var (
+	validServiceName  = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	validResourceName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+)
+
+// CheckMetadata validates the metadata against what ECS can run. Volumes would need
+// EFS, which the platform does not manage, so they are rejected up front.
+func (p *ECSPlatform) CheckMetadata(ctx context.Context, job uuid.UUID, metadata *models.Metadata) error {
+	if metadata.Volumes != nil && len(*metadata.Volumes) > 0 {
+		return fmt.Errorf("the ecs platform does not support volumes")
+	}
+	for name, service := range metadata.Services {
+		if !validServiceName.MatchString(name) || len(serviceName(job, name)) > 255 {
+			return fmt.Errorf("service %q cannot be an ECS service name (letters, digits, - and _, at most %d characters)", name, 255-len(serviceName(job, "")))
+		}
+		if service.Volumes != nil && len(*service.Volumes) > 0 {
+			return fmt.Errorf("service %q: the ecs platform does not support volumes", name)
+		}
+		if service.Resources == nil || p.data.Namespace == "" {
+			continue
+		}
+		for _, spec := range *service.Resources {
+			if !validResourceName.MatchString(spec.Name) || len(discoveryName(job, spec.Name)) > 63 {
+				return fmt.Errorf("service %q: resource %q cannot be a Cloud Map service name (lowercase DNS label, at most %d characters)", name, spec.Name, 63-len(discoveryName(job, "")))
+			}
+		}
+	}
+	return nil
+}
+
+func (p *ECSPlatform) ServiceSetup(ctx context.Context,
+	job uuid.UUID,
+	run uuid.UUID,
+	metadata *models.Metadata,
+	needsSetup platforms.ServiceFilter) error {
+
+	services := metadata.Services
+	if services == nil {
+		return nil
+	}
+
+	// Launch in the same order the run plan records.
+	order, err := plan.ServiceOrder(services)
+	if err != nil {
+		return err
+	}
+
+	failed := map[string]bool{} // left out under on_failure: continue
+	rep := progress.From(ctx)
+	for _, name := range order {
+		service := services[name]
+
+		// Stop launching new services once the run is cancelled.
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+
+		if needsSetup != nil {
+			needed, err := needsSetup(name, &service)
+			if err != nil {
+				return err
+			}
+			if !needed {
+				p.recordFacts(job, name, &service)
+				rep.ServiceSkipped(name)
+				continue
+			}
+		}
+
+		if dep := platforms.Blocker(&service, failed); dep != "" {
+			p.warn("service %q was not deployed: it depends on %q, which failed", name, dep)
+			failed[name] = true
+			rep.ServiceSkipped(name)
+			continue
+		}
+
+		started := time.Now()
+		rep.ServiceStarted(name)
+		sctx, cancel := platforms.WithProgressDeadline(runerr.WithService(ctx, name), &service)
+		err := p.SetupService(sctx, job, run, name, &service)
+		if err != nil && platforms.IsStalled(ctx, sctx) {
+			err = platforms.StallError(runerr.WithService(ctx, name), name, &service, "")
+		}
+		cancel()
+		rep.ServiceFinished(name, time.Since(started), err)
+		if err != nil {
+			if err := platforms.FailService(name, &service, err, p.warn); err != nil {
+				return err
+			}
+			if service.FailurePolicy() == models.FailurePolicyContinue {
+				failed[name] = true
+			}
+			continue
+		}
+		platforms.RecordServiceTiming(&p.result, p.warn, name, &service, time.Since(started))
+		p.recordFacts(job, name, &service)
+		if platforms.IsRunnerRole(&service) {
+			if err := p.steps.Record(job, run, name, &service); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// recordFacts stores what connection metadata can refer to about a long-running
+// service (see template.Facts). Tasks have their own network interface, so the
+// "networks" are security groups.
+func (p *ECSPlatform) recordFacts(job uuid.UUID, name string, service *models.MetadataService) {
+	network := groupName(job, "default")
+	if service.NetworkGroups != nil && len(*service.NetworkGroups) > 0 {
+		network = groupName(job, (*service.NetworkGroups)[0])
+	}
+	platforms.RecordFacts(p.facts, name, service, serviceName(job, name), network, func(resource string) string {
+		return groupName(job, "res-"+resource)
+	})
+}
+
+// SetupService registers a task definition for the service and creates or updates
+// its ECS service, waiting until the deployment is stable. Runner-role steps run
+// as a single task that is waited for instead; they have no runner volume, so
+// they produce no outputs.
+func (p *ECSPlatform) SetupService(
+	ctx context.Context,
+	job uuid.UUID,
+	run uuid.UUID,
+	name string,
+	service *models.MetadataService,
+) error {
+	if service == nil {
+		return nil
+	}
+	isRunner := platforms.IsRunnerRole(service)
+
+	// Hold the service back until the resources it connects to can take connections.
+	if service.ResourceReadyTimeout != nil && service.Connections != nil {
+		if err := readiness.Wait(ctx, p.comm, *service.Connections, time.Duration(*service.ResourceReadyTimeout)); err != nil {
+			return err
+		}
+	}
+
+	groupTags := platforms.MergeLabels(map[string]string{
+		"deploy-commander.job": job.String(),
+		"deploy-commander.run": run.String(),
+	}, p.jobLabels)
+
+	// 1) Security groups: network groups, groups of resources connected to and produced
+	groups := append([]string(nil), p.data.SecurityGroups...)
+	if service.NetworkGroups != nil {
+		for _, group := range *service.NetworkGroups {
+			id, err := p.ensureGroup(ctx, groupName(job, group), groupTags)
+			if err != nil {
+				return err
+			}
+			groups = append(groups, id)
+		}
+	}
+	if service.Connections != nil {
+		for _, conn := range *service.Connections {
+			data := platforms.GetPlatformData(conn)
+			if data == nil {
+				continue
+			}
+			var pc models.ECSPlatformConnection
+			if err := json.Unmarshal(*data, &pc); err != nil {
+				return runerr.Wrap(ctx, "parse platform connection", "", err)
+			}
+			if pc.SecurityGroup == "" {
+				return runerr.Errorf(ctx, "parse platform connection", "", "security_group is required")
+			}
+			groups = append(groups, pc.SecurityGroup)
+		}
+	}
+
+	resources := []models.CreateResource{}
+	resourceNames := make(map[string]struct{})
+	var registries []ecstypes.ServiceRegistry
+	if service.Resources != nil {
+		for _, spec := range *service.Resources {
+			if isRunner {
+				resources = append(resources, models.CreateResource{
+					ResourceType:     spec.ResourceType,
+					Name:             spec.Name,
+					PublicConnection: spec.PublicConnection,
+					Metadata:         spec.Metadata,
+				})
+				continue
+			}
+
+			id, err := p.ensureGroup(ctx, groupName(job, "res-"+spec.Name), groupTags)
+			if err != nil {
+				return err
+			}
+			groups = append(groups, id)
+			pc := models.ECSPlatformConnection{SecurityGroup: id}
+
+			if p.data.Namespace != "" {
+				arn, hostname, err := p.ensureDiscovery(ctx, job, spec.Name, groupTags)
+				if err != nil {
+					return err
+				}
+				registries = append(registries, ecstypes.ServiceRegistry{RegistryArn: aws.String(arn)})
+				pc.Hostname = hostname
+			}
+
+			b, err := json.Marshal(pc)
+			if err != nil {
+				return runerr.Wrap(ctx, "marshal platform connection for resource", spec.Name, err)
+			}
+			rm := json.RawMessage(b)
+			resources = append(resources, models.CreateResource{
+				ResourceType:       spec.ResourceType,
+				Name:               spec.Name,
+				PlatformConnection: &rm,
+				PublicConnection:   spec.PublicConnection,
+				Metadata:           spec.Metadata,
+			})
+			resourceNames[spec.Name] = struct{}{}
+		}
+	}
+	if len(groups) == len(p.data.SecurityGroups) {
+		id, err := p.ensureGroup(ctx, groupName(job, "default"), groupTags)
+		if err != nil {
+			return err
+		}
+		groups = append(groups, id)
+	}
+
+	// 2) Env (with ${JOB}, ${RUN}, ${services...}, ${steps...} and secret://
+	// references resolved). Services have no DNS names here, so there is no
+	// address fact.
+	env := []ecstypes.KeyValuePair{}
+	lookup := template.Chain(template.Vars(job, run), p.facts.Lookup, p.steps.Lookup)
+	for k, v := range service.Environment {
+		resolved, err := template.Interpolate(v, lookup)
+		if err != nil {
+			return runerr.Wrap(ctx, "resolve env", k, err)
+		}
+		if resolved, err = secrets.Resolve(ctx, resolved); err != nil {
+			return runerr.Wrap(ctx, "resolve secret", k, err)
+		}
+		env = append(env, ecstypes.KeyValuePair{Name: aws.String(k), Value: aws.String(resolved)})
+	}
+	secretEnv, err := platforms.SecretEnv(ctx, p.comm, job, service)
+	if err != nil {
+		return err
+	}
+	for _, kv := range secretEnv {
+		k, v, _ := strings.Cut(kv, "=")
+		env = append(env, ecstypes.KeyValuePair{Name: aws.String(k), Value: aws.String(v)})
+	}
+	sort.Slice(env, func(i, j int) bool { return *env[i].Name < *env[j].Name })
+
+	// 3) Tags
+	specHash, err := platforms.ServiceSpecHash(service)
+	if err != nil {
+		return err
+	}
+	tags := platforms.MergeLabels(map[string]string{
+		"deploy-commander.job":       job.String(),
+		"deploy-commander.run":       run.String(),
+		"deploy-commander.service":   name,
+		"deploy-commander.spec-hash": specHash, // last-applied spec, compared on update
+	}, p.jobLabels, service.Labels)
+
+	// 4) Task definition
+	family := serviceName(job, name)
+	taskDef, err := p.registerTaskDefinition(ctx, job, family, name, service, env, tags)
+	if err != nil {
+		return err
+	}
+
+	network := &ecstypes.NetworkConfiguration{
+		AwsvpcConfiguration: &ecstypes.AwsVpcConfiguration{
+			Subnets:        p.data.Subnets,
+			SecurityGroups: dedupe(groups),
+			AssignPublicIp: ecstypes.AssignPublicIpDisabled,
+		},
+	}
+	if p.data.AssignPublicIP {
+		network.AwsvpcConfiguration.AssignPublicIp = ecstypes.AssignPublicIpEnabled
+	}
+
+	if isRunner {
+		if err := p.runStep(ctx, name, family, taskDef, network, tags); err != nil {
+			return err
+		}
+		p.steps.SetOutputs(name, map[string]string{})
+		return platforms.RegisterResources(ctx, p.comm, resources, p.changed)
+	}
+
+	// 5) Service, keeping the resources an earlier version registered
+	existing, err := p.describeService(ctx, family)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		collectResources(existing.Tags, resourceNames)
+	}
+	if len(resourceNames) > 0 {
+		names := make([]string, 0, len(resourceNames))
+		for n := range resourceNames {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		// Tag values can't hold JSON (or commas), so the list is space separated.
+		tags["deploy-commander.resources"] = strings.Join(names, " ")
+	}
+	ecsTags := awsTags(tags, func(k, v string) ecstypes.Tag {
+		return ecstypes.Tag{Key: aws.String(k), Value: aws.String(v)}
+	})
+
+	desired := int32(1)
+	if service.Scale != nil && service.Scale.Min != nil {
+		desired = int32(*service.Scale.Min)
+	}
+
+	if existing == nil {
+		_, err = p.ecs.CreateService(ctx, &ecs.CreateServiceInput{
+			Cluster:              aws.String(p.data.Cluster),
+			ServiceName:          aws.String(family),
+			TaskDefinition:       aws.String(taskDef),
+			DesiredCount:         aws.Int32(desired),
+			LaunchType:           ecstypes.LaunchType(p.data.LaunchType),
+			NetworkConfiguration: network,
+			ServiceRegistries:    registries,
+			PropagateTags:        ecstypes.PropagateTagsService,
+			EnableECSManagedTags: true,
+			Tags:                 ecsTags,
+		})
+		if err != nil {
+			return runerr.Wrap(ctx, "create ecs service", family, err)
+		}
+	} else {
+		_, err = p.ecs.UpdateService(ctx, &ecs.UpdateServiceInput{
+			Cluster:              aws.String(p.data.Cluster),
+			Service:              aws.String(family),
+			TaskDefinition:       aws.String(taskDef),
+			DesiredCount:         aws.Int32(desired),
+			NetworkConfiguration: network,
+			ServiceRegistries:    registries,
+			ForceNewDeployment:   true,
+		})
+		if err != nil {
+			return runerr.Wrap(ctx, "update ecs service", family, err)
+		}
+		_, err = p.ecs.TagResource(ctx, &ecs.TagResourceInput{ResourceArn: existing.ServiceArn, Tags: ecsTags})
+		if err != nil {
+			return runerr.Wrap(ctx, "tag ecs service", family, err)
+		}
+	}
+	p.changed()
+
+	// 6) Wait for the deployment to reach its desired count
+	err = ecs.NewServicesStableWaiter(p.ecs).Wait(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(p.data.Cluster),
+		Services: []string{family},
+	}, maxWait)
+	if err != nil {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		return runerr.Wrap(ctx, "wait for ecs service", family, err)
+	}
+
+	if err := platforms.RegisterResources(ctx, p.comm, resources, p.changed); err != nil {
+		// Take the service down again rather than leave it unregistered.
+		rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+		defer cancel()
+		if derr := p.removeService(rctx, family); derr != nil {
+			p.warn("remove %q after its resources failed to register: %v", family, derr)
+		}
+		return err
+	}
+	return nil
+}
+
+// registerTaskDefinition registers a new revision of the service's task definition
+// and returns its ARN.
+func (p *ECSPlatform) registerTaskDefinition(
+	ctx context.Context,
+	job uuid.UUID,
+	family string,
+	name string,
+	service *models.MetadataService,
+	env []ecstypes.KeyValuePair,
+	tags map[string]string,
+) (string, error) {
+	memory := defaultMemoryMiB
+	if mem := service.MemoryLimit(); mem != nil {
+		memory = mebibytes(*mem)
+	}
+
+	container := ecstypes.ContainerDefinition{
+		Name:        aws.String(name),
+		Image:       aws.String(service.Image),
+		Essential:   aws.Bool(true),
+		Environment: env,
+	}
+	if service.Entrypoint != nil {
+		container.EntryPoint = *service.Entrypoint
+	}
+	if service.Command != nil {
+		container.Command = *service.Command
+	}
+	if service.User != nil {
+		container.User = service.User
+	}
+	if service.WorkingDir != nil {
+		container.WorkingDirectory = service.WorkingDir
+	}
+	container.Privileged = service.Privileged
+	// Fargate rejects shared memory settings and devices, so they are EC2 only.
+	ec2 := p.data.LaunchType == "EC2"
+	shm := service.ShmSize != nil && ec2
+	devices, err := ecsDevices(service.Devices)
+	if err != nil {
+		return "", runerr.Wrap(ctx, "parse devices", name, err)
+	}
+	if !ec2 {
+		devices = nil
+	}
+	if len(service.CapAdd) > 0 || len(service.CapDrop) > 0 || service.Init != nil || shm || len(devices) > 0 {
+		container.LinuxParameters = &ecstypes.LinuxParameters{InitProcessEnabled: service.Init, Devices: devices}
+	}
+	if shm {
+		container.LinuxParameters.SharedMemorySize = aws.Int32(int32(mebibytes(*service.ShmSize)))
+	}
+	if len(service.CapAdd) > 0 || len(service.CapDrop) > 0 {
+		container.LinuxParameters.Capabilities = &ecstypes.KernelCapabilities{
+			Add:  normalizeCaps(service.CapAdd),
+			Drop: normalizeCaps(service.CapDrop),
+		}
+	}
+	if r := service.Limits; r != nil {
+		if r.Cpus != nil {
+			// ECS counts 1024 units per vCPU, out of the task's cpu.
+			container.Cpu = int32(math.Round(*r.Cpus * 1024))
+		}
+		if r.MemoryReservation != nil {
+			container.MemoryReservation = aws.Int32(int32(mebibytes(*r.MemoryReservation)))
+		}
+	}
+	if hc := service.Healthcheck; hc != nil && hc.Test[0] != "NONE" {
+		container.HealthCheck = &ecstypes.HealthCheck{
+			Command:     hc.Test,
+			Interval:    seconds(hc.Interval),
+			Timeout:     seconds(hc.Timeout),
+			StartPeriod: seconds(hc.StartPeriod),
+		}
+		if hc.Retries != nil {
+			container.HealthCheck.Retries = aws.Int32(int32(*hc.Retries))
+		}
+	}
+	if service.Bindings != nil {
+		for _, b := range *service.Bindings {
+			if b.ContainerPort != nil {
+				container.PortMappings = append(container.PortMappings, ecstypes.PortMapping{
+					ContainerPort: aws.Int32(int32(*b.ContainerPort)),
+					Protocol:      ecstypes.TransportProtocolTcp,
+				})
+			}
+		}
+	}
+	if service.StopGracePeriod != nil {
+		grace := min(time.Duration(*service.StopGracePeriod), maxStopTimeout)
+		container.StopTimeout = aws.Int32(int32(grace / time.Second))
+	}
+	if p.data.LogGroup != "" {
+		container.LogConfiguration = &ecstypes.LogConfiguration{
+			LogDriver: ecstypes.LogDriverAwslogs,
+			Options: map[string]string{
+				"awslogs-group":         p.data.LogGroup,
+				"awslogs-region":        p.data.Region,
+				"awslogs-stream-prefix": job.String(),
+			},
+		}
+	}
+
+	input := &ecs.RegisterTaskDefinitionInput{
+		Family:                  aws.String(family),
+		NetworkMode:             ecstypes.NetworkModeAwsvpc,
+		RequiresCompatibilities: []ecstypes.Compatibility{ecstypes.Compatibility(p.data.LaunchType)},
+		Cpu:                     aws.String(p.data.CPU),
+		Memory:                  aws.String(strconv.Itoa(memory)),
+		ContainerDefinitions:    []ecstypes.ContainerDefinition{container},
+		Tags: awsTags(tags, func(k, v string) ecstypes.Tag {
+			return ecstypes.Tag{Key: aws.String(k), Value: aws.String(v)}
+		}),
+	}
+	if service.Ipc != nil && p.data.LaunchType == "EC2" {
+		mode, err := ipcMode(*service.Ipc)
+		if err != nil {
+			return "", runerr.Wrap(ctx, "parse ipc", name, err)
+		}
+		input.IpcMode = mode
+	}
+	if service.Platform != nil {
+		rp, err := runtimePlatform(service)
+		if err != nil {
+			return "", runerr.Wrap(ctx, "parse platform", name, err)
+		}
+		input.RuntimePlatform = rp
+	}
+	if p.data.ExecutionRoleARN != "" {
+		input.ExecutionRoleArn = aws.String(p.data.ExecutionRoleARN)
+	}
+	if p.data.TaskRoleARN != "" {
+		input.TaskRoleArn = aws.String(p.data.TaskRoleARN)
+	}
+
+	out, err := p.ecs.RegisterTaskDefinition(ctx, input)
+	if err != nil {
+		return "", runerr.Wrap(ctx, "register task definition", family, err)
+	}
+	p.changed()
+	return aws.ToString(out.TaskDefinition.TaskDefinitionArn), nil
+}
+
+// runStep runs a runner-role step as one task and waits for it to stop. A step
+// cancelled with the run has its task stopped.
+func (p *ECSPlatform) runStep(ctx context.Context, name, family, taskDef string, network *ecstypes.NetworkConfiguration, tags map[string]string) error {
+	out, err := p.ecs.RunTask(ctx, &ecs.RunTaskInput{
+		Cluster:              aws.String(p.data.Cluster),
+		TaskDefinition:       aws.String(taskDef),
+		LaunchType:           ecstypes.LaunchType(p.data.LaunchType),
+		NetworkConfiguration: network,
+		StartedBy:            aws.String("deploy-commander"),
+		Tags: awsTags(tags, func(k, v string) ecstypes.Tag {
+			return ecstypes.Tag{Key: aws.String(k), Value: aws.String(v)}
+		}),
+	})
+	if err != nil {
+		return runerr.Wrap(ctx, "run step", name, err)
+	}
+	if len(out.Tasks) == 0 {
+		reason := "no task started"
+		if len(out.Failures) > 0 {
+			reason = aws.ToString(out.Failures[0].Reason)
+		}
+		return runerr.Errorf(ctx, "run step", name, "%s", reason)
+	}
+	task := aws.ToString(out.Tasks[0].TaskArn)
+	p.changed()
+
+	stopped, err := ecs.NewTasksStoppedWaiter(p.ecs).WaitForOutput(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(p.data.Cluster),
+		Tasks:   []string{task},
+	}, maxWait)
+	if err != nil {
+		if ctx.Err() != nil {
+			_, _ = p.ecs.StopTask(context.WithoutCancel(ctx), &ecs.StopTaskInput{
+				Cluster: aws.String(p.data.Cluster),
+				Task:    aws.String(task),
+				Reason:  aws.String("run cancelled"),
+			})
+			return context.Cause(ctx)
+		}
+		return runerr.Wrap(ctx, "wait for step", name, err)
+	}
+
+	for _, t := range stopped.Tasks {
+		for _, c := range t.Containers {
+			if aws.ToString(c.Name) != name {
+				continue
+			}
+			if c.ExitCode == nil {
+				return runerr.Errorf(ctx, "run step", name, "stopped without exit code: %s", aws.ToString(t.StoppedReason))
+			}
+			if *c.ExitCode != 0 {
+				return runerr.Errorf(ctx, "run step", name, "exited with status %d", *c.ExitCode)
+			}
+			return nil
+		}
+	}
+	return runerr.Errorf(ctx, "run step", name, "task %s has no container %q", task, name)
+}
+
+// describeService returns the job's ECS service with its tags, or nil if it does
+// not exist or is already being deleted.
+func (p *ECSPlatform) describeService(ctx context.Context, name string) (*ecstypes.Service, error) {
+	out, err := p.ecs.DescribeServices(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(p.data.Cluster),
+		Services: []string{name},
+		Include:  []ecstypes.ServiceField{ecstypes.ServiceFieldTags},
+	})
+	if err != nil {
+		return nil, runerr.Wrap(ctx, "describe ecs service", name, err)
+	}
+	for i := range out.Services {
+		if aws.ToString(out.Services[i].Status) == "ACTIVE" {
+			return &out.Services[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// collectResources adds the names in a service's deploy-commander.resources tag to names.
+func collectResources(tags []ecstypes.Tag, names map[string]struct{}) {
+	for _, t := range tags {
+		if aws.ToString(t.Key) != "deploy-commander.resources" {
+			continue
+		}
+		for _, n := range strings.Fields(aws.ToString(t.Value)) {
+			names[n] = struct{}{}
+		}
+	}
+}
+
+// tagValue returns the value of key among tags.
+func tagValue(tags []ecstypes.Tag, key string) string {
+	for _, t := range tags {
+		if aws.ToString(t.Key) == key {
+			return aws.ToString(t.Value)
+		}
+	}
+	return ""
+}
+
+// dedupe drops repeated ids, keeping the first of each.
+func dedupe(ids []string) []string {
+	seen := make(map[string]struct{}, len(ids))
+	out := ids[:0:0]
+	for _, id := range ids {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// seconds converts an optional duration to ECS's whole seconds, rounding up so a
+// sub-second value does not become zero (which ECS rejects).
+func seconds(d *models.Duration) *int32 {
+	if d == nil {
+		return nil
+	}
+	return aws.Int32(int32((time.Duration(*d) + time.Second - 1) / time.Second))
+}
+
+// ecsDevices maps devices onto ECS's, whose permissions are spelled out.
+func ecsDevices(entries []string) ([]ecstypes.Device, error) {
+	mappings, err := device.ParseAll(entries)
+	if err != nil {
+		return nil, err
+	}
+	perms := map[rune]ecstypes.DeviceCgroupPermission{
+		'r': ecstypes.DeviceCgroupPermissionRead,
+		'w': ecstypes.DeviceCgroupPermissionWrite,
+		'm': ecstypes.DeviceCgroupPermissionMknod,
+	}
+	var out []ecstypes.Device
+	for _, m := range mappings {
+		d := ecstypes.Device{HostPath: aws.String(m.Host), ContainerPath: aws.String(m.Container)}
+		for _, c := range m.Permissions {
+			d.Permissions = append(d.Permissions, perms[c])
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// ipcMode maps ipc onto the task's IPC mode. Every task has its own namespace,
+// so private and shareable are both "task"; tasks cannot join each other's.
+func ipcMode(ipc string) (ecstypes.IpcMode, error) {
+	switch ipc {
+	case "private", "shareable":
+		return ecstypes.IpcModeTask, nil
+	case "host":
+		return ecstypes.IpcModeHost, nil
+	case "none":
+		return ecstypes.IpcModeNone, nil
+	}
+	return "", fmt.Errorf("ipc %q is not supported on ecs (use private, shareable, host or none)", ipc)
+}
+
+// runtimePlatform maps platform onto the task's. ECS runs tasks on hosts of
+// that architecture rather than emulating it, and only has these two.
+func runtimePlatform(service *models.MetadataService) (*ecstypes.RuntimePlatform, error) {
+	platform, err := platforms.ImagePlatform(service)
+	if err != nil {
+		return nil, err
+	}
+	rp := &ecstypes.RuntimePlatform{OperatingSystemFamily: ecstypes.OSFamilyLinux}
+	switch {
+	case platform.OS != "linux":
+	case platform.Architecture == "amd64":
+		rp.CpuArchitecture = ecstypes.CPUArchitectureX8664
+		return rp, nil
+	case platform.Architecture == "arm64":
+		rp.CpuArchitecture = ecstypes.CPUArchitectureArm64
+		return rp, nil
+	}
+	return nil, fmt.Errorf("platform %q is not supported on ecs (use linux/amd64 or linux/arm64)", *service.Platform)
+}
+
+// mebibytes rounds a size up to the MiB ECS sizes memory in.
+func mebibytes(b models.ByteSize) int {
+	return int((int64(b) + 1<<20 - 1) >> 20)
+}
+
+// normalizeCaps writes capabilities the way ECS takes them, without CAP_.
+func normalizeCaps(names []string) []string {
+	var out []string
+	for _, n := range names {
+		out = append(out, linuxcap.Normalize(n))
+	}
+	return out
+}
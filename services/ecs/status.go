@@ -0,0 +1,46 @@
+package ecs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+)
+
+// Status lists the job's ECS services with their running task counts, sorted by service name.
+func (p *ECSPlatform) Status(ctx context.Context, job uuid.UUID) ([]models.ServiceStatus, error) {
+	services, err := p.taggedServices(ctx, "deploy-commander.job", job.String())
+	if err != nil {
+		return nil, runerr.Wrap(ctx, "list ecs services", job.String(), err)
+	}
+
+	out := make([]models.ServiceStatus, 0, len(services))
+	for _, s := range services {
+		image := ""
+		td, err := p.ecs.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{TaskDefinition: s.TaskDefinition})
+		if err != nil {
+			return nil, runerr.Wrap(ctx, "describe task definition", aws.ToString(s.TaskDefinition), err)
+		}
+		if defs := td.TaskDefinition.ContainerDefinitions; len(defs) > 0 {
+			image = aws.ToString(defs[0].Image)
+		}
+
+		out = append(out, models.ServiceStatus{
+			Service:   tagValue(s.Tags, "deploy-commander.service"),
+			Container: aws.ToString(s.ServiceName),
+			Image:     image,
+			State:     strings.ToLower(aws.ToString(s.Status)),
+			Status:    fmt.Sprintf("%d/%d running", s.RunningCount, s.DesiredCount),
+			Run:       tagValue(s.Tags, "deploy-commander.run"),
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Service < out[j].Service })
+	return out, nil
+}
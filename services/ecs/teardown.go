@@ -0,0 +1,241 @@
+package ecs
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecstypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+)
+
+// ECS describes at most this many services per call.
+const describeBatch = 10
+
+// taggedServices lists the cluster's active services tagged with key=value.
+func (p *ECSPlatform) taggedServices(ctx context.Context, key, value string) ([]ecstypes.Service, error) {
+	var arns []string
+	pages := ecs.NewListServicesPaginator(p.ecs, &ecs.ListServicesInput{Cluster: aws.String(p.data.Cluster)})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		arns = append(arns, page.ServiceArns...)
+	}
+
+	var out []ecstypes.Service
+	for start := 0; start < len(arns); start += describeBatch {
+		batch, err := p.ecs.DescribeServices(ctx, &ecs.DescribeServicesInput{
+			Cluster:  aws.String(p.data.Cluster),
+			Services: arns[start:min(start+describeBatch, len(arns))],
+			Include:  []ecstypes.ServiceField{ecstypes.ServiceFieldTags},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range batch.Services {
+			if aws.ToString(s.Status) == "ACTIVE" && tagValue(s.Tags, key) == value {
+				out = append(out, s)
+			}
+		}
+	}
+	return out, nil
+}
+
+// removeService deletes an ECS service, stopping its tasks, and deregisters its
+// task definitions.
+func (p *ECSPlatform) removeService(ctx context.Context, name string) error {
+	_, err := p.ecs.DeleteService(ctx, &ecs.DeleteServiceInput{
+		Cluster: aws.String(p.data.Cluster),
+		Service: aws.String(name),
+		Force:   aws.Bool(true), // no need to scale to zero first
+	})
+	if err != nil && apiErrorCode(err) != "ServiceNotFoundException" {
+		return runerr.Wrap(ctx, "delete ecs service", name, err)
+	}
+	return p.deregisterTaskDefinitions(ctx, name, false)
+}
+
+// deregisterTaskDefinitions deregisters the active revisions of the family, or of
+// every family starting with it when prefix is set.
+func (p *ECSPlatform) deregisterTaskDefinitions(ctx context.Context, family string, prefix bool) error {
+	pages := ecs.NewListTaskDefinitionsPaginator(p.ecs, &ecs.ListTaskDefinitionsInput{
+		FamilyPrefix: aws.String(family),
+		Status:       ecstypes.TaskDefinitionStatusActive,
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return runerr.Wrap(ctx, "list task definitions", family, err)
+		}
+		for _, arn := range page.TaskDefinitionArns {
+			// arn:aws:ecs:<region>:<account>:task-definition/<family>:<revision>
+			name := arn[strings.LastIndex(arn, "/")+1:]
+			name = name[:strings.LastIndex(name, ":")]
+			if !prefix && name != family {
+				continue
+			}
+			if _, err := p.ecs.DeregisterTaskDefinition(ctx, &ecs.DeregisterTaskDefinitionInput{TaskDefinition: aws.String(arn)}); err != nil {
+				return runerr.Wrap(ctx, "deregister task definition", arn, err)
+			}
+		}
+	}
+	return nil
+}
+
+// removeTaggedServices removes every service tagged with key=value, then deletes the
+// agent resources they registered. It keeps going after individual failures; they
+// are recorded in summary and joined.
+func (p *ECSPlatform) removeTaggedServices(ctx context.Context, key, value string, summary *models.TeardownSummary) error {
+	services, err := p.taggedServices(ctx, key, value)
+	if err != nil {
+		return summary.Fail("service", value, runerr.Wrap(ctx, "list ecs services", value, err))
+	}
+
+	var errs []error
+	resourceNames := make(map[string]struct{})
+	for _, s := range services {
+		name := aws.ToString(s.ServiceName)
+		collectResources(s.Tags, resourceNames)
+		if err := p.removeService(ctx, name); err != nil {
+			errs = append(errs, summary.Fail("service", name, err))
+			continue
+		}
+		summary.Services = append(summary.Services, name)
+	}
+
+	if p.comm != nil {
+		for resource := range resourceNames {
+			if err := p.comm.DeleteResourceByName(ctx, resource); err != nil {
+				errs = append(errs, summary.Fail("resource", resource, runerr.Wrap(ctx, "delete resource", resource, err)))
+				continue
+			}
+			summary.Resources = append(summary.Resources, resource)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// TearDownNetworks deletes the job's Cloud Map services and security groups.
+// Security groups are reported as the summary's networks.
+func (p *ECSPlatform) TearDownNetworks(ctx context.Context, job uuid.UUID, summary *models.TeardownSummary) error {
+	var errs []error
+
+	discovery, err := p.discoveryServices(ctx, "-"+job.String())
+	if err != nil {
+		errs = append(errs, summary.Fail("network", job.String(), runerr.Wrap(ctx, "list cloud map services", job.String(), err)))
+	}
+	for _, s := range discovery {
+		if err := p.deleteDiscovery(ctx, aws.ToString(s.Id), aws.ToString(s.Name)); err != nil {
+			errs = append(errs, summary.Fail("network", aws.ToString(s.Name), err))
+		}
+	}
+
+	groups, err := p.jobGroups(ctx, "deploy-commander.job", job.String())
+	if err != nil {
+		return errors.Join(append(errs, summary.Fail("network", job.String(), runerr.Wrap(ctx, "list security groups", job.String(), err)))...)
+	}
+	for _, g := range groups {
+		if err := p.deleteGroup(ctx, aws.ToString(g.GroupId)); err != nil {
+			errs = append(errs, summary.Fail("network", aws.ToString(g.GroupName), err))
+			continue
+		}
+		summary.Networks = append(summary.Networks, aws.ToString(g.GroupName))
+	}
+	return errors.Join(errs...)
+}
+
+// Teardown removes everything the job owns. It is best-effort: every step runs
+// even if an earlier one failed, and the agent is notified with a summary.
+func (p *ECSPlatform) Teardown(ctx context.Context, job uuid.UUID) error {
+	summary := models.TeardownSummary{Job: job}
+
+	var connErr error
+	if p.comm != nil {
+		connErr = p.comm.DeleteJobConnections(ctx, job, &summary)
+	}
+	servicesErr := p.removeTaggedServices(ctx, "deploy-commander.job", job.String(), &summary)
+	err := errors.Join(
+		connErr,
+		servicesErr,
+		p.deregisterTaskDefinitions(ctx, serviceName(job, ""), true),
+		// Security groups outlive the services' tasks by a little; TearDownNetworks retries.
+		p.TearDownNetworks(ctx, job, &summary),
+	)
+
+	if len(summary.Services)+len(summary.Networks)+len(summary.Connections)+len(summary.Resources) > 0 {
+		p.changed()
+	}
+
+	if p.comm != nil {
+		if nerr := p.comm.NotifyTeardown(ctx, job, summary); nerr != nil {
+			err = errors.Join(err, runerr.Wrap(ctx, "notify agent of teardown", job.String(), nerr))
+		}
+	}
+
+	return err
+}
+
+// Rollback removes the services tagged with the run and the security groups and
+// Cloud Map services this run created. Used when a run is cancelled mid-flight.
+func (p *ECSPlatform) Rollback(ctx context.Context, run uuid.UUID) error {
+	summary := models.TeardownSummary{}
+	errs := []error{p.removeTaggedServices(ctx, "deploy-commander.run", run.String(), &summary)}
+
+	for _, id := range p.createdDiscovery {
+		if err := p.deleteDiscovery(ctx, id, id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, id := range p.createdGroups {
+		if err := p.deleteGroup(ctx, id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RemoveServices removes the named services and the resources they registered.
+func (p *ECSPlatform) RemoveServices(ctx context.Context, job uuid.UUID, removeServices *[]string) error {
+	if removeServices == nil {
+		return nil
+	}
+
+	resourceNames := make(map[string]struct{})
+	for _, service := range *removeServices {
+		ctx := runerr.WithService(ctx, service)
+
+		name := serviceName(job, service)
+		existing, err := p.describeService(ctx, name)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			continue
+		}
+		collectResources(existing.Tags, resourceNames)
+
+		if err := p.removeService(ctx, name); err != nil {
+			return err
+		}
+		p.changed()
+	}
+
+	if p.comm != nil {
+		for resource := range resourceNames {
+			if err := p.comm.DeleteResourceByName(ctx, resource); err != nil {
+				p.warn("delete resource %q of removed service: %v", resource, err)
+				continue
+			}
+			p.changed()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package ecs
+
+import (
+	"context"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/google/uuid"
+)
+
+// updateFilter builds the ServiceFilter for action "update", with the same rules as
+// the Docker platform: a service is re-applied when its spec hash tag differs, or
+// its ECS service is missing or runs fewer tasks than it should. Runner-role steps
+// that already succeeded for this run are never re-run.
+func (p *ECSPlatform) updateFilter(ctx context.Context, job uuid.UUID, run uuid.UUID) (platforms.ServiceFilter, error) {
+	st, err := p.steps.State(job)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(name string, service *models.MetadataService) (bool, error) {
+		if platforms.IsRunnerRole(service) {
+			return !p.steps.Done(st, run, name), nil
+		}
+
+		desired, err := platforms.ServiceSpecHash(service)
+		if err != nil {
+			return false, err
+		}
+
+		existing, err := p.describeService(ctx, serviceName(job, name))
+		if err != nil {
+			return false, err
+		}
+		if existing == nil {
+			return true, nil
+		}
+		if tagValue(existing.Tags, "deploy-commander.spec-hash") != desired {
+			return true, nil
+		}
+		return existing.RunningCount < existing.DesiredCount, nil
+	}, nil
+}
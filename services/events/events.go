@@ -0,0 +1,113 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Event is one mutating operation, appended to a run's event log as a line of
+// JSON.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`           // docker, containerd, ecs or agent
+	Op       string    `json:"op"`               // e.g. "POST /containers/create"
+	Target   string    `json:"target,omitempty"` // the object operated on, if known
+	Outcome  string    `json:"outcome"`          // ok or failed
+	Status   int       `json:"status,omitempty"` // HTTP status, for HTTP APIs
+	Error    string    `json:"error,omitempty"`
+	Duration float64   `json:"duration_seconds"`
+}
+
+// Outcomes of an Event.
+const (
+	OutcomeOK     = "ok"
+	OutcomeFailed = "failed"
+)
+
+// Log appends events to a file. It is safe for concurrent use, and recording
+// into a closed Log does nothing.
+type Log struct {
+	mu     sync.Mutex
+	f      *os.File
+	closed bool
+}
+
+// Open opens the event log at path for appending, creating it if needed. A
+// resumed run appends to the log it started.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create event log dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open event log: %w", err)
+	}
+	return &Log{f: f}, nil
+}
+
+// Record appends e. Each event is written with a single write so a crash
+// leaves at most the last line partial.
+func (l *Log) Record(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write event log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the file; later events are dropped.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.f.Close()
+}
+
+type logKey struct{}
+
+// WithLog returns a context whose operations are recorded in l. The platforms'
+// and agent's clients record through the context (see Record), so every call
+// made on behalf of the run lands in its log.
+func WithLog(ctx context.Context, l *Log) context.Context {
+	return context.WithValue(ctx, logKey{}, l)
+}
+
+// Record appends an operation that started at started and ended with err to the
+// context's log, if it has one. A log that cannot be written is not the run's
+// problem, so failures are dropped.
+func Record(ctx context.Context, source, op, target string, status int, started time.Time, err error) {
+	l, ok := ctx.Value(logKey{}).(*Log)
+	if !ok || l == nil {
+		return
+	}
+	e := Event{
+		Time:     started.UTC(),
+		Source:   source,
+		Op:       op,
+		Target:   target,
+		Outcome:  OutcomeOK,
+		Status:   status,
+		Duration: time.Since(started).Seconds(),
+	}
+	if err != nil {
+		e.Outcome = OutcomeFailed
+		e.Error = err.Error()
+	}
+	_ = l.Record(e)
+}
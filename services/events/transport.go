@@ -0,0 +1,50 @@
+package events
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Transport records the mutating requests made through next: every method but
+// GET and HEAD, except the ones that only wait on or stream from an object.
+func Transport(source string, next http.RoundTripper) http.RoundTripper {
+	return &transport{source: source, next: next}
+}
+
+type transport struct {
+	source string
+	next   http.RoundTripper
+}
+
+// Docker prefixes paths with the API version.
+var apiVersion = regexp.MustCompile(`^/v[0-9.]+/`)
+
+// Requests that use POST without changing anything.
+var readOnlySuffixes = []string{"/wait", "/attach", "/resize", "/auth"}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return t.next.RoundTrip(req)
+	}
+	path := apiVersion.ReplaceAllString(req.URL.Path, "/")
+	for _, s := range readOnlySuffixes {
+		if strings.HasSuffix(path, s) {
+			return t.next.RoundTrip(req)
+		}
+	}
+
+	started := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	status, failure := 0, err
+	if err == nil {
+		status = resp.StatusCode
+		if status >= http.StatusBadRequest {
+			failure = errors.New(http.StatusText(status))
+		}
+	}
+	Record(req.Context(), t.source, req.Method+" "+path, req.URL.Query().Get("name"), status, started, failure)
+	return resp, err
+}
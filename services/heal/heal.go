@@ -0,0 +1,62 @@
+package heal
+
+import (
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+)
+
+// Step is what a check does about a container.
+type Step int
+
+const (
+	None     Step = iota
+	Recreate      // it failed: replace it with a fresh container from a newly pulled image
+	Degrade       // it failed again after that: report the service degraded
+	Recover       // a degraded service stopped failing: report it recovered
+)
+
+// DefaultThreshold is how many restarts between two checks count as failing.
+const DefaultThreshold = 3
+
+// Failed returns how often the container restarted since the last check and
+// whether that makes it failing: at least threshold restarts, or an unhealthy
+// healthcheck, which the daemon does not act on by itself.
+func Failed(prev state.ContainerHeal, now models.ServiceRestarts, threshold int) (int, bool) {
+	restarts := now.Restarts - prev.Restarts
+	if restarts < 0 {
+		restarts = now.Restarts // replaced since, e.g. by a run
+	}
+	return restarts, restarts >= threshold || now.Health == "unhealthy"
+}
+
+// Next works out the step for a container checked at at, and its record after
+// the step succeeds. Escalation starts over once the container stops failing.
+func Next(prev state.ContainerHeal, now models.ServiceRestarts, threshold int, at time.Time) (state.ContainerHeal, Step) {
+	_, failing := Failed(prev, now, threshold)
+	if !failing {
+		next := state.ContainerHeal{Restarts: now.Restarts}
+		if prev.Degraded {
+			return next, Recover
+		}
+		return next, None
+	}
+
+	next := prev
+	next.Restarts = now.Restarts
+	if next.Since == nil {
+		next.Since = &at
+	}
+	switch {
+	case prev.Degraded:
+		return next, None
+	case prev.Recreated:
+		next.Degraded = true
+		return next, Degrade
+	default:
+		next.Recreated = true
+		next.Restarts = 0 // the new container's count
+		return next, Recreate
+	}
+}
@@ -0,0 +1,180 @@
+package include
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// Nesting limit for included documents, which also catches runaway chains.
+const maxDepth = 8
+
+// AgentPrefix marks a reference as an agent path, e.g. agent:/v1/jobs/{id}/metadata.
+const AgentPrefix = "agent:"
+
+// A Loader returns the metadata document at an absolute file path, http(s) URL or
+// agent path. digest is the include's sha256, if it has one, for the loader to
+// check against the document as read.
+type Loader func(ctx context.Context, ref string, digest string) (*models.Metadata, error)
+
+// Resolve replaces md with md merged over everything it includes, recursively.
+// base is the file path, URL or agent path of the document md came from; relative
+// includes are resolved against it. The returned metadata has no includes left.
+//
+// A pinned document (one whose checksum was verified) may only include pinned
+// documents, so every include below it needs a sha256; a document included with
+// a sha256 is pinned in turn.
+//
+// Precedence, lowest first: includes in the order listed, then the including document.
+//   - services are keyed by name and a higher-precedence definition replaces the lower one whole
+//   - networks and volume_sources are keyed by group and volume name, and a
+//     higher-precedence entry replaces the lower one whole
+//   - labels are merged key by key, the higher-precedence value winning
+//   - volumes, remove_services and remove_volumes are unioned, keeping first-seen order
+//   - connections from a higher-precedence document replace lower ones when set
+func Resolve(ctx context.Context, md *models.Metadata, base string, pinned bool, load Loader) error {
+	if md == nil || len(md.Includes) == 0 {
+		return nil
+	}
+	merged, err := resolve(ctx, *md, base, pinned, load, []string{base})
+	if err != nil {
+		return err
+	}
+	*md = merged
+	return nil
+}
+
+func resolve(ctx context.Context, md models.Metadata, base string, pinned bool, load Loader, chain []string) (models.Metadata, error) {
+	if len(chain) > maxDepth {
+		return models.Metadata{}, fmt.Errorf("includes nested deeper than %d: %s", maxDepth, strings.Join(chain, " -> "))
+	}
+
+	var merged models.Metadata
+	for _, inc := range md.Includes {
+		if pinned && inc.SHA256 == "" {
+			return models.Metadata{}, fmt.Errorf("include %q: sha256 is required below a checksummed document", inc.Ref)
+		}
+		ref, err := Locate(base, inc.Ref)
+		if err != nil {
+			return models.Metadata{}, err
+		}
+		if slices.Contains(chain, ref) {
+			return models.Metadata{}, fmt.Errorf("include cycle: %s -> %s", strings.Join(chain, " -> "), ref)
+		}
+
+		child, err := load(ctx, ref, inc.SHA256)
+		if err != nil {
+			return models.Metadata{}, fmt.Errorf("include %q: %w", inc.Ref, err)
+		}
+		if child == nil {
+			continue
+		}
+		resolved, err := resolve(ctx, *child, ref, inc.SHA256 != "", load, append(slices.Clone(chain), ref))
+		if err != nil {
+			return models.Metadata{}, err
+		}
+		merged = Merge(merged, resolved)
+	}
+
+	md.Includes = nil
+	return Merge(merged, md), nil
+}
+
+// Merge returns over layered on top of base using the precedence rules of Resolve.
+// It starts from over, so a field without a rule below is taken from it.
+func Merge(base, over models.Metadata) models.Metadata {
+	out := over
+	out.Volumes = union(base.Volumes, over.Volumes)
+	out.RemoveServices = union(base.RemoveServices, over.RemoveServices)
+	out.RemoveVolumes = union(base.RemoveVolumes, over.RemoveVolumes)
+	if out.Connections == nil {
+		out.Connections = base.Connections
+	}
+
+	out.Services = mergeMap(base.Services, over.Services)
+	out.Networks = mergeMap(base.Networks, over.Networks)
+	out.VolumeSources = mergeMap(base.VolumeSources, over.VolumeSources)
+	out.Labels = mergeMap(base.Labels, over.Labels)
+	return out
+}
+
+// mergeMap returns base's entries with over's on top, or nil if both are empty.
+func mergeMap[M ~map[K]V, K comparable, V any](base, over M) M {
+	if len(base)+len(over) == 0 {
+		return nil
+	}
+	out := make(M, len(base)+len(over))
+	maps.Copy(out, base)
+	maps.Copy(out, over)
+	return out
+}
+
+// Locate resolves an include reference against the document it appears in.
+// Documents from the agent include agent paths, never local files.
+func Locate(base, ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("include: empty reference")
+	}
+
+	if isURL(ref) {
+		return ref, nil
+	}
+	if p, ok := strings.CutPrefix(ref, AgentPrefix); ok {
+		return AgentPrefix + path.Clean("/"+p), nil
+	}
+	if b, ok := strings.CutPrefix(base, AgentPrefix); ok {
+		if !strings.HasPrefix(ref, "/") {
+			ref = path.Join(path.Dir(b), ref)
+		}
+		return AgentPrefix + path.Clean(ref), nil
+	}
+	if isURL(base) {
+		b, err := url.Parse(base)
+		if err != nil {
+			return "", fmt.Errorf("include %q: %w", ref, err)
+		}
+		r, err := url.Parse(ref)
+		if err != nil {
+			return "", fmt.Errorf("include %q: %w", ref, err)
+		}
+		return b.ResolveReference(r).String(), nil
+	}
+
+	if filepath.IsAbs(ref) {
+		return filepath.Clean(ref), nil
+	}
+	dir := "."
+	if base != "" {
+		dir = filepath.Dir(base)
+	}
+	return filepath.Abs(filepath.Join(dir, ref))
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
+}
+
+func union(a, b *[]string) *[]string {
+	if a == nil && b == nil {
+		return nil
+	}
+	var out []string
+	for _, list := range []*[]string{a, b} {
+		if list == nil {
+			continue
+		}
+		for _, s := range *list {
+			if !slices.Contains(out, s) {
+				out = append(out, s)
+			}
+		}
+	}
+	return &out
+}
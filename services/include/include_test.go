@@ -0,0 +1,155 @@
+package include
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// docs loads documents from a map and records the digest each was asked with.
+type docs struct {
+	byRef   map[string]models.Metadata
+	digests map[string]string
+}
+
+func (d *docs) load(_ context.Context, ref string, digest string) (*models.Metadata, error) {
+	md, ok := d.byRef[ref]
+	if !ok {
+		return nil, fmt.Errorf("no document %s", ref)
+	}
+	if d.digests == nil {
+		d.digests = map[string]string{}
+	}
+	d.digests[ref] = digest
+	return &md, nil
+}
+
+func TestLocate(t *testing.T) {
+	tests := []struct {
+		base, ref, want string
+	}{
+		{"/etc/dc/config.json", "base.json", "/etc/dc/base.json"},
+		{"/etc/dc/config.json", "/srv/base.json", "/srv/base.json"},
+		{"https://example.com/dc/app.json", "base.json", "https://example.com/dc/base.json"},
+		{"agent:/v1/jobs/1/metadata", "base", "agent:/v1/jobs/1/base"},
+		{"agent:/v1/jobs/1/metadata", "../shared/base", "agent:/v1/jobs/shared/base"},
+		{"agent:/v1/jobs/1/metadata", "/v1/shared/base", "agent:/v1/shared/base"},
+		{"agent:/v1/jobs/1/metadata", "https://example.com/base.json", "https://example.com/base.json"},
+		{"/etc/dc/config.json", "agent:/v1/shared/base", "agent:/v1/shared/base"},
+	}
+	for _, tt := range tests {
+		got, err := Locate(tt.base, tt.ref)
+		if err != nil {
+			t.Errorf("Locate(%q, %q): %v", tt.base, tt.ref, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Locate(%q, %q) = %q, want %q", tt.base, tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestResolvePinnedRequiresDigests(t *testing.T) {
+	d := &docs{byRef: map[string]models.Metadata{
+		"agent:/v1/jobs/1/base":   {Includes: []models.Include{{Ref: "shared"}}},
+		"agent:/v1/jobs/1/shared": {},
+	}}
+
+	md := models.Metadata{Includes: []models.Include{{Ref: "base"}}}
+	err := Resolve(context.Background(), &md, "agent:/v1/jobs/1/metadata", true, d.load)
+	if err == nil || !strings.Contains(err.Error(), "sha256 is required") {
+		t.Fatalf("include without sha256 below a pinned document: got %v", err)
+	}
+
+	// A checksummed include is pinned in turn, so what it includes needs one too.
+	md = models.Metadata{Includes: []models.Include{{Ref: "base", SHA256: "ab"}}}
+	err = Resolve(context.Background(), &md, "agent:/v1/jobs/1/metadata", true, d.load)
+	if err == nil || !strings.Contains(err.Error(), `"shared"`) {
+		t.Fatalf("nested include without sha256: got %v", err)
+	}
+	if got := d.digests["agent:/v1/jobs/1/base"]; got != "ab" {
+		t.Errorf("loader got digest %q, want %q", got, "ab")
+	}
+
+	// Unpinned documents may include without a digest.
+	md = models.Metadata{Includes: []models.Include{{Ref: "base"}}}
+	if err := Resolve(context.Background(), &md, "agent:/v1/jobs/1/metadata", false, d.load); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveKeepsLabels(t *testing.T) {
+	d := &docs{byRef: map[string]models.Metadata{
+		"/etc/dc/base.json": {Labels: map[string]string{"team": "platform", "tier": "base"}},
+	}}
+
+	md := models.Metadata{
+		Includes: []models.Include{{Ref: "base.json"}},
+		Labels:   map[string]string{"tier": "app", "owner": "web"},
+	}
+	if err := Resolve(context.Background(), &md, "/etc/dc/config.json", false, d.load); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"team": "platform", "tier": "app", "owner": "web"}
+	if !maps.Equal(md.Labels, want) {
+		t.Errorf("labels = %v, want %v", md.Labels, want)
+	}
+}
+
+func TestResolveKeepsNetworks(t *testing.T) {
+	d := &docs{byRef: map[string]models.Metadata{
+		"/etc/dc/base.json": {Networks: map[string]models.NetworkSpec{
+			"backend": {Subnets: []models.NetworkSubnet{{Subnet: "10.10.0.0/24"}}},
+			"shared":  {Subnets: []models.NetworkSubnet{{Subnet: "10.20.0.0/24"}}},
+		}},
+	}}
+
+	md := models.Metadata{
+		Includes: []models.Include{{Ref: "base.json"}},
+		Networks: map[string]models.NetworkSpec{
+			"backend": {Subnets: []models.NetworkSubnet{{Subnet: "10.30.0.0/24"}}},
+		},
+	}
+	if err := Resolve(context.Background(), &md, "/etc/dc/config.json", false, d.load); err != nil {
+		t.Fatal(err)
+	}
+	if got := md.Networks["backend"].Subnets; len(got) != 1 || got[0].Subnet != "10.30.0.0/24" {
+		t.Errorf("backend subnets = %v, want the including document's", got)
+	}
+	if got := md.Networks["shared"].Subnets; len(got) != 1 || got[0].Subnet != "10.20.0.0/24" {
+		t.Errorf("shared subnets = %v, want the included document's", got)
+	}
+}
+
+func TestResolveKeepsVolumeSources(t *testing.T) {
+	d := &docs{byRef: map[string]models.Metadata{
+		"/etc/dc/base.json": {
+			Volumes: &[]string{"assets", "seed"},
+			VolumeSources: map[string]models.VolumeSource{
+				"assets": {Image: "web:1", Path: "/srv/assets"},
+				"seed":   {Image: "db:1", Path: "/seed"},
+			},
+		},
+	}}
+
+	md := models.Metadata{
+		Includes: []models.Include{{Ref: "base.json"}},
+		VolumeSources: map[string]models.VolumeSource{
+			"assets": {Image: "web:2", Path: "/srv/assets"},
+		},
+	}
+	if err := Resolve(context.Background(), &md, "/etc/dc/config.json", false, d.load); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]models.VolumeSource{
+		"assets": {Image: "web:2", Path: "/srv/assets"},
+		"seed":   {Image: "db:1", Path: "/seed"},
+	}
+	if !maps.Equal(md.VolumeSources, want) {
+		t.Errorf("volume_sources = %v, want %v", md.VolumeSources, want)
+	}
+}
@@ -0,0 +1,275 @@
+package inspect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+	"github.com/google/uuid"
+)
+
+// How long in-flight requests get when the server stops.
+const shutdownTimeout = 5 * time.Second
+
+// Server answers read-only questions about the workspace for local tooling: what
+// is running, which jobs the runner knows about, and how recent runs ended. It
+// reads the files runs leave in the workspace and changes nothing.
+type Server struct {
+	store   *state.Store
+	started time.Time
+}
+
+func NewServer(workspace string) *Server {
+	return &Server{store: state.New(workspace), started: time.Now().UTC()}
+}
+
+// Run is a run record with whether its process is still alive. A run that is
+// "running" without a live process was interrupted before it could record its end.
+type Run struct {
+	state.RunRecord
+	Active bool `json:"active"`
+}
+
+// Job is one job's inventory: its recorded steps and latest run.
+type Job struct {
+	Job     uuid.UUID                   `json:"job"`
+	Steps   map[string]state.StepRecord `json:"steps,omitempty"`
+	Runs    int                         `json:"runs"`
+	LastRun *Run                        `json:"last_run,omitempty"`
+}
+
+type Health struct {
+	Status     string    `json:"status"`
+	Workspace  string    `json:"workspace"`
+	Started    time.Time `json:"started"`
+	ActiveRuns int       `json:"active_runs"`
+}
+
+// Handler routes the API. Only GET is served.
+//
+//	GET /v1/health     liveness and the number of active runs
+//	GET /v1/runs       every recorded run, newest first (?active=true for current ones)
+//	GET /v1/runs/{id}  one run
+//	GET /v1/jobs       every job with its steps and latest run
+//	GET /v1/jobs/{id}  one job
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/health", s.health)
+	mux.HandleFunc("GET /v1/runs", s.listRuns)
+	mux.HandleFunc("GET /v1/runs/{id}", s.getRun)
+	mux.HandleFunc("GET /v1/jobs", s.listJobs)
+	mux.HandleFunc("GET /v1/jobs/{id}", s.getJob)
+	return mux
+}
+
+// Serve listens on the unix socket at path until ctx ends. A stale socket left by
+// an earlier server is replaced; the socket is only accessible to its owner and group.
+func (s *Server) Serve(ctx context.Context, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create socket dir: %w", err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove stale socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", path, err)
+	}
+	defer os.Remove(path)
+	if err := os.Chmod(path, 0o660); err != nil {
+		ln.Close()
+		return fmt.Errorf("chmod %s: %w", path, err)
+	}
+
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(sctx)
+	}()
+
+	log.Printf("inspection API listening on %s", path)
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	runs, err := s.runs()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	active := 0
+	for _, run := range runs {
+		if run.Active {
+			active++
+		}
+	}
+	writeJSON(w, Health{Status: "ok", Workspace: s.store.Dir, Started: s.started, ActiveRuns: active})
+}
+
+func (s *Server) listRuns(w http.ResponseWriter, r *http.Request) {
+	runs, err := s.runs()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if r.URL.Query().Get("active") == "true" {
+		current := []Run{}
+		for _, run := range runs {
+			if run.Active {
+				current = append(current, run)
+			}
+		}
+		runs = current
+	}
+	writeJSON(w, runs)
+}
+
+func (s *Server) getRun(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("run id: %w", err))
+		return
+	}
+	rec, err := s.store.LoadRun(id)
+	if errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %s not found", id))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, withActive(*rec))
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.jobs()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, jobs)
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("job id: %w", err))
+		return
+	}
+	jobs, err := s.jobs()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, j := range jobs {
+		if j.Job == id {
+			writeJSON(w, j)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", id))
+}
+
+func (s *Server) runs() ([]Run, error) {
+	return runs(s.store)
+}
+
+func (s *Server) jobs() ([]Job, error) {
+	return Inventory(s.store)
+}
+
+func runs(store *state.Store) ([]Run, error) {
+	records, err := store.Runs()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Run, 0, len(records))
+	for _, rec := range records {
+		out = append(out, withActive(rec))
+	}
+	return out, nil
+}
+
+// Inventory merges the jobs with state and the jobs with runs in the
+// workspace, sorted by job.
+func Inventory(store *state.Store) ([]Job, error) {
+	states, err := store.Jobs()
+	if err != nil {
+		return nil, err
+	}
+	runs, err := runs(store)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[uuid.UUID]*Job{}
+	var order []uuid.UUID
+	job := func(id uuid.UUID) *Job {
+		if j, ok := byID[id]; ok {
+			return j
+		}
+		byID[id] = &Job{Job: id}
+		order = append(order, id)
+		return byID[id]
+	}
+	for _, st := range states {
+		job(st.Job).Steps = st.Steps
+	}
+	for _, run := range runs { // newest first
+		j := job(run.Job)
+		j.Runs++
+		if j.LastRun == nil {
+			j.LastRun = &run
+		}
+	}
+
+	out := make([]Job, 0, len(order))
+	for _, id := range order {
+		out = append(out, *byID[id])
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Job.String() < out[j].Job.String() })
+	return out, nil
+}
+
+func withActive(rec state.RunRecord) Run {
+	return Run{RunRecord: rec, Active: rec.Status == models.RunStatusRunning && alive(rec.PID)}
+}
+
+// alive reports whether a process with the pid exists.
+func alive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,83 @@
+package inspect
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/services/metrics"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+)
+
+// TextfileName is the file WriteTextfile writes into the textfile directory.
+const TextfileName = "deploy_commander.prom"
+
+// WriteTextfile writes the workspace's inventory into dir for node-exporter's
+// textfile collector, so hosts it already scrapes report their deployments.
+func WriteTextfile(workspace, dir string) error {
+	jobs, err := Inventory(state.New(workspace))
+	if err != nil {
+		return fmt.Errorf("read inventory: %w", err)
+	}
+	return metrics.WriteTextfile(filepath.Join(dir, TextfileName), Gauges(jobs, time.Now()))
+}
+
+// Gauges describes the inventory as metrics: one set per job, from its latest
+// run and recorded steps.
+func Gauges(jobs []Job, now time.Time) []metrics.Gauge {
+	out := []metrics.Gauge{
+		{Name: "deploy_commander_inventory_generated_timestamp_seconds", Help: "When the inventory was written, as a Unix timestamp.", Value: unix(now)},
+		{Name: "deploy_commander_inventory_jobs", Help: "Number of jobs the runner has state or runs for.", Value: float64(len(jobs))},
+	}
+	for _, j := range jobs {
+		job := map[string]string{"job": j.Job.String()}
+		with := func(k, v string) map[string]string {
+			l := maps.Clone(job)
+			l[k] = v
+			return l
+		}
+
+		out = append(out, metrics.Gauge{Name: "deploy_commander_job_runs", Help: "Number of runs recorded for the job.", Value: float64(j.Runs), Labels: job})
+		if r := j.LastRun; r != nil {
+			out = append(out,
+				metrics.Gauge{Name: "deploy_commander_job_info", Help: "The job's latest run; always 1.", Value: 1, Labels: map[string]string{
+					"job":      j.Job.String(),
+					"run":      r.Run.String(),
+					"platform": r.Platform,
+					"action":   r.Action,
+					"status":   string(r.Status),
+					"outcome":  string(r.Outcome),
+				}},
+				metrics.Gauge{Name: "deploy_commander_job_active", Help: "1 while a run of the job is in progress.", Value: bool01(r.Active), Labels: job},
+				metrics.Gauge{Name: "deploy_commander_job_last_run_started_timestamp_seconds", Help: "When the job's latest run started, as a Unix timestamp.", Value: unix(r.Started), Labels: job},
+				metrics.Gauge{Name: "deploy_commander_job_last_run_warnings", Help: "Number of warnings the job's latest run reported.", Value: float64(len(r.Warnings)), Labels: job},
+			)
+			if r.Finished != nil {
+				out = append(out, metrics.Gauge{Name: "deploy_commander_job_last_run_finished_timestamp_seconds", Help: "When the job's latest run finished, as a Unix timestamp.", Value: unix(*r.Finished), Labels: job})
+			}
+			if r.Readiness != nil {
+				out = append(out, metrics.Gauge{Name: "deploy_commander_job_ready", Help: "1 if the job's latest run left it ready.", Value: bool01(r.Readiness.Ready), Labels: job})
+			}
+			for _, s := range r.Services {
+				out = append(out, metrics.Gauge{Name: "deploy_commander_job_service_setup_seconds", Help: "Setup time of each service the job's latest run set up.", Value: time.Duration(s.Duration).Seconds(), Labels: with("service", s.Service)})
+			}
+		}
+		for _, step := range slices.Sorted(maps.Keys(j.Steps)) {
+			out = append(out, metrics.Gauge{Name: "deploy_commander_job_step_completed_timestamp_seconds", Help: "When each of the job's runner steps last completed, as a Unix timestamp.", Value: unix(j.Steps[step].CompletedAt), Labels: with("step", step)})
+		}
+	}
+	return out
+}
+
+func unix(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+func bool01(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
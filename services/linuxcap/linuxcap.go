@@ -0,0 +1,49 @@
+package linuxcap
+
+import (
+	"slices"
+	"strings"
+)
+
+// All stands for every capability in cap_add and cap_drop.
+const All = "ALL"
+
+// Known lists the Linux capabilities up to kernel 5.9, without the CAP_ prefix.
+var Known = []string{
+	"AUDIT_CONTROL", "AUDIT_READ", "AUDIT_WRITE", "BLOCK_SUSPEND", "BPF",
+	"CHECKPOINT_RESTORE", "CHOWN", "DAC_OVERRIDE", "DAC_READ_SEARCH", "FOWNER",
+	"FSETID", "IPC_LOCK", "IPC_OWNER", "KILL", "LEASE", "LINUX_IMMUTABLE",
+	"MAC_ADMIN", "MAC_OVERRIDE", "MKNOD", "NET_ADMIN", "NET_BIND_SERVICE",
+	"NET_BROADCAST", "NET_RAW", "PERFMON", "SETFCAP", "SETGID", "SETPCAP",
+	"SETUID", "SYS_ADMIN", "SYS_BOOT", "SYS_CHROOT", "SYS_MODULE", "SYS_NICE",
+	"SYS_PACCT", "SYS_PTRACE", "SYS_RAWIO", "SYS_RESOURCE", "SYS_TIME",
+	"SYS_TTY_CONFIG", "SYSLOG", "WAKE_ALARM",
+}
+
+// Normalize accepts "net_admin", "CAP_NET_ADMIN" and the like and returns the
+// name in Known's form.
+func Normalize(name string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "CAP_")
+}
+
+// Valid reports whether the name is a known capability or ALL.
+func Valid(name string) bool {
+	n := Normalize(name)
+	return n == All || slices.Contains(Known, n)
+}
+
+// Expand normalizes names for runtimes that want CAP_-prefixed names and no ALL.
+func Expand(names []string) []string {
+	var out []string
+	for _, name := range names {
+		n := Normalize(name)
+		if n == All {
+			for _, k := range Known {
+				out = append(out, "CAP_"+k)
+			}
+			continue
+		}
+		out = append(out, "CAP_"+n)
+	}
+	return out
+}
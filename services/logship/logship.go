@@ -0,0 +1,259 @@
+package logship
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/google/uuid"
+)
+
+// Limits for services without a log_limit, so no service can flood the agent.
+const (
+	DefaultLinesPerSecond = 100
+	DefaultBurst          = 500
+)
+
+const (
+	flushInterval = time.Second
+	maxBatchLines = 200
+	maxPending    = 50 * maxBatchLines // while the agent is unreachable; further lines are dropped
+	maxLineBytes  = 16 << 10           // longer lines are cut
+	closeTimeout  = 10 * time.Second
+)
+
+// Shipper forwards a service's output to the agent line by line, rate limited by a
+// token bucket. Lines over the limit are counted and reported with the next batch.
+// Sending happens in the background so a slow agent never blocks the service's output.
+// A nil Shipper forwards nothing.
+type Shipper struct {
+	ctx     context.Context
+	comm    *agent.AgentCommunication
+	run     uuid.UUID
+	service string
+
+	mu      sync.Mutex
+	bucket  bucket
+	pending []models.LogLine
+	dropped int64 // since the last batch
+	total   int64 // for the whole stream
+	partial map[string][]byte
+	failed  bool // a send failed; logged once
+
+	wake      chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// New starts forwarding for one service of a run. It returns nil without an agent.
+func New(ctx context.Context, comm *agent.AgentCommunication, run uuid.UUID, service string, limit *models.LogLimit) *Shipper {
+	if comm == nil {
+		return nil
+	}
+	s := newShipper(ctx, comm, run, service, limit)
+	go s.loop()
+	return s
+}
+
+// newShipper returns a Shipper whose loop is not started yet.
+func newShipper(ctx context.Context, comm *agent.AgentCommunication, run uuid.UUID, service string, limit *models.LogLimit) *Shipper {
+	rate, burst := float64(DefaultLinesPerSecond), DefaultBurst
+	if limit != nil {
+		rate, burst = limit.LinesPerSecond, limit.Burst
+		if burst <= 0 {
+			burst = max(1, int(rate))
+		}
+	}
+
+	return &Shipper{
+		ctx:     context.WithoutCancel(ctx),
+		comm:    comm,
+		run:     run,
+		service: service,
+		bucket:  bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()},
+		partial: map[string][]byte{},
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Tee returns writers that go to stdout and stderr and are also forwarded.
+func (s *Shipper) Tee(stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	if s == nil {
+		return stdout, stderr
+	}
+	return io.MultiWriter(stdout, &streamWriter{s: s, stream: "stdout"}),
+		io.MultiWriter(stderr, &streamWriter{s: s, stream: "stderr"})
+}
+
+// Close forwards what is left and returns how many lines the rate limit dropped.
+func (s *Shipper) Close() int64 {
+	if s == nil {
+		return 0
+	}
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		for stream, b := range s.partial {
+			if len(b) > 0 {
+				s.add(stream, b)
+			}
+		}
+		s.partial = map[string][]byte{}
+		s.mu.Unlock()
+
+		close(s.done)
+		<-s.stopped
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+type streamWriter struct {
+	s      *Shipper
+	stream string
+}
+
+// Write splits p into lines; an unfinished line waits for the rest of it.
+func (w *streamWriter) Write(p []byte) (int, error) {
+	s := w.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := append(s.partial[w.stream], p...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		s.add(w.stream, buf[:i])
+		buf = buf[i+1:]
+	}
+	if len(buf) > maxLineBytes {
+		s.add(w.stream, buf)
+		buf = nil
+	}
+	s.partial[w.stream] = append([]byte(nil), buf...)
+	return len(p), nil
+}
+
+// add queues one line if the bucket allows it and the queue has room. s.mu must be held.
+func (s *Shipper) add(stream string, line []byte) {
+	now := time.Now()
+	if len(s.pending) >= maxPending || !s.bucket.allow(now) {
+		s.dropped++
+		s.total++
+		return
+	}
+	if len(line) > maxLineBytes {
+		line = line[:maxLineBytes]
+	}
+	s.pending = append(s.pending, models.LogLine{
+		Time:   now,
+		Stream: stream,
+		Line:   string(bytes.TrimSuffix(line, []byte("\r"))),
+	})
+	if len(s.pending) >= maxBatchLines {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *Shipper) loop() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		case <-s.done:
+			ctx, cancel := context.WithTimeout(s.ctx, closeTimeout)
+			for s.flush(ctx) {
+			}
+			cancel()
+			return
+		}
+		s.flush(s.ctx)
+	}
+}
+
+// flush sends one batch and reports whether more lines are waiting.
+func (s *Shipper) flush(ctx context.Context) bool {
+	s.mu.Lock()
+	n := min(len(s.pending), maxBatchLines)
+	batch := models.LogBatch{
+		Service: s.service,
+		Lines:   s.pending[:n:n],
+		Dropped: s.dropped,
+	}
+	s.pending = s.pending[n:]
+	s.dropped = 0
+	more := len(s.pending) > 0
+	s.mu.Unlock()
+
+	if len(batch.Lines) == 0 && batch.Dropped == 0 {
+		return false
+	}
+
+	if err := s.comm.SendLogs(ctx, s.run, batch); err != nil {
+		s.mu.Lock()
+		s.requeue(batch)
+		first := !s.failed
+		s.failed = true
+		s.mu.Unlock()
+		if first {
+			log.Printf("forward logs of service %q: %v", s.service, err)
+		}
+		// The rest waits for the next tick rather than hammering an agent that is down.
+		return false
+	}
+
+	s.mu.Lock()
+	s.failed = false // log the next outage too
+	s.mu.Unlock()
+	return more
+}
+
+// requeue puts a batch the agent did not take back in front of the queue. Lines
+// past maxPending are dropped, newest first, like lines added to a full queue.
+// s.mu must be held.
+func (s *Shipper) requeue(batch models.LogBatch) {
+	s.pending = append(batch.Lines, s.pending...)
+	if over := len(s.pending) - maxPending; over > 0 {
+		s.pending = s.pending[:maxPending]
+		s.dropped += int64(over)
+		s.total += int64(over)
+	}
+	s.dropped += batch.Dropped
+}
+
+// bucket is a token bucket: rate tokens per second, holding at most burst.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) allow(now time.Time) bool {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,108 @@
+package logship
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/google/uuid"
+)
+
+// fakeAgent takes log batches while up and fails them while down.
+type fakeAgent struct {
+	mu      sync.Mutex
+	down    bool
+	lines   []string
+	dropped int64
+}
+
+func (a *fakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var batch models.LogBatch
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, l := range batch.Lines {
+		a.lines = append(a.lines, l.Line)
+	}
+	a.dropped += batch.Dropped
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *fakeAgent) setDown(down bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.down = down
+}
+
+// newTestShipper returns a shipper to a, whose loop the test starts itself.
+func newTestShipper(t *testing.T, a *fakeAgent) *Shipper {
+	t.Helper()
+	srv := httptest.NewServer(a)
+	t.Cleanup(srv.Close)
+	comm, err := agent.NewAgentCommunication("tcp://" + strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	comm.Token = "test"
+	// No rate limit worth speaking of, so only the queue drops lines.
+	limit := &models.LogLimit{LinesPerSecond: 1e9, Burst: 1e9}
+	return newShipper(context.Background(), comm, uuid.New(), "web", limit)
+}
+
+func TestShipperKeepsLinesWhileAgentIsDown(t *testing.T) {
+	a := &fakeAgent{down: true}
+	s := newTestShipper(t, a)
+	stdout, _ := s.Tee(nopWriter{}, nopWriter{})
+
+	const overflow = 10
+	for i := range maxPending + overflow {
+		fmt.Fprintf(stdout, "line %d\n", i)
+	}
+
+	// A failed send keeps the batch and the count of lines dropped so far.
+	s.flush(context.Background())
+	s.mu.Lock()
+	pending, dropped, failed := len(s.pending), s.dropped, s.failed
+	s.mu.Unlock()
+	if pending != maxPending || dropped != overflow || !failed {
+		t.Fatalf("after a failed send: %d line(s) pending, %d dropped, failed %t; want %d, %d, true", pending, dropped, failed, maxPending, overflow)
+	}
+
+	a.setDown(false)
+	go s.loop()
+	if got := s.Close(); got != overflow {
+		t.Errorf("Close = %d dropped line(s), want %d", got, overflow)
+	}
+	if s.failed {
+		t.Error("a successful send did not clear the failure")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.lines) != maxPending || a.dropped != overflow {
+		t.Fatalf("agent got %d line(s) and %d dropped, want %d and %d", len(a.lines), a.dropped, maxPending, overflow)
+	}
+	for i, l := range a.lines {
+		if want := fmt.Sprintf("line %d", i); l != want {
+			t.Fatalf("line %d = %q, want %q", i, l, want)
+		}
+	}
+}
+
+type nopWriter struct{}
+
+func (nopWriter) Write(p []byte) (int, error) { return len(p), nil }
@@ -0,0 +1,234 @@
+package messages
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/phase"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+)
+
+// Code identifies a user-facing message. Codes are stable: the agent UI keys its
+// translations on them and fills in the params, so renaming one is a breaking change.
+type Code string
+
+const (
+	RunSucceeded             Code = "run.succeeded"
+	RunSucceededWithWarnings Code = "run.succeeded_with_warnings"
+	RunFailed                Code = "run.failed"
+	RunStoppedBySignal       Code = "run.stopped.signal"
+	RunStoppedByTimeout      Code = "run.stopped.timeout"
+	RunStoppedByAgent        Code = "run.stopped.agent"
+	RunSuperseded            Code = "run.stopped.superseded"
+	RunDeferred              Code = "run.deferred"
+
+	ImageUnavailable   Code = "image.unavailable"
+	ServiceStartFailed Code = "service.start_failed"
+	ServiceStalled     Code = "service.stalled"
+	StepFailed         Code = "step.failed"
+	StepOutputsFailed  Code = "step.outputs_failed"
+	ResourceNotReady   Code = "resource.not_ready"
+	ResourceFailed     Code = "resource.failed"
+	ConnectionFailed   Code = "connection.failed"
+	NetworkFailed      Code = "network.failed"
+	VolumeFailed       Code = "volume.failed"
+	ConfigInvalid      Code = "config.invalid"
+	SecretUnavailable  Code = "secret.unavailable"
+	AgentUnreachable   Code = "agent.unreachable"
+	PlatformFailed     Code = "platform.failed"
+)
+
+// catalog holds the English text of every message. {name} is replaced by the
+// param of that name: any of runerr.Error's fields (job, run, service, phase, op,
+// target), "error" (the underlying cause) and "warnings" (a count).
+var catalog = map[Code]string{
+	RunSucceeded:             "The run finished.",
+	RunSucceededWithWarnings: "The run finished with {warnings} warning(s).",
+	RunFailed:                "The run failed: {error}",
+	RunStoppedBySignal:       "The run was stopped on the runner host.",
+	RunStoppedByTimeout:      "The {phase} phase took too long and was stopped.",
+	RunStoppedByAgent:        "The run was cancelled.",
+	RunSuperseded:            "The run was stopped because a newer run of the job took over.",
+	RunDeferred:              "The run was deferred: {error}",
+
+	ImageUnavailable:   "The image {target} for service {service} could not be pulled.",
+	ServiceStartFailed: "Service {service} could not be started: {error}",
+	ServiceStalled:     "Service {service} was not up within its progress deadline: {error}",
+	StepFailed:         "Step {service} failed: {error}",
+	StepOutputsFailed:  "The outputs of step {service} could not be read.",
+	ResourceNotReady:   "Service {service} is waiting for {target}, which is not ready.",
+	ResourceFailed:     "Resource {target} could not be registered with the agent.",
+	ConnectionFailed:   "Connection {target} could not be updated.",
+	NetworkFailed:      "Network {target} could not be set up.",
+	VolumeFailed:       "Volume {target} could not be set up.",
+	ConfigInvalid:      "The configuration of service {service} is invalid: {error}",
+	SecretUnavailable:  "A secret for {target} of service {service} could not be read: {error}",
+	AgentUnreachable:   "The agent could not be reached.",
+	PlatformFailed:     "The platform failed to {op} {target}: {error}",
+}
+
+// opCodes maps runerr operations to the message shown for them. Operations not
+// listed fall back to PlatformFailed.
+var opCodes = map[string]Code{
+	"pull image":    ImageUnavailable,
+	"parse image":   ImageUnavailable,
+	"inspect image": ImageUnavailable,
+
+	"create container":     ServiceStartFailed,
+	"start container":      ServiceStartFailed,
+	"wait for healthy":     ServiceStartFailed,
+	"wait for progress":    ServiceStalled,
+	"create task":          ServiceStartFailed,
+	"start task":           ServiceStartFailed,
+	"create swarm service": ServiceStartFailed,
+	"update swarm service": ServiceStartFailed,
+	"create ecs service":   ServiceStartFailed,
+	"update ecs service":   ServiceStartFailed,
+	"wait for ecs service": ServiceStartFailed,
+	"rename container":     ServiceStartFailed,
+
+	"run step":                 StepFailed,
+	"read outputs of step":     StepOutputsFailed,
+	"copy outputs of step":     StepOutputsFailed,
+	"provision ssh key":        StepFailed,
+	"provision files":          ServiceStartFailed,
+	"create swarm config":      ServiceStartFailed,
+	"resolve cache key":        ConfigInvalid,
+	"wait for resource":        ResourceNotReady,
+	"wait for resources":       ResourceNotReady,
+	"create resource":          ResourceFailed,
+	"delete resource":          ResourceFailed,
+	"list resources":           ResourceFailed,
+	"notify agent of teardown": AgentUnreachable,
+
+	"create connection":               ConnectionFailed,
+	"delete connection":               ConnectionFailed,
+	"remove connection":               ConnectionFailed,
+	"list connections":                ConnectionFailed,
+	"remove connections for resource": ConnectionFailed,
+	"expand connection metadata":      ConnectionFailed,
+
+	"create network":                   NetworkFailed,
+	"remove network":                   NetworkFailed,
+	"list networks":                    NetworkFailed,
+	"find platform connection network": NetworkFailed,
+	"create security group":            NetworkFailed,
+	"create cloud map service":         NetworkFailed,
+
+	"create volume":           VolumeFailed,
+	"inspect volume":          VolumeFailed,
+	"remove volume":           VolumeFailed,
+	"find volume":             VolumeFailed,
+	"mount volume":            VolumeFailed,
+	"list volumes":            VolumeFailed,
+	"create volume directory": VolumeFailed,
+	"remove volume directory": VolumeFailed,
+	"export volume":           VolumeFailed,
+	"import volume":           VolumeFailed,
+	"create volume helper":    VolumeFailed,
+	"seed volume":             VolumeFailed,
+	"checksum volume":         VolumeFailed,
+	"verify volume":           VolumeFailed,
+
+	"defer run": RunDeferred,
+	"claim run": RunSuperseded,
+	"fence run": RunSuperseded,
+
+	"resolve env":               ConfigInvalid,
+	"resolve secret":            SecretUnavailable,
+	"get secret":                SecretUnavailable,
+	"parse platform connection": ConfigInvalid,
+	"parse host_ip":             ConfigInvalid,
+	"parse restart":             ConfigInvalid,
+	"parse ipc":                 ConfigInvalid,
+	"parse devices":             ConfigInvalid,
+	"parse files":               ConfigInvalid,
+	"parse platform":            ConfigInvalid,
+	"parse security_opt":        ConfigInvalid,
+	"parse strategy":            ConfigInvalid,
+	"parse action":              ConfigInvalid,
+}
+
+var placeholder = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// Render fills in a message's text. Missing params render as empty strings.
+func Render(code Code, params map[string]string) string {
+	text, ok := catalog[code]
+	if !ok {
+		text = catalog[RunFailed]
+	}
+	return placeholder.ReplaceAllStringFunc(text, func(m string) string {
+		return params[m[1:len(m)-1]]
+	})
+}
+
+// Catalog lists every code with its English text, sorted by code.
+func Catalog() []models.UserMessage {
+	out := make([]models.UserMessage, 0, len(catalog))
+	for code, text := range catalog {
+		out = append(out, models.UserMessage{Code: string(code), Text: text})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
+
+// ForRun returns the message for how a run ended.
+func ForRun(outcome models.RunOutcome, warnings int, err error) models.UserMessage {
+	if err == nil {
+		if outcome == models.RunOutcomeSucceededWithWarnings {
+			return message(RunSucceededWithWarnings, map[string]string{"warnings": strconv.Itoa(warnings)})
+		}
+		return message(RunSucceeded, nil)
+	}
+
+	params := runerr.Fields(err)
+	if params == nil {
+		params = map[string]string{}
+	}
+	params["error"] = rootCause(err).Error()
+
+	var pe *phase.Error
+	if errors.As(err, &pe) && params["phase"] == "" {
+		params["phase"] = pe.Phase
+	}
+
+	switch cause := phase.Cause(err); {
+	case errors.Is(cause, phase.ErrSignal):
+		return message(RunStoppedBySignal, params)
+	case errors.Is(cause, phase.ErrTimeout):
+		return message(RunStoppedByTimeout, params)
+	case errors.Is(cause, phase.ErrAgentAbort):
+		return message(RunStoppedByAgent, params)
+	case errors.Is(cause, phase.ErrSuperseded):
+		return message(RunSuperseded, params)
+	}
+
+	if op, ok := params["op"]; ok {
+		if code, ok := opCodes[op]; ok {
+			return message(code, params)
+		}
+		return message(PlatformFailed, params)
+	}
+	return message(RunFailed, params)
+}
+
+func message(code Code, params map[string]string) models.UserMessage {
+	return models.UserMessage{Code: string(code), Params: params, Text: Render(code, params)}
+}
+
+// rootCause is the innermost error below the runerr and phase wrappers, which is
+// what the message text shows; the wrappers' context is already in the params.
+func rootCause(err error) error {
+	var re *runerr.Error
+	if errors.As(err, &re) {
+		return re.Err
+	}
+	var pe *phase.Error
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
@@ -0,0 +1,263 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// DefaultTimeout bounds a push when the configuration sets none.
+const DefaultTimeout = 10 * time.Second
+
+// Run is what gets pushed about one finished run.
+type Run struct {
+	Job      string
+	Run      string
+	Runner   string
+	Platform string
+	Action   string
+
+	Outcome  models.RunOutcome
+	Started  time.Time
+	Finished time.Time
+	Changed  bool
+	Warnings int
+	Services []models.ServiceTiming
+}
+
+// A sample is one metric value; every sample also carries the run's labels.
+type sample struct {
+	name   string
+	help   string
+	value  float64
+	labels map[string]string
+}
+
+func (r Run) samples() []sample {
+	changed := 0.0
+	if r.Changed {
+		changed = 1
+	}
+
+	out := []sample{
+		{name: "deploy_commander_run_duration_seconds", help: "Wall time of the run.", value: r.Finished.Sub(r.Started).Seconds()},
+		{name: "deploy_commander_run_completed_timestamp_seconds", help: "When the run finished, as a Unix timestamp.", value: float64(r.Finished.UnixNano()) / 1e9},
+		{name: "deploy_commander_run_changed", help: "1 if the run modified platform or agent state.", value: changed},
+		{name: "deploy_commander_run_warnings", help: "Number of warnings the run reported.", value: float64(r.Warnings)},
+		{name: "deploy_commander_run_outcome", help: "1 for the outcome the run ended with.", value: 1, labels: map[string]string{"outcome": string(r.Outcome)}},
+	}
+	for _, s := range r.Services {
+		out = append(out, sample{
+			name:   "deploy_commander_service_setup_seconds",
+			help:   "Setup time per service.",
+			value:  time.Duration(s.Duration).Seconds(),
+			labels: map[string]string{"service": s.Service},
+		})
+	}
+	return out
+}
+
+// labels are attached to every sample. Job and run are left to the grouping key
+// (pushgateway) or the resource (OTLP).
+func (r Run) labels() map[string]string {
+	return map[string]string{
+		"runner":   r.Runner,
+		"platform": r.Platform,
+		"action":   r.Action,
+	}
+}
+
+// Push sends the run's metrics with the configured protocol.
+func Push(ctx context.Context, cfg models.MetricsPush, r Run) error {
+	timeout := DefaultTimeout
+	if cfg.Timeout != nil {
+		timeout = time.Duration(*cfg.Timeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		method, target, contentType string
+		body                        []byte
+		err                         error
+	)
+	switch cfg.Protocol {
+	case models.MetricsProtocolPushgateway:
+		method, contentType = http.MethodPut, "text/plain; version=0.0.4"
+		target = pushgatewayURL(cfg.URL, r)
+		body = pushgatewayBody(r)
+	case models.MetricsProtocolOTLP:
+		method, contentType = http.MethodPost, "application/json"
+		target, err = otlpURL(cfg.URL)
+		if err != nil {
+			return err
+		}
+		body, err = otlpBody(r)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown metrics protocol %q", cfg.Protocol)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("push metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return fmt.Errorf("push metrics: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// pushgatewayURL groups the metrics by job and run, so every run keeps its own
+// series instead of overwriting the previous one.
+func pushgatewayURL(base string, r Run) string {
+	return fmt.Sprintf("%s/metrics/job/%s/run/%s",
+		strings.TrimRight(base, "/"), url.PathEscape(r.Job), url.PathEscape(r.Run))
+}
+
+// pushgatewayBody renders the samples in the Prometheus text exposition format.
+func pushgatewayBody(r Run) []byte {
+	var b bytes.Buffer
+	seen := map[string]bool{}
+	for _, s := range r.samples() {
+		if !seen[s.name] {
+			seen[s.name] = true
+			fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", s.name, s.help, s.name)
+		}
+		fmt.Fprintf(&b, "%s{%s} %g\n", s.name, promLabels(r.labels(), s.labels), s.value)
+	}
+	return b.Bytes()
+}
+
+func promLabels(sets ...map[string]string) string {
+	all := map[string]string{}
+	for _, set := range sets {
+		for k, v := range set {
+			all[k] = v
+		}
+	}
+	keys := make([]string, 0, len(all))
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, k, escape.Replace(all[k])))
+	}
+	return strings.Join(parts, ",")
+}
+
+// otlpURL appends the standard metrics path when the endpoint has none.
+func otlpURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("metrics url %q: %w", endpoint, err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+	return u.String(), nil
+}
+
+// The subset of the OTLP/JSON metrics request the runner sends: gauges only.
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+type otlpMetric struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Gauge       struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+func otlpAttributes(m map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]otlpAttribute, 0, len(keys))
+	for _, k := range keys {
+		a := otlpAttribute{Key: k}
+		a.Value.StringValue = m[k]
+		out = append(out, a)
+	}
+	return out
+}
+
+func otlpBody(r Run) ([]byte, error) {
+	ts := fmt.Sprint(r.Finished.UnixNano())
+
+	var metrics []*otlpMetric
+	byName := map[string]*otlpMetric{}
+	for _, s := range r.samples() {
+		m, ok := byName[s.name]
+		if !ok {
+			m = &otlpMetric{Name: s.name, Description: s.help}
+			if strings.HasSuffix(s.name, "_seconds") {
+				m.Unit = "s"
+			}
+			byName[s.name] = m
+			metrics = append(metrics, m)
+		}
+		m.Gauge.DataPoints = append(m.Gauge.DataPoints, otlpDataPoint{
+			Attributes:   otlpAttributes(s.labels),
+			TimeUnixNano: ts,
+			AsDouble:     s.value,
+		})
+	}
+
+	resource := r.labels()
+	resource["service.name"] = "deploy-commander-runner"
+	resource["deploy_commander.job"] = r.Job
+	resource["deploy_commander.run"] = r.Run
+
+	return json.Marshal(map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource": map[string]any{"attributes": otlpAttributes(resource)},
+			"scopeMetrics": []any{map[string]any{
+				"scope":   map[string]any{"name": "github.com/ezenkico/deploy-commander/runner"},
+				"metrics": metrics,
+			}},
+		}},
+	})
+}
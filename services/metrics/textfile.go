@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Gauge is one sample written by Text.
+type Gauge struct {
+	Name   string
+	Help   string
+	Value  float64
+	Labels map[string]string
+}
+
+// Text renders gauges in the Prometheus text exposition format. A metric's
+// samples are grouped under its HELP and TYPE, in the order it first appears.
+func Text(gauges []Gauge) []byte {
+	var order []string
+	byName := map[string][]Gauge{}
+	for _, g := range gauges {
+		if _, ok := byName[g.Name]; !ok {
+			order = append(order, g.Name)
+		}
+		byName[g.Name] = append(byName[g.Name], g)
+	}
+
+	var b bytes.Buffer
+	for _, name := range order {
+		samples := byName[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, samples[0].Help, name)
+		for _, g := range samples {
+			if len(g.Labels) == 0 {
+				fmt.Fprintf(&b, "%s %g\n", name, g.Value)
+				continue
+			}
+			fmt.Fprintf(&b, "%s{%s} %g\n", name, promLabels(g.Labels), g.Value)
+		}
+	}
+	return b.Bytes()
+}
+
+// WriteTextfile writes gauges to path for node-exporter's textfile collector.
+// The collector may read at any time, so the file is replaced in one rename.
+func WriteTextfile(path string, gauges []Gauge) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create textfile dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("write textfile: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(Text(gauges)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write textfile: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write textfile: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write textfile: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write textfile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package noop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/docker"
+	"github.com/ezenkico/deploy-commander/runner/services/plan"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/validate"
+)
+
+// NoopPlatform runs every metadata check the Docker platform would and prints the
+// containers, networks and volumes it would create, without Docker or the agent.
+// It is meant for validating generated configurations in CI.
+type NoopPlatform struct {
+	out    io.Writer
+	result models.RunResult
+}
+
+func NewNoopPlatform(out io.Writer) *NoopPlatform {
+	return &NoopPlatform{out: out}
+}
+
+// Capabilities are Docker's, since that is what the checks and names simulate.
+func (p *NoopPlatform) Capabilities() models.PlatformCapabilities {
+	caps := (&docker.DockerPlatform{}).Capabilities()
+	caps.Platform = "noop"
+	return caps
+}
+
+func (p *NoopPlatform) warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("warning: %s", msg)
+	p.result.Warnings = append(p.result.Warnings, msg)
+}
+
+// Run checks the configuration and prints what it would do. It never reports changes.
+func (p *NoopPlatform) Run(ctx context.Context, config models.Configuration) (models.RunResult, error) {
+	p.result = models.RunResult{}
+	job := config.Job.String()
+
+	var errs []error
+	for _, f := range validate.Configuration(config) {
+		if f.Severity == validate.SeverityError {
+			errs = append(errs, errors.New(f.String()))
+		} else {
+			p.warn("%s", f)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return p.result, err
+	}
+
+	if config.Action == models.ActionTeardown {
+		fmt.Fprintf(p.out, "noop: would remove every container, volume, network and connection of job %s\n", job)
+		return p.result, nil
+	}
+
+	md := config.Metadata
+	if md == nil {
+		fmt.Fprintln(p.out, "noop: no metadata, nothing to do")
+		return p.result, nil
+	}
+
+	// The same checks as docker.CheckMetadata, minus the daemon lookups.
+	if err := platforms.CheckDependsOnServicesExist(md.Services); err != nil {
+		return p.result, err
+	}
+	if err := platforms.CheckCircularDependencies(md.Services); err != nil {
+		return p.result, err
+	}
+	declared, err := platforms.DeclaredVolumeSet(md.Volumes)
+	if err != nil {
+		return p.result, err
+	}
+	stragglers, err := platforms.CheckServiceVolumeMounts(md.Services, declared)
+	if err != nil {
+		return p.result, err
+	}
+	for _, name := range sortedKeys(*stragglers) {
+		p.warn("volume %q is not declared in metadata.volumes; it must already exist as %s", name, docker.DockerVolumeName(job, name))
+	}
+
+	order, err := plan.ServiceOrder(md.Services)
+	if err != nil {
+		return p.result, err
+	}
+
+	if md.Volumes != nil {
+		for _, v := range *md.Volumes {
+			if src, ok := md.VolumeSources[v]; ok {
+				fmt.Fprintf(p.out, "noop: would create volume %s (filled from %s of %s)\n", docker.DockerVolumeName(job, v), src.Path, src.Image)
+				continue
+			}
+			fmt.Fprintf(p.out, "noop: would create volume %s\n", docker.DockerVolumeName(job, v))
+		}
+	}
+
+	networks := map[string]struct{}{}
+	for _, name := range order {
+		svc := md.Services[name]
+		isRunner := platforms.IsRunnerRole(&svc)
+
+		var nets []string
+		if svc.NetworkGroups != nil {
+			for _, g := range *svc.NetworkGroups {
+				nets = append(nets, docker.DockerNetworkName(job, g))
+			}
+		}
+		if svc.Resources != nil && !isRunner {
+			for _, r := range *svc.Resources {
+				nets = append(nets, docker.DockerNetworkResourceName(job, r.Name))
+			}
+		}
+		if len(nets) == 0 {
+			nets = append(nets, job)
+		}
+		for _, n := range nets {
+			if _, ok := networks[n]; !ok {
+				networks[n] = struct{}{}
+				fmt.Fprintf(p.out, "noop: would create network %s\n", n)
+			}
+		}
+
+		verb := "create container"
+		if isRunner {
+			verb = "run step"
+		}
+		fmt.Fprintf(p.out, "noop: would %s %s (image %s, networks %s%s)\n",
+			verb, docker.DockerServiceName(job, name), svc.Image, strings.Join(nets, ", "), describePorts(svc.Bindings))
+	}
+
+	if md.RemoveServices != nil {
+		for _, name := range *md.RemoveServices {
+			fmt.Fprintf(p.out, "noop: would remove container %s\n", docker.DockerServiceName(job, name))
+		}
+	}
+	if md.RemoveVolumes != nil {
+		for _, name := range *md.RemoveVolumes {
+			fmt.Fprintf(p.out, "noop: would remove volume %s\n", docker.DockerVolumeName(job, name))
+		}
+	}
+	if cp := md.Connections; cp != nil {
+		if cp.Create != nil && len(*cp.Create) > 0 {
+			fmt.Fprintf(p.out, "noop: would create %d connection(s)\n", len(*cp.Create))
+		}
+		if cp.Remove != nil && len(*cp.Remove) > 0 {
+			fmt.Fprintf(p.out, "noop: would remove %d connection(s)\n", len(*cp.Remove))
+		}
+	}
+
+	return p.result, nil
+}
+
+func describePorts(bindings *[]models.BindingSpec) string {
+	if bindings == nil {
+		return ""
+	}
+	var ports []string
+	for _, b := range *bindings {
+		if b.ContainerPort == nil || b.HostPort == nil {
+			continue
+		}
+		host := ""
+		if b.HostIP != nil {
+			host = *b.HostIP + ":"
+		}
+		ports = append(ports, fmt.Sprintf("%s%d->%d", host, *b.HostPort, *b.ContainerPort))
+	}
+	if len(ports) == 0 {
+		return ""
+	}
+	return ", ports " + strings.Join(ports, ", ")
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,16 @@
+package noop
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/ezenkico/deploy-commander/runner/interfaces"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+)
+
+func init() {
+	platforms.Register("noop", func(_ *agent.AgentCommunication, _ *json.RawMessage) (interfaces.Platform, error) {
+		return NewNoopPlatform(os.Stdout), nil
+	})
+}
@@ -0,0 +1,242 @@
+package override
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// Apply sets each override on md. Paths use a strict syntax, checked against the
+// metadata schema before anything is changed:
+//
+//	services.web.image
+//	services.web.environment.LOG_LEVEL
+//	services.web.environment["log.level"]   (keys with other characters are quoted)
+//	services.web.bindings[0].host_port
+//
+// Paths must name an existing service and existing list elements; only maps
+// below a service (environment) may gain new keys. Values are JSON and must fit
+// the field's type. Overrides are applied in path order.
+func Apply(md *models.Metadata, overrides map[string]json.RawMessage) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	if md == nil {
+		return fmt.Errorf("overrides: no metadata to override")
+	}
+
+	var doc any
+	b, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(overrides))
+	for p := range overrides {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		segs, err := Parse(p)
+		if err != nil {
+			return fmt.Errorf("override %q: %w", p, err)
+		}
+		if err := check(reflect.TypeOf(models.Metadata{}), segs); err != nil {
+			return fmt.Errorf("override %q: %w", p, err)
+		}
+
+		var value any
+		vdec := json.NewDecoder(bytes.NewReader(overrides[p]))
+		vdec.UseNumber()
+		if err := vdec.Decode(&value); err != nil {
+			return fmt.Errorf("override %q: value: %w", p, err)
+		}
+		if doc, err = set(doc, segs, value, true); err != nil {
+			return fmt.Errorf("override %q: %w", p, err)
+		}
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var result models.Metadata
+	strict := json.NewDecoder(bytes.NewReader(out))
+	strict.DisallowUnknownFields()
+	if err := strict.Decode(&result); err != nil {
+		return fmt.Errorf("overrides: %w", err)
+	}
+	*md = result
+	return nil
+}
+
+// A Segment is one step of an override path: a key, or an index when Index >= 0.
+type Segment struct {
+	Key   string
+	Index int
+}
+
+var (
+	bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+`)
+	index   = regexp.MustCompile(`^\[([0-9]+)\]`)
+	quoted  = regexp.MustCompile(`^\["((?:[^"\\]|\\.)*)"\]`)
+)
+
+// Parse splits an override path into segments.
+func Parse(path string) ([]Segment, error) {
+	var segs []Segment
+	rest := path
+	for first := true; rest != ""; first = false {
+		switch {
+		case strings.HasPrefix(rest, "["):
+			if m := index.FindStringSubmatch(rest); m != nil {
+				i, err := strconv.Atoi(m[1])
+				if err != nil {
+					return nil, err
+				}
+				segs = append(segs, Segment{Index: i})
+				rest = rest[len(m[0]):]
+				continue
+			}
+			m := quoted.FindStringSubmatch(rest)
+			if m == nil {
+				return nil, fmt.Errorf("bad bracket at %q (use [n] or [\"key\"])", rest)
+			}
+			key, err := strconv.Unquote(`"` + m[1] + `"`)
+			if err != nil {
+				return nil, fmt.Errorf("bad quoted key %q", m[1])
+			}
+			segs = append(segs, Segment{Key: key, Index: -1})
+			rest = rest[len(m[0]):]
+		default:
+			if !first {
+				if !strings.HasPrefix(rest, ".") {
+					return nil, fmt.Errorf("expected . or [ at %q", rest)
+				}
+				rest = rest[1:]
+			}
+			key := bareKey.FindString(rest)
+			if key == "" {
+				return nil, fmt.Errorf("expected a key at %q", rest)
+			}
+			segs = append(segs, Segment{Key: key, Index: -1})
+			rest = rest[len(key):]
+		}
+	}
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	return segs, nil
+}
+
+// check walks the Go type of the metadata to reject paths the schema cannot hold.
+func check(t reflect.Type, segs []Segment) error {
+	for i, s := range segs {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			if s.Index >= 0 {
+				return fmt.Errorf("segment %d: cannot index an object", i)
+			}
+			f, ok := fieldByJSONName(t, s.Key)
+			if !ok {
+				return fmt.Errorf("segment %d: unknown field %q", i, s.Key)
+			}
+			t = f.Type
+		case reflect.Map:
+			if s.Index >= 0 {
+				return fmt.Errorf("segment %d: cannot index a map", i)
+			}
+			t = t.Elem()
+		case reflect.Slice:
+			if s.Index < 0 {
+				return fmt.Errorf("segment %d: %q on a list (use [n])", i, s.Key)
+			}
+			t = t.Elem()
+		default:
+			return fmt.Errorf("segment %d: %s is not an object or list", i, t)
+		}
+	}
+	return nil
+}
+
+func fieldByJSONName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == name && tag != "-" {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// set stores value at segs inside node. Missing object fields are created, but a
+// service name must already exist so a typo cannot deploy a new service.
+func set(node any, segs []Segment, value any, root bool) (any, error) {
+	if len(segs) == 0 {
+		return value, nil
+	}
+	s := segs[0]
+
+	if s.Index >= 0 {
+		list, ok := node.([]any)
+		if !ok || s.Index >= len(list) {
+			return nil, fmt.Errorf("index %d is out of range", s.Index)
+		}
+		v, err := set(list[s.Index], segs[1:], value, false)
+		if err != nil {
+			return nil, err
+		}
+		list[s.Index] = v
+		return list, nil
+	}
+
+	obj, ok := node.(map[string]any)
+	if node == nil {
+		obj, ok = map[string]any{}, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("%q: parent is not an object", s.Key)
+	}
+	child := obj[s.Key]
+	if root && s.Key == "services" {
+		if len(segs) < 3 {
+			return nil, fmt.Errorf("override a field of a service, not the services map or a whole service")
+		}
+		svcs, _ := child.(map[string]any)
+		name := segs[1].Key
+		svc, found := svcs[name]
+		if !found {
+			return nil, fmt.Errorf("service %q is not defined", name)
+		}
+		v, err := set(svc, segs[2:], value, false)
+		if err != nil {
+			return nil, err
+		}
+		svcs[name] = v
+		return obj, nil
+	}
+
+	v, err := set(child, segs[1:], value, false)
+	if err != nil {
+		return nil, err
+	}
+	obj[s.Key] = v
+	return obj, nil
+}
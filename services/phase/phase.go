@@ -0,0 +1,138 @@
+package phase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/services/progress"
+)
+
+// Phase names for the stages of a run.
+const (
+	Check       = "check"
+	Volumes     = "volumes"
+	Services    = "services"
+	Removals    = "removals"
+	Connections = "connections"
+	Teardown    = "teardown"
+)
+
+// Names lists every known phase in execution order.
+var Names = []string{Check, Volumes, Services, Removals, Connections, Teardown}
+
+// Cancellation causes. These are attached to contexts with the *Cause
+// variants of the context package so the final error can say *why* a run stopped.
+var (
+	ErrSignal     = errors.New("received termination signal")
+	ErrTimeout    = errors.New("phase deadline exceeded")
+	ErrAgentAbort = errors.New("run aborted by agent")
+	ErrSuperseded = errors.New("run superseded by a newer run of the job")
+)
+
+// Info is the phase metadata carried by a phase context.
+type Info struct {
+	Name     string
+	Started  time.Time
+	Deadline time.Time // zero when the phase has no deadline
+}
+
+type infoKey struct{}
+
+// FromContext returns the phase metadata of the innermost phase context.
+func FromContext(ctx context.Context) (Info, bool) {
+	info, ok := ctx.Value(infoKey{}).(Info)
+	return info, ok
+}
+
+// Error is returned by Run when a phase fails.
+// Cause is set when the phase context was cancelled (signal, deadline, agent abort).
+type Error struct {
+	Phase string
+	Cause error
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s phase cancelled (%v): %v", e.Phase, e.Cause, e.Err)
+	}
+	return fmt.Sprintf("%s phase: %v", e.Phase, e.Err)
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Cause != nil {
+		return []error{e.Err, e.Cause}
+	}
+	return []error{e.Err}
+}
+
+// Cause reports which cancellation cause (ErrSignal, ErrTimeout, ErrAgentAbort,
+// ErrSuperseded) stopped a run, or nil if err is not a cancellation.
+func Cause(err error) error {
+	for _, c := range []error{ErrSignal, ErrTimeout, ErrAgentAbort, ErrSuperseded} {
+		if errors.Is(err, c) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Timeouts parses per-phase deadlines (e.g. {"services": "10m"}).
+// Unknown phase names and non-positive durations are rejected.
+func Timeouts(raw map[string]string) (map[string]time.Duration, error) {
+	out := make(map[string]time.Duration, len(raw))
+	for name, v := range raw {
+		if !slices.Contains(Names, name) {
+			return nil, fmt.Errorf("phase_timeouts: unknown phase %q (valid: %v)", name, Names)
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("phase_timeouts.%s: %w", name, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("phase_timeouts.%s must be positive, got %q", name, v)
+		}
+		out[name] = d
+	}
+	return out, nil
+}
+
+// Run executes fn in a child context of ctx that carries the phase metadata.
+// If timeout > 0 the child context is cancelled with ErrTimeout once it elapses.
+func Run(ctx context.Context, name string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	// Don't start a new phase if the run is already cancelled.
+	if ctx.Err() != nil {
+		return &Error{Phase: name, Cause: context.Cause(ctx), Err: ctx.Err()}
+	}
+
+	info := Info{Name: name, Started: time.Now()}
+
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		info.Deadline = info.Started.Add(timeout)
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w: %s phase exceeded %s", ErrTimeout, name, timeout))
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	ctx = context.WithValue(ctx, infoKey{}, info)
+
+	rep := progress.From(ctx)
+	rep.PhaseStarted(name)
+
+	err := fn(ctx)
+	if err != nil {
+		perr := &Error{Phase: name, Err: err}
+		if ctx.Err() != nil {
+			perr.Cause = context.Cause(ctx)
+		}
+		err = perr
+	}
+
+	rep.PhaseFinished(name, time.Since(info.Started), err)
+	return err
+}
@@ -0,0 +1,207 @@
+package plan
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/phase"
+)
+
+// Build computes the ordered operations a run will perform. The same configuration
+// always produces the same plan (map keys are visited in sorted order).
+func Build(cfg models.Configuration) (*models.Plan, error) {
+	p := &models.Plan{Job: cfg.Job, Run: cfg.Run, Action: cfg.Action, Operations: []models.PlanOperation{}}
+
+	add := func(ph, op, target string, inputs any) error {
+		var raw json.RawMessage
+		if inputs != nil {
+			b, err := json.Marshal(inputs)
+			if err != nil {
+				return fmt.Errorf("plan %s %q: %w", op, target, err)
+			}
+			raw = b
+		}
+		p.Operations = append(p.Operations, models.PlanOperation{
+			Seq:    len(p.Operations) + 1,
+			Phase:  ph,
+			Op:     op,
+			Target: target,
+			Inputs: raw,
+		})
+		return nil
+	}
+
+	if cfg.Action == models.ActionTeardown {
+		if err := add(phase.Teardown, "teardown", cfg.Job.String(), nil); err != nil {
+			return nil, err
+		}
+		return p, sum(p)
+	}
+
+	md := cfg.Metadata
+	if md == nil {
+		return p, sum(p)
+	}
+
+	if md.Volumes != nil {
+		for _, v := range *md.Volumes {
+			if err := add(phase.Volumes, "create_volume", v, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	order, err := ServiceOrder(md.Services)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range order {
+		svc := md.Services[name]
+		if err := add(phase.Services, "setup_service", name, svc); err != nil {
+			return nil, err
+		}
+	}
+
+	if md.RemoveServices != nil {
+		for _, name := range *md.RemoveServices {
+			if err := add(phase.Removals, "remove_service", name, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if md.RemoveVolumes != nil {
+		for _, name := range *md.RemoveVolumes {
+			if err := add(phase.Removals, "remove_volume", name, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cp := md.Connections; cp != nil {
+		if cp.Create != nil {
+			for _, spec := range *cp.Create {
+				if err := add(phase.Connections, "create_connection", refTarget(spec.Resource), spec); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if cp.Remove != nil {
+			for _, spec := range *cp.Remove {
+				target := ""
+				if spec.Resource != nil {
+					target = refTarget(*spec.Resource)
+				}
+				if err := add(phase.Connections, "remove_connection", target, spec); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return p, sum(p)
+}
+
+// ServiceOrder returns service names in launch order: in passes of services whose
+// dependencies are all earlier, sorted by name within a pass.
+func ServiceOrder(services map[string]models.MetadataService) ([]string, error) {
+	pending := make([]string, 0, len(services))
+	for name := range services {
+		pending = append(pending, name)
+	}
+	slices.Sort(pending)
+
+	order := make([]string, 0, len(services))
+	placed := make(map[string]struct{}, len(services))
+	for len(pending) > 0 {
+		var next, wait []string
+		for _, name := range pending {
+			ready := true
+			if deps := services[name].DependsOn; deps != nil {
+				for _, dep := range *deps {
+					if _, ok := placed[dep]; !ok {
+						ready = false
+						break
+					}
+				}
+			}
+			if ready {
+				next = append(next, name)
+			} else {
+				wait = append(wait, name)
+			}
+		}
+		if len(next) == 0 {
+			return nil, fmt.Errorf("cannot order services %v: unresolved or circular depends_on", wait)
+		}
+		for _, name := range next {
+			placed[name] = struct{}{}
+		}
+		order = append(order, next...)
+		pending = wait
+	}
+
+	return order, nil
+}
+
+func refTarget(ref models.ResourceRef) string {
+	switch {
+	case ref.ID != nil:
+		return ref.ID.String()
+	case ref.Service != nil && ref.Name != nil:
+		return *ref.Service + "/" + *ref.Name
+	case ref.Name != nil:
+		return *ref.Name
+	}
+	return ""
+}
+
+// sum sets the plan digest over everything except Digest and Signature.
+func sum(p *models.Plan) error {
+	p.Digest, p.Signature = "", ""
+	b, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("marshal plan: %w", err)
+	}
+	d := sha256.Sum256(b)
+	p.Digest = hex.EncodeToString(d[:])
+	return nil
+}
+
+// Sign sets the plan signature (HMAC-SHA256 of the digest). An empty key leaves the plan unsigned.
+func Sign(p *models.Plan, key []byte) {
+	if len(key) == 0 {
+		return
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(p.Digest))
+	p.Signature = hex.EncodeToString(mac.Sum(nil))
+}
+
+// Save writes the plan to {workspace}/plans/{run}.json atomically and returns the path.
+func Save(workspace string, p *models.Plan) (string, error) {
+	path := filepath.Join(workspace, "plans", p.Run.String()+".json")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("create plan dir: %w", err)
+	}
+
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return "", fmt.Errorf("write plan %s: %w", p.Run, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("write plan %s: %w", p.Run, err)
+	}
+	return path, nil
+}
@@ -0,0 +1,83 @@
+package platforms
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+	"github.com/ezenkico/deploy-commander/runner/services/template"
+)
+
+// Size a job's caches may reach before the least recently used are evicted,
+// unless the runner sets RUNNER_CACHE_LIMIT.
+const defaultCacheLimit = 10 << 30
+
+// CacheID names a cache by its key, which is free-form and may be long.
+func CacheID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// CacheKey resolves a cache's key against the outputs of earlier steps.
+func CacheKey(c models.CacheMount, lookup template.Lookup) (string, error) {
+	key, err := template.Interpolate(c.Key, lookup)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(key) == "" {
+		return "", fmt.Errorf("cache key %q is empty", c.Key)
+	}
+	return key, nil
+}
+
+// CacheLimit returns RUNNER_CACHE_LIMIT (e.g. "20Gi"), or the default.
+func CacheLimit() (int64, error) {
+	v := strings.TrimSpace(os.Getenv("RUNNER_CACHE_LIMIT"))
+	if v == "" {
+		return defaultCacheLimit, nil
+	}
+	size, err := models.ParseByteSize(v)
+	if err != nil {
+		return 0, fmt.Errorf("RUNNER_CACHE_LIMIT: %w", err)
+	}
+	return int64(size), nil
+}
+
+// TouchCache records that a cache was mounted now.
+func TouchCache(st *state.JobState, key string) {
+	if st.Caches == nil {
+		st.Caches = map[string]time.Time{}
+	}
+	st.Caches[key] = time.Now().UTC()
+}
+
+// EvictCaches picks the caches to remove, least recently used first, until the
+// rest fit in limit. Caches used since the run started are never picked.
+func EvictCaches(sizes map[string]int64, lastUsed map[string]time.Time, since time.Time, limit int64) []string {
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	keys := slices.SortedFunc(maps.Keys(sizes), func(a, b string) int {
+		return lastUsed[a].Compare(lastUsed[b])
+	})
+	var out []string
+	for _, key := range keys {
+		if total <= limit {
+			break
+		}
+		if !lastUsed[key].Before(since) {
+			continue
+		}
+		out = append(out, key)
+		total -= sizes[key]
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package platforms
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Detection is the platform Detect picked and why.
+type Detection struct {
+	Platform string
+	Data     *json.RawMessage // platform_data to use when the configuration has none
+	Found    string           // what was found, for the log
+}
+
+// Detect picks a platform for configurations that don't name one. It probes, in
+// order, and takes the first that is present:
+//
+//  1. Docker: DOCKER_HOST, or the socket at /var/run/docker.sock
+//  2. Podman: CONTAINER_HOST, or a Podman socket (rootless, then rootful), used
+//     through the docker platform since Podman serves the same API
+//  3. Kubernetes: KUBECONFIG, ~/.kube/config or an in-cluster service account,
+//     if a "kubernetes" platform is compiled in
+func Detect() (Detection, error) {
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		return Detection{Platform: "docker", Found: "DOCKER_HOST=" + host}, nil
+	}
+	if isSocket("/var/run/docker.sock") {
+		return Detection{Platform: "docker", Found: "Docker socket /var/run/docker.sock"}, nil
+	}
+
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return podman(host, "CONTAINER_HOST="+host), nil
+	}
+	for _, path := range podmanSockets() {
+		if isSocket(path) {
+			return podman("unix://"+path, "Podman socket "+path), nil
+		}
+	}
+
+	if found := kubeconfig(); found != "" {
+		if registered("kubernetes") {
+			return Detection{Platform: "kubernetes", Found: found}, nil
+		}
+		return Detection{}, errors.New("platform is not set and only " + found + " was found, but no kubernetes platform is compiled in (registered: " + strings.Join(Names(), ", ") + ")")
+	}
+
+	return Detection{}, errors.New("platform is not set and no Docker socket, Podman socket or kubeconfig was found")
+}
+
+func podman(host, found string) Detection {
+	b, _ := json.Marshal(map[string]string{"host": host})
+	data := json.RawMessage(b)
+	return Detection{Platform: "docker", Data: &data, Found: found}
+}
+
+// podmanSockets lists where Podman's API socket lives: the rootless one for the
+// current user first, then the system one.
+func podmanSockets() []string {
+	var paths []string
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "podman", "podman.sock"))
+	}
+	return append(paths, "/run/podman/podman.sock")
+}
+
+// kubeconfig describes the Kubernetes credentials found, or returns "".
+func kubeconfig() string {
+	if v := os.Getenv("KUBECONFIG"); v != "" {
+		for _, path := range filepath.SplitList(v) {
+			if fileExists(path) {
+				return "kubeconfig " + path
+			}
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if path := filepath.Join(home, ".kube", "config"); fileExists(path) {
+			return "kubeconfig " + path
+		}
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" && fileExists("/var/run/secrets/kubernetes.io/serviceaccount/token") {
+		return "in-cluster service account"
+	}
+	return ""
+}
+
+func registered(name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := factories[name]
+	return ok
+}
+
+func isSocket(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode()&os.ModeSocket != 0
+}
+
+func fileExists(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
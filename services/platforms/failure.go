@@ -0,0 +1,75 @@
+package platforms
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+)
+
+// ErrStalled is the cause of a service setup cut off by its progress_deadline.
+var ErrStalled = errors.New("progress_deadline exceeded")
+
+// WithProgressDeadline bounds setting up the service by its progress_deadline,
+// if it has one. Once it passes, context.Cause of the returned context is ErrStalled.
+func WithProgressDeadline(ctx context.Context, service *models.MetadataService) (context.Context, context.CancelFunc) {
+	if service.ProgressDeadline == nil {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, time.Duration(*service.ProgressDeadline), ErrStalled)
+}
+
+// IsStalled reports whether a service setup run under sctx, derived from ctx,
+// was cut off by its progress_deadline rather than by the run ending.
+func IsStalled(ctx, sctx context.Context) bool {
+	return errors.Is(context.Cause(sctx), ErrStalled) && ctx.Err() == nil
+}
+
+// StallError reports which service stalled, with detail such as its last logs
+// (may be empty).
+func StallError(ctx context.Context, name string, service *models.MetadataService, detail string) error {
+	return runerr.Errorf(ctx, "wait for progress", name, "no progress within progress_deadline %s%s", time.Duration(*service.ProgressDeadline), detail)
+}
+
+// rollbackError marks a service failure whose on_failure asks for the run to be
+// rolled back.
+type rollbackError struct{ error }
+
+func (e rollbackError) Unwrap() error { return e.error }
+
+// FailService applies the service's on_failure to err. It returns the error that
+// ends the run, or nil under continue and ignore, after which warn has recorded
+// the failure and the caller skips the service's dependents (see Blocker).
+func FailService(name string, service *models.MetadataService, err error, warn func(format string, args ...any)) error {
+	switch policy := service.FailurePolicy(); policy {
+	case models.FailurePolicyContinue, models.FailurePolicyIgnore:
+		warn("service %q failed and was left out (on_failure: %s): %v", name, policy, err)
+		return nil
+	case models.FailurePolicyRollback:
+		return rollbackError{err}
+	default:
+		return err
+	}
+}
+
+// RollbackRequested reports whether err asks for the run to be rolled back (see FailService).
+func RollbackRequested(err error) bool {
+	var r rollbackError
+	return errors.As(err, &r)
+}
+
+// Blocker returns the first service in failed the service depends on, or "".
+// Services failed under ignore are never put in failed, so block nothing.
+func Blocker(service *models.MetadataService, failed map[string]bool) string {
+	if service.DependsOn == nil {
+		return ""
+	}
+	for _, dep := range *service.DependsOn {
+		if failed[dep] {
+			return dep
+		}
+	}
+	return ""
+}
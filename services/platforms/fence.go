@@ -0,0 +1,31 @@
+package platforms
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ezenkico/deploy-commander/runner/services/phase"
+)
+
+// Generation returns the run generation recorded in labels under key, or 0 if
+// there is none (objects created before generations were recorded).
+func Generation(labels map[string]string, key string) int64 {
+	g, err := strconv.ParseInt(labels[key], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return g
+}
+
+// Fence refuses to replace an object a newer run created: a run of generation
+// generation may only touch objects whose labels record the same or an older
+// one. A generation of 0 (the run has none) is never fenced.
+func Fence(labels map[string]string, key string, generation int64) error {
+	if generation == 0 {
+		return nil
+	}
+	if g := Generation(labels, key); g > generation {
+		return fmt.Errorf("%w: created by generation %d, this run is generation %d", phase.ErrSuperseded, g, generation)
+	}
+	return nil
+}
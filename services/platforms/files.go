@@ -0,0 +1,37 @@
+package platforms
+
+import (
+	"context"
+	"io/fs"
+	"path"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+)
+
+// File is one of a service's files, decoded.
+type File struct {
+	Path    string
+	Mode    fs.FileMode
+	Content []byte
+}
+
+// Files decodes a service's files.
+func Files(ctx context.Context, serviceName string, service *models.MetadataService) ([]File, error) {
+	out := make([]File, 0, len(service.Files))
+	for _, f := range service.Files {
+		if !path.IsAbs(f.Path) {
+			return nil, runerr.Errorf(ctx, "parse files", serviceName, "file path %q must be absolute", f.Path)
+		}
+		data, err := f.Data()
+		if err != nil {
+			return nil, runerr.Wrap(ctx, "parse files", serviceName, err)
+		}
+		mode, err := f.FileMode()
+		if err != nil {
+			return nil, runerr.Wrap(ctx, "parse files", serviceName, err)
+		}
+		out = append(out, File{Path: path.Clean(f.Path), Mode: mode, Content: data})
+	}
+	return out, nil
+}
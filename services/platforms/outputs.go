@@ -0,0 +1,71 @@
+package platforms
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Runner-role steps get the runner volume mounted here and write their outputs
+// (key=value lines) to the file named by DC_OUTPUTS.
+const RunnerVolumeMountPath = "/deploy-commander"
+
+// StepOutputsPath is where a step writes its outputs, inside its container.
+func StepOutputsPath(run uuid.UUID, step string) string {
+	return path.Join(RunnerVolumeMountPath, "outputs", run.String(), step+".env")
+}
+
+// ParseStepOutputs parses key=value lines. Blank lines and lines starting with # are ignored.
+func ParseStepOutputs(r io.Reader) (map[string]string, error) {
+	out := map[string]string{}
+
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		k, v, ok := strings.Cut(text, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("outputs line %d: expected key=value, got %q", line, text)
+		}
+		out[k] = v
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// LookupStepOutput resolves a steps.<name>.outputs.<key> reference against the
+// outputs of steps that already ran, keyed by step name. It is an Interpolate lookup.
+func LookupStepOutput(stepOutputs map[string]map[string]string, ref string) (string, bool, error) {
+	rest, ok := strings.CutPrefix(ref, "steps.")
+	if !ok {
+		return "", false, nil
+	}
+
+	step, key, ok := strings.Cut(rest, ".outputs.")
+	if !ok || step == "" || key == "" {
+		return "", false, fmt.Errorf("invalid step output reference ${%s} (want ${steps.<name>.outputs.<key>})", ref)
+	}
+
+	outputs, ok := stepOutputs[step]
+	if !ok {
+		return "", false, fmt.Errorf("${%s}: step %q has not run (add it to depends_on)", ref, step)
+	}
+	v, ok := outputs[key]
+	if !ok {
+		return "", false, fmt.Errorf("${%s}: step %q has no output %q", ref, step, key)
+	}
+	return v, true, nil
+}
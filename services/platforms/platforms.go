@@ -0,0 +1,62 @@
+package platforms
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ezenkico/deploy-commander/runner/interfaces"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+)
+
+// A Factory builds a platform for one run. comm is nil when the runner has no
+// agent; data is the configuration's platform_data and may be nil.
+type Factory func(comm *agent.AgentCommunication, data *json.RawMessage) (interfaces.Platform, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{}
+)
+
+// Register makes a platform available under name. Platform packages call it from
+// init, so compiling a platform in only takes a blank import. Registering a name
+// twice panics.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if factory == nil {
+		panic("platforms: Register factory is nil for " + name)
+	}
+	if _, dup := factories[name]; dup {
+		panic("platforms: Register called twice for " + name)
+	}
+	factories[name] = factory
+}
+
+// New builds the platform registered under name.
+func New(name string, comm *agent.AgentCommunication, data *json.RawMessage) (interfaces.Platform, error) {
+	mu.RLock()
+	factory, ok := factories[name]
+	mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%q is not a valid platform (registered: %s)", name, strings.Join(Names(), ", "))
+	}
+	return factory(comm, data)
+}
+
+// Names lists the registered platforms in sorted order.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,71 @@
+package platforms
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/template"
+)
+
+// RecordServiceTiming stores how long a service took to set up in result and
+// warns when it went over its deploy_budget.
+func RecordServiceTiming(result *models.RunResult, warn func(format string, args ...any), name string, service *models.MetadataService, took time.Duration) {
+	timing := models.ServiceTiming{
+		Service:  name,
+		Duration: models.Duration(took),
+		Budget:   service.DeployBudget,
+	}
+	if service.DeployBudget != nil && took > time.Duration(*service.DeployBudget) {
+		timing.OverBudget = true
+		warn("service %q took %s, over its deploy_budget of %s", name, took.Round(time.Millisecond), time.Duration(*service.DeployBudget))
+	}
+	result.Services = append(result.Services, timing)
+}
+
+// RegisterResources sends the resources a service produces to the agent, calling
+// changed if any were created. On failure none of them stay registered. comm may
+// be nil.
+func RegisterResources(ctx context.Context, comm *agent.AgentCommunication, resources []models.CreateResource, changed func()) error {
+	if comm == nil {
+		return nil
+	}
+	n, err := comm.CreateResources(ctx, resources)
+	if n > 0 {
+		changed()
+	}
+	if err != nil {
+		return runerr.Wrap(ctx, "create resource", resources[n].Name, err)
+	}
+	return nil
+}
+
+// RecordFacts stores what connection metadata can refer to about a long-running
+// service (see template.Facts), on platforms that read no live state back and
+// give services no aliases: its container, which is also its alias, its network,
+// the host ports its bindings publish and the network of each resource it
+// produces. A binding without a host port records nothing, so referring to it
+// fails rather than resolving to the wrong port.
+func RecordFacts(facts template.Facts, name string, service *models.MetadataService, container, network string, resourceNetwork func(resource string) string) {
+	if IsRunnerRole(service) {
+		return
+	}
+	facts.Set(name, "container", container)
+	facts.Set(name, "alias", container)
+	facts.Set(name, "network", network)
+	if service.Bindings != nil {
+		for _, b := range *service.Bindings {
+			if b.ContainerPort != nil && b.HostPort != nil && *b.HostPort > 0 {
+				facts.Set(name, "host_port."+strconv.Itoa(*b.ContainerPort), strconv.Itoa(*b.HostPort))
+			}
+		}
+	}
+	if service.Resources != nil {
+		for _, spec := range *service.Resources {
+			facts.Set(name, "resources."+spec.Name+".network", resourceNetwork(spec.Name))
+		}
+	}
+}
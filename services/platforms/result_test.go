@@ -0,0 +1,37 @@
+package platforms
+
+import (
+	"testing"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/template"
+)
+
+func TestRecordFacts(t *testing.T) {
+	port := func(n int) *int { return &n }
+	service := &models.MetadataService{
+		Image:   "web:1",
+		Aliases: &[]string{"www"}, // ignored by these platforms
+		Bindings: &[]models.BindingSpec{
+			{ContainerPort: port(80), HostPort: port(80)},
+			{ContainerPort: port(9090)}, // not published
+		},
+	}
+
+	facts := template.Facts{}
+	RecordFacts(facts, "web", service, "job-web", "job-default", func(resource string) string { return "job-res-" + resource })
+
+	for ref, want := range map[string]string{
+		"services.web.container":    "job-web",
+		"services.web.alias":        "job-web",
+		"services.web.network":      "job-default",
+		"services.web.host_port.80": "80",
+	} {
+		if got, ok, err := facts.Lookup(ref); err != nil || !ok || got != want {
+			t.Errorf("%s = %q, %t, %v; want %q", ref, got, ok, err, want)
+		}
+	}
+	if got, _, err := facts.Lookup("services.web.host_port.9090"); err == nil {
+		t.Errorf("unpublished port resolved to host port %q, want an error", got)
+	}
+}
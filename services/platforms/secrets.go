@@ -0,0 +1,33 @@
+package platforms
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/google/uuid"
+)
+
+// SecretEnv reads the service's agent-managed secrets as KEY=value entries. They
+// go straight into the container's environment; nothing else records them.
+func SecretEnv(ctx context.Context, comm *agent.AgentCommunication, job uuid.UUID, service *models.MetadataService) ([]string, error) {
+	if len(service.Secrets) == 0 {
+		return nil, nil
+	}
+	if comm == nil {
+		return nil, runerr.Errorf(ctx, "get secret", "", "secrets are read from the agent, which is not configured (AGENT_ENDPOINT)")
+	}
+	var env []string
+	for _, k := range slices.Sorted(maps.Keys(service.Secrets)) {
+		name := service.Secrets[k]
+		value, err := comm.GetSecret(ctx, job, name)
+		if err != nil {
+			return nil, runerr.Wrap(ctx, "get secret", name, err)
+		}
+		env = append(env, k+"="+value)
+	}
+	return env, nil
+}
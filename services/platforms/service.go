@@ -0,0 +1,78 @@
+package platforms
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+
+	cplatforms "github.com/containerd/platforms"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func IsRunnerRole(service *models.MetadataService) bool {
+	if service == nil || service.Role == nil {
+		return false
+	}
+	return *service.Role == models.ServiceRoleRunner
+}
+
+// ServiceSpecHash returns a stable hash of a service's desired spec.
+// encoding/json sorts map keys, so equal specs always hash the same.
+func ServiceSpecHash(service *models.MetadataService) (string, error) {
+	b, err := json.Marshal(service)
+	if err != nil {
+		return "", fmt.Errorf("marshal service spec: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ImagePlatform parses the service's platform, or returns nil when it has none.
+func ImagePlatform(service *models.MetadataService) (*ocispec.Platform, error) {
+	if service.Platform == nil {
+		return nil, nil
+	}
+	platform, err := cplatforms.Parse(*service.Platform)
+	if err != nil {
+		return nil, fmt.Errorf("invalid platform %q: %w", *service.Platform, err)
+	}
+	platform = cplatforms.Normalize(platform)
+	return &platform, nil
+}
+
+func GetPlatformData(connection models.ResourceConnection) *json.RawMessage {
+	if connection.Type != models.ResourceConnectionTypePlatform {
+		return nil
+	}
+	return &connection.Data
+}
+
+// MergeLabels returns the operator's labels (metadata.labels, then the service's)
+// with the runner's own on top, so an operator label can never replace one.
+func MergeLabels(own map[string]string, operator ...map[string]string) map[string]string {
+	out := map[string]string{}
+	for _, m := range operator {
+		maps.Copy(out, m)
+	}
+	maps.Copy(out, own)
+	return out
+}
+
+// BlueGreenConflict reports why two containers of the service cannot run side
+// by side, or nil if they can.
+func BlueGreenConflict(service *models.MetadataService) error {
+	if service.Bindings != nil {
+		for _, b := range *service.Bindings {
+			if b.HostPort != nil {
+				return fmt.Errorf("host port %d cannot be published by two containers at once", *b.HostPort)
+			}
+		}
+	}
+	if len(service.Endpoints) > 0 {
+		return fmt.Errorf("fixed endpoint addresses cannot be held by two containers at once")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package platforms
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/secrets"
+)
+
+// Runner steps with an ssh block find their deploy key and known_hosts here. It
+// is outside the runner volume, so the key never outlives the step's container.
+const SSHDir = "/run/deploy-commander/ssh"
+
+// SSHFile is one file written to SSHDir.
+type SSHFile struct {
+	Name    string
+	Mode    fs.FileMode
+	Content []byte
+}
+
+// SSHFiles resolves a step's ssh block, secret:// references included, into
+// the files written to SSHDir.
+func SSHFiles(ctx context.Context, ssh *models.SSHKey) ([]SSHFile, error) {
+	key, err := secrets.Resolve(ctx, ssh.Key)
+	if err != nil {
+		return nil, runerr.Wrap(ctx, "resolve secret", "ssh.key", err)
+	}
+	knownHosts, err := secrets.Resolve(ctx, ssh.KnownHosts)
+	if err != nil {
+		return nil, runerr.Wrap(ctx, "resolve secret", "ssh.known_hosts", err)
+	}
+	return []SSHFile{
+		// ssh rejects a key without its trailing newline, which secrets trim.
+		{Name: "id_key", Mode: 0o600, Content: []byte(withNewline(key))},
+		{Name: "known_hosts", Mode: 0o644, Content: []byte(withNewline(knownHosts))},
+	}, nil
+}
+
+// SSHEnv points git (and anything else honoring GIT_SSH_COMMAND) at SSHDir.
+func SSHEnv() string {
+	return "GIT_SSH_COMMAND=ssh -i " + path.Join(SSHDir, "id_key") +
+		" -o IdentitiesOnly=yes -o StrictHostKeyChecking=yes -o UserKnownHostsFile=" + path.Join(SSHDir, "known_hosts")
+}
+
+func withNewline(s string) string {
+	if strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
@@ -0,0 +1,92 @@
+package platforms
+
+import (
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+	"github.com/google/uuid"
+)
+
+// ServiceFilter decides whether a service needs to be (re)applied.
+// Services it skips still count as done for depends_on ordering.
+type ServiceFilter func(name string, service *models.MetadataService) (bool, error)
+
+// Steps keeps what a run knows about its runner-role steps: the job state, which
+// records the steps that succeeded, and the outputs of the steps that ran (or
+// were skipped) in this run. A platform makes one per run.
+type Steps struct {
+	store    *state.Store
+	jobState *state.JobState
+
+	// Outputs by step name
+	outputs map[string]map[string]string
+}
+
+// NewSteps starts a run's steps. store may be nil, in which case nothing is
+// recorded.
+func NewSteps(store *state.Store) *Steps {
+	return &Steps{store: store, outputs: map[string]map[string]string{}}
+}
+
+// State returns the job state, reading it from the store only once per run.
+func (s *Steps) State(job uuid.UUID) (*state.JobState, error) {
+	if s.jobState != nil && s.jobState.Job == job {
+		return s.jobState, nil
+	}
+
+	st, err := s.store.Load(job)
+	if err != nil {
+		return nil, err
+	}
+	s.jobState = st
+	return st, nil
+}
+
+// Done reports whether a runner-role step already succeeded in this run, so
+// update need not run it again. Skipped steps still provide their outputs to
+// later services.
+func (s *Steps) Done(st *state.JobState, run uuid.UUID, name string) bool {
+	rec, ok := st.Steps[name]
+	if !ok || rec.Run != run {
+		return false
+	}
+	s.outputs[name] = rec.Outputs
+	return true
+}
+
+// SetOutputs stores the outputs a step wrote.
+func (s *Steps) SetOutputs(name string, outputs map[string]string) {
+	s.outputs[name] = outputs
+}
+
+// Record remembers a successful runner-role step so update never re-runs it for the same run.
+func (s *Steps) Record(job uuid.UUID, run uuid.UUID, name string, service *models.MetadataService) error {
+	if s.store == nil {
+		return nil
+	}
+
+	st, err := s.State(job)
+	if err != nil {
+		return err
+	}
+
+	hash, err := ServiceSpecHash(service)
+	if err != nil {
+		return err
+	}
+
+	st.Steps[name] = state.StepRecord{
+		Run:         run,
+		SpecHash:    hash,
+		Outputs:     s.outputs[name],
+		CompletedAt: time.Now().UTC(),
+	}
+	return s.store.Save(st)
+}
+
+// Lookup resolves steps.<name>.outputs.<key> against outputs of steps that
+// already ran. It is a template.Lookup.
+func (s *Steps) Lookup(ref string) (string, bool, error) {
+	return LookupStepOutput(s.outputs, ref)
+}
@@ -0,0 +1,40 @@
+package platforms
+
+import (
+	"testing"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+	"github.com/google/uuid"
+)
+
+func TestStepsSkipOnlyWithinTheRun(t *testing.T) {
+	store := state.New(t.TempDir())
+	job, run := uuid.New(), uuid.New()
+	role := models.ServiceRoleRunner
+	step := &models.MetadataService{Image: "migrate:1", Role: &role}
+
+	steps := NewSteps(store)
+	steps.SetOutputs("migrate", map[string]string{"version": "42"})
+	if err := steps.Record(job, run, "migrate", step); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later invocation of the same run skips the step and still sees its outputs.
+	steps = NewSteps(store)
+	st, err := steps.State(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !steps.Done(st, run, "migrate") {
+		t.Fatal("step recorded for this run is not done")
+	}
+	if v, ok, err := steps.Lookup("steps.migrate.outputs.version"); err != nil || !ok || v != "42" {
+		t.Errorf("Lookup = %q, %t, %v; want 42", v, ok, err)
+	}
+
+	// Another run runs it again.
+	if NewSteps(store).Done(st, uuid.New(), "migrate") {
+		t.Error("step recorded for another run is done")
+	}
+}
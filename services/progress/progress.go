@@ -0,0 +1,41 @@
+package progress
+
+import (
+	"context"
+	"time"
+)
+
+// Reporter receives a run's progress as it happens. Platforms and the phase
+// package report through the context (see From), so code that nobody listens
+// to needs no changes. Implementations must be safe for concurrent use.
+type Reporter interface {
+	PhaseStarted(name string)
+	PhaseFinished(name string, elapsed time.Duration, err error)
+	ServiceStarted(name string)
+	ServiceFinished(name string, elapsed time.Duration, err error)
+	ServiceSkipped(name string) // left alone by an update
+}
+
+type reporterKey struct{}
+
+// WithReporter returns a context whose progress goes to r.
+func WithReporter(ctx context.Context, r Reporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, r)
+}
+
+// From returns the context's reporter, or one that ignores everything.
+func From(ctx context.Context) Reporter {
+	if r, ok := ctx.Value(reporterKey{}).(Reporter); ok && r != nil {
+		return r
+	}
+	return Nop{}
+}
+
+// Nop ignores every event.
+type Nop struct{}
+
+func (Nop) PhaseStarted(string)                          {}
+func (Nop) PhaseFinished(string, time.Duration, error)   {}
+func (Nop) ServiceStarted(string)                        {}
+func (Nop) ServiceFinished(string, time.Duration, error) {}
+func (Nop) ServiceSkipped(string)                        {}
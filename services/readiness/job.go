@@ -0,0 +1,50 @@
+package readiness
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// Service states that count as up: containers report running, ECS services active
+// (setup has already waited for them to be stable).
+var upStates = []string{"running", "active"}
+
+// Job works out the readiness of a job whose run succeeded, from its metadata and
+// the live state of its services. Runner steps are not looked at: one that failed
+// either failed the run or was let through by its on_failure. pendingWrites is the number of agent writes, such as resource
+// registrations, still queued for retry.
+func Job(md *models.Metadata, statuses []models.ServiceStatus, pendingWrites int) models.JobReadiness {
+	var reasons []string
+	if md != nil {
+		for _, name := range slices.Sorted(maps.Keys(md.Services)) {
+			svc := md.Services[name]
+			// Services under on_failure ignore are optional.
+			if svc.Role != nil && *svc.Role == models.ServiceRoleRunner || svc.FailurePolicy() == models.FailurePolicyIgnore {
+				continue
+			}
+			found := false
+			for _, s := range statuses {
+				if s.Service != name {
+					continue
+				}
+				found = true
+				switch {
+				case !slices.Contains(upStates, s.State):
+					reasons = append(reasons, fmt.Sprintf("service %q: %s is %s", name, s.Container, s.State))
+				case s.Health != "" && s.Health != "healthy":
+					reasons = append(reasons, fmt.Sprintf("service %q: %s is %s", name, s.Container, s.Health))
+				}
+			}
+			if !found {
+				reasons = append(reasons, fmt.Sprintf("service %q: not deployed", name))
+			}
+		}
+	}
+	if pendingWrites > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d agent write(s) queued; resources may not be registered", pendingWrites))
+	}
+	return models.JobReadiness{Ready: len(reasons) == 0, Reasons: reasons}
+}
@@ -0,0 +1,120 @@
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+)
+
+// How often an unready resource is checked again, and how long one TCP probe may take.
+const (
+	pollInterval = 2 * time.Second
+	dialTimeout  = 2 * time.Second
+)
+
+// A check reports whether a resource is ready and, if not, why.
+type check struct {
+	target string
+	ready  func(ctx context.Context) (bool, string)
+}
+
+// Wait blocks until every connected resource is ready, or fails after timeout naming
+// the resource that blocked the deploy. A connection with an agent resource id asks
+// the agent's health endpoint; otherwise (or when the agent has no health for it)
+// network connections are probed over TCP. Connections with nothing to check pass.
+func Wait(ctx context.Context, comm *agent.AgentCommunication, conns []models.ResourceConnection, timeout time.Duration) error {
+	checks, err := checksFor(comm, conns)
+	if err != nil {
+		return runerr.Wrap(ctx, "wait for resources", "", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for _, c := range checks {
+		for {
+			ok, reason := c.ready(ctx)
+			if ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				return runerr.Errorf(ctx, "wait for resource", c.target, "not ready after %s: %s", timeout, reason)
+			}
+
+			select {
+			case <-ctx.Done():
+				return runerr.Wrap(ctx, "wait for resource", c.target, context.Cause(ctx))
+			case <-time.After(min(pollInterval, time.Until(deadline)+time.Millisecond)):
+			}
+		}
+	}
+	return nil
+}
+
+func checksFor(comm *agent.AgentCommunication, conns []models.ResourceConnection) ([]check, error) {
+	var checks []check
+	for _, conn := range conns {
+		probe, target, err := networkProbe(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		if conn.Resource != nil && comm != nil {
+			id := *conn.Resource
+			if target == "" {
+				target = id.String()
+			}
+			checks = append(checks, check{target: target, ready: func(ctx context.Context) (bool, string) {
+				health, err := comm.ResourceHealth(ctx, id)
+				if errors.Is(err, agent.ErrNoResourceHealth) && probe != nil {
+					return probe(ctx)
+				}
+				if err != nil {
+					return false, err.Error()
+				}
+				if !health.Ready && health.Message == "" {
+					return false, "agent reports the resource is not ready"
+				}
+				return health.Ready, health.Message
+			}})
+			continue
+		}
+
+		if probe != nil {
+			checks = append(checks, check{target: target, ready: probe})
+		}
+	}
+	return checks, nil
+}
+
+// networkProbe returns a TCP probe for a Network connection with a port (nil otherwise)
+// and the address it dials.
+func networkProbe(conn models.ResourceConnection) (func(ctx context.Context) (bool, string), string, error) {
+	if conn.Type != models.ResourceConnectionTypeNetwork {
+		return nil, "", nil
+	}
+	var nc models.NetworkConnection
+	if err := json.Unmarshal(conn.Data, &nc); err != nil {
+		return nil, "", fmt.Errorf("parse network connection: %w", err)
+	}
+	if nc.Address == "" || nc.Port == nil {
+		return nil, "", nil
+	}
+
+	addr := net.JoinHostPort(nc.Address, strconv.Itoa(int(*nc.Port)))
+	return func(ctx context.Context) (bool, string) {
+		d := net.Dialer{Timeout: dialTimeout}
+		c, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return false, err.Error()
+		}
+		c.Close()
+		return true, ""
+	}, addr, nil
+}
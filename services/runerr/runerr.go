@@ -0,0 +1,121 @@
+package runerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/services/phase"
+	"github.com/google/uuid"
+)
+
+// Error is a failed operation together with where in the run it happened.
+// Job, Run and Service come from the context (see WithRun and WithService),
+// Phase from the enclosing phase context.
+type Error struct {
+	Job     uuid.UUID
+	Run     uuid.UUID
+	Service string
+	Phase   string
+	Op      string // what was attempted, e.g. "create container"
+	Target  string // what it was attempted on, e.g. the container name
+	Err     error
+}
+
+// Error renders `op "target": err (service "name")`. Job, run and phase are the
+// same for the whole run (and phase.Error already prefixes the phase), so they
+// are left to Fields.
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Op)
+	if e.Target != "" {
+		fmt.Fprintf(&b, " %q", e.Target)
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+	if e.Service != "" {
+		fmt.Fprintf(&b, " (service %q)", e.Service)
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Fields returns the non-empty context of the error for structured reporting.
+func (e *Error) Fields() map[string]string {
+	f := map[string]string{"op": e.Op}
+	if e.Job != uuid.Nil {
+		f["job"] = e.Job.String()
+	}
+	if e.Run != uuid.Nil {
+		f["run"] = e.Run.String()
+	}
+	if e.Service != "" {
+		f["service"] = e.Service
+	}
+	if e.Phase != "" {
+		f["phase"] = e.Phase
+	}
+	if e.Target != "" {
+		f["target"] = e.Target
+	}
+	return f
+}
+
+type runKey struct{}
+type serviceKey struct{}
+
+type runIDs struct {
+	job uuid.UUID
+	run uuid.UUID
+}
+
+// WithRun attaches the job and run ids that Wrap records.
+func WithRun(ctx context.Context, job, run uuid.UUID) context.Context {
+	return context.WithValue(ctx, runKey{}, runIDs{job: job, run: run})
+}
+
+// WithService attaches the service name that Wrap records.
+func WithService(ctx context.Context, service string) context.Context {
+	return context.WithValue(ctx, serviceKey{}, service)
+}
+
+// Wrap returns err as an *Error for op on target, filled in from ctx.
+// It returns nil for a nil err, and does not re-wrap an *Error for the same op and target.
+func Wrap(ctx context.Context, op, target string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var re *Error
+	if errors.As(err, &re) && re.Op == op && re.Target == target {
+		return err
+	}
+
+	e := &Error{Op: op, Target: target, Err: err}
+	if ids, ok := ctx.Value(runKey{}).(runIDs); ok {
+		e.Job, e.Run = ids.job, ids.run
+	}
+	if s, ok := ctx.Value(serviceKey{}).(string); ok {
+		e.Service = s
+	}
+	if info, ok := phase.FromContext(ctx); ok {
+		e.Phase = info.Name
+	}
+	return e
+}
+
+// Errorf is Wrap with a formatted cause, for failures that have no underlying error.
+func Errorf(ctx context.Context, op, target, format string, args ...any) error {
+	return Wrap(ctx, op, target, fmt.Errorf(format, args...))
+}
+
+// Fields returns the context of the outermost *Error in err's chain, or nil.
+func Fields(err error) map[string]string {
+	var re *Error
+	if errors.As(err, &re) {
+		return re.Fields()
+	}
+	return nil
+}
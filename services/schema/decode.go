@@ -0,0 +1,233 @@
+package schema
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// Decode reads a configuration of any supported version from r and migrates it
+// to Current as it streams. Services are read, upgraded and decoded one at a
+// time, so a large metadata document is never held as raw bytes, a generic map
+// and structs at once. r is read twice when schema_version does not come first.
+func Decode(r io.ReadSeeker) (models.Configuration, error) {
+	version, err := peekVersion(r)
+	if err != nil {
+		return models.Configuration{}, err
+	}
+	if version > Current {
+		return models.Configuration{}, fmt.Errorf("schema_version %d is newer than supported version %d (upgrade the runner)", version, Current)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return models.Configuration{}, err
+	}
+
+	dec := json.NewDecoder(bufio.NewReaderSize(r, 64<<10))
+	rest := map[string]json.RawMessage{}
+	var services map[string]models.MetadataService
+	err = decodeObject(dec, func(key string) error {
+		if key != "metadata" {
+			return decodeRaw(dec, rest, key)
+		}
+		metadata := map[string]json.RawMessage{}
+		isNull, err := decodeObjectOrNull(dec, func(key string) error {
+			if key != "services" {
+				return decodeRaw(dec, metadata, key)
+			}
+			services, err = decodeServices(dec, version)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if isNull {
+			rest[key] = json.RawMessage("null")
+			return nil
+		}
+		b, err := json.Marshal(metadata)
+		rest[key] = b
+		return err
+	})
+	if err != nil {
+		return models.Configuration{}, err
+	}
+
+	// What is left is small, so it goes through the generic migration.
+	doc, err := json.Marshal(rest)
+	if err != nil {
+		return models.Configuration{}, err
+	}
+	if version < Current {
+		if doc, err = migrateRest(doc, version); err != nil {
+			return models.Configuration{}, err
+		}
+	}
+	var cfg models.Configuration
+	if err := json.Unmarshal(doc, &cfg); err != nil {
+		return models.Configuration{}, err
+	}
+	if services != nil && cfg.Metadata != nil {
+		cfg.Metadata.Services = services
+	}
+	return cfg, nil
+}
+
+// peekVersion reads schema_version from the top-level object, skipping (not
+// keeping) the values before it.
+func peekVersion(r io.Reader) (int, error) {
+	dec := json.NewDecoder(bufio.NewReaderSize(r, 64<<10))
+	dec.UseNumber()
+	version := 1
+	errFound := errors.New("found")
+	err := decodeObject(dec, func(key string) error {
+		if key != "schema_version" {
+			return skipValue(dec)
+		}
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		var err error
+		if version, err = Version(map[string]any{"schema_version": v}); err != nil {
+			return err
+		}
+		return errFound
+	})
+	if err != nil && err != errFound {
+		return 0, err
+	}
+	return version, nil
+}
+
+// decodeServices decodes metadata.services one service at a time, upgrading
+// each from version.
+func decodeServices(dec *json.Decoder, version int) (map[string]models.MetadataService, error) {
+	services := map[string]models.MetadataService{}
+	isNull, err := decodeObjectOrNull(dec, func(name string) error {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		if version < Current {
+			var err error
+			if raw, err = migrateServiceJSON(name, raw, version); err != nil {
+				return err
+			}
+		}
+		var svc models.MetadataService
+		if err := json.Unmarshal(raw, &svc); err != nil {
+			return fmt.Errorf("metadata.services.%s: %w", name, err)
+		}
+		services[name] = svc
+		return nil
+	})
+	if err != nil || isNull {
+		return nil, err
+	}
+	return services, nil
+}
+
+func migrateServiceJSON(name string, raw json.RawMessage, version int) (json.RawMessage, error) {
+	var svc map[string]any
+	if err := unmarshalNumbers(raw, &svc); err != nil {
+		return nil, fmt.Errorf("metadata.services.%s: %w", name, err)
+	}
+	for v := version; v < Current; v++ {
+		if err := migrateService(name, svc, v); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(svc)
+}
+
+// migrateRest runs the config shims over the document without its services.
+func migrateRest(doc []byte, version int) ([]byte, error) {
+	var cfg map[string]any
+	if err := unmarshalNumbers(doc, &cfg); err != nil {
+		return nil, err
+	}
+	for v := version; v < Current; v++ {
+		if err := migrateConfig(cfg, v); err != nil {
+			return nil, err
+		}
+	}
+	cfg["schema_version"] = Current
+	return json.Marshal(cfg)
+}
+
+// unmarshalNumbers keeps numbers exactly as sent when the value is re-encoded.
+func unmarshalNumbers(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// decodeObject reads a JSON object, calling field for each key with the decoder
+// positioned at its value, which field must consume.
+func decodeObject(dec *json.Decoder, field func(key string) error) error {
+	isNull, err := decodeObjectOrNull(dec, field)
+	if err == nil && isNull {
+		return errors.New("expected an object, got null")
+	}
+	return err
+}
+
+// decodeObjectOrNull is decodeObject that also accepts null, and reports it.
+func decodeObjectOrNull(dec *json.Decoder, field func(key string) error) (bool, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return false, err
+	}
+	if t == nil {
+		return true, nil
+	}
+	if t != json.Delim('{') {
+		return false, fmt.Errorf("expected an object, got %v", t)
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return false, err
+		}
+		key, _ := t.(string)
+		if err := field(key); err != nil {
+			return false, err
+		}
+	}
+	_, err = dec.Token() // the closing }
+	return false, err
+}
+
+func decodeRaw(dec *json.Decoder, into map[string]json.RawMessage, key string) error {
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	into[key] = raw
+	return nil
+}
+
+// skipValue consumes the next value token by token, so nothing of it is kept.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
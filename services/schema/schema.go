@@ -0,0 +1,130 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Current is the configuration schema version this runner writes and understands.
+// Configurations without schema_version are treated as version 1.
+const Current = 2
+
+// A shim upgrades a decoded configuration from version N to N+1 in place. Each
+// service is upgraded on its own, so Decode can migrate a document while it
+// streams it; config sees the rest of the document.
+type shim struct {
+	config  func(cfg map[string]any) error
+	service func(name string, svc map[string]any) error
+}
+
+// shims[i] upgrades version i+1 to i+2.
+var shims = []shim{
+	{service: structuredServiceVolumes},
+}
+
+// Migrate upgrades a raw configuration document to Current so older agents can keep
+// sending older shapes. Documents newer than Current are rejected rather than guessed at.
+func Migrate(b []byte) ([]byte, error) {
+	// UseNumber keeps numbers exactly as sent when the document is re-encoded.
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var cfg map[string]any
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, err
+	}
+
+	version, err := Version(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if version > Current {
+		return nil, fmt.Errorf("schema_version %d is newer than supported version %d (upgrade the runner)", version, Current)
+	}
+	if version == Current {
+		return b, nil
+	}
+
+	metadata, _ := cfg["metadata"].(map[string]any)
+	services, _ := metadata["services"].(map[string]any)
+	for v := version; v < Current; v++ {
+		if err := migrateConfig(cfg, v); err != nil {
+			return nil, err
+		}
+		for name, s := range services {
+			svc, _ := s.(map[string]any)
+			if err := migrateService(name, svc, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	cfg["schema_version"] = Current
+
+	return json.Marshal(cfg)
+}
+
+// Version reads schema_version from a configuration decoded with UseNumber (1 when absent).
+func Version(cfg map[string]any) (int, error) {
+	raw, ok := cfg["schema_version"]
+	if !ok || raw == nil {
+		return 1, nil
+	}
+	n, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("schema_version must be a positive integer, got %v", raw)
+	}
+	v, err := strconv.Atoi(n.String())
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("schema_version must be a positive integer, got %v", raw)
+	}
+	return v, nil
+}
+
+func migrateConfig(cfg map[string]any, v int) error {
+	if s := shims[v-1]; s.config != nil {
+		if err := s.config(cfg); err != nil {
+			return fmt.Errorf("migrate schema v%d -> v%d: %w", v, v+1, err)
+		}
+	}
+	return nil
+}
+
+func migrateService(name string, svc map[string]any, v int) error {
+	if s := shims[v-1]; s.service != nil && svc != nil {
+		if err := s.service(name, svc); err != nil {
+			return fmt.Errorf("migrate schema v%d -> v%d: %w", v, v+1, err)
+		}
+	}
+	return nil
+}
+
+// structuredServiceVolumes (v1 -> v2) rewrites string service volumes into
+// {"name", "mount_path"} objects:
+//
+//	"data:/var/lib/data" -> {"name": "data", "mount_path": "/var/lib/data"}
+//	"/work"              -> {"name": null, "mount_path": "/work"} (runner volume)
+func structuredServiceVolumes(svcName string, svc map[string]any) error {
+	vols, _ := svc["volumes"].([]any)
+	for i, v := range vols {
+		str, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		mount := map[string]any{"name": nil}
+		if name, path, ok := strings.Cut(str, ":"); ok {
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("service %q volume %q has an empty name", svcName, str)
+			}
+			mount["name"] = name
+			mount["mount_path"] = path
+		} else {
+			mount["mount_path"] = str
+		}
+		vols[i] = mount
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package secopt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Kinds of security_opt entries.
+const (
+	NoNewPrivileges = "no-new-privileges"
+	Seccomp         = "seccomp"
+	AppArmor        = "apparmor"
+	Label           = "label" // SELinux, e.g. label=type:svirt_apache_t or label=disable
+)
+
+// Unconfined turns seccomp or AppArmor off for the service.
+const Unconfined = "unconfined"
+
+// Opt is one security_opt entry.
+type Opt struct {
+	Kind  string
+	Value string // "true" or "false" for no-new-privileges; a profile path for a custom seccomp profile
+}
+
+// Parse reads one entry in Docker's syntax: no-new-privileges[=true|false],
+// seccomp=<profile.json>|unconfined, apparmor=<profile>|unconfined or
+// label=<selinux option>. Docker's older colon separator is accepted too.
+func Parse(s string) (Opt, error) {
+	s = strings.TrimSpace(s)
+	kind, value, hasValue := strings.Cut(s, "=")
+	if !hasValue {
+		kind, value, hasValue = strings.Cut(s, ":")
+	}
+	opt := Opt{Kind: kind, Value: value}
+	switch kind {
+	case NoNewPrivileges:
+		if !hasValue {
+			opt.Value = "true"
+			return opt, nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return opt, fmt.Errorf("invalid security_opt %q: no-new-privileges takes true or false", s)
+		}
+		opt.Value = strconv.FormatBool(b)
+		return opt, nil
+	case Seccomp:
+		if value != Unconfined && !filepath.IsAbs(value) {
+			return opt, fmt.Errorf("invalid security_opt %q: seccomp takes unconfined or an absolute profile path", s)
+		}
+	case AppArmor, Label:
+		if value == "" {
+			return opt, fmt.Errorf("invalid security_opt %q: %s needs a value", s, kind)
+		}
+	default:
+		return opt, fmt.Errorf("unknown security_opt %q (valid: no-new-privileges, seccomp=, apparmor=, label=)", s)
+	}
+	return opt, nil
+}
+
+// ParseAll parses a service's security_opt.
+func ParseAll(entries []string) ([]Opt, error) {
+	out := make([]Opt, 0, len(entries))
+	for _, e := range entries {
+		opt, err := Parse(e)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, opt)
+	}
+	return out, nil
+}
+
+// Custom reports whether the entry names a seccomp profile file.
+func (o Opt) Custom() bool {
+	return o.Kind == Seccomp && o.Value != Unconfined
+}
+
+// Profile reads a custom seccomp profile from the runner's host and returns it
+// compacted, as the Docker API takes the profile itself rather than its path.
+func (o Opt) Profile() ([]byte, error) {
+	b, err := os.ReadFile(o.Value)
+	if err != nil {
+		return nil, fmt.Errorf("read seccomp profile: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return nil, fmt.Errorf("seccomp profile %s is not JSON: %w", o.Value, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,35 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// secretsManager reads secrets from AWS Secrets Manager by name or ARN, with the
+// runner's default AWS credentials and region.
+type secretsManager struct {
+	client *secretsmanager.Client
+}
+
+func newSecretsManager(ctx context.Context) (Provider, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	return &secretsManager{client: secretsmanager.NewFromConfig(cfg)}, nil
+}
+
+func (p *secretsManager) Secret(ctx context.Context, path string) (string, error) {
+	out, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(path)})
+	if err != nil {
+		return "", err
+	}
+	if out.SecretString != nil {
+		return *out.SecretString, nil
+	}
+	return string(out.SecretBinary), nil
+}
@@ -0,0 +1,44 @@
+package secrets
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+)
+
+// Where file secrets are read from unless RUNNER_SECRETS_DIR says otherwise, as
+// Docker and Kubernetes mount them.
+const defaultSecretsDir = "/run/secrets"
+
+// fileProvider reads secrets from files under a directory; paths cannot leave it,
+// so a job cannot read the runner's other files.
+type fileProvider struct {
+	root *os.Root
+}
+
+func newFile(context.Context) (Provider, error) {
+	dir := strings.TrimSpace(os.Getenv("RUNNER_SECRETS_DIR"))
+	if dir == "" {
+		dir = defaultSecretsDir
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &fileProvider{root: root}, nil
+}
+
+func (p *fileProvider) Secret(_ context.Context, path string) (string, error) {
+	f, err := p.root.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	// Files written by editors and echo end with a newline that is not part of the secret.
+	return strings.TrimSuffix(strings.TrimSuffix(string(b), "\n"), "\r"), nil
+}
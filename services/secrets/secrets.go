@@ -0,0 +1,128 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Scheme starts a secret reference: secret://<backend>/<path>#<key>.
+const Scheme = "secret://"
+
+// Ref is a parsed secret reference.
+type Ref struct {
+	Backend string // vault, aws-sm or file
+	Path    string
+	Key     string // field of a JSON object secret; empty for the whole value
+}
+
+func (r Ref) String() string {
+	s := Scheme + r.Backend + "/" + r.Path
+	if r.Key != "" {
+		s += "#" + r.Key
+	}
+	return s
+}
+
+// Provider reads secrets from one backend.
+type Provider interface {
+	// Secret returns the raw value of the secret at path.
+	Secret(ctx context.Context, path string) (string, error)
+}
+
+// Backends, created on first use from the runner's environment: the credentials
+// are the runner's, not the job's.
+var backends = map[string]func(ctx context.Context) (Provider, error){
+	"vault":  newVault,
+	"aws-sm": newSecretsManager,
+	"file":   newFile,
+}
+
+// Backends lists the backend names a reference may use.
+func Backends() []string {
+	return slices.Sorted(maps.Keys(backends))
+}
+
+// Parse reads a secret reference. ok is false for values that are not one.
+func Parse(s string) (ref Ref, ok bool, err error) {
+	rest, ok := strings.CutPrefix(s, Scheme)
+	if !ok {
+		return ref, false, nil
+	}
+	rest, ref.Key, _ = strings.Cut(rest, "#")
+	ref.Backend, ref.Path, _ = strings.Cut(rest, "/")
+	if _, known := backends[ref.Backend]; !known {
+		return ref, true, fmt.Errorf("unknown secret backend %q (valid: %s)", ref.Backend, strings.Join(Backends(), ", "))
+	}
+	if ref.Path == "" {
+		return ref, true, fmt.Errorf("secret reference %q has no path", s)
+	}
+	return ref, true, nil
+}
+
+// Resolve returns value with a secret reference replaced by the secret; any other
+// value is returned as is. Secrets are read once per process, that is per run.
+func Resolve(ctx context.Context, value string) (string, error) {
+	ref, ok, err := Parse(value)
+	if !ok || err != nil {
+		return value, err
+	}
+	return std.resolve(ctx, ref)
+}
+
+var std = &resolver{providers: map[string]Provider{}, values: map[string]string{}}
+
+type resolver struct {
+	mu        sync.Mutex
+	providers map[string]Provider
+	values    map[string]string // by backend and path
+}
+
+func (r *resolver) resolve(ctx context.Context, ref Ref) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := ref.Backend + "/" + ref.Path
+	raw, ok := r.values[id]
+	if !ok {
+		p, ok := r.providers[ref.Backend]
+		if !ok {
+			var err error
+			if p, err = backends[ref.Backend](ctx); err != nil {
+				return "", fmt.Errorf("secret backend %s: %w", ref.Backend, err)
+			}
+			r.providers[ref.Backend] = p
+		}
+		var err error
+		if raw, err = p.Secret(ctx, ref.Path); err != nil {
+			return "", fmt.Errorf("read secret %s/%s: %w", ref.Backend, ref.Path, err)
+		}
+		r.values[id] = raw
+	}
+	return field(raw, ref)
+}
+
+// field picks ref.Key out of a secret holding a JSON object. Strings are used as
+// they are, anything else as JSON.
+func field(raw string, ref Ref) (string, error) {
+	if ref.Key == "" {
+		return raw, nil
+	}
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(raw), &obj); err != nil {
+		return "", fmt.Errorf("secret %s/%s is not a JSON object, so it has no key %q", ref.Backend, ref.Path, ref.Key)
+	}
+	v, ok := obj[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s has no key %q", ref.Backend, ref.Path, ref.Key)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
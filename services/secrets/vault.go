@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// vault reads secrets from HashiCorp Vault's HTTP API, configured like the vault
+// CLI: VAULT_ADDR, VAULT_TOKEN, and optionally VAULT_NAMESPACE and VAULT_CACERT.
+// Paths are API paths below /v1, e.g. secret/data/app for a KV v2 mount.
+type vault struct {
+	addr      string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+func newVault(context.Context) (Provider, error) {
+	v := &vault{
+		addr:      strings.TrimSuffix(strings.TrimSpace(os.Getenv("VAULT_ADDR")), "/"),
+		token:     strings.TrimSpace(os.Getenv("VAULT_TOKEN")),
+		namespace: strings.TrimSpace(os.Getenv("VAULT_NAMESPACE")),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if v.addr == "" || v.token == "" {
+		return nil, errors.New("VAULT_ADDR and VAULT_TOKEN must be set on the runner")
+	}
+	if ca := os.Getenv("VAULT_CACERT"); ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("read VAULT_CACERT: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("VAULT_CACERT %s holds no certificates", ca)
+		}
+		v.client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	return v, nil
+}
+
+// Secret returns the secret's data as a JSON object, unwrapping KV v2 responses.
+func (v *vault) Secret(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return "", fmt.Errorf("vault returned %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("parse vault response: %w", err)
+	}
+	data := body.Data
+	if raw, ok := data["data"]; ok {
+		if _, kv2 := data["metadata"]; kv2 {
+			var inner map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &inner); err != nil {
+				return "", fmt.Errorf("parse vault response: %w", err)
+			}
+			data = inner
+		}
+	}
+	b, err := json.Marshal(data)
+	return string(b), err
+}
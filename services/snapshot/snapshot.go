@@ -0,0 +1,110 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+const manifestFile = "manifest.json"
+
+// DefaultDir is where action "snapshot" writes its bundle when none is configured.
+func DefaultDir(cfg models.Configuration) string {
+	return filepath.Join(cfg.WorkspaceDir(), "snapshots", cfg.Run.String())
+}
+
+// VolumeFile names the archive of the i-th volume, relative to the bundle.
+// Volumes are numbered so any volume name is safe to use.
+func VolumeFile(i int) string {
+	return filepath.Join("volumes", strconv.Itoa(i)+".tar")
+}
+
+// MountedVolumes lists the declared volumes at least one service mounts; only
+// those have contents a platform can reach.
+func MountedVolumes(md *models.Metadata) []string {
+	if md == nil || md.Volumes == nil {
+		return nil
+	}
+	mounted := map[string]bool{}
+	for _, name := range slices.Sorted(maps.Keys(md.Services)) {
+		svc := md.Services[name]
+		if svc.Volumes == nil {
+			continue
+		}
+		for _, vm := range *svc.Volumes {
+			if vm.Name != nil {
+				mounted[*vm.Name] = true
+			}
+		}
+	}
+	var out []string
+	for _, v := range *md.Volumes {
+		if mounted[v] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Pin replaces the image of every service in images and returns the images it
+// replaced, keyed by service.
+func Pin(md *models.Metadata, images map[string]string) map[string]string {
+	was := map[string]string{}
+	for name, image := range images {
+		svc, ok := md.Services[name]
+		if !ok || svc.Image == image {
+			continue
+		}
+		was[name] = svc.Image
+		svc.Image = image
+		md.Services[name] = svc
+	}
+	return was
+}
+
+// WriteManifest writes manifest.json into the bundle directory.
+func WriteManifest(dir string, m models.SnapshotManifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode snapshot manifest: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create snapshot bundle: %w", err)
+	}
+	tmp := filepath.Join(dir, manifestFile+".tmp")
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write snapshot manifest: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, manifestFile)); err != nil {
+		return fmt.Errorf("write snapshot manifest: %w", err)
+	}
+	return nil
+}
+
+// ReadManifest reads a bundle's manifest and checks that its volume archives
+// stay inside the bundle and exist.
+func ReadManifest(dir string) (models.SnapshotManifest, error) {
+	var m models.SnapshotManifest
+	b, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return m, fmt.Errorf("read snapshot manifest: %w", err)
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("decode snapshot manifest: %w", err)
+	}
+	for _, v := range m.Volumes {
+		if !filepath.IsLocal(v.File) {
+			return m, fmt.Errorf("snapshot volume %q: archive %q is outside the bundle", v.Name, v.File)
+		}
+		if _, err := os.Stat(filepath.Join(dir, v.File)); err != nil {
+			return m, fmt.Errorf("snapshot volume %q: %w", v.Name, err)
+		}
+	}
+	return m, nil
+}
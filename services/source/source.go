@@ -0,0 +1,123 @@
+package source
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+)
+
+// DefaultImage runs source steps unless the step or RUNNER_SOURCE_IMAGE names
+// another; it only needs sh and git. Pin it by digest in RUNNER_SOURCE_IMAGE
+// where tags are not trusted.
+const DefaultImage = "alpine/git:2.47.2"
+
+// The checkout, with the step's settings passed in the environment so nothing
+// from the metadata is ever parsed by the shell. Fetching the ref by itself
+// works for branches, tags and commit ids alike.
+const script = `set -eu
+dir="$DC_SOURCE_DIR"
+rm -rf "$dir"
+mkdir -p "$dir"
+cd "$dir"
+git init -q
+git remote add origin "$DC_SOURCE_REPO"
+depth=""
+if [ "$DC_SOURCE_DEPTH" -gt 0 ]; then depth="--depth=$DC_SOURCE_DEPTH"; fi
+git fetch -q $depth origin "${DC_SOURCE_REF:-HEAD}"
+git -c advice.detachedHead=false checkout -q FETCH_HEAD
+if [ "$DC_SOURCE_SUBMODULES" = true ]; then git submodule update -q --init --recursive $depth; fi
+commit="$(git rev-parse HEAD)"
+echo "checked out $DC_SOURCE_REPO ${DC_SOURCE_REF:-HEAD} at $commit into $dir"
+if [ -n "${DC_OUTPUTS:-}" ]; then
+	mkdir -p "$(dirname "$DC_OUTPUTS")"
+	printf 'commit=%s\npath=%s\n' "$commit" "$dir" >> "$DC_OUTPUTS"
+fi
+`
+
+var entrypoint = []string{"/bin/sh", "-c", script}
+
+// Expand turns the metadata's source steps into plain runner steps: it fills in
+// the image, the checkout command and its settings. Steps that were already
+// expanded (e.g. metadata from a snapshot) are left as they are.
+func Expand(md *models.Metadata) error {
+	if md == nil {
+		return nil
+	}
+	for _, name := range slices.Sorted(maps.Keys(md.Services)) {
+		service := md.Services[name]
+		src := service.Source
+		if src == nil {
+			continue
+		}
+		if err := check(src); err != nil {
+			return fmt.Errorf("service %q: source: %w", name, err)
+		}
+		if service.Role != nil && *service.Role != models.ServiceRoleRunner {
+			return fmt.Errorf("service %q: source steps are runner steps; remove role %q", name, *service.Role)
+		}
+		if (service.Entrypoint != nil && !slices.Equal(*service.Entrypoint, entrypoint)) || service.Command != nil {
+			return fmt.Errorf("service %q: source steps run the runner's checkout; remove entrypoint and command", name)
+		}
+
+		role := models.ServiceRoleRunner
+		service.Role = &role
+		if service.Image == "" {
+			service.Image = Image()
+		}
+		ep := slices.Clone(entrypoint)
+		service.Entrypoint = &ep
+		dir := src.Path
+		if dir == "" {
+			dir = "source/" + name
+		}
+		service.Environment = maps.Clone(service.Environment)
+		if service.Environment == nil {
+			service.Environment = map[string]string{}
+		}
+		maps.Copy(service.Environment, map[string]string{
+			"DC_SOURCE_REPO":       src.Repo,
+			"DC_SOURCE_REF":        src.Ref,
+			"DC_SOURCE_DEPTH":      strconv.Itoa(src.Depth),
+			"DC_SOURCE_SUBMODULES": strconv.FormatBool(src.Submodules),
+			"DC_SOURCE_DIR":        path.Join(platforms.RunnerVolumeMountPath, dir),
+		})
+		md.Services[name] = service
+	}
+	return nil
+}
+
+// Image is the image source steps run in.
+func Image() string {
+	if image := strings.TrimSpace(os.Getenv("RUNNER_SOURCE_IMAGE")); image != "" {
+		return image
+	}
+	return DefaultImage
+}
+
+func check(src *models.SourceStep) error {
+	if strings.TrimSpace(src.Repo) == "" {
+		return fmt.Errorf("repo is required")
+	}
+	if strings.HasPrefix(src.Repo, "-") || strings.HasPrefix(src.Ref, "-") {
+		return fmt.Errorf("repo and ref cannot start with -")
+	}
+	if src.Depth < 0 {
+		return fmt.Errorf("depth must not be negative")
+	}
+	if src.Path != "" && (path.IsAbs(src.Path) || !pathIsLocal(src.Path)) {
+		return fmt.Errorf("path %q must be relative to the runner volume and stay inside it", src.Path)
+	}
+	return nil
+}
+
+func pathIsLocal(p string) bool {
+	p = path.Clean(p)
+	return p != "." && p != ".." && !strings.HasPrefix(p, "../")
+}
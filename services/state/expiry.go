@@ -0,0 +1,75 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/google/uuid"
+)
+
+// Expiry records when a job deployed with a ttl is due to be torn down, and what
+// the teardown needs, since it runs later from a scheduled `runner expire`.
+type Expiry struct {
+	Job          uuid.UUID        `json:"job"`
+	Run          uuid.UUID        `json:"run"` // run that set the ttl
+	Platform     string           `json:"platform"`
+	PlatformData *json.RawMessage `json:"platform_data,omitempty"`
+	TTL          models.Duration  `json:"ttl"`
+	Expires      time.Time        `json:"expires"`
+}
+
+func (s *Store) expiryPath(job uuid.UUID) string {
+	return filepath.Join(s.Dir, "expiry", job.String()+".json")
+}
+
+// SaveExpiry writes the job's expiry atomically, replacing an earlier one. It is
+// only readable by the runner, as platform data may hold credentials.
+func (s *Store) SaveExpiry(e Expiry) error {
+	p := s.expiryPath(e.Job)
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return fmt.Errorf("create expiry dir: %w", err)
+	}
+
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("write expiry of job %s: %w", e.Job, err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return fmt.Errorf("write expiry of job %s: %w", e.Job, err)
+	}
+	return nil
+}
+
+// RemoveExpiry forgets the job's expiry; a job without one is not an error.
+func (s *Store) RemoveExpiry(job uuid.UUID) error {
+	if err := os.Remove(s.expiryPath(job)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove expiry of job %s: %w", job, err)
+	}
+	return nil
+}
+
+// Expiries returns every recorded expiry, soonest first.
+func (s *Store) Expiries() ([]Expiry, error) {
+	var out []Expiry
+	err := s.each("expiry", func(b []byte, name string) error {
+		var e Expiry
+		if err := json.Unmarshal(b, &e); err != nil {
+			return fmt.Errorf("parse expiry %s: %w", name, err)
+		}
+		out = append(out, e)
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Expires.Before(out[j].Expires) })
+	return out, err
+}
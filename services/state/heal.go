@@ -0,0 +1,88 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Heal is what a scheduled `runner heal` keeps about a deployed job: how to
+// reach its platform, and how each of its containers fared at the last check.
+// A run that deploys the job starts it afresh.
+type Heal struct {
+	Job          uuid.UUID        `json:"job"`
+	Platform     string           `json:"platform"`
+	PlatformData *json.RawMessage `json:"platform_data,omitempty"`
+
+	// Keyed by container name
+	Containers map[string]ContainerHeal `json:"containers,omitempty"`
+}
+
+// ContainerHeal is one container's record between checks.
+type ContainerHeal struct {
+	Restarts int `json:"restarts"` // restart count at the last check
+
+	// Recreated is set once its container was replaced for failing, and
+	// Degraded once it failed again and was reported. Since is when it
+	// started failing.
+	Recreated bool       `json:"recreated,omitempty"`
+	Degraded  bool       `json:"degraded,omitempty"`
+	Since     *time.Time `json:"since,omitempty"`
+}
+
+func (s *Store) healPath(job uuid.UUID) string {
+	return filepath.Join(s.Dir, "heal", job.String()+".json")
+}
+
+// SaveHeal writes the job's heal record atomically. Like an expiry it is only
+// readable by the runner, as platform data may hold credentials.
+func (s *Store) SaveHeal(h *Heal) error {
+	p := s.healPath(h.Job)
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return fmt.Errorf("create heal dir: %w", err)
+	}
+
+	b, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("write heal record of job %s: %w", h.Job, err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return fmt.Errorf("write heal record of job %s: %w", h.Job, err)
+	}
+	return nil
+}
+
+// RemoveHeal forgets the job once it is torn down; a job without a record is
+// not an error.
+func (s *Store) RemoveHeal(job uuid.UUID) error {
+	if err := os.Remove(s.healPath(job)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove heal record of job %s: %w", job, err)
+	}
+	return nil
+}
+
+// Heals returns the heal record of every deployed job, sorted by job.
+func (s *Store) Heals() ([]Heal, error) {
+	var out []Heal
+	err := s.each("heal", func(b []byte, name string) error {
+		var h Heal
+		if err := json.Unmarshal(b, &h); err != nil {
+			return fmt.Errorf("parse heal record %s: %w", name, err)
+		}
+		out = append(out, h)
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Job.String() < out[j].Job.String() })
+	return out, err
+}
@@ -0,0 +1,150 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Owner is the run that last claimed a job, so runs that started before it can
+// tell they were superseded. It is kept apart from JobState, which platforms
+// load once and save later in the run.
+type Owner struct {
+	Job        uuid.UUID `json:"job"`
+	Run        uuid.UUID `json:"run"`
+	Generation int64     `json:"generation"`
+	Claimed    time.Time `json:"claimed"`
+}
+
+// SupersededError is returned when a newer run owns the job.
+type SupersededError struct {
+	Run        uuid.UUID
+	Generation int64
+	Owner      Owner
+}
+
+func (e *SupersededError) Error() string {
+	return fmt.Sprintf("run %s (generation %d) was superseded by run %s (generation %d)", e.Run, e.Generation, e.Owner.Run, e.Owner.Generation)
+}
+
+func (s *Store) ownerPath(job uuid.UUID) string {
+	return filepath.Join(s.Dir, "owners", job.String()+".json")
+}
+
+// LoadOwner returns the job's owner, or nil if no run has claimed it.
+func (s *Store) LoadOwner(job uuid.UUID) (*Owner, error) {
+	b, err := os.ReadFile(s.ownerPath(job))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read owner of job %s: %w", job, err)
+	}
+	var o Owner
+	if err := json.Unmarshal(b, &o); err != nil {
+		return nil, fmt.Errorf("parse owner of job %s: %w", job, err)
+	}
+	return &o, nil
+}
+
+// Claim makes run the job's owner and returns its generation. A generation of 0
+// (the agent did not assign one) numbers the run after the current owner. A run
+// older than the owner gets a *SupersededError; the owner claiming again keeps
+// its generation. Claims of the same job, from this or another runner process,
+// take turns, so two runs starting at once can't both win.
+func (s *Store) Claim(job, run uuid.UUID, generation int64) (int64, error) {
+	p := s.ownerPath(job)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return 0, fmt.Errorf("create owners dir: %w", err)
+	}
+	unlock, err := lockFile(strings.TrimSuffix(p, ".json") + ".lock")
+	if err != nil {
+		return 0, fmt.Errorf("lock owner of job %s: %w", job, err)
+	}
+	defer unlock()
+
+	owner, err := s.LoadOwner(job)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case owner == nil:
+		if generation == 0 {
+			generation = 1
+		}
+	case owner.Run == run:
+		return max(owner.Generation, generation), nil
+	case generation == 0:
+		generation = owner.Generation + 1
+	case generation <= owner.Generation:
+		return 0, &SupersededError{Run: run, Generation: generation, Owner: *owner}
+	}
+
+	b, err := json.MarshalIndent(Owner{Job: job, Run: run, Generation: generation, Claimed: time.Now().UTC()}, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	if err := writeFile(p, b); err != nil {
+		return 0, fmt.Errorf("write owner of job %s: %w", job, err)
+	}
+	return generation, nil
+}
+
+// lockFile takes an exclusive lock on path, creating it if needed, and returns
+// the function that releases it. The kernel releases it if the process dies, so
+// a crashed run never leaves the job locked.
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// writeFile replaces path with b in one rename, through a temp file of its own
+// so concurrent writers never write into each other's.
+func writeFile(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// CheckOwner returns a *SupersededError once another run has claimed the job.
+func (s *Store) CheckOwner(job, run uuid.UUID, generation int64) error {
+	owner, err := s.LoadOwner(job)
+	if err != nil {
+		return err
+	}
+	if owner != nil && owner.Run != run {
+		return &SupersededError{Run: run, Generation: generation, Owner: *owner}
+	}
+	return nil
+}
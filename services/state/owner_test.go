@@ -0,0 +1,89 @@
+package state
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestClaimConcurrentRunsGetDistinctGenerations(t *testing.T) {
+	s := New(t.TempDir())
+	job := uuid.New()
+
+	const runs = 20
+	generations := make([]int64, runs)
+	var wg sync.WaitGroup
+	for i := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g, err := s.Claim(job, uuid.New(), 0)
+			if err != nil {
+				t.Error(err)
+			}
+			generations[i] = g
+		}()
+	}
+	wg.Wait()
+
+	slices.Sort(generations)
+	for i, g := range generations {
+		if g != int64(i+1) {
+			t.Fatalf("generations = %v, want 1 to %d once each", generations, runs)
+		}
+	}
+	owner, err := s.LoadOwner(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.Generation != runs {
+		t.Errorf("owner generation = %d, want %d", owner.Generation, runs)
+	}
+}
+
+func TestClaimConcurrentRunsOfOneGenerationOnlyOneWins(t *testing.T) {
+	s := New(t.TempDir())
+	job := uuid.New()
+
+	const runs = 20
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		won        []uuid.UUID
+		superseded int
+	)
+	for range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run := uuid.New()
+			_, err := s.Claim(job, run, 7)
+			mu.Lock()
+			defer mu.Unlock()
+			var se *SupersededError
+			switch {
+			case err == nil:
+				won = append(won, run)
+			case errors.As(err, &se):
+				superseded++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(won) != 1 || superseded != runs-1 {
+		t.Fatalf("%d runs claimed generation 7 and %d were superseded, want 1 and %d", len(won), superseded, runs-1)
+	}
+	owner, err := s.LoadOwner(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.Run != won[0] {
+		t.Errorf("owner is run %s, want the winner %s", owner.Run, won[0])
+	}
+}
@@ -0,0 +1,139 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/google/uuid"
+)
+
+// RunRecord is what the runner keeps about one run in the workspace, so local
+// tooling can see what is running and how recent runs ended without the agent.
+type RunRecord struct {
+	Run       uuid.UUID        `json:"run"`
+	Job       uuid.UUID        `json:"job"`
+	Platform  string           `json:"platform"`
+	Action    string           `json:"action"`
+	Status    models.RunStatus `json:"status"` // running until the run ends
+	PID       int              `json:"pid"`    // process executing the run
+	Started   time.Time        `json:"started"`
+	Finished  *time.Time       `json:"finished,omitempty"`
+	NotBefore *time.Time       `json:"not_before,omitempty"` // when a deferred run may start
+
+	Outcome  models.RunOutcome      `json:"outcome,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+	Message  *models.UserMessage    `json:"message,omitempty"`
+	Warnings []string               `json:"warnings,omitempty"`
+	Services []models.ServiceTiming `json:"services,omitempty"`
+
+	Readiness *models.JobReadiness `json:"readiness,omitempty"`
+}
+
+func (s *Store) runPath(run uuid.UUID) string {
+	return filepath.Join(s.Dir, "runs", run.String()+".json")
+}
+
+// EventsPath is where the run's event log is appended (see services/events).
+func (s *Store) EventsPath(run uuid.UUID) string {
+	return filepath.Join(s.Dir, "runs", run.String()+".events.jsonl")
+}
+
+// SaveRun writes the run record atomically (temp file + rename).
+func (s *Store) SaveRun(r *RunRecord) error {
+	p := s.runPath(r.Run)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("create runs dir: %w", err)
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("write run record %s: %w", r.Run, err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return fmt.Errorf("write run record %s: %w", r.Run, err)
+	}
+	return nil
+}
+
+// LoadRun returns the record of one run; os.ErrNotExist if there is none.
+func (s *Store) LoadRun(run uuid.UUID) (*RunRecord, error) {
+	b, err := os.ReadFile(s.runPath(run))
+	if err != nil {
+		return nil, err
+	}
+	var r RunRecord
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("parse run record %s: %w", run, err)
+	}
+	return &r, nil
+}
+
+// Runs returns every run record, newest first.
+func (s *Store) Runs() ([]RunRecord, error) {
+	var out []RunRecord
+	err := s.each("runs", func(b []byte, name string) error {
+		var r RunRecord
+		if err := json.Unmarshal(b, &r); err != nil {
+			return fmt.Errorf("parse run record %s: %w", name, err)
+		}
+		out = append(out, r)
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Started.After(out[j].Started) })
+	return out, err
+}
+
+// Jobs returns the state of every job the workspace has state for, sorted by job.
+func (s *Store) Jobs() ([]JobState, error) {
+	var out []JobState
+	err := s.each("state", func(b []byte, name string) error {
+		var st JobState
+		if err := json.Unmarshal(b, &st); err != nil {
+			return fmt.Errorf("parse job state %s: %w", name, err)
+		}
+		out = append(out, st)
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Job.String() < out[j].Job.String() })
+	return out, err
+}
+
+// each calls fn with the contents of every .json file in a workspace subdirectory.
+// A missing directory has no files.
+func (s *Store) each(dir string, fn func(b []byte, name string) error) error {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, dir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("list %s: %w", dir, err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(s.Dir, dir, e.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			continue // removed while listing
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(b, e.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Store persists per-job runner state as JSON files in the workspace,
+// so later invocations (e.g. an update of the same run) can see what already happened.
+type Store struct {
+	Dir string
+}
+
+type StepRecord struct {
+	Run         uuid.UUID         `json:"run"`
+	SpecHash    string            `json:"spec_hash"`
+	Outputs     map[string]string `json:"outputs,omitempty"`
+	CompletedAt time.Time         `json:"completed_at"`
+}
+
+type JobState struct {
+	Job uuid.UUID `json:"job"`
+
+	// Runner-role steps that completed successfully, keyed by service name
+	Steps map[string]StepRecord `json:"steps,omitempty"`
+
+	// Checksums of volumes filled from volume_sources, taken right after filling
+	// them, keyed by volume name
+	VolumeChecksums map[string]string `json:"volume_checksums,omitempty"`
+
+	// When each of the job's caches was last mounted, keyed by cache key, for
+	// evicting the least recently used
+	Caches map[string]time.Time `json:"caches,omitempty"`
+}
+
+func New(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+func (s *Store) path(job uuid.UUID) string {
+	return filepath.Join(s.Dir, "state", job.String()+".json")
+}
+
+// Load returns the stored state for the job, or an empty state if none exists yet.
+func (s *Store) Load(job uuid.UUID) (*JobState, error) {
+	b, err := os.ReadFile(s.path(job))
+	if errors.Is(err, os.ErrNotExist) {
+		return &JobState{Job: job, Steps: map[string]StepRecord{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read job state %s: %w", job, err)
+	}
+
+	var st JobState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, fmt.Errorf("parse job state %s: %w", job, err)
+	}
+	if st.Steps == nil {
+		st.Steps = map[string]StepRecord{}
+	}
+	return &st, nil
+}
+
+// Save writes the state atomically (temp file + rename).
+func (s *Store) Save(st *JobState) error {
+	p := s.path(st.Job)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("write job state %s: %w", st.Job, err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return fmt.Errorf("write job state %s: %w", st.Job, err)
+	}
+	return nil
+}
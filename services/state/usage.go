@@ -0,0 +1,87 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/google/uuid"
+)
+
+// Usage is a job's accumulated usage, and what a scheduled `runner account` needs
+// to sample it again.
+type Usage struct {
+	models.JobUsage
+	PlatformData *json.RawMessage `json:"platform_data,omitempty"`
+}
+
+func (s *Store) usagePath(job uuid.UUID) string {
+	return filepath.Join(s.Dir, "usage", job.String()+".json")
+}
+
+// LoadUsage returns the job's recorded usage, or an empty one if none exists yet.
+func (s *Store) LoadUsage(job uuid.UUID) (*Usage, error) {
+	b, err := os.ReadFile(s.usagePath(job))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Usage{JobUsage: models.JobUsage{Job: job}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read usage of job %s: %w", job, err)
+	}
+	var u Usage
+	if err := json.Unmarshal(b, &u); err != nil {
+		return nil, fmt.Errorf("parse usage of job %s: %w", job, err)
+	}
+	return &u, nil
+}
+
+// SaveUsage writes the job's usage atomically. Like an expiry it is only readable
+// by the runner, as platform data may hold credentials.
+func (s *Store) SaveUsage(u *Usage) error {
+	p := s.usagePath(u.Job)
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return fmt.Errorf("create usage dir: %w", err)
+	}
+
+	b, err := json.MarshalIndent(u, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("write usage of job %s: %w", u.Job, err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return fmt.Errorf("write usage of job %s: %w", u.Job, err)
+	}
+	return nil
+}
+
+// RemoveUsage forgets the job's usage once it is torn down; a job without one is
+// not an error.
+func (s *Store) RemoveUsage(job uuid.UUID) error {
+	if err := os.Remove(s.usagePath(job)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove usage of job %s: %w", job, err)
+	}
+	return nil
+}
+
+// Usages returns the recorded usage of every job, sorted by job.
+func (s *Store) Usages() ([]Usage, error) {
+	var out []Usage
+	err := s.each("usage", func(b []byte, name string) error {
+		var u Usage
+		if err := json.Unmarshal(b, &u); err != nil {
+			return fmt.Errorf("parse usage %s: %w", name, err)
+		}
+		out = append(out, u)
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Job.String() < out[j].Job.String() })
+	return out, err
+}
@@ -0,0 +1,200 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/google/uuid"
+)
+
+// A Lookup resolves the reference inside ${...}. ok=false leaves the reference
+// untouched; a non-nil error aborts the expansion.
+type Lookup func(ref string) (value string, ok bool, err error)
+
+// Interpolate replaces ${...} references for which lookup reports a value.
+// ok=false from lookup leaves the reference untouched (it may be meant for the container's shell);
+// a non-nil error aborts.
+func Interpolate(s string, lookup Lookup) (string, error) {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		end += start
+
+		ref := s[start+2 : end]
+		v, ok, err := lookup(ref)
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(s[:start])
+		if ok {
+			b.WriteString(v)
+		} else {
+			b.WriteString(s[start : end+1])
+		}
+		s = s[end+1:]
+	}
+}
+
+// Refs returns the references inside ${...} in s, in order.
+func Refs(s string) []string {
+	var refs []string
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			return refs
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return refs
+		}
+		refs = append(refs, s[start+2:start+end])
+		s = s[start+end+1:]
+	}
+}
+
+// Vars resolves ${JOB} and ${RUN} to the ids of the job and the run.
+func Vars(job, run uuid.UUID) Lookup {
+	return func(ref string) (string, bool, error) {
+		switch ref {
+		case "JOB":
+			return job.String(), true, nil
+		case "RUN":
+			return run.String(), true, nil
+		}
+		return "", false, nil
+	}
+}
+
+// Facts are values a run only learns while it executes (container names, allocated
+// host ports, networks), keyed by service and then by fact name. Connection metadata
+// and environment values refer to them as ${services.<service>.<fact>}.
+//
+// Platforms record at least:
+//
+//	address                  name (or IP) other services reach it at; recorded
+//	                         for every service before any is set up (not on ecs)
+//	alias                    first alias, or the container name
+//	container                container (or swarm service) name
+//	network                  the network the service was attached to first
+//	host_port.<port>         host port published for container port <port>
+//	resources.<name>.network network of a resource the service produces
+type Facts map[string]map[string]string
+
+// Set records one fact about a service.
+func (f Facts) Set(service, key, value string) {
+	if f[service] == nil {
+		f[service] = map[string]string{}
+	}
+	f[service][key] = value
+}
+
+// Lookup resolves services.<service>.<fact>. Other references are left alone.
+func (f Facts) Lookup(ref string) (string, bool, error) {
+	rest, ok := strings.CutPrefix(ref, "services.")
+	if !ok {
+		return "", false, nil
+	}
+	service, key, ok := strings.Cut(rest, ".")
+	if !ok || service == "" || key == "" {
+		return "", false, fmt.Errorf("invalid service reference ${%s} (want ${services.<name>.<fact>})", ref)
+	}
+
+	facts, ok := f[service]
+	if !ok {
+		return "", false, fmt.Errorf("${%s}: service %q was not set up in this run", ref, service)
+	}
+	v, ok := facts[key]
+	if !ok {
+		return "", false, fmt.Errorf("${%s}: service %q has no %q", ref, service, key)
+	}
+	return v, true, nil
+}
+
+// ExpandJSON interpolates every string value (not keys) in a JSON document.
+func ExpandJSON(raw json.RawMessage, lookup Lookup) (json.RawMessage, error) {
+	if len(raw) == 0 || !bytes.Contains(raw, []byte("${")) {
+		return raw, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	doc, err := expand(doc, lookup)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+func expand(v any, lookup Lookup) (any, error) {
+	switch x := v.(type) {
+	case string:
+		return Interpolate(x, lookup)
+	case []any:
+		for i := range x {
+			e, err := expand(x[i], lookup)
+			if err != nil {
+				return nil, err
+			}
+			x[i] = e
+		}
+	case map[string]any:
+		for k := range x {
+			e, err := expand(x[k], lookup)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			x[k] = e
+		}
+	}
+	return v, nil
+}
+
+// ExpandConnectionPlan returns a copy of the plan with the metadata of each
+// connection to create expanded.
+func ExpandConnectionPlan(cp *models.ConnectionPlan, lookup Lookup) (*models.ConnectionPlan, error) {
+	if cp == nil || cp.Create == nil {
+		return cp, nil
+	}
+
+	create := make([]models.CreateConnectionSpec, len(*cp.Create))
+	for i, spec := range *cp.Create {
+		md, err := ExpandJSON(spec.Metadata, lookup)
+		if err != nil {
+			return nil, fmt.Errorf("connection %d metadata: %w", i, err)
+		}
+		spec.Metadata = md
+		create[i] = spec
+	}
+	return &models.ConnectionPlan{Create: &create, Remove: cp.Remove}, nil
+}
+
+// Chain tries each lookup in turn and uses the first that resolves the reference.
+func Chain(lookups ...Lookup) Lookup {
+	return func(ref string) (string, bool, error) {
+		for _, l := range lookups {
+			v, ok, err := l(ref)
+			if err != nil || ok {
+				return v, ok, err
+			}
+		}
+		return "", false, nil
+	}
+}
@@ -0,0 +1,174 @@
+package validate
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// Capabilities checks the metadata against what the platform can honor. Features
+// the platform would silently ignore are warnings; ones it cannot run are errors.
+func Capabilities(cfg models.Configuration, caps models.PlatformCapabilities) []Finding {
+	out := []Finding{}
+	errorf := func(ptr string, format string, args ...any) {
+		out = append(out, Finding{Severity: SeverityError, Pointer: ptr, Message: fmt.Sprintf(format, args...)})
+	}
+	warnf := func(ptr string, format string, args ...any) {
+		out = append(out, Finding{Severity: SeverityWarning, Pointer: ptr, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !caps.CgroupParent && cfg.CgroupParent != "" {
+		// An error: the job would run without the cap the operator set up for it.
+		errorf(Pointer("cgroup_parent"), "platform %s cannot place containers under cgroup_parent", caps.Platform)
+	}
+	if cfg.Metadata == nil {
+		return out
+	}
+
+	if !caps.VolumeSources {
+		for name := range cfg.Metadata.VolumeSources {
+			warnf(Pointer("metadata", "volume_sources", name), "platform %s does not fill volumes from images; the volume starts empty", caps.Platform)
+		}
+	}
+
+	for name, svc := range cfg.Metadata.Services {
+		at := func(tokens ...any) string {
+			return Pointer(append([]any{"metadata", "services", name}, tokens...)...)
+		}
+
+		if svc.Role != nil && *svc.Role == models.ServiceRoleRunner && !caps.RunnerSteps {
+			errorf(at("role"), "platform %s cannot run runner-role steps", caps.Platform)
+		}
+		if !caps.SSHKeys && svc.SSH != nil {
+			errorf(at("ssh"), "platform %s cannot provision ssh keys for runner steps", caps.Platform)
+		}
+		if !caps.Caches && len(svc.Caches) > 0 {
+			warnf(at("caches"), "platform %s does not keep caches; the step starts without them", caps.Platform)
+		}
+		if !caps.Files && len(svc.Files) > 0 {
+			errorf(at("files"), "platform %s cannot write files into containers", caps.Platform)
+		}
+
+		if svc.Scale != nil {
+			mode := models.ScaleMode(svc.Scale.Mode)
+			if mode != "" && !slices.Contains(caps.ScaleModes, mode) {
+				warnf(at("scale", "mode"), "platform %s does not honor scale mode %q; the service runs a single instance", caps.Platform, mode)
+			} else if !caps.Replicas && ((svc.Scale.Min != nil && *svc.Scale.Min > 1) || (svc.Scale.Max != nil && *svc.Scale.Max > 1)) {
+				warnf(at("scale"), "platform %s runs a single instance of each service", caps.Platform)
+			}
+		}
+
+		isRunner := svc.Role != nil && *svc.Role == models.ServiceRoleRunner
+		if svc.Strategy != nil && !isRunner && len(caps.Strategies) > 0 && !slices.Contains(caps.Strategies, *svc.Strategy) {
+			// An error: falling back to another strategy changes what an update costs.
+			errorf(at("strategy"), "platform %s does not support strategy %q (supported: %v)", caps.Platform, *svc.Strategy, caps.Strategies)
+		}
+
+		if svc.Bindings != nil {
+			for i, b := range *svc.Bindings {
+				if !caps.HostPorts && b.HostPort != nil && b.ContainerPort != nil && *b.HostPort != *b.ContainerPort {
+					errorf(at("bindings", i, "host_port"), "platform %s cannot publish container port %d on another host port (%d)", caps.Platform, *b.ContainerPort, *b.HostPort)
+				}
+				if !caps.HostIP && b.HostIP != nil {
+					warnf(at("bindings", i, "host_ip"), "platform %s ignores host_ip", caps.Platform)
+				}
+			}
+		}
+
+		if !caps.NetworkGroups && svc.NetworkGroups != nil && len(*svc.NetworkGroups) > 0 {
+			warnf(at("network_groups"), "platform %s does not isolate network groups", caps.Platform)
+		}
+		if !caps.Addressing && len(svc.Endpoints) > 0 {
+			warnf(at("endpoints"), "platform %s ignores fixed endpoint addresses", caps.Platform)
+		}
+		if !caps.Hostnames && (svc.Hostname != nil || svc.Domainname != nil) {
+			warnf(at("hostname"), "platform %s ignores hostname and domainname", caps.Platform)
+		}
+		if !caps.PinHosts && len(svc.PinHosts) > 0 {
+			warnf(at("pin_hosts"), "platform %s ignores pin_hosts", caps.Platform)
+		}
+		if !caps.DNS && (len(svc.DNS) > 0 || len(svc.DNSSearch) > 0 || len(svc.DNSOptions) > 0) {
+			warnf(at("dns"), "platform %s ignores dns, dns_search and dns_options", caps.Platform)
+		}
+		if !caps.PrimaryNetwork && svc.PrimaryNetwork != nil {
+			warnf(at("primary_network"), "platform %s ignores primary_network", caps.Platform)
+		}
+		if !caps.Aliases && svc.Aliases != nil && len(*svc.Aliases) > 0 {
+			warnf(at("aliases"), "platform %s ignores aliases", caps.Platform)
+		}
+		if !caps.PullPolicies && svc.PullPolicy != nil && *svc.PullPolicy != models.PullAlways {
+			warnf(at("pull_policy"), "platform %s pulls images itself and ignores pull_policy %q", caps.Platform, *svc.PullPolicy)
+		}
+		if !caps.Placement && svc.Placement != nil {
+			warnf(at("placement"), "platform %s runs every service on one host and ignores placement", caps.Platform)
+		}
+		if !caps.Healthchecks && svc.Healthcheck != nil {
+			warnf(at("healthcheck"), "platform %s ignores healthchecks and starts dependents without waiting", caps.Platform)
+		}
+		if !caps.Runtimes && svc.Runtime != nil && *svc.Runtime != "default" {
+			// An error, not a warning: the runtime is usually there to sandbox the service.
+			errorf(at("runtime"), "platform %s cannot run services under runtime %q", caps.Platform, *svc.Runtime)
+		}
+		if !caps.Privileged && svc.Privileged != nil && *svc.Privileged {
+			errorf(at("privileged"), "platform %s cannot run privileged services", caps.Platform)
+		}
+		if !caps.Init && svc.Init != nil && *svc.Init {
+			warnf(at("init"), "platform %s has no init process; zombies are only reaped if the service does it", caps.Platform)
+		}
+		if !caps.StopSignals && svc.StopSignal != nil {
+			warnf(at("stop_signal"), "platform %s ignores stop_signal and stops services with SIGTERM", caps.Platform)
+		}
+		if !caps.Restarts && svc.Restart != nil {
+			warnf(at("restart"), "platform %s ignores restart and keeps services running itself", caps.Platform)
+		}
+		if !caps.SecurityOpts && len(svc.SecurityOpt) > 0 {
+			// An error: running without the hardening asked for is not a safe fallback.
+			errorf(at("security_opt"), "platform %s cannot apply security_opt", caps.Platform)
+		}
+		if !caps.KernelCaps && (len(svc.CapAdd) > 0 || len(svc.CapDrop) > 0) {
+			warnf(at("cap_add"), "platform %s ignores cap_add and cap_drop", caps.Platform)
+		}
+		if !caps.GroupAdd && len(svc.GroupAdd) > 0 {
+			warnf(at("group_add"), "platform %s ignores group_add", caps.Platform)
+		}
+		if !caps.Checkpoints && svc.CheckpointOnUpdate != nil && *svc.CheckpointOnUpdate {
+			warnf(at("checkpoint_on_update"), "platform %s cannot checkpoint services; updates restart them fresh", caps.Platform)
+		}
+		if !caps.Devices && len(svc.Devices) > 0 {
+			// An error: a service given hardware needs it, and would start without it.
+			errorf(at("devices"), "platform %s cannot map host devices", caps.Platform)
+		}
+		if !caps.GPU && len(svc.DeviceRequests) > 0 {
+			warnf(at("device_requests"), "platform %s does not attach devices", caps.Platform)
+		}
+		if !caps.MemoryLimits && svc.MemoryLimit() != nil {
+			warnf(at("memory"), "platform %s does not enforce memory limits", caps.Platform)
+		}
+		if !caps.CPULimits && svc.Limits != nil && svc.Limits.Cpus != nil {
+			warnf(at("limits", "cpus"), "platform %s does not enforce cpu limits", caps.Platform)
+		}
+		if !caps.PidsLimits && svc.Limits != nil && svc.Limits.PidsLimit != nil {
+			warnf(at("limits", "pids_limit"), "platform %s does not enforce pids_limit", caps.Platform)
+		}
+		if !caps.MemoryTuning && (svc.MemorySwap != nil || svc.MemorySwappiness != nil || svc.OomScoreAdj != nil || svc.OomKillDisable != nil) {
+			warnf(at("memory_swap"), "platform %s ignores memory_swap, memory_swappiness, oom_score_adj and oom_kill_disable", caps.Platform)
+		}
+		if !caps.SharedMemory && (svc.ShmSize != nil || svc.Ipc != nil) {
+			warnf(at("shm_size"), "platform %s ignores shm_size and ipc", caps.Platform)
+		}
+		if !caps.PIDNamespaces && svc.Pid != nil {
+			warnf(at("pid"), "platform %s ignores pid", caps.Platform)
+		}
+		if !caps.UsernsMode && svc.UsernsMode != nil {
+			warnf(at("userns_mode"), "platform %s ignores userns_mode", caps.Platform)
+		}
+		if !caps.CPUPinning && (svc.CpusetCpus != nil || svc.CpusetMems != nil) {
+			warnf(at("cpuset_cpus"), "platform %s does not pin services to CPUs or memory nodes", caps.Platform)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Pointer < out[j].Pointer })
+	return out
+}
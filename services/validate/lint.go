@@ -0,0 +1,113 @@
+package validate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// Lint rule ids. Configuration.LintRules can set each to "off", "warning" or "error".
+const (
+	RuleLatestTag      = "latest-tag"      // image uses :latest or no tag
+	RuleResourceLimits = "resource-limits" // long-running service without a memory limit
+	RuleWorldExposed   = "world-exposed"   // host port published on every interface
+	RuleRunnerBindings = "runner-bindings" // runner step publishes host ports
+	RuleNoHealthcheck  = "no-healthcheck"  // long-running service without a healthcheck
+)
+
+// Rules lists every lint rule with its default severity.
+var Rules = map[string]Severity{
+	RuleLatestTag:      SeverityWarning,
+	RuleResourceLimits: SeverityWarning,
+	RuleWorldExposed:   SeverityWarning,
+	RuleRunnerBindings: SeverityWarning,
+	RuleNoHealthcheck:  severityOff, // opt in; many images need no probe
+}
+
+const severityOff Severity = "off"
+
+// Lint applies the best-practice rules. Unlike Configuration, findings here are
+// advice; they only become errors when LintRules raises a rule to "error".
+func Lint(cfg models.Configuration) ([]Finding, error) {
+	severity := make(map[string]Severity, len(Rules))
+	for rule, sev := range Rules {
+		severity[rule] = sev
+	}
+	for rule, v := range cfg.LintRules {
+		if _, ok := Rules[rule]; !ok {
+			return nil, fmt.Errorf("lint_rules: unknown rule %q", rule)
+		}
+		switch sev := Severity(v); sev {
+		case severityOff, SeverityWarning, SeverityError:
+			severity[rule] = sev
+		default:
+			return nil, fmt.Errorf("lint_rules.%s: want off, warning or error, got %q", rule, v)
+		}
+	}
+
+	out := []Finding{}
+	report := func(rule, ptr, format string, args ...any) {
+		if severity[rule] == severityOff {
+			return
+		}
+		out = append(out, Finding{Severity: severity[rule], Pointer: ptr, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	md := cfg.Metadata
+	if md == nil {
+		return out, nil
+	}
+
+	for name, svc := range md.Services {
+		at := func(tokens ...any) string {
+			return Pointer(append([]any{"metadata", "services", name}, tokens...)...)
+		}
+		runner := svc.Role != nil && *svc.Role == models.ServiceRoleRunner
+
+		if tag, ok := imageTag(svc.Image); !ok {
+			report(RuleLatestTag, at("image"), "image %q has no tag (pin a version or digest)", svc.Image)
+		} else if tag == "latest" {
+			report(RuleLatestTag, at("image"), "image %q uses the latest tag (pin a version or digest)", svc.Image)
+		}
+
+		if !runner && svc.MemoryLimit() == nil {
+			report(RuleResourceLimits, at(), "no memory limit set")
+		}
+		if !runner && svc.Healthcheck == nil {
+			report(RuleNoHealthcheck, at(), "no healthcheck set (a hung process is never reported unhealthy)")
+		}
+
+		if svc.Bindings != nil {
+			for i, b := range *svc.Bindings {
+				if b.HostPort == nil {
+					continue
+				}
+				if runner {
+					report(RuleRunnerBindings, at("bindings", i), "runner steps should not publish host ports")
+				}
+				if b.HostIP == nil || *b.HostIP == "0.0.0.0" || *b.HostIP == "::" {
+					report(RuleWorldExposed, at("bindings", i), "host port %d is published on all interfaces (set host_ip)", *b.HostPort)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Pointer < out[j].Pointer })
+	return out, nil
+}
+
+// imageTag returns the tag of an image reference; ok is false when the image
+// has neither a tag nor a digest.
+func imageTag(image string) (tag string, ok bool) {
+	if strings.Contains(image, "@") {
+		return "", true
+	}
+	// The tag follows the last ":" after the last "/" (a ":" before it is a registry port).
+	last := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(last, ":"); i >= 0 {
+		return last[i+1:], true
+	}
+	return "", false
+}
@@ -0,0 +1,89 @@
+package validate
+
+import (
+	"maps"
+	"net/netip"
+	"slices"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// checkNetworks checks metadata.networks and each service's fixed endpoints:
+// addresses must parse, sit inside their network's subnets and not be taken twice.
+func checkNetworks(md *models.Metadata, errorf, warnf func(ptr string, format string, args ...any)) {
+	used := map[string]bool{}
+	for _, svc := range md.Services {
+		if svc.NetworkGroups != nil {
+			for _, g := range *svc.NetworkGroups {
+				used[g] = true
+			}
+		}
+	}
+
+	subnets := map[string][]netip.Prefix{}
+	for _, group := range slices.Sorted(maps.Keys(md.Networks)) {
+		if !used[group] {
+			warnf(Pointer("metadata", "networks", group), "no service joins network group %q", group)
+		}
+		for i, s := range md.Networks[group].Subnets {
+			at := func(key string) string { return Pointer("metadata", "networks", group, "subnets", i, key) }
+			prefix, err := netip.ParsePrefix(s.Subnet)
+			if err != nil {
+				errorf(at("subnet"), "invalid subnet %q", s.Subnet)
+				continue
+			}
+			subnets[group] = append(subnets[group], prefix.Masked())
+			if s.Gateway != "" {
+				if gw, err := netip.ParseAddr(s.Gateway); err != nil || !prefix.Contains(gw) {
+					errorf(at("gateway"), "gateway %q is not an address in %s", s.Gateway, prefix)
+				}
+			}
+			if s.IPRange != "" {
+				if r, err := netip.ParsePrefix(s.IPRange); err != nil || !prefix.Contains(r.Addr()) || r.Bits() < prefix.Bits() {
+					errorf(at("ip_range"), "ip_range %q is not a range inside %s", s.IPRange, prefix)
+				}
+			}
+		}
+	}
+
+	taken := map[string]string{} // group/address -> service
+	for _, name := range slices.Sorted(maps.Keys(md.Services)) {
+		svc := md.Services[name]
+		for _, group := range slices.Sorted(maps.Keys(svc.Endpoints)) {
+			ep := svc.Endpoints[group]
+			at := func(tokens ...any) string {
+				return Pointer(append([]any{"metadata", "services", name, "endpoints", group}, tokens...)...)
+			}
+			if svc.NetworkGroups == nil || !slices.Contains(*svc.NetworkGroups, group) {
+				errorf(at(), "network group %q is not one of the service's network_groups", group)
+				continue
+			}
+			for _, a := range []struct {
+				key, value string
+				v6         bool
+			}{{"ipv4_address", ep.IPv4Address, false}, {"ipv6_address", ep.IPv6Address, true}} {
+				if a.value == "" {
+					continue
+				}
+				addr, err := netip.ParseAddr(a.value)
+				if err != nil || addr.Is6() != a.v6 {
+					errorf(at(a.key), "invalid %s %q", a.key, a.value)
+					continue
+				}
+				if !slices.ContainsFunc(subnets[group], func(p netip.Prefix) bool { return p.Contains(addr) }) {
+					errorf(at(a.key), "%s is not inside a subnet of network group %q in metadata.networks", addr, group)
+					continue
+				}
+				if other, ok := taken[group+"/"+addr.String()]; ok {
+					errorf(at(a.key), "%s is already the address of service %q", addr, other)
+				}
+				taken[group+"/"+addr.String()] = name
+			}
+			for i, ip := range ep.LinkLocalIPs {
+				if addr, err := netip.ParseAddr(ip); err != nil || !addr.IsLinkLocalUnicast() {
+					errorf(at("link_local_ips", i), "%q is not a link-local address", ip)
+				}
+			}
+		}
+	}
+}
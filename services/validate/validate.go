@@ -0,0 +1,697 @@
+package validate
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/checksum"
+	"github.com/ezenkico/deploy-commander/runner/services/cpuset"
+	"github.com/ezenkico/deploy-commander/runner/services/device"
+	"github.com/ezenkico/deploy-commander/runner/services/linuxcap"
+	"github.com/ezenkico/deploy-commander/runner/services/phase"
+	"github.com/ezenkico/deploy-commander/runner/services/plan"
+	"github.com/ezenkico/deploy-commander/runner/services/platforms"
+	"github.com/ezenkico/deploy-commander/runner/services/secopt"
+	"github.com/ezenkico/deploy-commander/runner/services/secrets"
+	"github.com/ezenkico/deploy-commander/runner/services/template"
+	"github.com/ezenkico/deploy-commander/runner/services/window"
+	"github.com/moby/sys/signal"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is one problem in a configuration. Pointer is an RFC 6901 JSON pointer
+// into the configuration document, e.g. /metadata/services/web/volumes/0/mount_path.
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Pointer  string   `json:"pointer"`
+	Rule     string   `json:"rule,omitempty"` // lint rule id; empty for hard validation errors
+	Message  string   `json:"message"`
+}
+
+func (f Finding) String() string {
+	if f.Rule != "" {
+		return fmt.Sprintf("%s: %s: %s [%s]", f.Pointer, f.Severity, f.Message, f.Rule)
+	}
+	return fmt.Sprintf("%s: %s: %s", f.Pointer, f.Severity, f.Message)
+}
+
+// Pointer builds a JSON pointer from path tokens, escaping "~" and "/".
+func Pointer(tokens ...any) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		s := fmt.Sprint(t)
+		s = strings.ReplaceAll(s, "~", "~0")
+		s = strings.ReplaceAll(s, "/", "~1")
+		b.WriteString("/")
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+// HasErrors reports whether any finding is an error.
+func HasErrors(findings []Finding) bool {
+	return slices.ContainsFunc(findings, func(f Finding) bool { return f.Severity == SeverityError })
+}
+
+var pullPolicies = []models.PullPolicy{models.PullAlways, models.PullIfNotPresent, models.PullNever}
+
+var strategies = []models.DeployStrategy{
+	models.StrategyRecreate,
+	models.StrategyBlueGreen,
+	models.StrategyRolling,
+	models.StrategyCanary,
+}
+
+var failurePolicies = []models.FailurePolicy{
+	models.FailurePolicyAbort,
+	models.FailurePolicyRollback,
+	models.FailurePolicyContinue,
+	models.FailurePolicyIgnore,
+}
+
+var scaleModes = []models.ScaleMode{
+	models.ScaleModeSingle,
+	models.ScaleModeAutoscale,
+	models.ScaleModeAutoscaleCore,
+	models.ScaleModeGlobal,
+}
+
+// Configuration runs every check that needs neither a platform nor the agent.
+// Findings are sorted by pointer so output is stable.
+func Configuration(cfg models.Configuration) []Finding {
+	out := []Finding{}
+	errorf := func(ptr string, format string, args ...any) {
+		out = append(out, Finding{Severity: SeverityError, Pointer: ptr, Message: fmt.Sprintf(format, args...)})
+	}
+	warnf := func(ptr string, format string, args ...any) {
+		out = append(out, Finding{Severity: SeverityWarning, Pointer: ptr, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !cfg.Action.Valid() {
+		errorf(Pointer("action"), "unknown action %q (valid: %v)", cfg.Action, models.Actions())
+	}
+	if _, err := phase.Timeouts(cfg.PhaseTimeouts); err != nil {
+		errorf(Pointer("phase_timeouts"), "%v", err)
+	}
+	if m := cfg.Metrics; m != nil {
+		if m.Protocol != models.MetricsProtocolPushgateway && m.Protocol != models.MetricsProtocolOTLP {
+			errorf(Pointer("metrics", "protocol"), "unknown metrics protocol %q (valid: pushgateway, otlp)", m.Protocol)
+		}
+		if u, err := url.Parse(m.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			errorf(Pointer("metrics", "url"), "invalid metrics url %q", m.URL)
+		}
+	}
+
+	if cfg.Action == models.ActionPortForward {
+		switch f := cfg.PortForward; {
+		case f == nil:
+			errorf(Pointer("port_forward"), "port_forward is required for action port-forward")
+		default:
+			if strings.TrimSpace(f.Service) == "" {
+				errorf(Pointer("port_forward", "service"), "service is required")
+			}
+			if f.Port < 1 || f.Port > 65535 {
+				errorf(Pointer("port_forward", "port"), "port %d is out of range", f.Port)
+			}
+			if _, _, err := net.SplitHostPort(f.ListenAddr()); err != nil {
+				errorf(Pointer("port_forward", "listen"), "invalid listen address %q: %v", f.Listen, err)
+			}
+		}
+	}
+
+	if cfg.TTL != nil {
+		switch {
+		case *cfg.TTL <= 0:
+			errorf(Pointer("ttl"), "ttl must be positive")
+		case cfg.Action != models.ActionSetup && cfg.Action != models.ActionUpdate && cfg.Action != models.ActionClone:
+			warnf(Pointer("ttl"), "ttl is ignored for action %s", cfg.Action)
+		}
+	}
+	for i, w := range cfg.DeployWindows {
+		if err := window.Validate(w); err != nil {
+			errorf(Pointer("deploy_windows", i), "%v", err)
+		}
+	}
+	if len(cfg.DeployWindows) > 0 && (cfg.Action == models.ActionPortForward || cfg.Action == models.ActionSnapshot) {
+		warnf(Pointer("deploy_windows"), "deploy_windows is ignored for action %s, which does not change the job", cfg.Action)
+	}
+	if cfg.Action == models.ActionClone && cfg.Bundle == "" {
+		errorf(Pointer("bundle"), "bundle is required for action clone")
+	}
+	if c := cfg.CgroupParent; c != "" {
+		switch {
+		case strings.ContainsFunc(c, unicode.IsSpace):
+			errorf(Pointer("cgroup_parent"), "cgroup_parent %q contains whitespace", c)
+		case slices.Contains(strings.Split(c, "/"), ".."):
+			errorf(Pointer("cgroup_parent"), "cgroup_parent %q cannot contain ..", c)
+		case strings.HasSuffix(c, ".slice") && strings.Contains(c, "/"):
+			errorf(Pointer("cgroup_parent"), "cgroup_parent %q: a systemd slice is a name, not a path", c)
+		}
+	}
+
+	md := cfg.Metadata
+	if md == nil {
+		return out
+	}
+
+	checkLabels(md.Labels, errorf, "metadata", "labels")
+	checkNetworks(md, errorf, warnf)
+
+	declared := map[string]struct{}{}
+	if md.Volumes != nil {
+		for i, v := range *md.Volumes {
+			name := strings.TrimSpace(v)
+			switch {
+			case name == "":
+				errorf(Pointer("metadata", "volumes", i), "volume name is empty")
+			case hasKey(declared, name):
+				errorf(Pointer("metadata", "volumes", i), "duplicate volume %q", name)
+			}
+			declared[name] = struct{}{}
+		}
+	}
+	for _, v := range slices.Sorted(maps.Keys(md.VolumeSources)) {
+		src := md.VolumeSources[v]
+		if !hasKey(declared, v) {
+			errorf(Pointer("metadata", "volume_sources", v), "volume %q is not in metadata.volumes", v)
+		}
+		if strings.TrimSpace(src.Image) == "" {
+			errorf(Pointer("metadata", "volume_sources", v, "image"), "image is required")
+		}
+		if !strings.HasPrefix(src.Path, "/") || src.Path == "/" {
+			errorf(Pointer("metadata", "volume_sources", v, "path"), "path %q must be an absolute directory other than /", src.Path)
+		}
+		if src.Checksum != "" {
+			if sum, ok := strings.CutPrefix(src.Checksum, checksum.Prefix); !ok || len(sum) != 64 || strings.Trim(sum, "0123456789abcdef") != "" {
+				errorf(Pointer("metadata", "volume_sources", v, "checksum"), "checksum %q must be %s followed by 64 lowercase hex digits", src.Checksum, checksum.Prefix)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(md.Services))
+	for name := range md.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		svc := md.Services[name]
+		at := func(tokens ...any) string {
+			return Pointer(append([]any{"metadata", "services", name}, tokens...)...)
+		}
+
+		if strings.TrimSpace(svc.Image) == "" {
+			errorf(at("image"), "image is required")
+		}
+		if _, err := platforms.ImagePlatform(&svc); err != nil {
+			errorf(at("platform"), "%v", err)
+		}
+		if svc.PullPolicy != nil && !slices.Contains(pullPolicies, *svc.PullPolicy) {
+			errorf(at("pull_policy"), "unknown pull_policy %q (valid: %v)", *svc.PullPolicy, pullPolicies)
+		}
+		if svc.Role != nil && !svc.Role.Valid() {
+			errorf(at("role"), "unknown role %q (valid: %v)", *svc.Role, models.ServiceRoles())
+		}
+		if svc.User != nil && strings.TrimSpace(*svc.User) == "" {
+			errorf(at("user"), "user is empty")
+		}
+		checkLabels(svc.Labels, errorf, "metadata", "services", name, "labels")
+		for key, caps := range map[string][]string{"cap_add": svc.CapAdd, "cap_drop": svc.CapDrop} {
+			for i, c := range caps {
+				if !linuxcap.Valid(c) {
+					errorf(at(key, i), "unknown capability %q", c)
+				}
+			}
+		}
+		for i, g := range svc.GroupAdd {
+			if g == "" || strings.ContainsAny(g, ": \t") || strings.HasPrefix(g, "-") {
+				errorf(at("group_add", i), "invalid group %q (a group name or GID)", g)
+			}
+		}
+		if svc.Runtime != nil && strings.TrimSpace(*svc.Runtime) == "" {
+			errorf(at("runtime"), "runtime is empty (use default for the daemon's)")
+		}
+		if svc.Hostname != nil && !validHostname(*svc.Hostname, 64) {
+			errorf(at("hostname"), "invalid hostname %q", *svc.Hostname)
+		}
+		if svc.Domainname != nil && !validHostname(*svc.Domainname, 253) {
+			errorf(at("domainname"), "invalid domainname %q", *svc.Domainname)
+		}
+		if svc.Restart != nil {
+			if _, _, err := svc.Restart.Mode(); err != nil {
+				errorf(at("restart"), "%v", err)
+			} else if svc.Role != nil && *svc.Role == models.ServiceRoleRunner {
+				warnf(at("restart"), "runner steps never restart; restart is ignored")
+			}
+		}
+		if svc.SSH != nil {
+			if svc.Role == nil || *svc.Role != models.ServiceRoleRunner {
+				warnf(at("ssh"), "ssh only applies to runner steps; it is ignored")
+			}
+			if strings.TrimSpace(svc.SSH.Key) == "" {
+				errorf(at("ssh", "key"), "ssh key is required")
+			} else if _, ok, err := secrets.Parse(svc.SSH.Key); err != nil {
+				errorf(at("ssh", "key"), "%v", err)
+			} else if !ok {
+				warnf(at("ssh", "key"), "ssh key is inline in the metadata; use a %s reference", secrets.Scheme)
+			}
+			if strings.TrimSpace(svc.SSH.KnownHosts) == "" {
+				errorf(at("ssh", "known_hosts"), "known_hosts is required; host keys are always checked")
+			} else if _, _, err := secrets.Parse(svc.SSH.KnownHosts); err != nil {
+				errorf(at("ssh", "known_hosts"), "%v", err)
+			}
+		}
+		for _, k := range slices.Sorted(maps.Keys(svc.Secrets)) {
+			if strings.TrimSpace(svc.Secrets[k]) == "" {
+				errorf(at("secrets", k), "secret name is required")
+			}
+			if _, ok := svc.Environment[k]; ok {
+				errorf(at("secrets", k), "%s is set in both environment and secrets", k)
+			}
+		}
+		for _, k := range slices.Sorted(maps.Keys(svc.Environment)) {
+			if _, _, err := secrets.Parse(svc.Environment[k]); err != nil {
+				errorf(at("environment", k), "%v", err)
+			}
+			for _, ref := range template.Refs(svc.Environment[k]) {
+				rest, ok := strings.CutPrefix(ref, "services.")
+				if !ok {
+					continue
+				}
+				other, fact, _ := strings.Cut(rest, ".")
+				dep, ok := md.Services[other]
+				switch {
+				case !ok:
+					errorf(at("environment", k), "${%s}: service %q does not exist", ref, other)
+				case dep.Role != nil && *dep.Role == models.ServiceRoleRunner:
+					errorf(at("environment", k), "${%s}: %q is a runner step; use ${steps.%s.outputs.<key>}", ref, other, other)
+				case fact == "":
+					errorf(at("environment", k), "invalid service reference ${%s} (want ${services.<name>.<fact>})", ref)
+				case fact != "address" && (svc.DependsOn == nil || !slices.Contains(*svc.DependsOn, other)):
+					warnf(at("environment", k), "${%s} is only known once %q is set up; add it to depends_on", ref, other)
+				}
+			}
+		}
+		for i, entry := range svc.Devices {
+			if _, err := device.Parse(entry); err != nil {
+				errorf(at("devices", i), "%v", err)
+			}
+		}
+		for i, entry := range svc.SecurityOpt {
+			if _, err := secopt.Parse(entry); err != nil {
+				errorf(at("security_opt", i), "%v", err)
+			}
+		}
+		if svc.StopSignal != nil {
+			if _, err := signal.ParseSignal(*svc.StopSignal); err != nil {
+				errorf(at("stop_signal"), "unknown stop_signal %q", *svc.StopSignal)
+			}
+		}
+		if svc.WorkingDir != nil && !strings.HasPrefix(*svc.WorkingDir, "/") {
+			errorf(at("working_dir"), "working_dir %q must be absolute", *svc.WorkingDir)
+		}
+		if svc.Healthcheck != nil {
+			checkHealthcheck(svc.Healthcheck, errorf, "metadata", "services", name, "healthcheck")
+		}
+		if svc.Limits != nil {
+			checkLimits(svc, errorf, at)
+		}
+		if svc.MemorySwap != nil {
+			switch mem := svc.MemoryLimit(); {
+			case mem == nil:
+				errorf(at("memory_swap"), "memory_swap needs memory")
+			case *svc.MemorySwap < *mem:
+				errorf(at("memory_swap"), "memory_swap %s is less than memory %s", *svc.MemorySwap, *mem)
+			}
+		}
+		if svc.MemorySwappiness != nil && (*svc.MemorySwappiness < 0 || *svc.MemorySwappiness > 100) {
+			errorf(at("memory_swappiness"), "memory_swappiness %d is out of range 0-100", *svc.MemorySwappiness)
+		}
+		if svc.OomScoreAdj != nil && (*svc.OomScoreAdj < -1000 || *svc.OomScoreAdj > 1000) {
+			errorf(at("oom_score_adj"), "oom_score_adj %d is out of range -1000-1000", *svc.OomScoreAdj)
+		}
+		if svc.OomKillDisable != nil && *svc.OomKillDisable && svc.MemoryLimit() == nil {
+			errorf(at("oom_kill_disable"), "oom_kill_disable needs memory, or the host can run out of memory")
+		}
+		if svc.ShmSize != nil && *svc.ShmSize <= 0 {
+			errorf(at("shm_size"), "shm_size must be positive")
+		}
+		for i, s := range svc.DNS {
+			if _, err := netip.ParseAddr(s); err != nil {
+				errorf(at("dns", i), "invalid nameserver %q", s)
+			}
+		}
+		for i, s := range svc.DNSSearch {
+			if s == "" || strings.ContainsAny(s, " \t") {
+				errorf(at("dns_search", i), "invalid search domain %q", s)
+			}
+		}
+		for i, s := range svc.DNSOptions {
+			if s == "" || strings.ContainsAny(s, " \t") {
+				errorf(at("dns_options", i), "invalid resolver option %q", s)
+			}
+		}
+		for i, target := range svc.PinHosts {
+			switch t, ok := md.Services[target]; {
+			case !ok:
+				errorf(at("pin_hosts", i), "service %q does not exist", target)
+			case target == name:
+				errorf(at("pin_hosts", i), "service pins its own host")
+			case t.Role != nil && *t.Role == models.ServiceRoleRunner:
+				errorf(at("pin_hosts", i), "service %q is a runner step and has no lasting address", target)
+			case svc.DependsOn == nil || !slices.Contains(*svc.DependsOn, target):
+				errorf(at("pin_hosts", i), "service %q must be in depends_on so its address is known first", target)
+			}
+		}
+		if svc.PrimaryNetwork != nil && (svc.NetworkGroups == nil || !slices.Contains(*svc.NetworkGroups, *svc.PrimaryNetwork)) {
+			errorf(at("primary_network"), "primary_network %q is not one of the service's network_groups", *svc.PrimaryNetwork)
+		}
+		if svc.Ipc != nil {
+			checkIpc(md.Services, name, svc, errorf, at)
+		}
+		if svc.Pid != nil {
+			checkPid(md.Services, name, svc, errorf, at)
+		}
+		if svc.UsernsMode != nil && *svc.UsernsMode != "host" {
+			errorf(at("userns_mode"), "unknown userns_mode %q (valid: host)", *svc.UsernsMode)
+		}
+		for i, d := range svc.DeviceRequests {
+			switch {
+			case d.Driver == "" && len(d.Capabilities) == 0:
+				errorf(at("device_requests", i), "set driver or capabilities so the platform can pick a device driver")
+			case d.Count != 0 && len(d.DeviceIDs) > 0:
+				errorf(at("device_requests", i), "set count or device_ids, not both")
+			case d.Count == 0 && len(d.DeviceIDs) == 0:
+				errorf(at("device_requests", i, "count"), "set count (-1 for every device) or device_ids")
+			case d.Count < -1:
+				errorf(at("device_requests", i, "count"), "count %d is invalid (-1 means every device)", d.Count)
+			}
+		}
+		if svc.CpusetCpus != nil {
+			if _, err := cpuset.Parse(*svc.CpusetCpus); err != nil {
+				errorf(at("cpuset_cpus"), "%v", err)
+			}
+		}
+		if svc.CpusetMems != nil {
+			if _, err := cpuset.Parse(*svc.CpusetMems); err != nil {
+				errorf(at("cpuset_mems"), "%v", err)
+			}
+		}
+
+		if svc.DependsOn != nil {
+			for i, dep := range *svc.DependsOn {
+				if _, ok := md.Services[dep]; !ok {
+					errorf(at("depends_on", i), "service %q does not exist", dep)
+				}
+				if dep == name {
+					errorf(at("depends_on", i), "service depends on itself")
+				}
+			}
+		}
+
+		if svc.Volumes != nil {
+			seen := map[string]struct{}{}
+			for i, m := range *svc.Volumes {
+				mountPath := strings.TrimSpace(m.MountPath)
+				switch {
+				case mountPath == "":
+					errorf(at("volumes", i, "mount_path"), "mount_path is empty")
+				case !strings.HasPrefix(mountPath, "/"):
+					errorf(at("volumes", i, "mount_path"), "mount_path %q must be absolute", mountPath)
+				case hasKey(seen, mountPath):
+					errorf(at("volumes", i, "mount_path"), "duplicate mount_path %q", mountPath)
+				}
+				seen[mountPath] = struct{}{}
+
+				if m.Name == nil {
+					continue
+				}
+				vol := strings.TrimSpace(*m.Name)
+				if vol == "" {
+					errorf(at("volumes", i, "name"), "volume name is empty")
+				} else if !hasKey(declared, vol) {
+					warnf(at("volumes", i, "name"), "volume %q is not in metadata.volumes; it must already exist on the platform", vol)
+				}
+			}
+		}
+
+		if len(svc.Caches) > 0 && (svc.Role == nil || *svc.Role != models.ServiceRoleRunner) {
+			warnf(at("caches"), "caches only apply to runner steps; they are ignored")
+		}
+		for i, c := range svc.Caches {
+			if strings.TrimSpace(c.Key) == "" {
+				errorf(at("caches", i, "key"), "cache key is required")
+			}
+			mountPath := strings.TrimSpace(c.MountPath)
+			switch {
+			case mountPath == "":
+				errorf(at("caches", i, "mount_path"), "mount_path is empty")
+			case !strings.HasPrefix(mountPath, "/"):
+				errorf(at("caches", i, "mount_path"), "mount_path %q must be absolute", mountPath)
+			case mountPath == platforms.RunnerVolumeMountPath:
+				errorf(at("caches", i, "mount_path"), "mount_path %q is the runner volume", mountPath)
+			case svc.Volumes != nil && slices.ContainsFunc(*svc.Volumes, func(m models.VolumeMount) bool { return strings.TrimSpace(m.MountPath) == mountPath }):
+				errorf(at("caches", i, "mount_path"), "mount_path %q is also a volume's", mountPath)
+			case slices.ContainsFunc(svc.Caches[:i], func(o models.CacheMount) bool { return strings.TrimSpace(o.MountPath) == mountPath }):
+				errorf(at("caches", i, "mount_path"), "duplicate mount_path %q", mountPath)
+			}
+		}
+
+		for i, f := range svc.Files {
+			p := strings.TrimSpace(f.Path)
+			switch {
+			case p == "":
+				errorf(at("files", i, "path"), "path is empty")
+			case !strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/"):
+				errorf(at("files", i, "path"), "path %q must be an absolute file path", p)
+			case slices.ContainsFunc(svc.Files[:i], func(o models.FileMount) bool { return strings.TrimSpace(o.Path) == p }):
+				errorf(at("files", i, "path"), "duplicate path %q", p)
+			}
+			if data, err := f.Data(); err != nil {
+				errorf(at("files", i), "%v", err)
+			} else if len(data) > models.MaxFileSize {
+				errorf(at("files", i), "file %q is %d bytes; files are for small configs (at most %d)", p, len(data), models.MaxFileSize)
+			}
+			if _, err := f.FileMode(); err != nil {
+				errorf(at("files", i, "mode"), "%v", err)
+			}
+			if strings.HasPrefix(f.Content, secrets.Scheme) {
+				warnf(at("files", i, "content"), "file content is not resolved as a secret reference; it is written as is")
+			}
+		}
+
+		if svc.Bindings != nil {
+			for i, b := range *svc.Bindings {
+				if b.ContainerPort != nil && (*b.ContainerPort < 1 || *b.ContainerPort > 65535) {
+					errorf(at("bindings", i, "container_port"), "port %d out of range 1-65535", *b.ContainerPort)
+				}
+				if b.HostPort != nil && (*b.HostPort < 1 || *b.HostPort > 65535) {
+					errorf(at("bindings", i, "host_port"), "port %d out of range 1-65535", *b.HostPort)
+				}
+				if b.HostPort != nil && b.ContainerPort == nil {
+					warnf(at("bindings", i), "host_port without container_port is ignored")
+				}
+				if b.HostIP != nil {
+					if _, err := netip.ParseAddr(*b.HostIP); err != nil {
+						errorf(at("bindings", i, "host_ip"), "invalid host_ip %q", *b.HostIP)
+					}
+				}
+			}
+		}
+
+		if svc.Resources != nil {
+			for i, spec := range *svc.Resources {
+				for j, port := range spec.Ports {
+					if port < 1 || port > 65535 {
+						errorf(at("resources", i, "ports", j), "port %d out of range 1-65535", port)
+					}
+				}
+			}
+		}
+
+		if l := svc.LogLimit; l != nil {
+			if l.LinesPerSecond <= 0 {
+				errorf(at("log_limit", "lines_per_second"), "lines_per_second must be positive")
+			}
+			if l.Burst < 0 {
+				errorf(at("log_limit", "burst"), "burst must not be negative")
+			}
+		}
+
+		if svc.ProgressDeadline != nil && *svc.ProgressDeadline <= 0 {
+			errorf(at("progress_deadline"), "progress_deadline must be positive")
+		}
+		if svc.OnFailure != nil && !slices.Contains(failurePolicies, *svc.OnFailure) {
+			errorf(at("on_failure"), "unknown on_failure %q (valid: %v)", *svc.OnFailure, failurePolicies)
+		}
+		if svc.Strategy != nil {
+			switch {
+			case !slices.Contains(strategies, *svc.Strategy):
+				errorf(at("strategy"), "unknown strategy %q (valid: %v)", *svc.Strategy, strategies)
+			case svc.Role != nil && *svc.Role == models.ServiceRoleRunner:
+				warnf(at("strategy"), "runner steps run to completion; strategy is ignored")
+			case *svc.Strategy == models.StrategyBlueGreen:
+				if err := platforms.BlueGreenConflict(&svc); err != nil {
+					errorf(at("strategy"), "blue-green: %v", err)
+				}
+			}
+		}
+
+		if svc.Scale != nil && !slices.Contains(scaleModes, models.ScaleMode(svc.Scale.Mode)) {
+			errorf(at("scale", "mode"), "unknown scale mode %q (valid: %v)", svc.Scale.Mode, scaleModes)
+		}
+	}
+
+	// Cycles are only meaningful once every dependency exists.
+	if !HasErrors(out) {
+		if _, err := plan.ServiceOrder(md.Services); err != nil {
+			errorf(Pointer("metadata", "services"), "%v", err)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Pointer < out[j].Pointer })
+	return out
+}
+
+// checkLabels rejects empty keys and keys the runner reserves for its own labels.
+func checkLabels(labels map[string]string, errorf func(ptr string, format string, args ...any), at ...any) {
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		switch {
+		case strings.TrimSpace(k) == "":
+			errorf(Pointer(at...), "label key is empty")
+		case strings.HasPrefix(k, models.ReservedLabelPrefix):
+			errorf(Pointer(append(at, k)...), "label %q uses the reserved prefix %q", k, models.ReservedLabelPrefix)
+		}
+	}
+}
+
+// checkLimits checks the limits block against itself and the older memory field.
+func checkLimits(svc models.MetadataService, errorf func(ptr string, format string, args ...any), at func(tokens ...any) string) {
+	l := svc.Limits
+	if l.Memory != nil && svc.Memory != nil {
+		errorf(at("memory"), "memory is also set in limits.memory (use one or the other)")
+	}
+	if l.Cpus != nil && *l.Cpus <= 0 {
+		errorf(at("limits", "cpus"), "cpus must be positive")
+	}
+	if l.Memory != nil && *l.Memory <= 0 {
+		errorf(at("limits", "memory"), "memory must be positive")
+	}
+	if l.MemoryReservation != nil {
+		switch mem := svc.MemoryLimit(); {
+		case *l.MemoryReservation <= 0:
+			errorf(at("limits", "memory_reservation"), "memory_reservation must be positive")
+		case mem != nil && *l.MemoryReservation > *mem:
+			errorf(at("limits", "memory_reservation"), "memory_reservation %s is more than memory %s", *l.MemoryReservation, *mem)
+		}
+	}
+	if l.PidsLimit != nil && *l.PidsLimit <= 0 {
+		errorf(at("limits", "pids_limit"), "pids_limit must be positive")
+	}
+}
+
+// checkIpc checks the ipc mode; joining another service's namespace needs that
+// service to allow it and to start first.
+func checkIpc(services map[string]models.MetadataService, name string, svc models.MetadataService, errorf func(ptr string, format string, args ...any), at func(tokens ...any) string) {
+	mode := *svc.Ipc
+	if target, ok := strings.CutPrefix(mode, models.ServiceNamespacePrefix); ok {
+		other, exists := services[target]
+		switch {
+		case target == name:
+			errorf(at("ipc"), "ipc cannot join the service's own namespace")
+		case !exists:
+			errorf(at("ipc"), "ipc service %q does not exist", target)
+		case other.Ipc == nil || *other.Ipc != "shareable":
+			errorf(at("ipc"), "ipc service %q must set ipc to shareable", target)
+		case svc.DependsOn == nil || !slices.Contains(*svc.DependsOn, target):
+			errorf(at("ipc"), "ipc service %q must be in depends_on so it starts first", target)
+		}
+	} else if !slices.Contains([]string{"private", "shareable", "host", "none"}, mode) {
+		errorf(at("ipc"), "unknown ipc %q (valid: private, shareable, host, none, service:<name>)", mode)
+		return
+	}
+	if svc.ShmSize != nil && mode != "private" && mode != "shareable" {
+		errorf(at("shm_size"), "shm_size only applies with ipc private or shareable, not %q", mode)
+	}
+}
+
+// checkPid checks the pid mode; a service:<name> target must start first.
+func checkPid(services map[string]models.MetadataService, name string, svc models.MetadataService, errorf func(ptr string, format string, args ...any), at func(tokens ...any) string) {
+	target, ok := strings.CutPrefix(*svc.Pid, models.ServiceNamespacePrefix)
+	if !ok {
+		if *svc.Pid != "host" {
+			errorf(at("pid"), "unknown pid %q (valid: host, service:<name>)", *svc.Pid)
+		}
+		return
+	}
+	_, exists := services[target]
+	switch {
+	case target == name:
+		errorf(at("pid"), "pid cannot join the service's own namespace")
+	case !exists:
+		errorf(at("pid"), "pid service %q does not exist", target)
+	case svc.DependsOn == nil || !slices.Contains(*svc.DependsOn, target):
+		errorf(at("pid"), "pid service %q must be in depends_on so it starts first", target)
+	}
+}
+
+// checkHealthcheck checks the test form Docker expects and that the timings make sense.
+func checkHealthcheck(hc *models.Healthcheck, errorf func(ptr string, format string, args ...any), at ...any) {
+	ptr := func(tokens ...any) string { return Pointer(append(slices.Clone(at), tokens...)...) }
+	switch {
+	case len(hc.Test) == 0:
+		errorf(ptr("test"), "test is required")
+	case hc.Test[0] == "NONE":
+	case hc.Test[0] != "CMD" && hc.Test[0] != "CMD-SHELL":
+		errorf(ptr("test", 0), "test must start with CMD, CMD-SHELL or NONE, got %q", hc.Test[0])
+	case len(hc.Test) == 1:
+		errorf(ptr("test"), "test %s has no command", hc.Test[0])
+	}
+	for key, d := range map[string]*models.Duration{"interval": hc.Interval, "timeout": hc.Timeout, "start_period": hc.StartPeriod} {
+		if d != nil && *d < 0 {
+			errorf(ptr(key), "%s %s is negative", key, time.Duration(*d))
+		}
+	}
+	if hc.Retries != nil && *hc.Retries < 0 {
+		errorf(ptr("retries"), "retries %d is negative", *hc.Retries)
+	}
+}
+
+// validHostname reports whether s is a host name of at most max characters: dot
+// separated labels of letters, digits and inner hyphens (RFC 1123).
+func validHostname(s string, max int) bool {
+	if s == "" || len(s) > max {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func hasKey(m map[string]struct{}, k string) bool {
+	_, ok := m[k]
+	return ok
+}
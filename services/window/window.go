@@ -0,0 +1,165 @@
+package window
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// Deferred is the error of a run outside its deploy windows.
+type Deferred struct {
+	Next time.Time // when the run may start
+}
+
+func (e *Deferred) Error() string {
+	return fmt.Sprintf("outside the deploy windows; the next one opens at %s", e.Next.Format(time.RFC3339))
+}
+
+// How often Check moves to the next opening of one set of windows to find a time
+// that is inside all of them, before giving up on sets that never overlap.
+const maxRounds = 64
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+type window struct {
+	days         [7]bool
+	hour, minute int
+	length       time.Duration
+	loc          *time.Location
+}
+
+// Validate checks a window's days, times and timezone.
+func Validate(w models.DeployWindow) error {
+	_, err := parse(w)
+	return err
+}
+
+// Check returns nil if now is inside every non-empty set of windows (say, the
+// job's and the runner's), or a *Deferred with the first time that is.
+func Check(now time.Time, sets ...[]models.DeployWindow) error {
+	var parsed [][]window
+	for _, set := range sets {
+		if len(set) == 0 {
+			continue
+		}
+		ws := make([]window, len(set))
+		for i, w := range set {
+			var err error
+			if ws[i], err = parse(w); err != nil {
+				return err
+			}
+		}
+		parsed = append(parsed, ws)
+	}
+
+	t := now
+	for range maxRounds {
+		moved := false
+		for _, ws := range parsed {
+			if next := earliest(ws, t); next.After(t) {
+				t, moved = next, true
+			}
+		}
+		if !moved {
+			if t.Equal(now) {
+				return nil
+			}
+			return &Deferred{Next: t.UTC()}
+		}
+	}
+	return fmt.Errorf("the runner's and the job's deploy windows never overlap")
+}
+
+// earliest returns t if it is inside one of ws, or when the first of them opens.
+func earliest(ws []window, t time.Time) time.Time {
+	var best time.Time
+	for _, w := range ws {
+		if next := w.next(t); best.IsZero() || next.Before(best) {
+			best = next
+		}
+	}
+	return best
+}
+
+// next returns t if it is inside the window, or when the window next opens.
+func (w window) next(t time.Time) time.Time {
+	y, m, d := t.In(w.loc).Date()
+	var best time.Time
+	// Start the day before, whose window may run past midnight into today.
+	for i := -1; i <= 7; i++ {
+		open := time.Date(y, m, d+i, w.hour, w.minute, 0, 0, w.loc)
+		if !w.days[open.Weekday()] {
+			continue
+		}
+		if !t.Before(open) && t.Before(open.Add(w.length)) {
+			return t
+		}
+		if open.After(t) && (best.IsZero() || open.Before(best)) {
+			best = open
+		}
+	}
+	return best
+}
+
+func parse(w models.DeployWindow) (window, error) {
+	var out window
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return out, fmt.Errorf("unknown timezone %q", w.Timezone)
+	}
+	out.loc = loc
+
+	start, err := clock(w.Start)
+	if err != nil {
+		return out, err
+	}
+	end, err := clock(w.End)
+	if err != nil {
+		return out, err
+	}
+	out.hour, out.minute = int(start/time.Hour), int(start%time.Hour/time.Minute)
+	if out.length = end - start; out.length <= 0 {
+		out.length += 24 * time.Hour
+	}
+
+	if len(w.Days) == 0 {
+		out.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	for _, d := range w.Days {
+		first, last, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(d)), "-")
+		if !isRange {
+			last = first
+		}
+		from, to := dayIndex(first), dayIndex(last)
+		if from < 0 || to < 0 {
+			return out, fmt.Errorf("unknown day %q (valid: %s, or a range like mon-fri)", d, strings.Join(weekdays, ", "))
+		}
+		for i := from; ; i = (i + 1) % 7 {
+			out.days[i] = true
+			if i == to {
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// clock parses "HH:MM" as the time since midnight.
+func clock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func dayIndex(name string) int {
+	for i, d := range weekdays {
+		if name == d {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/interfaces"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/runerr"
+	"github.com/ezenkico/deploy-commander/runner/services/snapshot"
+)
+
+// snapshotJob runs action "snapshot": it writes the job's resolved metadata, with
+// images pinned to what is running, and an archive of each mounted volume into
+// the bundle. Anything that could not be captured exactly is a warning.
+func snapshotJob(ctx context.Context, p interfaces.Platform, cfg models.Configuration) (models.RunResult, error) {
+	var result models.RunResult
+	snap, ok := p.(interfaces.Snapshotter)
+	if !ok {
+		return result, fmt.Errorf("platform %q does not support snapshot", cfg.Platform)
+	}
+	if cfg.Metadata == nil {
+		return result, errors.New("metadata is required for action snapshot")
+	}
+	ctx = runerr.WithRun(ctx, cfg.Job, cfg.Run)
+	dir := cfg.Bundle
+	if dir == "" {
+		dir = snapshot.DefaultDir(cfg)
+	}
+
+	md := *cfg.Metadata
+	md.Services = maps.Clone(md.Services)
+	digests, err := snap.ImageDigests(ctx, cfg.Job, &md)
+	if err != nil {
+		return result, err
+	}
+	images := snapshot.Pin(&md, digests)
+	for _, name := range slices.Sorted(maps.Keys(md.Services)) {
+		if _, ok := digests[name]; !ok {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("service %q: no digest to pin (not running, or built locally); keeping %s", name, md.Services[name].Image))
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "volumes"), 0o755); err != nil {
+		return result, fmt.Errorf("create snapshot bundle: %w", err)
+	}
+	mounted := snapshot.MountedVolumes(&md)
+	var volumes []models.SnapshotVolume
+	if md.Volumes != nil {
+		for _, v := range *md.Volumes {
+			if !slices.Contains(mounted, v) {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("volume %q is not mounted by any service; not captured", v))
+				continue
+			}
+			file := snapshot.VolumeFile(len(volumes))
+			if err := snap.ExportVolume(ctx, cfg.Job, &md, v, filepath.Join(dir, file)); err != nil {
+				return result, err
+			}
+			fi, err := os.Stat(filepath.Join(dir, file))
+			if err != nil {
+				return result, fmt.Errorf("snapshot volume %q: %w", v, err)
+			}
+			volumes = append(volumes, models.SnapshotVolume{Name: v, File: file, Size: fi.Size()})
+		}
+	}
+
+	err = snapshot.WriteManifest(dir, models.SnapshotManifest{
+		Job:      cfg.Job,
+		Run:      cfg.Run,
+		Platform: cfg.Platform,
+		Created:  time.Now().UTC(),
+		Metadata: md,
+		Images:   images,
+		Volumes:  volumes,
+	})
+	if err != nil {
+		return result, err
+	}
+	log.Printf("snapshot of job %s written to %s (%d image(s) pinned, %d volume(s))", cfg.Job, dir, len(digests), len(volumes))
+	return result, nil
+}
+
+// loadSnapshot fills in the metadata of action "clone" from its bundle. It runs
+// before resolveMetadata so overrides still apply to the clone.
+func loadSnapshot(cfg *models.Configuration) (models.SnapshotManifest, error) {
+	if cfg.Bundle == "" {
+		return models.SnapshotManifest{}, errors.New("bundle is required for action clone")
+	}
+	if cfg.Metadata != nil || cfg.MetadataRef != nil || cfg.Compose != nil {
+		return models.SnapshotManifest{}, errors.New("action clone takes its metadata from the bundle; remove metadata, metadata_ref and compose")
+	}
+	m, err := snapshot.ReadManifest(cfg.Bundle)
+	if err != nil {
+		return m, err
+	}
+	if m.Job == cfg.Job {
+		return m, fmt.Errorf("the bundle is a snapshot of job %s; clone it under a new job", m.Job)
+	}
+	md := m.Metadata
+	cfg.Metadata = &md
+	log.Printf("cloning job %s from snapshot %s (taken %s)", m.Job, m.Run, m.Created.Format(time.RFC3339))
+	return m, nil
+}
+
+// restoreVolumes unpacks the bundle's volume archives into the clone's volumes
+// before its services start.
+func restoreVolumes(ctx context.Context, p interfaces.Platform, cfg models.Configuration, m models.SnapshotManifest) error {
+	if len(m.Volumes) == 0 {
+		return nil
+	}
+	snap, ok := p.(interfaces.Snapshotter)
+	if !ok {
+		return fmt.Errorf("platform %q cannot restore snapshot volumes", cfg.Platform)
+	}
+	ctx = runerr.WithRun(ctx, cfg.Job, cfg.Run)
+	for _, v := range m.Volumes {
+		if err := snap.ImportVolume(ctx, cfg.Job, cfg.Run, cfg.Metadata, v.Name, filepath.Join(cfg.Bundle, v.File)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ezenkico/deploy-commander/runner/models"
+)
+
+// checkStepRuntimes makes runner steps, which run whatever a job's pipeline
+// checks out, use a sandboxed runtime. RUNNER_STEP_RUNTIMES lists the runtimes
+// steps may run under, e.g. runsc,kata-runtime; unset, any runtime will do. Like
+// privileged, the setting is the runner's since it protects the runner's host.
+func checkStepRuntimes(cfg models.Configuration) error {
+	if cfg.Metadata == nil {
+		return nil
+	}
+	var allowed []string
+	for _, r := range strings.Split(os.Getenv("RUNNER_STEP_RUNTIMES"), ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			allowed = append(allowed, r)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Metadata.Services)) {
+		service := cfg.Metadata.Services[name]
+		if service.Role == nil || *service.Role != models.ServiceRoleRunner {
+			continue
+		}
+		runtime := "default"
+		if service.Runtime != nil {
+			runtime = *service.Runtime
+		}
+		if !slices.Contains(allowed, runtime) {
+			return fmt.Errorf("runner step %q runs under runtime %q; the runner requires one of %s (RUNNER_STEP_RUNTIMES)", name, runtime, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
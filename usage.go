@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ezenkico/deploy-commander/runner/interfaces"
+	"github.com/ezenkico/deploy-commander/runner/models"
+	"github.com/ezenkico/deploy-commander/runner/services/agent"
+	"github.com/ezenkico/deploy-commander/runner/services/state"
+)
+
+// recordUsage samples the job's usage before a run replaces or removes its
+// containers, so their runtime is counted up to now. Accounting never fails a
+// run, so errors are only logged.
+func recordUsage(ctx context.Context, p interfaces.Platform, comm *agent.AgentCommunication, runs *state.Store, cfg models.Configuration) {
+	acct, ok := p.(interfaces.Accountant)
+	if !ok {
+		return
+	}
+	u, err := runs.LoadUsage(cfg.Job)
+	if err != nil {
+		log.Printf("record usage: %v", err)
+		return
+	}
+	u.Platform = cfg.Platform
+	u.PlatformData = cfg.PlatformData
+	if err := sampleUsage(ctx, acct, comm, runs, u); err != nil {
+		log.Printf("record usage: %v", err)
+	}
+}
+
+// sampleUsage adds a sample of the job to its usage, saves it and reports the
+// totals to the agent.
+func sampleUsage(ctx context.Context, acct interfaces.Accountant, comm *agent.AgentCommunication, runs *state.Store, u *state.Usage) error {
+	sample, err := acct.Usage(ctx, u.Job)
+	if err != nil {
+		return err
+	}
+	u.Add(sample, time.Now().UTC())
+	if err := runs.SaveUsage(u); err != nil {
+		return err
+	}
+	if comm == nil {
+		return nil
+	}
+	rctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	return comm.ReportUsage(rctx, u.JobUsage)
+}